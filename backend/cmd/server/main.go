@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"log"
+	"time"
 
 	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
@@ -14,10 +16,12 @@ import (
 
 	"google-keep-clone/internal/config"
 	"google-keep-clone/internal/handlers"
+	"google-keep-clone/internal/mail"
 	"google-keep-clone/internal/middleware"
 	"google-keep-clone/internal/models"
 	"google-keep-clone/internal/repositories"
 	"google-keep-clone/internal/services"
+	"google-keep-clone/internal/storage"
 	wsocket "google-keep-clone/internal/websocket"
 )
 
@@ -47,34 +51,126 @@ func main() {
 	// Auto-migrate database schemas
 	if err := db.AutoMigrate(
 		&models.User{},
+		&models.Session{},
+		&models.UserToken{},
+		&models.RecoveryCode{},
 		&models.Note{},
 		&models.Label{},
 		&models.Attachment{},
+		&models.ChecklistItem{},
+		&models.Reminder{},
+		&models.NoteRevision{},
+		&models.NoteCollaborator{},
+		&models.ImportJob{},
+		&models.SavedSearch{},
+		&models.SyncChange{},
+		&models.OutboxEvent{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.WebhookAttempt{},
 	); err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
+	if err := repositories.MigrateSearch(db); err != nil {
+		log.Fatal("Failed to set up full-text search:", err)
+	}
+	if err := repositories.MigrateSync(db); err != nil {
+		log.Fatal("Failed to set up change tracking:", err)
+	}
+	if err := repositories.MigrateImportJobs(db); err != nil {
+		log.Fatal("Failed to set up import jobs:", err)
+	}
+
+	// Initialize attachment storage
+	blobStore, err := initBlobStore(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize attachment storage:", err)
+	}
+
+	// Initialize email
+	mailer, err := initMailer(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize email:", err)
+	}
 
 	// Initialize WebSocket hub
-	hub := wsocket.NewHub()
+	broadcaster, err := initBroadcaster(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize realtime broadcasts:", err)
+	}
+	defer func() { _ = broadcaster.Close() }()
+
+	hub := wsocket.NewHub(broadcaster)
 	go hub.Run()
 
 	// Initialize repositories
 	userRepo := repositories.NewUserRepository(db)
+	sessionRepo := repositories.NewSessionRepository(db)
+	userTokenRepo := repositories.NewUserTokenRepository(db)
+	recoveryCodeRepo := repositories.NewRecoveryCodeRepository(db)
 	noteRepo := repositories.NewNoteRepository(db)
 	labelRepo := repositories.NewLabelRepository(db)
+	checklistRepo := repositories.NewChecklistRepository(db)
+	reminderRepo := repositories.NewReminderRepository(db)
+	revisionRepo := repositories.NewRevisionRepository(db)
+	collaboratorRepo := repositories.NewCollaboratorRepository(db)
+	attachmentRepo := repositories.NewAttachmentRepository(db)
+	importJobRepo := repositories.NewImportJobRepository(db)
+	savedSearchRepo := repositories.NewSavedSearchRepository(db)
+	syncRepo := repositories.NewSyncRepository(db)
+	outboxRepo := repositories.NewOutboxRepository(db)
+	webhookRepo := repositories.NewWebhookRepository(db)
+
+	// Initialize domain events
+	eventBus := services.NewEventBus(outboxRepo)
+	eventBus.Subscribe(services.NewHubSubscriber(hub))
+	eventBus.Subscribe(services.NewAuditLogSubscriber())
+	webhookService := services.NewWebhookService(webhookRepo, cfg.WebhookAllowedHosts)
+	eventBus.Subscribe(webhookService)
 
 	// Initialize services
-	authService := services.NewAuthService(userRepo, cfg)
-	noteService := services.NewNoteService(noteRepo, userRepo, hub)
-	labelService := services.NewLabelService(labelRepo, noteRepo, userRepo, hub)
+	authService := services.NewAuthService(userRepo, sessionRepo, userTokenRepo, recoveryCodeRepo, mailer, hub, cfg)
+	maxUploadSize := int64(cfg.MaxUploadSizeMB) << 20
+	thumbnailService := services.NewThumbnailService(attachmentRepo, noteRepo, blobStore, eventBus)
+	attachmentService := services.NewAttachmentService(attachmentRepo, noteRepo, blobStore, thumbnailService, maxUploadSize, int64(cfg.UserStorageQuota)<<20, eventBus)
+	noteService := services.NewNoteService(noteRepo, checklistRepo, revisionRepo, userRepo, attachmentService, cfg.SearchSimilarityThreshold, eventBus)
+	hub.SetDocumentStore(noteService)
+	labelService := services.NewLabelService(labelRepo, noteRepo, userRepo, eventBus)
+	viewService := services.NewViewService(savedSearchRepo, noteService, eventBus)
+	checklistService := services.NewChecklistService(checklistRepo, noteRepo, eventBus)
+	reminderService := services.NewReminderService(reminderRepo, noteRepo, eventBus)
+	collaboratorService := services.NewCollaboratorService(collaboratorRepo, noteRepo, userRepo, eventBus)
+	importService := services.NewImportService(importJobRepo, noteRepo, labelRepo, attachmentService, eventBus)
+	exportService := services.NewExportService(noteRepo, labelRepo, userRepo, attachmentService)
+	syncService := services.NewSyncService(syncRepo, noteRepo, labelRepo, noteService)
+
+	// Start background jobs
+	importService.FailInterruptedImports()
+	go eventBus.Run(5 * time.Second)
+	go reminderService.RunScheduler(30 * time.Second)
+	go noteService.RunTrashPurge(time.Hour, time.Duration(cfg.TrashRetentionDays)*24*time.Hour)
+	go thumbnailService.RunWorker(time.Minute)
+	go webhookService.RunWorker(10 * time.Second)
+	go authService.RunCleanup(24 * time.Hour)
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(authService)
 	noteHandler := handlers.NewNoteHandler(noteService)
 	labelHandler := handlers.NewLabelHandler(labelService)
+	viewHandler := handlers.NewViewHandler(viewService)
+	checklistHandler := handlers.NewChecklistHandler(checklistService)
+	reminderHandler := handlers.NewReminderHandler(reminderService)
+	collaboratorHandler := handlers.NewCollaboratorHandler(collaboratorService)
+	attachmentHandler := handlers.NewAttachmentHandler(attachmentService)
+	importHandler := handlers.NewImportHandler(importService)
+	exportHandler := handlers.NewExportHandler(exportService)
+	syncHandler := handlers.NewSyncHandler(syncService)
+	webhookHandler := handlers.NewWebhookHandler(webhookService)
 
 	// Initialize Fiber app
 	app := fiber.New(fiber.Config{
+		// Leave room for multipart overhead on top of the largest upload
+		BodyLimit: (max(cfg.MaxUploadSizeMB, cfg.MaxImportSizeMB) + 1) << 20,
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			code := fiber.StatusInternalServerError
 			if e, ok := err.(*fiber.Error); ok {
@@ -89,9 +185,10 @@ func main() {
 	// Middleware
 	app.Use(logger.New())
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowMethods: "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders: "Origin,Content-Type,Accept,Authorization",
+		AllowOrigins:  "*",
+		AllowMethods:  "GET,POST,PUT,PATCH,DELETE,OPTIONS",
+		AllowHeaders:  "Origin,Content-Type,Accept,Authorization,Range,If-Match",
+		ExposeHeaders: "Content-Range,Content-Disposition,Accept-Ranges,ETag",
 	}))
 
 	// Health check
@@ -106,14 +203,37 @@ func main() {
 	authRoutes := app.Group("/auth")
 	authRoutes.Post("/register", authHandler.Register)
 	authRoutes.Post("/login", authHandler.Login)
-	authRoutes.Post("/logout", authHandler.Logout)
+	authRoutes.Post("/refresh", authHandler.Refresh)
+	authRoutes.Post("/verify-email", authHandler.VerifyEmail)
+	authRoutes.Post("/forgot-password", authHandler.ForgotPassword)
+	authRoutes.Post("/reset-password", authHandler.ResetPassword)
+	authRoutes.Post("/2fa/verify", authHandler.VerifyTwoFactor)
 
 	// Protected auth routes
+	authRoutes.Post("/logout", middleware.AuthMiddleware(authService), authHandler.Logout)
+	authRoutes.Get("/sessions", middleware.AuthMiddleware(authService), authHandler.GetSessions)
+	authRoutes.Delete("/sessions/:id", middleware.AuthMiddleware(authService), authHandler.RevokeSession)
+	authRoutes.Post("/verify-email/resend", middleware.AuthMiddleware(authService), authHandler.ResendVerification)
+	authRoutes.Get("/2fa", middleware.AuthMiddleware(authService), authHandler.GetTwoFactorStatus)
+	authRoutes.Post("/2fa/setup", middleware.AuthMiddleware(authService), authHandler.SetupTwoFactor)
+	authRoutes.Post("/2fa/confirm", middleware.AuthMiddleware(authService), authHandler.ConfirmTwoFactor)
+	authRoutes.Post("/2fa/disable", middleware.AuthMiddleware(authService), authHandler.DisableTwoFactor)
+	authRoutes.Post("/2fa/recovery-codes", middleware.AuthMiddleware(authService), authHandler.RegenerateRecoveryCodes)
 	authRoutes.Get("/me", middleware.AuthMiddleware(authService), authHandler.GetCurrentUser)
+	authRoutes.Patch("/me", middleware.AuthMiddleware(authService), authHandler.UpdateCurrentUser)
 
 	// Notes routes (protected)
 	notes := app.Group("/notes", middleware.AuthMiddleware(authService))
 
+	// Special views (registered before /:id so they aren't captured by it)
+	notes.Get("/search", noteHandler.SearchNotes)
+	notes.Post("/search/advanced", noteHandler.SearchNotesAdvanced)
+	notes.Get("/pinned", noteHandler.GetPinnedNotes)
+	notes.Get("/archived", noteHandler.GetArchivedNotes)
+	notes.Get("/reminders", reminderHandler.GetUpcomingReminders)
+	notes.Get("/trash", noteHandler.GetTrashedNotes)
+	notes.Delete("/trash", noteHandler.EmptyTrash)
+
 	// CRUD operations
 	notes.Get("/", noteHandler.GetNotes)
 	notes.Post("/", noteHandler.CreateNote)
@@ -125,17 +245,52 @@ func main() {
 	notes.Patch("/:id/pin", noteHandler.TogglePin)
 	notes.Patch("/:id/archive", noteHandler.ToggleArchive)
 	notes.Patch("/:id/color", noteHandler.UpdateColor)
+	notes.Post("/:id/restore", noteHandler.RestoreNote)
 
-	// Special views
-	notes.Get("/search", noteHandler.SearchNotes)
-	notes.Post("/search/advanced", noteHandler.SearchNotesAdvanced)
-	notes.Get("/pinned", noteHandler.GetPinnedNotes)
-	notes.Get("/archived", noteHandler.GetArchivedNotes)
+	// Note revision history
+	notes.Get("/:id/revisions", noteHandler.GetRevisions)
+	notes.Get("/:id/revisions/:rev/diff", noteHandler.DiffRevision)
+	notes.Post("/:id/revisions/:rev/restore", noteHandler.RestoreRevision)
 
 	// Note label operations
 	notes.Post("/:note_id/labels", labelHandler.AttachLabelToNote)
 	notes.Delete("/:note_id/labels/:label_id", labelHandler.DetachLabelFromNote)
 
+	// Checklist item operations
+	notes.Post("/:id/items", checklistHandler.AddItem)
+	notes.Put("/:id/items/order", checklistHandler.ReorderItems)
+	notes.Patch("/:id/items/:item_id", checklistHandler.UpdateItem)
+	notes.Delete("/:id/items/:item_id", checklistHandler.DeleteItem)
+
+	// Note reminder operations
+	notes.Get("/:id/reminder", reminderHandler.GetReminder)
+	notes.Post("/:id/reminder", reminderHandler.CreateReminder)
+	notes.Put("/:id/reminder", reminderHandler.UpdateReminder)
+	notes.Delete("/:id/reminder", reminderHandler.DeleteReminder)
+
+	// Note sharing
+	notes.Get("/:id/collaborators", collaboratorHandler.GetCollaborators)
+	notes.Post("/:id/collaborators", collaboratorHandler.AddCollaborator)
+	notes.Delete("/:id/collaborators/:user_id", collaboratorHandler.RemoveCollaborator)
+
+	// Note attachments
+	notes.Post("/:id/attachments", attachmentHandler.UploadAttachment)
+
+	// Attachments routes (protected)
+	attachments := app.Group("/attachments", middleware.AuthMiddleware(authService))
+	attachments.Get("/:id", attachmentHandler.DownloadAttachment)
+	attachments.Get("/:id/thumbnails/:size", attachmentHandler.GetThumbnail)
+	attachments.Delete("/:id", attachmentHandler.DeleteAttachment)
+
+	// Import routes (protected)
+	imports := app.Group("/import", middleware.AuthMiddleware(authService))
+	imports.Post("/keep", importHandler.ImportKeep)
+	imports.Get("/jobs", importHandler.GetImportJobs)
+	imports.Get("/jobs/:id", importHandler.GetImportJob)
+
+	// Export routes (protected)
+	app.Get("/export", middleware.AuthMiddleware(authService), exportHandler.Export)
+
 	// Labels routes (protected)
 	labels := app.Group("/labels", middleware.AuthMiddleware(authService))
 
@@ -149,6 +304,33 @@ func main() {
 	// Label-specific views
 	labels.Get("/:id/notes", labelHandler.GetNotesByLabel)
 
+	// Sync routes (protected)
+	syncRoutes := app.Group("/sync", middleware.AuthMiddleware(authService))
+	syncRoutes.Get("/", syncHandler.GetChanges)
+	syncRoutes.Post("/push", syncHandler.Push)
+
+	// Saved search routes (protected)
+	views := app.Group("/views", middleware.AuthMiddleware(authService))
+	views.Get("/", viewHandler.GetViews)
+	views.Post("/", viewHandler.CreateView)
+	views.Get("/counts", viewHandler.GetViewCounts)
+	views.Get("/:id", viewHandler.GetViewByID)
+	views.Put("/:id", viewHandler.UpdateView)
+	views.Delete("/:id", viewHandler.DeleteView)
+	views.Get("/:id/notes", viewHandler.GetViewNotes)
+
+	// Webhook routes (protected)
+	webhooks := app.Group("/webhooks", middleware.AuthMiddleware(authService))
+	webhooks.Get("/", webhookHandler.GetWebhooks)
+	webhooks.Post("/", webhookHandler.CreateWebhook)
+	webhooks.Get("/:id", webhookHandler.GetWebhookByID)
+	webhooks.Put("/:id", webhookHandler.UpdateWebhook)
+	webhooks.Delete("/:id", webhookHandler.DeleteWebhook)
+	webhooks.Post("/:id/secret", webhookHandler.RotateSecret)
+	webhooks.Get("/:id/deliveries", webhookHandler.GetDeliveries)
+	webhooks.Get("/:id/deliveries/:delivery_id", webhookHandler.GetDelivery)
+	webhooks.Post("/:id/deliveries/:delivery_id/replay", webhookHandler.ReplayDelivery)
+
 	// API routes (for future extensions)
 	api := app.Group("/api", middleware.AuthMiddleware(authService))
 	api.Get("/", func(c *fiber.Ctx) error {
@@ -175,8 +357,8 @@ func main() {
 			return
 		}
 
-		// Validate token and get user ID
-		claims, err := authService.ValidateToken(token)
+		// Validate token and its session, and get user ID
+		claims, err := authService.Authenticate(token, c.IP())
 		if err != nil {
 			_ = c.Close()
 			return
@@ -187,9 +369,14 @@ func main() {
 			_ = c.Close()
 			return
 		}
+		sessionID, err := uuid.Parse(claims.SessionID)
+		if err != nil {
+			_ = c.Close()
+			return
+		}
 
-		// Handle WebSocket connection
-		hub.HandleWebSocket(c, userID)
+		// Handle WebSocket connection, replaying missed events if resuming
+		hub.HandleWebSocket(c, userID, sessionID, c.Query("resume_from"))
 	}))
 
 	// Start server
@@ -220,3 +407,77 @@ func initDatabase(databaseURL string) (*gorm.DB, error) {
 	log.Println("✅ Database connected successfully")
 	return db, nil
 }
+
+func initMailer(cfg *config.Config) (mail.Mailer, error) {
+	switch cfg.Mailer {
+	case "smtp":
+		mailer, err := mail.NewSMTPMailer(mail.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("✅ Sending email through SMTP at %s:%d", cfg.SMTPHost, cfg.SMTPPort)
+		return mailer, nil
+	default:
+		log.Printf("📧 Emails will be written to the log instead of sent")
+		return mail.NewLogMailer(), nil
+	}
+}
+
+func initBroadcaster(cfg *config.Config) (wsocket.Broadcaster, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	switch cfg.Broadcaster {
+	case "redis":
+		broadcaster, err := wsocket.NewRedisBroadcaster(ctx, cfg.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("✅ Using Redis for realtime broadcasts")
+		return broadcaster, nil
+	case "postgres":
+		broadcaster, err := wsocket.NewPostgresBroadcaster(ctx, cfg.DatabaseURL)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("✅ Using Postgres LISTEN/NOTIFY for realtime broadcasts")
+		return broadcaster, nil
+	default:
+		return wsocket.NewMemoryBroadcaster(), nil
+	}
+}
+
+func initBlobStore(cfg *config.Config) (storage.BlobStore, error) {
+	switch cfg.StorageBackend {
+	case "s3":
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		store, err := storage.NewS3Store(ctx, storage.S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			Region:    cfg.S3Region,
+			UseSSL:    cfg.S3UseSSL,
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("✅ Using S3 attachment storage at %s/%s", cfg.S3Endpoint, cfg.S3Bucket)
+		return store, nil
+	default:
+		store, err := storage.NewLocalStore(cfg.StorageLocalDir)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("✅ Using local attachment storage in %s", cfg.StorageLocalDir)
+		return store, nil
+	}
+}
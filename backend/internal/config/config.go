@@ -2,16 +2,49 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
 )
 
 type Config struct {
 	Port               string
 	DatabaseURL        string
 	RedisURL           string
+	Broadcaster        string // 'memory', 'redis' or 'postgres'; how realtime updates reach other replicas
 	JWTSecret          string
 	GoogleClientID     string
 	GoogleClientSecret string
 	Environment        string
+	TrashRetentionDays int
+
+	AccessTokenTTLMinutes int
+	RefreshTokenTTLDays   int    // refresh tokens last this long after their last use
+	TOTPIssuer            string // names the app in authenticator apps
+
+	AppURL       string // where the frontend is served, for links in emails
+	Mailer       string // 'log' or 'smtp'
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+
+	StorageBackend   string // 'local' or 's3'
+	StorageLocalDir  string
+	S3Endpoint       string
+	S3Bucket         string
+	S3AccessKey      string
+	S3SecretKey      string
+	S3Region         string
+	S3UseSSL         bool
+	MaxUploadSizeMB  int
+	UserStorageQuota int // in MB
+	MaxImportSizeMB  int
+
+	SearchSimilarityThreshold float64 // pg_trgm similarity for fuzzy search, 0 to 1
+
+	// Hosts webhooks may reach on loopback or private addresses
+	WebhookAllowedHosts []string
 }
 
 func Load() *Config {
@@ -19,10 +52,40 @@ func Load() *Config {
 		Port:               getEnv("PORT", "8080"),
 		DatabaseURL:        getEnv("DATABASE_URL", ""),
 		RedisURL:           getEnv("REDIS_URL", "redis://localhost:6379"),
+		Broadcaster:        getEnv("BROADCASTER", "memory"),
 		JWTSecret:          getEnv("JWT_SECRET", "your-secret-key"),
 		GoogleClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
 		GoogleClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
 		Environment:        getEnv("ENVIRONMENT", "development"),
+		TrashRetentionDays: getEnvInt("TRASH_RETENTION_DAYS", 7),
+
+		AccessTokenTTLMinutes: getEnvInt("ACCESS_TOKEN_TTL_MINUTES", 15),
+		RefreshTokenTTLDays:   getEnvInt("REFRESH_TOKEN_TTL_DAYS", 30),
+		TOTPIssuer:            getEnv("TOTP_ISSUER", "Keep"),
+
+		AppURL:       getEnv("APP_URL", "http://localhost:5173"),
+		Mailer:       getEnv("MAILER", "log"),
+		SMTPHost:     getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:     getEnvInt("SMTP_PORT", 1025),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		MailFrom:     getEnv("MAIL_FROM", "Keep <no-reply@localhost>"),
+
+		StorageBackend:   getEnv("STORAGE_BACKEND", "local"),
+		StorageLocalDir:  getEnv("STORAGE_LOCAL_DIR", "./uploads"),
+		S3Endpoint:       getEnv("S3_ENDPOINT", "localhost:9000"),
+		S3Bucket:         getEnv("S3_BUCKET", "keep-attachments"),
+		S3AccessKey:      getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:      getEnv("S3_SECRET_KEY", ""),
+		S3Region:         getEnv("S3_REGION", "us-east-1"),
+		S3UseSSL:         getEnv("S3_USE_SSL", "false") == "true",
+		MaxUploadSizeMB:  getEnvInt("MAX_UPLOAD_SIZE_MB", 25),
+		UserStorageQuota: getEnvInt("USER_STORAGE_QUOTA_MB", 1024),
+		MaxImportSizeMB:  getEnvInt("MAX_IMPORT_SIZE_MB", 512),
+
+		SearchSimilarityThreshold: getEnvFloat("SEARCH_SIMILARITY_THRESHOLD", 0.3),
+
+		WebhookAllowedHosts: getEnvList("WEBHOOK_ALLOWED_HOSTS"),
 	}
 }
 
@@ -32,3 +95,28 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvList splits a comma separated value, dropping empty entries
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,259 @@
+// Package crdt implements a replicated sequence of characters for live
+// collaborative editing, in the style of RGA. Every character has an ID
+// made of the site that typed it and a Lamport clock. An insert names the
+// character it follows, and concurrent inserts after the same character
+// are ordered by ID, so replicas that apply the same ops in any causal
+// order end up with the same text. Deleted characters are kept as
+// tombstones so later ops can still refer to them.
+package crdt
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// Op types
+const (
+	OpInsert = "insert"
+	OpDelete = "delete"
+)
+
+// MaxClockLead is how far ahead of the highest clock seen an insert's
+// clock may be. Clients count up from the clock they were given, so theirs
+// are never far ahead; one near the top of the range would leave no room
+// for later ops.
+const MaxClockLead = 1 << 20
+
+var (
+	ErrInvalidOp = errors.New("invalid op")
+	// The op refers to a character this replica has never seen
+	ErrUnknownElement = errors.New("unknown element")
+)
+
+// ID identifies a character
+type ID struct {
+	Site  string `json:"site"`
+	Clock uint64 `json:"clock"`
+}
+
+// Less orders IDs by clock, then by site
+func (id ID) Less(other ID) bool {
+	if id.Clock != other.Clock {
+		return id.Clock < other.Clock
+	}
+	return id.Site < other.Site
+}
+
+// Op inserts Value, a single character, after Origin (nil for the start of
+// the text), or deletes the character ID. Apply sets Index to the position
+// in the visible text the op took effect at.
+type Op struct {
+	Type   string `json:"type"`
+	ID     ID     `json:"id"`
+	Origin *ID    `json:"origin,omitempty"`
+	Value  string `json:"value,omitempty"`
+	Index  int    `json:"index"`
+}
+
+// Element is a character of the sequence, deleted or not
+type Element struct {
+	ID      ID     `json:"id"`
+	Value   string `json:"value"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+type Sequence struct {
+	elements []Element
+	index    map[ID]int // position of each element
+	visible  int
+	clock    uint64
+}
+
+// FromText starts a sequence holding text, one element per character,
+// typed by site
+func FromText(text, site string) *Sequence {
+	length := utf8.RuneCountInString(text)
+	s := &Sequence{
+		elements: make([]Element, 0, length),
+		index:    make(map[ID]int, length),
+	}
+	for _, r := range text {
+		s.clock++
+		id := ID{Site: site, Clock: s.clock}
+		s.index[id] = len(s.elements)
+		s.elements = append(s.elements, Element{ID: id, Value: string(r)})
+	}
+	s.visible = len(s.elements)
+	return s
+}
+
+// Text returns the visible text
+func (s *Sequence) Text() string {
+	var b strings.Builder
+	for _, e := range s.elements {
+		if !e.Deleted {
+			b.WriteString(e.Value)
+		}
+	}
+	return b.String()
+}
+
+// Len returns the number of visible characters
+func (s *Sequence) Len() int {
+	return s.visible
+}
+
+// Size returns the number of elements, tombstones included
+func (s *Sequence) Size() int {
+	return len(s.elements)
+}
+
+// Clock returns the highest clock seen. New ops must use a greater one.
+func (s *Sequence) Clock() uint64 {
+	return s.clock
+}
+
+// Elements returns a copy of every element, tombstones included, in order
+func (s *Sequence) Elements() []Element {
+	return append([]Element(nil), s.elements...)
+}
+
+// VisibleIDs returns the IDs of the visible characters, in order
+func (s *Sequence) VisibleIDs() []ID {
+	ids := make([]ID, 0, s.visible)
+	for _, e := range s.elements {
+		if !e.Deleted {
+			ids = append(ids, e.ID)
+		}
+	}
+	return ids
+}
+
+// Apply integrates an op. It reports false, without error, for an op that
+// was already applied.
+func (s *Sequence) Apply(op *Op) (bool, error) {
+	switch op.Type {
+	case OpInsert:
+		return s.insert(op)
+	case OpDelete:
+		return s.delete(op)
+	default:
+		return false, ErrInvalidOp
+	}
+}
+
+func (s *Sequence) insert(op *Op) (bool, error) {
+	if op.ID.Site == "" || op.ID.Clock == 0 || op.ID.Clock > s.clock+MaxClockLead || utf8.RuneCountInString(op.Value) != 1 {
+		return false, ErrInvalidOp
+	}
+	if s.find(op.ID) >= 0 {
+		return false, nil
+	}
+
+	pos := 0
+	if op.Origin != nil {
+		origin := s.find(*op.Origin)
+		if origin < 0 {
+			return false, ErrUnknownElement
+		}
+		// An insert is always typed after the character it follows
+		if !op.Origin.Less(op.ID) {
+			return false, ErrInvalidOp
+		}
+		pos = origin + 1
+	}
+
+	// Skip inserts made after the same origin by ops that win over this
+	// one. Everything typed after those has a greater clock still, so
+	// their whole runs are skipped too.
+	for pos < len(s.elements) && op.ID.Less(s.elements[pos].ID) {
+		pos++
+	}
+
+	s.elements = append(s.elements, Element{})
+	copy(s.elements[pos+1:], s.elements[pos:])
+	s.elements[pos] = Element{ID: op.ID, Value: op.Value}
+	for i := pos; i < len(s.elements); i++ {
+		s.index[s.elements[i].ID] = i
+	}
+	s.visible++
+	if op.ID.Clock > s.clock {
+		s.clock = op.ID.Clock
+	}
+
+	op.Index = s.indexOf(pos)
+	return true, nil
+}
+
+func (s *Sequence) delete(op *Op) (bool, error) {
+	pos := s.find(op.ID)
+	if pos < 0 {
+		return false, ErrUnknownElement
+	}
+	if s.elements[pos].Deleted {
+		return false, nil
+	}
+
+	s.elements[pos].Deleted = true
+	s.visible--
+
+	op.Index = s.indexOf(pos)
+	return true, nil
+}
+
+func (s *Sequence) find(id ID) int {
+	if pos, ok := s.index[id]; ok {
+		return pos
+	}
+	return -1
+}
+
+// indexOf returns the number of visible characters before pos
+func (s *Sequence) indexOf(pos int) int {
+	index := 0
+	for _, e := range s.elements[:pos] {
+		if !e.Deleted {
+			index++
+		}
+	}
+	return index
+}
+
+// Splice returns the ops that turn old into text, where ids are the IDs of
+// old's characters: the changed middle is deleted and its replacement
+// inserted after the last unchanged character, typed by site with clocks
+// after clock. It also returns the IDs of text's characters.
+func Splice(ids []ID, old, text []rune, site string, clock uint64) ([]Op, []ID) {
+	prefix := 0
+	for prefix < len(old) && prefix < len(text) && old[prefix] == text[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(old)-prefix && suffix < len(text)-prefix &&
+		old[len(old)-1-suffix] == text[len(text)-1-suffix] {
+		suffix++
+	}
+
+	var ops []Op
+	for _, id := range ids[prefix : len(old)-suffix] {
+		ops = append(ops, Op{Type: OpDelete, ID: id})
+	}
+
+	result := append([]ID(nil), ids[:prefix]...)
+	var origin *ID
+	if prefix > 0 {
+		last := ids[prefix-1]
+		origin = &last
+	}
+	for _, r := range text[prefix : len(text)-suffix] {
+		clock++
+		id := ID{Site: site, Clock: clock}
+		ops = append(ops, Op{Type: OpInsert, ID: id, Origin: origin, Value: string(r)})
+		result = append(result, id)
+		origin = &id
+	}
+	result = append(result, ids[len(old)-suffix:]...)
+
+	return ops, result
+}
@@ -0,0 +1,227 @@
+package crdt
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// insertAt makes the op for typing value at index of s's visible text, as
+// site, and applies it
+func insertAt(t *testing.T, s *Sequence, site string, index int, value string) Op {
+	t.Helper()
+	op := Op{Type: OpInsert, ID: ID{Site: site, Clock: s.Clock() + 1}, Value: value}
+	if index > 0 {
+		origin := s.VisibleIDs()[index-1]
+		op.Origin = &origin
+	}
+	if _, err := s.Apply(&op); err != nil {
+		t.Fatalf("inserting %q at %d: %v", value, index, err)
+	}
+	return op
+}
+
+func deleteAt(t *testing.T, s *Sequence, index int) Op {
+	t.Helper()
+	op := Op{Type: OpDelete, ID: s.VisibleIDs()[index]}
+	if _, err := s.Apply(&op); err != nil {
+		t.Fatalf("deleting at %d: %v", index, err)
+	}
+	return op
+}
+
+func applyAll(t *testing.T, s *Sequence, ops []Op) {
+	t.Helper()
+	for _, op := range ops {
+		if _, err := s.Apply(&op); err != nil {
+			t.Fatalf("applying %+v: %v", op, err)
+		}
+	}
+}
+
+func TestConcurrentInsertsAtSameOrigin(t *testing.T) {
+	a := FromText("ab", "base")
+	b := FromText("ab", "base")
+
+	// Both type after "a" without seeing the other's
+	x := insertAt(t, a, "site-a", 1, "X")
+	y := insertAt(t, b, "site-b", 1, "Y")
+	z := insertAt(t, b, "site-b", 2, "Z")
+
+	tests := []struct {
+		name  string
+		order []Op
+	}{
+		{"a first", []Op{x, y, z}},
+		{"b first", []Op{y, z, x}},
+		{"interleaved", []Op{y, x, z}},
+	}
+	var want string
+	for _, test := range tests {
+		s := FromText("ab", "base")
+		applyAll(t, s, test.order)
+		if want == "" {
+			want = s.Text()
+		}
+		if got := s.Text(); got != want {
+			t.Errorf("%s: text %q; want %q", test.name, got, want)
+		}
+	}
+	if want != "aYZXb" && want != "aXYZb" {
+		t.Errorf("text %q; want Y and Z kept together", want)
+	}
+
+	applyAll(t, a, []Op{y, z})
+	applyAll(t, b, []Op{x})
+	if a.Text() != want || b.Text() != want {
+		t.Errorf("replicas have %q and %q; want %q", a.Text(), b.Text(), want)
+	}
+}
+
+// TestConvergence has sites edit copies of a text independently, then
+// hands each the others' ops in a random order, keeping each site's own
+// in the order they were made
+func TestConvergence(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	sites := []string{"s1", "s2", "s3"}
+
+	for round := 0; round < 50; round++ {
+		replicas := make([]*Sequence, len(sites))
+		ops := make([][]Op, len(sites))
+		for i, site := range sites {
+			replicas[i] = FromText("hello world", "base")
+			for n := 0; n < 20; n++ {
+				s := replicas[i]
+				if s.Len() > 0 && rng.Intn(3) == 0 {
+					ops[i] = append(ops[i], deleteAt(t, s, rng.Intn(s.Len())))
+				} else {
+					ops[i] = append(ops[i], insertAt(t, s, site, rng.Intn(s.Len()+1), string(rune('a'+rng.Intn(26)))))
+				}
+			}
+		}
+
+		for i, s := range replicas {
+			next := make([]int, len(sites))
+			for {
+				var pending []int
+				for j := range sites {
+					if j != i && next[j] < len(ops[j]) {
+						pending = append(pending, j)
+					}
+				}
+				if len(pending) == 0 {
+					break
+				}
+				j := pending[rng.Intn(len(pending))]
+				op := ops[j][next[j]]
+				if _, err := s.Apply(&op); err != nil {
+					t.Fatalf("round %d: applying %+v: %v", round, op, err)
+				}
+				next[j]++
+			}
+		}
+
+		for i := 1; i < len(replicas); i++ {
+			if replicas[i].Text() != replicas[0].Text() {
+				t.Fatalf("round %d: replicas differ:\n%q\n%q", round, replicas[0].Text(), replicas[i].Text())
+			}
+			if !slices.Equal(replicas[i].Elements(), replicas[0].Elements()) {
+				t.Fatalf("round %d: replicas hold different elements", round)
+			}
+		}
+	}
+}
+
+func TestDeleteTombstone(t *testing.T) {
+	a := FromText("abc", "base")
+	b := FromText("abc", "base")
+
+	// Both delete "b" at once
+	first := deleteAt(t, a, 1)
+	second := deleteAt(t, b, 1)
+
+	if changed, err := a.Apply(&second); err != nil || changed {
+		t.Errorf("deleting a tombstone: changed %v, err %v; want neither", changed, err)
+	}
+	if changed, err := b.Apply(&first); err != nil || changed {
+		t.Errorf("deleting a tombstone: changed %v, err %v; want neither", changed, err)
+	}
+	if a.Text() != "ac" || b.Text() != "ac" || a.Len() != 2 || b.Len() != 2 {
+		t.Errorf("replicas have %q (%d) and %q (%d); want \"ac\" (2)", a.Text(), a.Len(), b.Text(), b.Len())
+	}
+
+	// An insert after the tombstone still finds its place
+	op := Op{Type: OpInsert, ID: ID{Site: "site-a", Clock: a.Clock() + 1}, Origin: &first.ID, Value: "X"}
+	if _, err := b.Apply(&op); err != nil {
+		t.Fatal(err)
+	}
+	if b.Text() != "aXc" || op.Index != 1 {
+		t.Errorf("text %q, index %d; want \"aXc\", 1", b.Text(), op.Index)
+	}
+}
+
+func TestSplice(t *testing.T) {
+	tests := []struct {
+		old, text string
+	}{
+		{"", ""},
+		{"", "new"},
+		{"hello", ""},
+		{"hello", "hello"},
+		{"hello", "help"},
+		{"hello world", "hello brave world"},
+		{"abc", "xbc"},
+		{"abc", "abx"},
+		{"aaa", "aa"},
+		{"héllo", "hallo wörld"},
+	}
+	for _, test := range tests {
+		s := FromText(test.old, "base")
+		ops, ids := Splice(s.VisibleIDs(), []rune(test.old), []rune(test.text), "server", s.Clock())
+
+		other := FromText(test.old, "base")
+		applyAll(t, s, ops)
+		if got := s.Text(); got != test.text {
+			t.Errorf("%q to %q: text %q", test.old, test.text, got)
+		}
+		if !slices.Equal(ids, s.VisibleIDs()) {
+			t.Errorf("%q to %q: ids %v; want %v", test.old, test.text, ids, s.VisibleIDs())
+		}
+
+		// The ops carry over to another replica
+		applyAll(t, other, ops)
+		if other.Text() != test.text {
+			t.Errorf("%q to %q: other replica has %q", test.old, test.text, other.Text())
+		}
+	}
+}
+
+func TestApplyRefusesClockFarAhead(t *testing.T) {
+	s := FromText("ab", "base")
+	origin := s.VisibleIDs()[1]
+
+	for _, clock := range []uint64{math.MaxUint64, s.Clock() + MaxClockLead + 1} {
+		op := Op{Type: OpInsert, ID: ID{Site: "site-a", Clock: clock}, Origin: &origin, Value: "X"}
+		if _, err := s.Apply(&op); !errors.Is(err, ErrInvalidOp) {
+			t.Errorf("clock %d: err %v; want ErrInvalidOp", clock, err)
+		}
+	}
+	if s.Clock() != 2 || s.Text() != "ab" {
+		t.Errorf("clock %d, text %q after refused ops; want 2, \"ab\"", s.Clock(), s.Text())
+	}
+
+	op := Op{Type: OpInsert, ID: ID{Site: "site-a", Clock: s.Clock() + MaxClockLead}, Origin: &origin, Value: "X"}
+	if _, err := s.Apply(&op); err != nil {
+		t.Errorf("clock at the limit: %v", err)
+	}
+}
+
+func TestApplyRefusesUnknownOrigin(t *testing.T) {
+	s := FromText("ab", "base")
+	op := Op{Type: OpInsert, ID: ID{Site: "site-a", Clock: 5}, Origin: &ID{Site: "elsewhere", Clock: 1}, Value: "X"}
+	if _, err := s.Apply(&op); !errors.Is(err, ErrUnknownElement) {
+		t.Errorf("err %v; want ErrUnknownElement", err)
+	}
+}
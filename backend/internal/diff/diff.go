@@ -0,0 +1,275 @@
+// Package diff produces line-level unified diffs using Myers' algorithm.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+type OpKind int
+
+const (
+	Equal OpKind = iota
+	Delete
+	Insert
+)
+
+type Op struct {
+	Kind OpKind
+	Line string
+}
+
+// Lines splits text into lines without their trailing newlines
+func Lines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// Longer inputs than this, counting the lines of both, are diffed as a
+// whole replacement rather than searched for a shortest edit script
+const maxLines = 40000
+
+// Compute returns the shortest edit script turning a into b. It uses the
+// linear-space variant of Myers' algorithm, which finds the middle of the
+// edit path and recurses on either side of it.
+func Compute(a, b []string) []Op {
+	if len(a)+len(b) == 0 {
+		return nil
+	}
+
+	ops := make([]Op, 0, len(a)+len(b))
+	if len(a)+len(b) > maxLines {
+		for _, line := range a {
+			ops = append(ops, Op{Kind: Delete, Line: line})
+		}
+		for _, line := range b {
+			ops = append(ops, Op{Kind: Insert, Line: line})
+		}
+		return ops
+	}
+
+	size := 2*((len(a)+len(b)+1)/2) + 3
+	d := &differ{a: a, b: b, forward: make([]int, size), reverse: make([]int, size)}
+	d.compare(0, len(a), 0, len(b))
+	return d.ops
+}
+
+type differ struct {
+	a, b []string
+	// Furthest x reached on each diagonal, searching from either end
+	forward, reverse []int
+	ops              []Op
+}
+
+// compare appends the edit script turning a[aLo:aHi] into b[bLo:bHi]
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	// Lines the ranges start or end with in common need no searching
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.ops = append(d.ops, Op{Kind: Equal, Line: d.a[aLo]})
+		aLo++
+		bLo++
+	}
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && d.a[aHi-suffix-1] == d.b[bHi-suffix-1] {
+		suffix++
+	}
+	aHi -= suffix
+	bHi -= suffix
+
+	switch {
+	case aLo == aHi:
+		for ; bLo < bHi; bLo++ {
+			d.ops = append(d.ops, Op{Kind: Insert, Line: d.b[bLo]})
+		}
+	case bLo == bHi:
+		for ; aLo < aHi; aLo++ {
+			d.ops = append(d.ops, Op{Kind: Delete, Line: d.a[aLo]})
+		}
+	default:
+		// With the common ends stripped both halves hold fewer edits
+		// than the whole, so the recursion ends
+		x, y, u, v := d.middleSnake(aLo, aHi, bLo, bHi)
+		d.compare(aLo, x, bLo, y)
+		for ; x < u; x, y = x+1, y+1 {
+			d.ops = append(d.ops, Op{Kind: Equal, Line: d.a[x]})
+		}
+		d.compare(u, aHi, v, bHi)
+	}
+
+	for i := aHi; i < aHi+suffix; i++ {
+		d.ops = append(d.ops, Op{Kind: Equal, Line: d.a[i]})
+	}
+}
+
+// middleSnake finds the run of equal lines, from (x, y) to (u, v), halfway
+// along a shortest edit path through a[aLo:aHi] and b[bLo:bHi]. It searches
+// forward from the start and backward from the end until the two meet.
+func (d *differ) middleSnake(aLo, aHi, bLo, bHi int) (x, y, u, v int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	limit := (n + m + 1) / 2
+	offset := limit + 1
+	forward, reverse := d.forward, d.reverse
+	forward[offset+1] = 0
+	reverse[offset+1] = 0
+
+	for cost := 0; cost <= limit; cost++ {
+		for k := -cost; k <= cost; k += 2 {
+			var x int
+			if k == -cost || (k != cost && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+
+			// The backward search on this diagonal is a step behind
+			if rk := delta - k; odd && rk >= -(cost-1) && rk <= cost-1 && x+reverse[offset+rk] >= n {
+				return aLo + startX, bLo + startY, aLo + x, bLo + y
+			}
+		}
+
+		// Backward, x and y count lines from the end of each range
+		for rk := -cost; rk <= cost; rk += 2 {
+			var x int
+			if rk == -cost || (rk != cost && reverse[offset+rk-1] < reverse[offset+rk+1]) {
+				x = reverse[offset+rk+1]
+			} else {
+				x = reverse[offset+rk-1] + 1
+			}
+			y := x - rk
+			startX, startY := x, y
+			for x < n && y < m && d.a[aHi-x-1] == d.b[bHi-y-1] {
+				x++
+				y++
+			}
+			reverse[offset+rk] = x
+
+			if k := delta - rk; !odd && k >= -cost && k <= cost && x+forward[offset+k] >= n {
+				return aHi - x, bHi - y, aHi - startX, bHi - startY
+			}
+		}
+	}
+
+	// Unreachable: the searches meet within limit steps
+	return aLo, bLo, aLo, bLo
+}
+
+// Unified renders the difference between oldText and newText as a unified
+// diff with the given number of context lines. It returns an empty string
+// when the texts are equal.
+func Unified(oldName, newName, oldText, newText string, context int) string {
+	ops := Compute(Lines(oldText), Lines(newText))
+
+	changed := false
+	for _, op := range ops {
+		if op.Kind != Equal {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+
+	for start := 0; start < len(ops); {
+		// Find the next change
+		for start < len(ops) && ops[start].Kind == Equal {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		// Extend the hunk until there are more than 2*context equal lines in a row
+		end := start
+		for end < len(ops) {
+			if ops[end].Kind != Equal {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].Kind == Equal {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				break
+			}
+			end = run
+		}
+
+		hunkStart := start - context
+		if hunkStart < 0 {
+			hunkStart = 0
+		}
+		hunkEnd := end + context
+		if hunkEnd > len(ops) {
+			hunkEnd = len(ops)
+		}
+
+		writeHunk(&sb, ops, hunkStart, hunkEnd)
+		start = hunkEnd
+	}
+
+	return sb.String()
+}
+
+func writeHunk(sb *strings.Builder, ops []Op, from, to int) {
+	// Line numbers of the hunk start in both texts
+	oldLine, newLine := 1, 1
+	for _, op := range ops[:from] {
+		if op.Kind != Insert {
+			oldLine++
+		}
+		if op.Kind != Delete {
+			newLine++
+		}
+	}
+
+	oldCount, newCount := 0, 0
+	for _, op := range ops[from:to] {
+		if op.Kind != Insert {
+			oldCount++
+		}
+		if op.Kind != Delete {
+			newCount++
+		}
+	}
+
+	fmt.Fprintf(sb, "@@ -%s +%s @@\n", hunkRange(oldLine, oldCount), hunkRange(newLine, newCount))
+	for _, op := range ops[from:to] {
+		switch op.Kind {
+		case Equal:
+			sb.WriteString(" ")
+		case Delete:
+			sb.WriteString("-")
+		case Insert:
+			sb.WriteString("+")
+		}
+		sb.WriteString(op.Line)
+		sb.WriteString("\n")
+	}
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		// An empty range points at the line before it, as in GNU diff
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
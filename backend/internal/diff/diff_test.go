@@ -0,0 +1,136 @@
+package diff
+
+import (
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// apply replays an edit script, returning the texts it turns from and into
+func apply(ops []Op) (a, b []string) {
+	for _, op := range ops {
+		if op.Kind != Insert {
+			a = append(a, op.Line)
+		}
+		if op.Kind != Delete {
+			b = append(b, op.Line)
+		}
+	}
+	return a, b
+}
+
+// lcs is the length of the longest common subsequence, which a shortest
+// edit script keeps as its equal lines
+func lcs(a, b []string) int {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+	return lengths[0][0]
+}
+
+func checkScript(t *testing.T, a, b []string) {
+	t.Helper()
+	ops := Compute(a, b)
+	gotA, gotB := apply(ops)
+	if !slices.Equal(gotA, a) || !slices.Equal(gotB, b) {
+		t.Fatalf("script for %q to %q turns %q into %q", a, b, gotA, gotB)
+	}
+	equal := 0
+	for _, op := range ops {
+		if op.Kind == Equal {
+			equal++
+		}
+	}
+	if want := lcs(a, b); equal != want {
+		t.Fatalf("script for %q to %q keeps %d lines; want %d", a, b, equal, want)
+	}
+}
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"", ""},
+		{"", "a\nb"},
+		{"a\nb", ""},
+		{"a\nb\nc", "a\nb\nc"},
+		{"a\nb\nc", "a\nx\nc"},
+		{"a\nb\nc\na\nb\nb\na", "c\nb\na\nb\na\nc"},
+		{"x\na\ny", "a"},
+		{"a", "x\na\ny"},
+		{"a\nb\nc\nd", "d\nc\nb\na"},
+	}
+	for _, test := range tests {
+		checkScript(t, Lines(test.a), Lines(test.b))
+	}
+}
+
+func TestComputeRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	text := func() []string {
+		lines := make([]string, rng.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(4)))
+		}
+		return lines
+	}
+	for i := 0; i < 500; i++ {
+		checkScript(t, text(), text())
+	}
+}
+
+func TestComputeTooLong(t *testing.T) {
+	a := strings.Split(strings.Repeat("a\n", maxLines), "\n")
+	ops := Compute(a, []string{"b"})
+	gotA, gotB := apply(ops)
+	if !slices.Equal(gotA, a) || !slices.Equal(gotB, []string{"b"}) {
+		t.Error("whole replacement does not turn one text into the other")
+	}
+	for _, op := range ops {
+		if op.Kind == Equal {
+			t.Fatal("inputs past maxLines diffed line by line")
+		}
+	}
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name, old, new string
+		context        int
+		want           string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", 3, ""},
+		{
+			"one change", "a\nb\nc\n", "a\nx\nc\n", 1,
+			"--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+		},
+		{
+			"from empty", "", "a\nb\n", 3,
+			"--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			"two hunks", "1\n2\n3\n4\n5\n6\n7\n8\n9\n", "1\nX\n3\n4\n5\n6\n7\nY\n9\n", 1,
+			"--- old\n+++ new\n@@ -1,3 +1,3 @@\n 1\n-2\n+X\n 3\n@@ -7,3 +7,3 @@\n 7\n-8\n+Y\n 9\n",
+		},
+		{
+			"merged hunks", "1\n2\n3\n4\n5\n", "X\n2\n3\n4\nY\n", 2,
+			"--- old\n+++ new\n@@ -1,5 +1,5 @@\n-1\n+X\n 2\n 3\n 4\n-5\n+Y\n",
+		},
+	}
+	for _, test := range tests {
+		if got := Unified("old", "new", test.old, test.new, test.context); got != test.want {
+			t.Errorf("%s:\n%s\nwant:\n%s", test.name, got, test.want)
+		}
+	}
+}
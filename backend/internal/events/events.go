@@ -0,0 +1,147 @@
+// Package events defines the domain events raised by changes to notes,
+// labels and the records that hang off them. Services write them to the outbox in the same transaction as
+// the change; a dispatcher then hands each one to every subscriber at
+// least once, so subscribers must cope with seeing an event twice.
+package events
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"google-keep-clone/internal/models"
+)
+
+type Type string
+
+// Event types. They double as the websocket message types.
+const (
+	NoteCreated      Type = "note_created"
+	NoteUpdated      Type = "note_updated"
+	NotePinned       Type = "note_pinned"
+	NoteUnpinned     Type = "note_unpinned"
+	NoteArchived     Type = "note_archived"
+	NoteUnarchived   Type = "note_unarchived"
+	NoteColorChanged Type = "note_color_changed"
+	NoteTrashed      Type = "note_trashed"
+	NoteRestored     Type = "note_restored"
+	NoteDeleted      Type = "note_deleted"
+
+	LabelCreated  Type = "label_created"
+	LabelUpdated  Type = "label_updated"
+	LabelDeleted  Type = "label_deleted"
+	LabelAttached Type = "label_attached"
+	LabelDetached Type = "label_detached"
+
+	ChecklistItemCreated    Type = "checklist_item_created"
+	ChecklistItemUpdated    Type = "checklist_item_updated"
+	ChecklistItemsReordered Type = "checklist_items_reordered"
+	ChecklistItemDeleted    Type = "checklist_item_deleted"
+
+	AttachmentAdded   Type = "attachment_added"
+	AttachmentUpdated Type = "attachment_updated"
+	AttachmentDeleted Type = "attachment_deleted"
+
+	CollaboratorAdded   Type = "collaborator_added"
+	CollaboratorRemoved Type = "collaborator_removed"
+	NoteShared          Type = "note_shared"
+	NoteUnshared        Type = "note_unshared"
+
+	ReminderCreated Type = "reminder_created"
+	ReminderUpdated Type = "reminder_updated"
+	ReminderDeleted Type = "reminder_deleted"
+	ReminderFired   Type = "reminder_fired"
+
+	ViewCreated Type = "view_created"
+	ViewUpdated Type = "view_updated"
+	ViewDeleted Type = "view_deleted"
+
+	ImportProgress  Type = "import_progress"
+	ImportCompleted Type = "import_completed"
+)
+
+// Types lists every event type
+var Types = []Type{
+	NoteCreated, NoteUpdated, NotePinned, NoteUnpinned, NoteArchived, NoteUnarchived,
+	NoteColorChanged, NoteTrashed, NoteRestored, NoteDeleted,
+	LabelCreated, LabelUpdated, LabelDeleted, LabelAttached, LabelDetached,
+	ChecklistItemCreated, ChecklistItemUpdated, ChecklistItemsReordered, ChecklistItemDeleted,
+	AttachmentAdded, AttachmentUpdated, AttachmentDeleted,
+	CollaboratorAdded, CollaboratorRemoved, NoteShared, NoteUnshared,
+	ReminderCreated, ReminderUpdated, ReminderDeleted, ReminderFired,
+	ViewCreated, ViewUpdated, ViewDeleted,
+	ImportProgress, ImportCompleted,
+}
+
+// Name returns the type as webhooks name it: note_created is note.created
+// and note_color_changed is note.color_changed
+func (t Type) Name() string {
+	return strings.Replace(string(t), "_", ".", 1)
+}
+
+// Event is a change as subscribers see it. Payload depends on the type:
+// the record as it is after the change, Deleted or NoteItemDeleted for
+// deletions, or one of the other payloads below where named.
+type Event struct {
+	ID         int64           `json:"id"`
+	Type       Type            `json:"type"`
+	ActorID    uuid.UUID       `json:"actor_id"`
+	Audience   []uuid.UUID     `json:"-"`
+	Payload    json.RawMessage `json:"payload"`
+	OccurredAt time.Time       `json:"occurred_at"`
+}
+
+// Deleted is the payload of NoteDeleted, LabelDeleted and ViewDeleted
+type Deleted struct {
+	ID uuid.UUID `json:"id"`
+}
+
+// NoteItemDeleted is the payload of ChecklistItemDeleted and
+// AttachmentDeleted
+type NoteItemDeleted struct {
+	ID     uuid.UUID `json:"id"`
+	NoteID uuid.UUID `json:"note_id"`
+}
+
+// ItemsReordered is the payload of ChecklistItemsReordered
+type ItemsReordered struct {
+	NoteID uuid.UUID              `json:"note_id"`
+	Items  []models.ChecklistItem `json:"items"`
+}
+
+// CollaboratorLink is the payload of CollaboratorRemoved and NoteUnshared
+type CollaboratorLink struct {
+	NoteID uuid.UUID `json:"note_id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// NoteRef is the payload of ReminderDeleted
+type NoteRef struct {
+	NoteID uuid.UUID `json:"note_id"`
+}
+
+// ReminderFiring is the payload of ReminderFired. Missed is set when it
+// went out well after ScheduledFor, such as after downtime.
+type ReminderFiring struct {
+	Reminder     *models.Reminder `json:"reminder"`
+	ScheduledFor time.Time        `json:"scheduled_for"`
+	Missed       bool             `json:"missed"`
+	NextFireAt   *time.Time       `json:"next_fire_at"`
+}
+
+// LabelLink is the payload of LabelAttached and LabelDetached
+type LabelLink struct {
+	NoteID  uuid.UUID    `json:"note_id"`
+	LabelID uuid.UUID    `json:"label_id"`
+	Note    *models.Note `json:"note"` // the note with its labels after the change
+}
+
+// Subscriber handles dispatched events. An error has the event handed to
+// it again later.
+type Subscriber interface {
+	// Name identifies the subscriber in the outbox; it must not change
+	Name() string
+	Handle(event *Event) error
+}
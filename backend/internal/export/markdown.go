@@ -0,0 +1,139 @@
+// Package export renders notes for account exports.
+package export
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"google-keep-clone/internal/models"
+)
+
+// FileName builds a filesystem-safe name from a note title. The ID suffix
+// keeps notes with the same title apart.
+func FileName(title string, id uuid.UUID, ext string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.TrimSpace(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(r)
+			dash = false
+		} else if !dash && sb.Len() > 0 {
+			sb.WriteByte('-')
+			dash = true
+		}
+		if sb.Len() >= 60 {
+			break
+		}
+	}
+
+	name := strings.TrimSuffix(sb.String(), "-")
+	if name == "" {
+		name = "untitled"
+	}
+	return name + "-" + id.String()[:8] + ext
+}
+
+// Markdown renders a note as Markdown with YAML front matter. Attachment
+// links point at the paths in attachmentPaths, relative to the note.
+func Markdown(note *models.Note, attachmentPaths map[uuid.UUID]string) []byte {
+	var sb strings.Builder
+
+	sb.WriteString("---\n")
+	writeField(&sb, "title", yamlString(note.Title))
+	writeField(&sb, "color", yamlString(note.Color))
+	writeField(&sb, "pinned", yamlBool(note.IsPinned))
+	writeField(&sb, "archived", yamlBool(note.IsArchived))
+	writeField(&sb, "trashed", yamlBool(note.IsDeleted))
+
+	labels := make([]string, len(note.Labels))
+	for i, label := range note.Labels {
+		labels[i] = yamlString(label.Name)
+	}
+	writeField(&sb, "labels", "["+strings.Join(labels, ", ")+"]")
+
+	writeField(&sb, "created", note.CreatedAt.UTC().Format(time.RFC3339))
+	writeField(&sb, "updated", note.UpdatedAt.UTC().Format(time.RFC3339))
+	if note.Reminder != nil && !note.Reminder.IsDone {
+		writeField(&sb, "reminder", note.Reminder.FireAt.UTC().Format(time.RFC3339))
+		if note.Reminder.Recurrence != "" {
+			writeField(&sb, "recurrence", yamlString(note.Reminder.Recurrence))
+		}
+	}
+	sb.WriteString("---\n\n")
+
+	if note.Title != "" {
+		sb.WriteString("# " + note.Title + "\n\n")
+	}
+
+	if note.Content != "" {
+		sb.WriteString(strings.TrimRight(note.Content, "\n"))
+		sb.WriteString("\n\n")
+	}
+
+	if len(note.Items) > 0 {
+		writeChecklist(&sb, note.Items)
+		sb.WriteString("\n")
+	}
+
+	for _, attachment := range note.Attachments {
+		link, ok := attachmentPaths[attachment.ID]
+		if !ok {
+			continue
+		}
+		if strings.HasPrefix(attachment.MimeType, "image/") {
+			sb.WriteString("!")
+		}
+		sb.WriteString("[" + attachment.Filename + "](<" + link + ">)\n")
+	}
+
+	return []byte(strings.TrimRight(sb.String(), "\n") + "\n")
+}
+
+// writeChecklist renders items as task lists, nesting children under their
+// parents
+func writeChecklist(sb *strings.Builder, items []models.ChecklistItem) {
+	children := make(map[uuid.UUID][]models.ChecklistItem)
+	for _, item := range items {
+		if item.ParentID != nil {
+			children[*item.ParentID] = append(children[*item.ParentID], item)
+		}
+	}
+
+	for _, item := range items {
+		if item.ParentID != nil {
+			continue
+		}
+		writeTask(sb, item, "")
+		for _, child := range children[item.ID] {
+			writeTask(sb, child, "  ")
+		}
+	}
+}
+
+func writeTask(sb *strings.Builder, item models.ChecklistItem, indent string) {
+	box := "[ ]"
+	if item.IsChecked {
+		box = "[x]"
+	}
+	sb.WriteString(indent + "- " + box + " " + strings.ReplaceAll(item.Text, "\n", " ") + "\n")
+}
+
+func writeField(sb *strings.Builder, key, value string) {
+	sb.WriteString(key + ": " + value + "\n")
+}
+
+// yamlString quotes a string for YAML; JSON strings are valid YAML
+func yamlString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+func yamlBool(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
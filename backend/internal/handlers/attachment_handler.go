@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"google-keep-clone/internal/services"
+)
+
+type AttachmentHandler struct {
+	attachmentService *services.AttachmentService
+}
+
+func NewAttachmentHandler(attachmentService *services.AttachmentService) *AttachmentHandler {
+	return &AttachmentHandler{attachmentService: attachmentService}
+}
+
+// @Summary Upload attachment
+// @Description Upload a file to a note as multipart form data
+// @Tags attachments
+// @Accept multipart/form-data
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Note ID"
+// @Param file formData file true "File to upload"
+// @Success 201 {object} models.Attachment
+// @Router /notes/{id}/attachments [post]
+func (h *AttachmentHandler) UploadAttachment(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	noteID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid note ID"})
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "file is required"})
+	}
+
+	attachment, err := h.attachmentService.Upload(c.Context(), noteID, userID, file)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrFileTooLarge), errors.Is(err, services.ErrQuotaExceeded):
+			return c.Status(413).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	return c.Status(201).JSON(attachment)
+}
+
+// @Summary Download attachment
+// @Description Stream an attachment's content. Supports single byte ranges.
+// @Tags attachments
+// @Produce octet-stream
+// @Security ApiKeyAuth
+// @Param id path string true "Attachment ID"
+// @Param Range header string false "Byte range, e.g. bytes=0-1023"
+// @Success 200
+// @Success 206
+// @Router /attachments/{id} [get]
+func (h *AttachmentHandler) DownloadAttachment(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	attachmentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid attachment ID"})
+	}
+
+	attachment, err := h.attachmentService.GetAttachment(attachmentID, userID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	offset, length := int64(0), attachment.Size
+	partial := false
+	if header := c.Get(fiber.HeaderRange); header != "" {
+		start, end, ok := parseByteRange(header, attachment.Size)
+		if !ok {
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", attachment.Size))
+			return c.Status(416).JSON(fiber.Map{"error": "Invalid range"})
+		}
+		offset, length, partial = start, end-start+1, true
+	}
+
+	_, reader, err := h.attachmentService.Open(c.Context(), attachmentID, userID, offset, length)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Only media types render inline; everything else downloads, so an
+	// uploaded HTML file can't run in our origin
+	disposition := "attachment"
+	if isInlineType(attachment.MimeType) {
+		disposition = "inline"
+	}
+
+	c.Set(fiber.HeaderContentType, attachment.MimeType)
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	c.Set(fiber.HeaderETag, `"`+attachment.SHA256+`"`)
+
+	if partial {
+		c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, attachment.Size))
+		c.Status(206)
+	}
+
+	return c.SendStream(reader, int(length))
+}
+
+// @Summary Get attachment thumbnail
+// @Description Get a resized preview of an image attachment
+// @Tags attachments
+// @Produce image/jpeg,image/png
+// @Security ApiKeyAuth
+// @Param id path string true "Attachment ID"
+// @Param size path string true "Thumbnail size (small, medium or large)"
+// @Success 200
+// @Router /attachments/{id}/thumbnails/{size} [get]
+func (h *AttachmentHandler) GetThumbnail(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	attachmentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid attachment ID"})
+	}
+
+	attachment, reader, err := h.attachmentService.OpenThumbnail(c.Context(), attachmentID, userID, c.Params("size"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Thumbnails never change once rendered, so clients may keep them
+	c.Set(fiber.HeaderContentType, attachment.ThumbnailMimeType)
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	c.Set(fiber.HeaderCacheControl, "private, max-age=31536000, immutable")
+
+	return c.SendStream(reader)
+}
+
+// @Summary Delete attachment
+// @Description Delete an attachment from its note
+// @Tags attachments
+// @Security ApiKeyAuth
+// @Param id path string true "Attachment ID"
+// @Success 204
+// @Router /attachments/{id} [delete]
+func (h *AttachmentHandler) DeleteAttachment(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	attachmentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid attachment ID"})
+	}
+
+	if err := h.attachmentService.DeleteAttachment(c.Context(), attachmentID, userID); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.SendStatus(204)
+}
+
+// parseByteRange parses a single-range Range header ("bytes=0-99",
+// "bytes=100-" or "bytes=-100") into inclusive offsets
+func parseByteRange(header string, size int64) (start, end int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") || size == 0 {
+		return 0, 0, false
+	}
+
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	if first == "" {
+		// Suffix range: the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+
+	end = size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	return start, end, true
+}
+
+func isInlineType(mimeType string) bool {
+	// SVG can carry scripts, so it is not treated as a plain image
+	if strings.HasPrefix(mimeType, "image/svg") {
+		return false
+	}
+	for _, prefix := range []string{"image/", "audio/", "video/", "application/pdf"} {
+		if strings.HasPrefix(mimeType, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"google-keep-clone/internal/services"
@@ -33,19 +35,21 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	user, token, err := h.authService.Register(&req)
+	user, tokens, err := h.authService.Register(&req, clientInfo(c, req.DeviceName))
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	return c.Status(201).JSON(fiber.Map{
-		"user":  user,
-		"token": token,
+		"user":          user,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 	})
 }
 
 // @Summary Login user
-// @Description Login with email and password
+// @Description Login with email and password. Returns a short-lived access token and a refresh token for POST /auth/refresh. For users with two-factor authentication on it instead returns mfa_required and an mfa_token, good for five minutes, to send to POST /auth/2fa/verify with a code.
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -62,17 +66,87 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	user, token, err := h.authService.Login(&req)
+	user, tokens, err := h.authService.Login(&req, clientInfo(c, req.DeviceName))
 	if err != nil {
+		var mfaRequired *services.MFARequiredError
+		if errors.As(err, &mfaRequired) {
+			return c.JSON(fiber.Map{
+				"mfa_required": true,
+				"mfa_token":    mfaRequired.Token,
+				"expires_in":   mfaRequired.ExpiresIn,
+			})
+		}
 		return c.Status(401).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	return c.JSON(fiber.Map{
-		"user":  user,
-		"token": token,
+		"user":          user,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 	})
 }
 
+// @Summary Verify two-factor code
+// @Description Finish signing in with the mfa_token from POST /auth/login and a code from the authenticator app, or one of the recovery codes. Each code works once. After five wrong codes in a row, codes are refused for 15 minutes.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body validators.TwoFactorVerifyRequest true "MFA token and code"
+// @Success 200 {object} map[string]interface{}
+// @Router /auth/2fa/verify [post]
+func (h *AuthHandler) VerifyTwoFactor(c *fiber.Ctx) error {
+	var req validators.TwoFactorVerifyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := validators.ValidateStruct(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	user, tokens, err := h.authService.VerifyTwoFactor(req.MFAToken, req.Code, clientInfo(c, ""))
+	if err != nil {
+		return twoFactorError(c, err, 401)
+	}
+
+	return c.JSON(fiber.Map{
+		"user":          user,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	})
+}
+
+// @Summary Refresh tokens
+// @Description Swap a refresh token for a new access token and a new refresh token. Each refresh token works once; presenting one that has already been swapped revokes the session.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body validators.RefreshRequest true "Refresh token"
+// @Success 200 {object} models.AuthTokens
+// @Router /auth/refresh [post]
+func (h *AuthHandler) Refresh(c *fiber.Ctx) error {
+	var req validators.RefreshRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := validators.ValidateStruct(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	tokens, err := h.authService.Refresh(req.RefreshToken, clientInfo(c, ""))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRefreshToken) {
+			return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(tokens)
+}
+
 // @Summary Get current user
 // @Description Get the currently authenticated user
 // @Tags auth
@@ -81,32 +155,359 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 // @Success 200 {object} models.User
 // @Router /auth/me [get]
 func (h *AuthHandler) GetCurrentUser(c *fiber.Ctx) error {
-	userID := c.Locals("userID").(string)
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
 
-	// Parse userID to UUID
-	id, err := uuid.Parse(userID)
+	user, err := h.authService.GetUser(userID)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	// Get user from database (you'll need to implement this)
-	// For now, return the userID
-	return c.JSON(fiber.Map{
-		"user_id": id,
-		"message": "User authenticated successfully",
-	})
+	return c.JSON(user)
+}
+
+// @Summary Update current user
+// @Description Update the authenticated user's name or search language. Changing the search language re-indexes all of the user's notes.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body validators.UpdateProfileRequest true "Profile fields to change"
+// @Success 200 {object} models.User
+// @Router /auth/me [patch]
+func (h *AuthHandler) UpdateCurrentUser(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+
+	var req validators.UpdateProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := validators.ValidateUpdateProfileRequest(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	user, err := h.authService.UpdateProfile(userID, &req)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(user)
 }
 
 // @Summary Logout user
-// @Description Logout the current user
+// @Description Logout the current user, revoking the session. Its access and refresh tokens stop working.
 // @Tags auth
 // @Produce json
+// @Security ApiKeyAuth
 // @Success 200 {object} map[string]interface{}
 // @Router /auth/logout [post]
 func (h *AuthHandler) Logout(c *fiber.Ctx) error {
-	// In a JWT implementation, logout is typically handled client-side
-	// by removing the token from storage
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	sessionID, _ := uuid.Parse(c.Locals("sessionID").(string))
+
+	if err := h.authService.Logout(sessionID, userID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	return c.JSON(fiber.Map{
 		"message": "Logged out successfully",
 	})
 }
+
+// @Summary Get sessions
+// @Description Get the devices the user is signed in on, most recently used first. The one making the request has current set.
+// @Tags auth
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} models.Session
+// @Router /auth/sessions [get]
+func (h *AuthHandler) GetSessions(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	sessionID, _ := uuid.Parse(c.Locals("sessionID").(string))
+
+	sessions, err := h.authService.GetSessions(userID, sessionID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(sessions)
+}
+
+// @Summary Revoke session
+// @Description Sign one of the user's devices out
+// @Tags auth
+// @Security ApiKeyAuth
+// @Param id path string true "Session ID"
+// @Success 204
+// @Router /auth/sessions/{id} [delete]
+func (h *AuthHandler) RevokeSession(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	sessionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid session ID"})
+	}
+
+	if err := h.authService.RevokeSession(sessionID, userID); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.SendStatus(204)
+}
+
+// @Summary Get two-factor status
+// @Description Whether the user has two-factor authentication on, and how many recovery codes they have left
+// @Tags auth
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} services.TwoFactorStatus
+// @Router /auth/2fa [get]
+func (h *AuthHandler) GetTwoFactorStatus(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+
+	status, err := h.authService.GetTwoFactorStatus(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(status)
+}
+
+// @Summary Set up two-factor authentication
+// @Description Start enrolling an authenticator app. Returns a new secret and an otpauth URI to show as a QR code. Two-factor authentication is only turned on by POST /auth/2fa/confirm; setting up again before then replaces the secret.
+// @Tags auth
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} services.TwoFactorSetup
+// @Router /auth/2fa/setup [post]
+func (h *AuthHandler) SetupTwoFactor(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+
+	setup, err := h.authService.SetupTwoFactor(userID)
+	if err != nil {
+		return twoFactorError(c, err, 400)
+	}
+
+	return c.JSON(setup)
+}
+
+// @Summary Confirm two-factor authentication
+// @Description Turn two-factor authentication on with a code from the newly enrolled app. Returns ten one-time recovery codes, which are not shown again.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body validators.TwoFactorConfirmRequest true "Code from the authenticator app"
+// @Success 200 {object} map[string]interface{}
+// @Router /auth/2fa/confirm [post]
+func (h *AuthHandler) ConfirmTwoFactor(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+
+	var req validators.TwoFactorConfirmRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := validators.ValidateStruct(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	codes, err := h.authService.ConfirmTwoFactor(userID, req.Code)
+	if err != nil {
+		return twoFactorError(c, err, 400)
+	}
+
+	return c.JSON(fiber.Map{
+		"recovery_codes": codes,
+	})
+}
+
+// @Summary Disable two-factor authentication
+// @Description Turn two-factor authentication off. Needs the password and a code from the authenticator app, or a recovery code. The recovery codes are deleted.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body validators.TwoFactorReauthRequest true "Password and code"
+// @Success 200 {object} map[string]interface{}
+// @Router /auth/2fa/disable [post]
+func (h *AuthHandler) DisableTwoFactor(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+
+	var req validators.TwoFactorReauthRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := validators.ValidateStruct(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := h.authService.DisableTwoFactor(userID, req.Password, req.Code); err != nil {
+		return twoFactorError(c, err, 403)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Two-factor authentication turned off",
+	})
+}
+
+// @Summary Regenerate recovery codes
+// @Description Replace the recovery codes with ten new ones; the old ones stop working. Needs the password and a code from the authenticator app, or a recovery code.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body validators.TwoFactorReauthRequest true "Password and code"
+// @Success 200 {object} map[string]interface{}
+// @Router /auth/2fa/recovery-codes [post]
+func (h *AuthHandler) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+
+	var req validators.TwoFactorReauthRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := validators.ValidateStruct(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	codes, err := h.authService.RegenerateRecoveryCodes(userID, req.Password, req.Code)
+	if err != nil {
+		return twoFactorError(c, err, 403)
+	}
+
+	return c.JSON(fiber.Map{
+		"recovery_codes": codes,
+	})
+}
+
+// @Summary Verify email
+// @Description Confirm the user's email address with the token from the verification email. Tokens work once and expire after 48 hours.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body validators.VerifyEmailRequest true "Verification token"
+// @Success 200 {object} models.User
+// @Router /auth/verify-email [post]
+func (h *AuthHandler) VerifyEmail(c *fiber.Ctx) error {
+	var req validators.VerifyEmailRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := validators.ValidateStruct(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	user, err := h.authService.VerifyEmail(req.Token)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidToken) {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(user)
+}
+
+// @Summary Resend verification email
+// @Description Email the authenticated user a new verification link. Earlier links stop working.
+// @Tags auth
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 202 {object} map[string]interface{}
+// @Router /auth/verify-email/resend [post]
+func (h *AuthHandler) ResendVerification(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+
+	if err := h.authService.ResendVerification(userID); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(202).JSON(fiber.Map{
+		"message": "Verification email sent",
+	})
+}
+
+// @Summary Forgot password
+// @Description Email a password reset link to the address if it has an account. The response is the same either way.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body validators.ForgotPasswordRequest true "Account email"
+// @Success 202 {object} map[string]interface{}
+// @Router /auth/forgot-password [post]
+func (h *AuthHandler) ForgotPassword(c *fiber.Ctx) error {
+	var req validators.ForgotPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := validators.ValidateStruct(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	h.authService.ForgotPassword(req.Email)
+
+	return c.Status(202).JSON(fiber.Map{
+		"message": "If an account exists for that email, a reset link has been sent",
+	})
+}
+
+// @Summary Reset password
+// @Description Set a new password with the token from the reset email. Tokens work once and expire after an hour. Every existing session is signed out.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body validators.ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} map[string]interface{}
+// @Router /auth/reset-password [post]
+func (h *AuthHandler) ResetPassword(c *fiber.Ctx) error {
+	var req validators.ResetPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := validators.ValidateStruct(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := h.authService.ResetPassword(req.Token, req.Password); err != nil {
+		if errors.Is(err, services.ErrInvalidToken) {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Password has been reset; sign in with the new password",
+	})
+}
+
+// twoFactorError maps an error from the two-factor calls to a response,
+// rejecting a wrong token, password or code with status
+func twoFactorError(c *fiber.Ctx, err error, status int) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidMFAToken),
+		errors.Is(err, services.ErrInvalidTwoFactorCode),
+		errors.Is(err, services.ErrIncorrectPassword):
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrTwoFactorLocked):
+		return c.Status(429).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrTwoFactorEnabled), errors.Is(err, services.ErrTwoFactorDisabled):
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+}
+
+func clientInfo(c *fiber.Ctx, deviceName string) services.ClientInfo {
+	return services.ClientInfo{
+		DeviceName: deviceName,
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get("User-Agent"),
+	}
+}
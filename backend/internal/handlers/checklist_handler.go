@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"google-keep-clone/internal/services"
+	"google-keep-clone/internal/validators"
+)
+
+type ChecklistHandler struct {
+	checklistService *services.ChecklistService
+}
+
+func NewChecklistHandler(checklistService *services.ChecklistService) *ChecklistHandler {
+	return &ChecklistHandler{checklistService: checklistService}
+}
+
+// @Summary Add checklist item
+// @Description Add an item to a note's checklist
+// @Tags checklist
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Note ID"
+// @Param request body validators.CreateChecklistItemRequest true "Item data"
+// @Success 201 {object} models.ChecklistItem
+// @Router /notes/{id}/items [post]
+func (h *ChecklistHandler) AddItem(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	noteID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid note ID"})
+	}
+
+	var req validators.CreateChecklistItemRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := validators.ValidateCreateChecklistItemRequest(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	item, err := h.checklistService.AddItem(noteID, userID, &req)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(item)
+}
+
+// @Summary Update checklist item
+// @Description Update the text, checked state or parent of a checklist item
+// @Tags checklist
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Note ID"
+// @Param item_id path string true "Item ID"
+// @Param request body validators.UpdateChecklistItemRequest true "Item data"
+// @Success 200 {object} models.ChecklistItem
+// @Router /notes/{id}/items/{item_id} [patch]
+func (h *ChecklistHandler) UpdateItem(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	noteID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid note ID"})
+	}
+
+	itemID, err := uuid.Parse(c.Params("item_id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid item ID"})
+	}
+
+	var req validators.UpdateChecklistItemRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := validators.ValidateUpdateChecklistItemRequest(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	item, err := h.checklistService.UpdateItem(noteID, itemID, userID, &req)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(item)
+}
+
+// @Summary Reorder checklist items
+// @Description Set the order of every item in a note's checklist
+// @Tags checklist
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Note ID"
+// @Param request body validators.ReorderChecklistItemsRequest true "Ordered item IDs"
+// @Success 200 {array} models.ChecklistItem
+// @Router /notes/{id}/items/order [put]
+func (h *ChecklistHandler) ReorderItems(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	noteID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid note ID"})
+	}
+
+	var req validators.ReorderChecklistItemsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := validators.ValidateReorderChecklistItemsRequest(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	items, err := h.checklistService.ReorderItems(noteID, userID, &req)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(items)
+}
+
+// @Summary Delete checklist item
+// @Description Delete a checklist item and any items nested under it
+// @Tags checklist
+// @Security ApiKeyAuth
+// @Param id path string true "Note ID"
+// @Param item_id path string true "Item ID"
+// @Success 204
+// @Router /notes/{id}/items/{item_id} [delete]
+func (h *ChecklistHandler) DeleteItem(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	noteID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid note ID"})
+	}
+
+	itemID, err := uuid.Parse(c.Params("item_id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid item ID"})
+	}
+
+	if err := h.checklistService.DeleteItem(noteID, itemID, userID); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.SendStatus(204)
+}
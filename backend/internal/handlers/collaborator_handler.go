@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"google-keep-clone/internal/services"
+	"google-keep-clone/internal/validators"
+)
+
+type CollaboratorHandler struct {
+	collaboratorService *services.CollaboratorService
+}
+
+func NewCollaboratorHandler(collaboratorService *services.CollaboratorService) *CollaboratorHandler {
+	return &CollaboratorHandler{collaboratorService: collaboratorService}
+}
+
+// @Summary Get collaborators
+// @Description Get the users a note is shared with
+// @Tags collaborators
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Note ID"
+// @Success 200 {array} models.NoteCollaborator
+// @Router /notes/{id}/collaborators [get]
+func (h *CollaboratorHandler) GetCollaborators(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	noteID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid note ID"})
+	}
+
+	collaborators, err := h.collaboratorService.GetCollaborators(noteID, userID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(collaborators)
+}
+
+// @Summary Add collaborator
+// @Description Share a note with another user by email, or change their role. The response is the same whether or not the email has an account.
+// @Tags collaborators
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Note ID"
+// @Param request body validators.AddCollaboratorRequest true "Collaborator data"
+// @Success 202 {object} map[string]interface{}
+// @Router /notes/{id}/collaborators [post]
+func (h *CollaboratorHandler) AddCollaborator(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	noteID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid note ID"})
+	}
+
+	var req validators.AddCollaboratorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := validators.ValidateAddCollaboratorRequest(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := h.collaboratorService.AddCollaborator(noteID, userID, &req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(202).JSON(fiber.Map{
+		"message": "If an account exists for that email, the note has been shared with it",
+	})
+}
+
+// @Summary Remove collaborator
+// @Description Stop sharing a note with a user
+// @Tags collaborators
+// @Security ApiKeyAuth
+// @Param id path string true "Note ID"
+// @Param user_id path string true "Collaborator user ID"
+// @Success 204
+// @Router /notes/{id}/collaborators/{user_id} [delete]
+func (h *CollaboratorHandler) RemoveCollaborator(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	noteID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid note ID"})
+	}
+
+	collaboratorID, err := uuid.Parse(c.Params("user_id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	if err := h.collaboratorService.RemoveCollaborator(noteID, collaboratorID, userID); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.SendStatus(204)
+}
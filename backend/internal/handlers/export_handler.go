@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"google-keep-clone/internal/services"
+)
+
+type ExportHandler struct {
+	exportService *services.ExportService
+}
+
+func NewExportHandler(exportService *services.ExportService) *ExportHandler {
+	return &ExportHandler{exportService: exportService}
+}
+
+// @Summary Export account
+// @Description Download a zip of all notes, labels and attachments. json is a lossless dump, markdown writes one .md file per note, keep mirrors a Google Takeout archive.
+// @Tags export
+// @Produce application/zip
+// @Security ApiKeyAuth
+// @Param format query string false "Export format (json, markdown or keep)" default(json)
+// @Success 200
+// @Router /export [get]
+func (h *ExportHandler) Export(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+
+	format := c.Query("format", services.ExportJSON)
+	if err := services.ValidateExportFormat(format); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	filename := fmt.Sprintf("keep-export-%s-%s.zip", format, time.Now().UTC().Format("2006-01-02"))
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	// The zip is written while the response is sent. Headers are already
+	// out by the time an error could happen, so failures can only be logged
+	// and show up as a truncated archive.
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := h.exportService.Export(context.Background(), userID, format, w); err != nil {
+			log.Printf("Error exporting notes for user %s: %v", userID, err)
+		}
+		if err := w.Flush(); err != nil {
+			log.Printf("Error flushing export for user %s: %v", userID, err)
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"google-keep-clone/internal/services"
+)
+
+type ImportHandler struct {
+	importService *services.ImportService
+}
+
+func NewImportHandler(importService *services.ImportService) *ImportHandler {
+	return &ImportHandler{importService: importService}
+}
+
+// @Summary Import from Google Keep
+// @Description Upload a Google Takeout zip; its Keep notes are imported in the background. Importing the same archive again skips notes that were already imported.
+// @Tags import
+// @Accept multipart/form-data
+// @Produce json
+// @Security ApiKeyAuth
+// @Param file formData file true "Google Takeout zip"
+// @Success 202 {object} models.ImportJob
+// @Router /import/keep [post]
+func (h *ImportHandler) ImportKeep(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "file is required"})
+	}
+
+	job, err := h.importService.StartKeepImport(userID, file)
+	if err != nil {
+		if errors.Is(err, services.ErrImportInProgress) {
+			return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(202).JSON(job)
+}
+
+// @Summary Get import jobs
+// @Description Get the authenticated user's recent imports, newest first
+// @Tags import
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} models.ImportJob
+// @Router /import/jobs [get]
+func (h *ImportHandler) GetImportJobs(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+
+	jobs, err := h.importService.GetImportJobs(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(jobs)
+}
+
+// @Summary Get import job
+// @Description Get an import's progress and per-item error report
+// @Tags import
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Import job ID"
+// @Success 200 {object} models.ImportJob
+// @Router /import/jobs/{id} [get]
+func (h *ImportHandler) GetImportJob(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	jobID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid import job ID"})
+	}
+
+	job, err := h.importService.GetImportJob(jobID, userID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(job)
+}
@@ -202,12 +202,17 @@ func (h *LabelHandler) DetachLabelFromNote(c *fiber.Ctx) error {
 }
 
 // @Summary Get notes by label
-// @Description Get all notes with a specific label
+// @Description Get notes with a specific label a page at a time
 // @Tags labels
 // @Produce json
 // @Security ApiKeyAuth
 // @Param id path string true "Label ID"
-// @Success 200 {array} models.Note
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param limit query int false "Page size, up to 200" default(50)
+// @Param sort query string false "Sort field (updated_at, created_at, title or position)"
+// @Param order query string false "Sort direction (asc or desc), defaults to newest first for dates and ascending otherwise"
+// @Param with_total query bool false "Include the total number of notes" default(false)
+// @Success 200 {object} models.NotePage
 // @Router /labels/{id}/notes [get]
 func (h *LabelHandler) GetNotesByLabel(c *fiber.Ctx) error {
 	userID, _ := uuid.Parse(c.Locals("userID").(string))
@@ -216,7 +221,12 @@ func (h *LabelHandler) GetNotesByLabel(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid label ID"})
 	}
 
-	notes, err := h.labelService.GetNotesByLabel(labelID, userID)
+	req, err := listNotesRequest(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	notes, err := h.labelService.GetNotesByLabel(labelID, userID, req)
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
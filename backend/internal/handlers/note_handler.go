@@ -1,11 +1,15 @@
 package handlers
 
 import (
+	"errors"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"google-keep-clone/internal/pagination"
+	"google-keep-clone/internal/searchquery"
 	"google-keep-clone/internal/services"
 	"google-keep-clone/internal/validators"
 	"strconv"
+	"strings"
 )
 
 type NoteHandler struct {
@@ -17,13 +21,18 @@ func NewNoteHandler(noteService *services.NoteService) *NoteHandler {
 }
 
 // @Summary Get all notes
-// @Description Get all notes for the authenticated user
+// @Description Get notes for the authenticated user a page at a time, pinned first
 // @Tags notes
 // @Produce json
 // @Security ApiKeyAuth
 // @Param archived query bool false "Include archived notes"
 // @Param deleted query bool false "Include deleted notes"
-// @Success 200 {array} models.Note
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param limit query int false "Page size, up to 200" default(50)
+// @Param sort query string false "Sort field (updated_at, created_at, title or position)"
+// @Param order query string false "Sort direction (asc or desc), defaults to newest first for dates and ascending otherwise"
+// @Param with_total query bool false "Include the total number of notes" default(false)
+// @Success 200 {object} models.NotePage
 // @Router /notes [get]
 func (h *NoteHandler) GetNotes(c *fiber.Ctx) error {
 	userID, _ := uuid.Parse(c.Locals("userID").(string))
@@ -31,14 +40,44 @@ func (h *NoteHandler) GetNotes(c *fiber.Ctx) error {
 	includeArchived := c.QueryBool("archived", false)
 	includeDeleted := c.QueryBool("deleted", false)
 
-	notes, err := h.noteService.GetNotesByUserID(userID, includeArchived, includeDeleted)
+	req, err := listNotesRequest(c)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	notes, err := h.noteService.GetNotesByUserID(userID, includeArchived, includeDeleted, req)
+	if err != nil {
+		return c.Status(listNotesStatus(err)).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	return c.JSON(notes)
 }
 
+// listNotesRequest reads the paging and sorting parameters every note
+// listing accepts
+func listNotesRequest(c *fiber.Ctx) (*validators.ListNotesRequest, error) {
+	limit, _ := strconv.Atoi(c.Query("limit", "0"))
+	req := &validators.ListNotesRequest{
+		Cursor:    c.Query("cursor"),
+		Limit:     limit,
+		Sort:      c.Query("sort"),
+		Order:     c.Query("order"),
+		WithTotal: c.QueryBool("with_total", false),
+	}
+	if err := validators.ValidateListNotesRequest(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// listNotesStatus tells a bad cursor apart from a failed listing
+func listNotesStatus(err error) int {
+	if errors.Is(err, pagination.ErrInvalidCursor) || errors.Is(err, pagination.ErrCursorMismatch) {
+		return 400
+	}
+	return 500
+}
+
 // @Summary Create note
 // @Description Create a new note
 // @Tags notes
@@ -88,6 +127,7 @@ func (h *NoteHandler) GetNoteByID(c *fiber.Ctx) error {
 		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	c.Set(fiber.HeaderETag, noteETag(note.Version))
 	return c.JSON(note)
 }
 
@@ -99,7 +139,9 @@ func (h *NoteHandler) GetNoteByID(c *fiber.Ctx) error {
 // @Security ApiKeyAuth
 // @Param id path string true "Note ID"
 // @Param request body validators.UpdateNoteRequest true "Note data"
+// @Param If-Match header string false "Version the edit was made against, as returned in ETag; same as expected_version"
 // @Success 200 {object} models.Note
+// @Failure 409 {object} map[string]interface{} "The note changed since that version; note holds the current copy"
 // @Router /notes/{id} [put]
 func (h *NoteHandler) UpdateNote(c *fiber.Ctx) error {
 	userID, _ := uuid.Parse(c.Locals("userID").(string))
@@ -113,18 +155,47 @@ func (h *NoteHandler) UpdateNote(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
+	if ifMatch := c.Get(fiber.HeaderIfMatch); ifMatch != "" {
+		version, err := parseETag(ifMatch)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		req.ExpectedVersion = &version
+	}
+
 	if err := validators.ValidateUpdateNoteRequest(&req); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	note, err := h.noteService.UpdateNote(noteID, userID, &req)
 	if err != nil {
+		var conflict *services.VersionConflictError
+		if errors.As(err, &conflict) {
+			c.Set(fiber.HeaderETag, noteETag(conflict.Current.Version))
+			return c.Status(409).JSON(fiber.Map{"error": err.Error(), "note": conflict.Current})
+		}
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	c.Set(fiber.HeaderETag, noteETag(note.Version))
 	return c.JSON(note)
 }
 
+// noteETag is the entity tag for a version of a note
+func noteETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// parseETag reads a note version back from an If-Match header
+func parseETag(value string) (int64, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "W/")
+	version, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+	if err != nil || version < 1 {
+		return 0, errors.New("If-Match must be a note version")
+	}
+	return version, nil
+}
+
 // @Summary Delete note
 // @Description Delete a note (soft delete by default)
 // @Tags notes
@@ -232,38 +303,50 @@ func (h *NoteHandler) UpdateColor(c *fiber.Ctx) error {
 }
 
 // @Summary Search notes
-// @Description Search notes by title and content
+// @Description Full-text search over titles, content and checklist items, best matches first. Supports "quoted phrases", -exclusions, OR between terms and the filters label:, color:, is:(pinned|archived|trashed|shared), has:(checklist|attachment|image|reminder|label), before: and after: (YYYY-MM-DD). Invalid queries return 400 with the position of each problem. With fuzzy=true words are matched by trigram similarity, so typos still find notes. When nothing matches, suggestion holds the query with misspelt words corrected from the user's notes.
 // @Tags notes
 // @Produce json
 // @Security ApiKeyAuth
 // @Param q query string true "Search query"
 // @Param limit query int false "Limit results" default(20)
 // @Param page query int false "Page number" default(0)
-// @Success 200 {array} models.Note
+// @Param fuzzy query bool false "Match words by similarity" default(false)
+// @Param threshold query number false "Similarity needed for fuzzy matches, 0 to 1 (server default when omitted)"
+// @Success 200 {object} models.SearchResponse
 // @Router /notes/search [get]
 func (h *NoteHandler) SearchNotes(c *fiber.Ctx) error {
 	userID, _ := uuid.Parse(c.Locals("userID").(string))
 
-	query := c.Query("q", "")
 	limit, _ := strconv.Atoi(c.Query("limit", "20"))
 	page, _ := strconv.Atoi(c.Query("page", "0"))
+	threshold, _ := strconv.ParseFloat(c.Query("threshold", "0"), 64)
 
 	req := validators.SearchRequest{
-		Query: query,
-		Limit: limit,
-		Page:  page,
+		Query:     c.Query("q", ""),
+		Limit:     limit,
+		Page:      page,
+		Fuzzy:     c.QueryBool("fuzzy", false),
+		Threshold: threshold,
 	}
 
 	if err := validators.ValidateSearchRequest(&req); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	notes, err := h.noteService.SearchNotes(userID, query)
+	if req.Limit == 0 {
+		req.Limit = 20
+	}
+
+	response, err := h.noteService.SearchNotes(userID, &req)
 	if err != nil {
+		var parseErrors searchquery.Errors
+		if errors.As(err, &parseErrors) {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid search query", "errors": parseErrors})
+		}
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.JSON(notes)
+	return c.JSON(response)
 }
 
 // @Summary Advanced search notes
@@ -273,7 +356,7 @@ func (h *NoteHandler) SearchNotes(c *fiber.Ctx) error {
 // @Produce json
 // @Security ApiKeyAuth
 // @Param request body validators.AdvancedSearchRequest true "Advanced search parameters"
-// @Success 200 {array} models.Note
+// @Success 200 {array} models.NoteSearchResult
 // @Router /notes/search/advanced [post]
 func (h *NoteHandler) SearchNotesAdvanced(c *fiber.Ctx) error {
 	userID, _ := uuid.Parse(c.Locals("userID").(string))
@@ -306,37 +389,197 @@ func (h *NoteHandler) SearchNotesAdvanced(c *fiber.Ctx) error {
 }
 
 // @Summary Get pinned notes
-// @Description Get all pinned notes for the authenticated user
+// @Description Get pinned notes for the authenticated user a page at a time
 // @Tags notes
 // @Produce json
 // @Security ApiKeyAuth
-// @Success 200 {array} models.Note
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param limit query int false "Page size, up to 200" default(50)
+// @Param sort query string false "Sort field (updated_at, created_at, title or position)"
+// @Param order query string false "Sort direction (asc or desc), defaults to newest first for dates and ascending otherwise"
+// @Param with_total query bool false "Include the total number of notes" default(false)
+// @Success 200 {object} models.NotePage
 // @Router /notes/pinned [get]
 func (h *NoteHandler) GetPinnedNotes(c *fiber.Ctx) error {
 	userID, _ := uuid.Parse(c.Locals("userID").(string))
 
-	notes, err := h.noteService.GetPinnedNotes(userID)
+	req, err := listNotesRequest(c)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	notes, err := h.noteService.GetPinnedNotes(userID, req)
+	if err != nil {
+		return c.Status(listNotesStatus(err)).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	return c.JSON(notes)
 }
 
 // @Summary Get archived notes
-// @Description Get all archived notes for the authenticated user
+// @Description Get archived notes for the authenticated user a page at a time
 // @Tags notes
 // @Produce json
 // @Security ApiKeyAuth
-// @Success 200 {array} models.Note
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param limit query int false "Page size, up to 200" default(50)
+// @Param sort query string false "Sort field (updated_at, created_at, title or position)"
+// @Param order query string false "Sort direction (asc or desc), defaults to newest first for dates and ascending otherwise"
+// @Param with_total query bool false "Include the total number of notes" default(false)
+// @Success 200 {object} models.NotePage
 // @Router /notes/archived [get]
 func (h *NoteHandler) GetArchivedNotes(c *fiber.Ctx) error {
 	userID, _ := uuid.Parse(c.Locals("userID").(string))
 
-	notes, err := h.noteService.GetArchivedNotes(userID)
+	req, err := listNotesRequest(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	notes, err := h.noteService.GetArchivedNotes(userID, req)
+	if err != nil {
+		return c.Status(listNotesStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(notes)
+}
+
+// @Summary Get trash
+// @Description Get all trashed notes for the authenticated user
+// @Tags notes
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} models.Note
+// @Router /notes/trash [get]
+func (h *NoteHandler) GetTrashedNotes(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+
+	notes, err := h.noteService.GetTrashedNotes(userID)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	return c.JSON(notes)
 }
+
+// @Summary Empty trash
+// @Description Permanently delete every trashed note
+// @Tags notes
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /notes/trash [delete]
+func (h *NoteHandler) EmptyTrash(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+
+	deleted, err := h.noteService.EmptyTrash(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"deleted": deleted})
+}
+
+// @Summary Restore note
+// @Description Restore a note from the trash
+// @Tags notes
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Note ID"
+// @Success 200 {object} models.Note
+// @Router /notes/{id}/restore [post]
+func (h *NoteHandler) RestoreNote(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	noteID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid note ID"})
+	}
+
+	note, err := h.noteService.RestoreNote(noteID, userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(note)
+}
+
+// @Summary Get note revisions
+// @Description Get the revision history of a note, newest first
+// @Tags notes
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Note ID"
+// @Success 200 {array} models.NoteRevision
+// @Router /notes/{id}/revisions [get]
+func (h *NoteHandler) GetRevisions(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	noteID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid note ID"})
+	}
+
+	revisions, err := h.noteService.GetRevisions(noteID, userID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(revisions)
+}
+
+// @Summary Diff note revision
+// @Description Get a line-level unified diff between a revision and the current note
+// @Tags notes
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Note ID"
+// @Param rev path string true "Revision ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /notes/{id}/revisions/{rev}/diff [get]
+func (h *NoteHandler) DiffRevision(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	noteID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid note ID"})
+	}
+
+	revisionID, err := uuid.Parse(c.Params("rev"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid revision ID"})
+	}
+
+	result, err := h.noteService.DiffRevision(noteID, revisionID, userID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(result)
+}
+
+// @Summary Restore note revision
+// @Description Restore a note to the state stored in a revision
+// @Tags notes
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Note ID"
+// @Param rev path string true "Revision ID"
+// @Success 200 {object} models.Note
+// @Router /notes/{id}/revisions/{rev}/restore [post]
+func (h *NoteHandler) RestoreRevision(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	noteID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid note ID"})
+	}
+
+	revisionID, err := uuid.Parse(c.Params("rev"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid revision ID"})
+	}
+
+	note, err := h.noteService.RestoreRevision(noteID, revisionID, userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(note)
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"google-keep-clone/internal/services"
+	"google-keep-clone/internal/validators"
+)
+
+type ReminderHandler struct {
+	reminderService *services.ReminderService
+}
+
+func NewReminderHandler(reminderService *services.ReminderService) *ReminderHandler {
+	return &ReminderHandler{reminderService: reminderService}
+}
+
+// @Summary Get upcoming reminders
+// @Description Get pending reminders for the authenticated user, soonest first
+// @Tags reminders
+// @Produce json
+// @Security ApiKeyAuth
+// @Param days query int false "Look-ahead window in days" default(7)
+// @Param limit query int false "Limit results" default(50)
+// @Success 200 {array} models.Reminder
+// @Router /notes/reminders [get]
+func (h *ReminderHandler) GetUpcomingReminders(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+
+	days := c.QueryInt("days", 7)
+	limit := c.QueryInt("limit", 50)
+	if days < 1 || days > 365 {
+		return c.Status(400).JSON(fiber.Map{"error": "days must be between 1 and 365"})
+	}
+	if limit < 1 || limit > 100 {
+		return c.Status(400).JSON(fiber.Map{"error": "limit must be between 1 and 100"})
+	}
+
+	reminders, err := h.reminderService.GetUpcomingReminders(userID, time.Duration(days)*24*time.Hour, limit)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(reminders)
+}
+
+// @Summary Create reminder
+// @Description Set a reminder on a note
+// @Tags reminders
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Note ID"
+// @Param request body validators.CreateReminderRequest true "Reminder data"
+// @Success 201 {object} models.Reminder
+// @Router /notes/{id}/reminder [post]
+func (h *ReminderHandler) CreateReminder(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	noteID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid note ID"})
+	}
+
+	var req validators.CreateReminderRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := validators.ValidateCreateReminderRequest(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	reminder, err := h.reminderService.CreateReminder(noteID, userID, &req)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(reminder)
+}
+
+// @Summary Get reminder
+// @Description Get the reminder set on a note
+// @Tags reminders
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Note ID"
+// @Success 200 {object} models.Reminder
+// @Router /notes/{id}/reminder [get]
+func (h *ReminderHandler) GetReminder(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	noteID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid note ID"})
+	}
+
+	reminder, err := h.reminderService.GetReminder(noteID, userID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(reminder)
+}
+
+// @Summary Update reminder
+// @Description Change the time, time zone or recurrence of a note's reminder
+// @Tags reminders
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Note ID"
+// @Param request body validators.UpdateReminderRequest true "Reminder data"
+// @Success 200 {object} models.Reminder
+// @Router /notes/{id}/reminder [put]
+func (h *ReminderHandler) UpdateReminder(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	noteID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid note ID"})
+	}
+
+	var req validators.UpdateReminderRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := validators.ValidateUpdateReminderRequest(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	reminder, err := h.reminderService.UpdateReminder(noteID, userID, &req)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(reminder)
+}
+
+// @Summary Delete reminder
+// @Description Remove the reminder from a note
+// @Tags reminders
+// @Security ApiKeyAuth
+// @Param id path string true "Note ID"
+// @Success 204
+// @Router /notes/{id}/reminder [delete]
+func (h *ReminderHandler) DeleteReminder(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	noteID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid note ID"})
+	}
+
+	if err := h.reminderService.DeleteReminder(noteID, userID); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.SendStatus(204)
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"google-keep-clone/internal/services"
+	"google-keep-clone/internal/validators"
+)
+
+type SyncHandler struct {
+	syncService *services.SyncService
+}
+
+func NewSyncHandler(syncService *services.SyncService) *SyncHandler {
+	return &SyncHandler{syncService: syncService}
+}
+
+// @Summary Sync changes
+// @Description Get the notes and labels created or updated after a change sequence, with tombstones for deleted ones. Pass the returned seq as since next time; keep asking while has_more is true. since=0 returns a full snapshot (full=true) that replaces the local cache, as does a since the server doesn't recognise. Label links, checklist items, attachments and sharing changes come back as changes to their note.
+// @Tags sync
+// @Produce json
+// @Security ApiKeyAuth
+// @Param since query int false "Sequence the client has synced up to" default(0)
+// @Param limit query int false "Changes per response, up to 1000" default(500)
+// @Success 200 {object} models.SyncResponse
+// @Router /sync [get]
+func (h *SyncHandler) GetChanges(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+
+	since, err := strconv.ParseInt(c.Query("since", "0"), 10, 64)
+	if err != nil || since < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "since must be a non-negative integer"})
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(services.DefaultSyncLimit)))
+	if err != nil || limit < 1 || limit > services.MaxSyncLimit {
+		return c.Status(400).JSON(fiber.Map{"error": "limit must be between 1 and " + strconv.Itoa(services.MaxSyncLimit)})
+	}
+
+	changes, err := h.syncService.Changes(userID, since, limit)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(changes)
+}
+
+// @Summary Push offline changes
+// @Description Apply a batch of note mutations queued while offline, in order. Each mutation gets its own result: accepted, conflict (the note changed since expected_version; note holds the server copy) or rejected (error says why).
+// @Tags sync
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body validators.PushRequest true "Queued mutations"
+// @Success 200 {object} models.PushResponse
+// @Router /sync/push [post]
+func (h *SyncHandler) Push(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+
+	var req validators.PushRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := validators.ValidatePushRequest(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(h.syncService.Push(userID, &req))
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"google-keep-clone/internal/services"
+	"google-keep-clone/internal/validators"
+)
+
+type ViewHandler struct {
+	viewService *services.ViewService
+}
+
+func NewViewHandler(viewService *services.ViewService) *ViewHandler {
+	return &ViewHandler{viewService: viewService}
+}
+
+// @Summary Get all views
+// @Description Get the authenticated user's saved searches, in display order
+// @Tags views
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} models.SavedSearch
+// @Router /views [get]
+func (h *ViewHandler) GetViews(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+
+	views, err := h.viewService.GetViews(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(views)
+}
+
+// @Summary Create view
+// @Description Save an advanced search as a view. Without a position it goes after the existing views.
+// @Tags views
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body validators.CreateViewRequest true "View data"
+// @Success 201 {object} models.SavedSearch
+// @Router /views [post]
+func (h *ViewHandler) CreateView(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+
+	var req validators.CreateViewRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := validators.ValidateCreateViewRequest(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	view, err := h.viewService.CreateView(userID, &req)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(view)
+}
+
+// @Summary Get view counts
+// @Description Count the notes every saved view currently matches, in one call
+// @Tags views
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} models.SavedSearchCount
+// @Router /views/counts [get]
+func (h *ViewHandler) GetViewCounts(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+
+	counts, err := h.viewService.GetViewCounts(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(counts)
+}
+
+// @Summary Get view by ID
+// @Description Get a specific saved search by ID
+// @Tags views
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "View ID"
+// @Success 200 {object} models.SavedSearch
+// @Router /views/{id} [get]
+func (h *ViewHandler) GetViewByID(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	viewID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid view ID"})
+	}
+
+	view, err := h.viewService.GetView(viewID, userID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(view)
+}
+
+// @Summary Update view
+// @Description Rename, refilter, restyle or move a saved search
+// @Tags views
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "View ID"
+// @Param request body validators.UpdateViewRequest true "View data"
+// @Success 200 {object} models.SavedSearch
+// @Router /views/{id} [put]
+func (h *ViewHandler) UpdateView(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	viewID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid view ID"})
+	}
+
+	var req validators.UpdateViewRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := validators.ValidateUpdateViewRequest(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	view, err := h.viewService.UpdateView(viewID, userID, &req)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(view)
+}
+
+// @Summary Delete view
+// @Description Delete a saved search
+// @Tags views
+// @Security ApiKeyAuth
+// @Param id path string true "View ID"
+// @Success 204
+// @Router /views/{id} [delete]
+func (h *ViewHandler) DeleteView(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	viewID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid view ID"})
+	}
+
+	if err := h.viewService.DeleteView(viewID, userID); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.SendStatus(204)
+}
+
+// @Summary Get view notes
+// @Description Run a saved search and return the notes it matches
+// @Tags views
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "View ID"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param limit query int false "Page size, up to 200" default(50)
+// @Param sort query string false "Sort field (updated_at, created_at, title or position)"
+// @Param order query string false "Sort direction (asc or desc), defaults to newest first for dates and ascending otherwise"
+// @Param with_total query bool false "Include the total number of notes" default(false)
+// @Success 200 {object} models.NotePage
+// @Router /views/{id}/notes [get]
+func (h *ViewHandler) GetViewNotes(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	viewID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid view ID"})
+	}
+
+	req, err := listNotesRequest(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	notes, err := h.viewService.GetViewNotes(viewID, userID, req)
+	if err != nil {
+		if errors.Is(err, services.ErrViewNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(listNotesStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(notes)
+}
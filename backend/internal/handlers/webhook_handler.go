@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"google-keep-clone/internal/services"
+	"google-keep-clone/internal/validators"
+)
+
+type WebhookHandler struct {
+	webhookService *services.WebhookService
+}
+
+func NewWebhookHandler(webhookService *services.WebhookService) *WebhookHandler {
+	return &WebhookHandler{webhookService: webhookService}
+}
+
+// @Summary Get all webhooks
+// @Description Get the authenticated user's webhooks. Secrets are left out.
+// @Tags webhooks
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} models.Webhook
+// @Router /webhooks [get]
+func (h *WebhookHandler) GetWebhooks(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+
+	webhooks, err := h.webhookService.GetWebhooks(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(webhooks)
+}
+
+// @Summary Create webhook
+// @Description Register an endpoint to be sent events such as note.created or label.deleted, or "*" for all of them. Each delivery is a JSON POST signed in the X-Keep-Signature header: "sha256=" and the hex HMAC-SHA256, keyed with the webhook's secret, of the X-Keep-Timestamp header, a dot and the body. The secret is only returned here and when rotated.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body validators.CreateWebhookRequest true "Webhook data"
+// @Success 201 {object} models.Webhook
+// @Router /webhooks [post]
+func (h *WebhookHandler) CreateWebhook(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+
+	var req validators.CreateWebhookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := validators.ValidateCreateWebhookRequest(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	webhook, err := h.webhookService.CreateWebhook(userID, &req)
+	if err != nil {
+		return webhookError(c, err)
+	}
+
+	return c.Status(201).JSON(webhook)
+}
+
+// @Summary Get webhook by ID
+// @Description Get a specific webhook by ID
+// @Tags webhooks
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Webhook ID"
+// @Success 200 {object} models.Webhook
+// @Router /webhooks/{id} [get]
+func (h *WebhookHandler) GetWebhookByID(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	webhookID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid webhook ID"})
+	}
+
+	webhook, err := h.webhookService.GetWebhook(webhookID, userID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(webhook)
+}
+
+// @Summary Update webhook
+// @Description Change a webhook's URL, description or events, or pause and resume it. Deliveries due while it is paused fail.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Webhook ID"
+// @Param request body validators.UpdateWebhookRequest true "Webhook data"
+// @Success 200 {object} models.Webhook
+// @Router /webhooks/{id} [put]
+func (h *WebhookHandler) UpdateWebhook(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	webhookID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid webhook ID"})
+	}
+
+	var req validators.UpdateWebhookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := validators.ValidateUpdateWebhookRequest(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	webhook, err := h.webhookService.UpdateWebhook(webhookID, userID, &req)
+	if err != nil {
+		return webhookError(c, err)
+	}
+
+	return c.JSON(webhook)
+}
+
+// @Summary Rotate webhook secret
+// @Description Give a webhook a new signing secret, returned in the response. The old one stops being used straight away.
+// @Tags webhooks
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Webhook ID"
+// @Success 200 {object} models.Webhook
+// @Router /webhooks/{id}/secret [post]
+func (h *WebhookHandler) RotateSecret(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	webhookID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid webhook ID"})
+	}
+
+	webhook, err := h.webhookService.RotateSecret(webhookID, userID)
+	if err != nil {
+		return webhookError(c, err)
+	}
+
+	return c.JSON(webhook)
+}
+
+// @Summary Delete webhook
+// @Description Delete a webhook along with its delivery log
+// @Tags webhooks
+// @Security ApiKeyAuth
+// @Param id path string true "Webhook ID"
+// @Success 204
+// @Router /webhooks/{id} [delete]
+func (h *WebhookHandler) DeleteWebhook(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	webhookID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid webhook ID"})
+	}
+
+	if err := h.webhookService.DeleteWebhook(webhookID, userID); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.SendStatus(204)
+}
+
+// @Summary Get webhook deliveries
+// @Description Get the webhook's 50 most recent deliveries, newest first
+// @Tags webhooks
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Webhook ID"
+// @Success 200 {array} models.WebhookDelivery
+// @Router /webhooks/{id}/deliveries [get]
+func (h *WebhookHandler) GetDeliveries(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	webhookID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid webhook ID"})
+	}
+
+	deliveries, err := h.webhookService.GetDeliveries(webhookID, userID)
+	if err != nil {
+		return webhookError(c, err)
+	}
+
+	return c.JSON(deliveries)
+}
+
+// @Summary Get webhook delivery
+// @Description Get a delivery with every attempt made at it: status code, start of the response and any error
+// @Tags webhooks
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Webhook ID"
+// @Param delivery_id path string true "Delivery ID"
+// @Success 200 {object} models.WebhookDelivery
+// @Router /webhooks/{id}/deliveries/{delivery_id} [get]
+func (h *WebhookHandler) GetDelivery(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	webhookID, deliveryID, err := parseDeliveryParams(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	delivery, err := h.webhookService.GetDelivery(webhookID, deliveryID, userID)
+	if err != nil {
+		return webhookError(c, err)
+	}
+
+	return c.JSON(delivery)
+}
+
+// @Summary Replay webhook delivery
+// @Description Send a delivery again with the same body and delivery ID, whether it succeeded or failed. It gets a fresh set of retries.
+// @Tags webhooks
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Webhook ID"
+// @Param delivery_id path string true "Delivery ID"
+// @Success 202 {object} models.WebhookDelivery
+// @Router /webhooks/{id}/deliveries/{delivery_id}/replay [post]
+func (h *WebhookHandler) ReplayDelivery(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(c.Locals("userID").(string))
+	webhookID, deliveryID, err := parseDeliveryParams(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	delivery, err := h.webhookService.ReplayDelivery(webhookID, deliveryID, userID)
+	if err != nil {
+		return webhookError(c, err)
+	}
+
+	return c.Status(202).JSON(delivery)
+}
+
+func parseDeliveryParams(c *fiber.Ctx) (uuid.UUID, uuid.UUID, error) {
+	webhookID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, errors.New("Invalid webhook ID")
+	}
+	deliveryID, err := uuid.Parse(c.Params("delivery_id"))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, errors.New("Invalid delivery ID")
+	}
+	return webhookID, deliveryID, nil
+}
+
+func webhookError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, services.ErrWebhookNotFound) || errors.Is(err, services.ErrDeliveryNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors.Is(err, services.ErrWebhookTarget) {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+}
@@ -0,0 +1,208 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+// EXIF tags we care about
+const (
+	tagOrientation      = 0x0112
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagDateTimeOriginal = 0x9003
+)
+
+// Metadata holds what we read from an image's EXIF block
+type Metadata struct {
+	Orientation int
+	TakenAt     *time.Time
+	HasGPS      bool
+}
+
+// exifBlock locates the TIFF structure inside a JPEG's APP1 segment
+type exifBlock struct {
+	data  []byte // the TIFF header and everything after it
+	order binary.ByteOrder
+}
+
+// findExif walks the JPEG markers up to the image data and returns the
+// EXIF block, if any
+func findExif(jpeg []byte) (*exifBlock, bool) {
+	if len(jpeg) < 4 || jpeg[0] != 0xFF || jpeg[1] != 0xD8 {
+		return nil, false
+	}
+
+	for i := 2; i+4 <= len(jpeg); {
+		if jpeg[i] != 0xFF {
+			return nil, false
+		}
+		marker := jpeg[i+1]
+		if marker == 0xFF {
+			i++
+			continue
+		}
+		// Start of scan or end of image: no more metadata segments
+		if marker == 0xDA || marker == 0xD9 {
+			return nil, false
+		}
+
+		length := int(binary.BigEndian.Uint16(jpeg[i+2:]))
+		if length < 2 || i+2+length > len(jpeg) {
+			return nil, false
+		}
+		segment := jpeg[i+4 : i+2+length]
+
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			tiff := segment[6:]
+			if len(tiff) < 8 {
+				return nil, false
+			}
+			var order binary.ByteOrder
+			switch string(tiff[:2]) {
+			case "II":
+				order = binary.LittleEndian
+			case "MM":
+				order = binary.BigEndian
+			default:
+				return nil, false
+			}
+			if order.Uint16(tiff[2:]) != 42 {
+				return nil, false
+			}
+			return &exifBlock{data: tiff, order: order}, true
+		}
+
+		i += 2 + length
+	}
+
+	return nil, false
+}
+
+type ifdEntry struct {
+	pos   int // offset of the 12-byte entry within the TIFF data
+	tag   uint16
+	typ   uint16
+	count uint32
+}
+
+// valueSize returns the byte size of the entry's value
+func (e ifdEntry) valueSize() int {
+	sizes := map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+	return sizes[e.typ] * int(e.count)
+}
+
+// valueOffset returns where the entry's value lives; values of four bytes
+// or less are stored in the entry itself
+func (b *exifBlock) valueOffset(e ifdEntry) int {
+	if e.valueSize() <= 4 {
+		return e.pos + 8
+	}
+	return int(b.order.Uint32(b.data[e.pos+8:]))
+}
+
+func (b *exifBlock) entries(offset int) []ifdEntry {
+	if offset <= 0 || offset+2 > len(b.data) {
+		return nil
+	}
+	count := int(b.order.Uint16(b.data[offset:]))
+	var entries []ifdEntry
+	for i := 0; i < count; i++ {
+		pos := offset + 2 + i*12
+		if pos+12 > len(b.data) {
+			break
+		}
+		entries = append(entries, ifdEntry{
+			pos:   pos,
+			tag:   b.order.Uint16(b.data[pos:]),
+			typ:   b.order.Uint16(b.data[pos+2:]),
+			count: b.order.Uint32(b.data[pos+4:]),
+		})
+	}
+	return entries
+}
+
+func (b *exifBlock) firstIFD() int {
+	return int(b.order.Uint32(b.data[4:]))
+}
+
+// ReadMetadata extracts orientation, capture time and whether GPS data is
+// present from a JPEG. Images without EXIF report orientation 1.
+func ReadMetadata(jpeg []byte) Metadata {
+	meta := Metadata{Orientation: 1}
+
+	block, ok := findExif(jpeg)
+	if !ok {
+		return meta
+	}
+
+	exifIFD := 0
+	for _, e := range block.entries(block.firstIFD()) {
+		switch e.tag {
+		case tagOrientation:
+			if e.typ == 3 && e.count == 1 {
+				if o := int(block.order.Uint16(block.data[e.pos+8:])); o >= 1 && o <= 8 {
+					meta.Orientation = o
+				}
+			}
+		case tagExifIFD:
+			exifIFD = int(block.order.Uint32(block.data[e.pos+8:]))
+		case tagGPSIFD:
+			meta.HasGPS = len(block.entries(int(block.order.Uint32(block.data[e.pos+8:])))) > 0
+		}
+	}
+
+	for _, e := range block.entries(exifIFD) {
+		if e.tag != tagDateTimeOriginal || e.typ != 2 {
+			continue
+		}
+		start := block.valueOffset(e)
+		end := start + int(e.count)
+		if start < 0 || end > len(block.data) {
+			continue
+		}
+		raw := string(bytes.TrimRight(block.data[start:end], "\x00 "))
+		if takenAt, err := time.Parse("2006:01:02 15:04:05", raw); err == nil {
+			meta.TakenAt = &takenAt
+		}
+	}
+
+	return meta
+}
+
+// StripGPS blanks out the GPS block of a JPEG's EXIF data in place and
+// reports whether anything was removed. Editing in place keeps every other
+// offset in the file valid, so the rest of the metadata survives.
+func StripGPS(jpeg []byte) bool {
+	block, ok := findExif(jpeg)
+	if !ok {
+		return false
+	}
+
+	gpsIFD := 0
+	for _, e := range block.entries(block.firstIFD()) {
+		if e.tag == tagGPSIFD {
+			gpsIFD = int(block.order.Uint32(block.data[e.pos+8:]))
+		}
+	}
+	if len(block.entries(gpsIFD)) == 0 {
+		return false
+	}
+
+	for _, e := range block.entries(gpsIFD) {
+		start := block.valueOffset(e)
+		end := start + e.valueSize()
+		if start >= 0 && end <= len(block.data) {
+			clear(block.data[start:end])
+		}
+		clear(block.data[e.pos : e.pos+12])
+	}
+	// Leave an empty IFD behind; the zeroed first entry doubles as its
+	// "no next IFD" offset
+	if gpsIFD > 0 && gpsIFD+2 <= len(block.data) {
+		clear(block.data[gpsIFD : gpsIFD+2])
+	}
+
+	return true
+}
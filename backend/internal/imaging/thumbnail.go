@@ -0,0 +1,213 @@
+// Package imaging decodes uploaded images and renders their thumbnails.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// MaxPixels bounds the images we are willing to decode, so a small file
+// declaring huge dimensions can't exhaust memory
+const MaxPixels = 50_000_000
+
+var ErrTooLarge = errors.New("image dimensions too large")
+
+// Size is a named thumbnail bounding box
+type Size struct {
+	Name string
+	Max  int
+}
+
+var Sizes = []Size{
+	{Name: "small", Max: 128},
+	{Name: "medium", Max: 512},
+	{Name: "large", Max: 1024},
+}
+
+// Thumbnail is an encoded thumbnail image
+type Thumbnail struct {
+	Size     Size
+	Data     []byte
+	MimeType string
+}
+
+// Result holds an image's metadata and its rendered thumbnails
+type Result struct {
+	Width      int
+	Height     int
+	Metadata   Metadata
+	Thumbnails []Thumbnail
+}
+
+// Supported reports whether we can decode images of the given type
+func Supported(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+func decoder(mimeType string) (func(r *bytes.Reader) (image.Image, error), func(r *bytes.Reader) (image.Config, error)) {
+	switch mimeType {
+	case "image/jpeg":
+		return func(r *bytes.Reader) (image.Image, error) { return jpeg.Decode(r) },
+			func(r *bytes.Reader) (image.Config, error) { return jpeg.DecodeConfig(r) }
+	case "image/png":
+		return func(r *bytes.Reader) (image.Image, error) { return png.Decode(r) },
+			func(r *bytes.Reader) (image.Config, error) { return png.DecodeConfig(r) }
+	case "image/gif":
+		// Only the first frame of an animation is used
+		return func(r *bytes.Reader) (image.Image, error) { return gif.Decode(r) },
+			func(r *bytes.Reader) (image.Config, error) { return gif.DecodeConfig(r) }
+	case "image/webp":
+		return func(r *bytes.Reader) (image.Image, error) { return webp.Decode(r) },
+			func(r *bytes.Reader) (image.Config, error) { return webp.DecodeConfig(r) }
+	}
+	return nil, nil
+}
+
+// Process decodes an image, corrects its EXIF orientation and renders a
+// thumbnail for each size. Thumbnails never carry metadata, so location
+// data can't leak through them.
+func Process(data []byte, mimeType string) (*Result, error) {
+	decode, decodeConfig := decoder(mimeType)
+	if decode == nil {
+		return nil, errors.New("unsupported image type")
+	}
+
+	config, err := decodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, errors.New("invalid image dimensions")
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	src, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	meta := Metadata{Orientation: 1}
+	if mimeType == "image/jpeg" {
+		meta = ReadMetadata(data)
+	}
+
+	result := &Result{Width: config.Width, Height: config.Height, Metadata: meta}
+	if swapsAxes(meta.Orientation) {
+		result.Width, result.Height = result.Height, result.Width
+	}
+
+	// Every size uses the same format so clients can rely on one type
+	opaque := true
+	if o, ok := src.(interface{ Opaque() bool }); ok {
+		opaque = o.Opaque()
+	}
+
+	for _, size := range Sizes {
+		thumb, err := render(src, size, meta.Orientation, opaque)
+		if err != nil {
+			return nil, err
+		}
+		result.Thumbnails = append(result.Thumbnails, *thumb)
+	}
+
+	return result, nil
+}
+
+func render(src image.Image, size Size, orientation int, opaque bool) (*Thumbnail, error) {
+	bounds := src.Bounds()
+	w, h := fit(bounds.Dx(), bounds.Dy(), size.Max)
+
+	scaled := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), src, bounds, draw.Src, nil)
+	oriented := orient(scaled, orientation)
+
+	var buf bytes.Buffer
+	if opaque {
+		if err := jpeg.Encode(&buf, oriented, &jpeg.Options{Quality: 82}); err != nil {
+			return nil, err
+		}
+		return &Thumbnail{Size: size, Data: buf.Bytes(), MimeType: "image/jpeg"}, nil
+	}
+
+	if err := png.Encode(&buf, oriented); err != nil {
+		return nil, err
+	}
+	return &Thumbnail{Size: size, Data: buf.Bytes(), MimeType: "image/png"}, nil
+}
+
+// fit scales w x h down to fit in a max x max box, never scaling up
+func fit(w, h, max int) (int, int) {
+	if w <= max && h <= max {
+		return w, h
+	}
+	if w >= h {
+		return max, clampMin(h * max / w)
+	}
+	return clampMin(w * max / h), max
+}
+
+func clampMin(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// swapsAxes reports whether an EXIF orientation rotates the image by 90°
+func swapsAxes(orientation int) bool {
+	return orientation >= 5 && orientation <= 8
+}
+
+// orient applies an EXIF orientation so the image displays upright
+func orient(src *image.NRGBA, orientation int) *image.NRGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if swapsAxes(orientation) {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // mirrored along the top-left diagonal
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise to display
+				dx, dy = h-1-y, x
+			case 7: // mirrored along the top-right diagonal
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90° counter-clockwise to display
+				dx, dy = y, w-1-x
+			}
+			si := src.PixOffset(x, y)
+			di := dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,179 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// smtpServer is just enough of an SMTP server to take one message
+type smtpServer struct {
+	listener net.Listener
+	from, to string
+	data     chan []byte
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &smtpServer{listener: listener, data: make(chan []byte, 1)}
+	go s.serve()
+	return s
+}
+
+func (s *smtpServer) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	text := textproto.NewConn(conn)
+	defer text.Close()
+
+	_ = text.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(command) {
+		case "EHLO", "HELO":
+			_ = text.PrintfLine("250 localhost")
+		case "MAIL":
+			s.from = arg
+			_ = text.PrintfLine("250 OK")
+		case "RCPT":
+			s.to = arg
+			_ = text.PrintfLine("250 OK")
+		case "DATA":
+			_ = text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.data <- data
+			_ = text.PrintfLine("250 OK")
+		case "QUIT":
+			_ = text.PrintfLine("221 Bye")
+			return
+		default:
+			_ = text.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	server := newSMTPServer(t)
+	_, port, _ := net.SplitHostPort(server.listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+
+	mailer, err := NewSMTPMailer(SMTPConfig{Host: "127.0.0.1", Port: portNumber, From: "Keep <no-reply@keep.example>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &Message{
+		To:      "Ada <ada@example.com>",
+		Subject: "Vérifiez votre adresse",
+		Text:    "Bonjour Ada,\n.\nOpen " + strings.Repeat("x", 100) + " to verify.",
+		HTML:    `<p>Bonjour Ada, <a href="https://keep.example/verify?token=a=b">verify</a></p>`,
+	}
+	if err := mailer.Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	data := <-server.data
+	message, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The long line of the text is wrapped with soft line breaks, which
+	// arrive with bare newlines from ReadDotBytes
+	if !bytes.Contains(data, []byte("=\n")) {
+		t.Error("text part is not quoted-printable encoded")
+	}
+
+	if server.from != "FROM:<no-reply@keep.example>" || server.to != "TO:<ada@example.com>" {
+		t.Errorf("envelope %s %s; want the bare sender and recipient addresses", server.from, server.to)
+	}
+
+	subject := message.Header.Get("Subject")
+	if !strings.HasPrefix(subject, "=?utf-8?q?") {
+		t.Errorf("Subject %q is not Q-encoded", subject)
+	}
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(subject); err != nil || decoded != msg.Subject {
+		t.Errorf("Subject decodes to %q (%v); want %q", decoded, err, msg.Subject)
+	}
+	if got := message.Header.Get("To"); got != msg.To {
+		t.Errorf("To = %q; want %q", got, msg.To)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type %q; want multipart/alternative", message.Header.Get("Content-Type"))
+	}
+	parts := multipart.NewReader(message.Body, params["boundary"])
+	for _, want := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatalf("reading the %s part: %v", want.contentType, err)
+		}
+		if got := part.Header.Get("Content-Type"); got != want.contentType {
+			t.Errorf("part Content-Type %q; want %q", got, want.contentType)
+		}
+		// The reader decodes quoted-printable parts itself
+		content, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != want.content {
+			t.Errorf("%s part = %q; want %q", want.contentType, content, want.content)
+		}
+	}
+	if _, err := parts.NextPart(); err != io.EOF {
+		t.Errorf("more than two parts: %v", err)
+	}
+}
+
+func TestBuildRefusesHeaderInjection(t *testing.T) {
+	for _, msg := range []*Message{
+		{To: "ada@example.com\r\nBcc: eve@example.com", Subject: "Hello"},
+		{To: "ada@example.com\nBcc: eve@example.com", Subject: "Hello"},
+	} {
+		if _, err := build("no-reply@keep.example", msg); err == nil {
+			t.Errorf("built a message to %q", msg.To)
+		}
+	}
+
+	// A line break in the subject is encoded rather than starting a header
+	data, err := build("no-reply@keep.example", &Message{To: "ada@example.com", Subject: "Hello\r\nBcc: eve@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bcc := message.Header.Get("Bcc"); bcc != "" {
+		t.Errorf("subject smuggled in Bcc: %s", bcc)
+	}
+	if _, err := build("no-reply@keep.example\r\nBcc: eve@example.com", &Message{To: "ada@example.com"}); err == nil {
+		t.Error("built a message from a sender with a line break")
+	}
+}
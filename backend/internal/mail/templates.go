@@ -0,0 +1,87 @@
+package mail
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Template is an email with a subject and text and HTML bodies rendered
+// from the same data
+type Template struct {
+	subject string
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// LinkData is what the templates with a call to action are rendered with
+type LinkData struct {
+	Name    string // the recipient's name
+	Link    string
+	Expires string // how long the link works for, e.g. "1 hour"
+}
+
+const layout = `<!DOCTYPE html>
+<html>
+<body style="margin:0;padding:24px;background:#f1f3f4;font-family:Arial,Helvetica,sans-serif;color:#202124">
+<div style="max-width:480px;margin:0 auto;padding:24px;background:#ffffff;border-radius:8px">
+{{template "content" .}}
+<p style="margin-top:32px;font-size:12px;color:#5f6368">If you didn't ask for this email, you can ignore it.</p>
+</div>
+</body>
+</html>`
+
+const buttonStyle = `display:inline-block;padding:10px 24px;background:#fbbc04;color:#202124;border-radius:4px;text-decoration:none;font-weight:bold`
+
+var (
+	VerifyEmail = mustTemplate("Verify your email address", `Hi {{.Name}},
+
+Please confirm this is your email address by opening the link below:
+
+{{.Link}}
+
+The link works for {{.Expires}}.`, `<p>Hi {{.Name}},</p>
+<p>Please confirm this is your email address.</p>
+<p><a href="{{.Link}}" style="`+buttonStyle+`">Verify email</a></p>
+<p>The link works for {{.Expires}}.</p>`)
+
+	ResetPassword = mustTemplate("Reset your password", `Hi {{.Name}},
+
+Someone asked to reset the password of your account. To choose a new one, open the link below:
+
+{{.Link}}
+
+The link works for {{.Expires}} and can only be used once. Resetting your password signs you out on every device.`, `<p>Hi {{.Name}},</p>
+<p>Someone asked to reset the password of your account. To choose a new one, use the button below.</p>
+<p><a href="{{.Link}}" style="`+buttonStyle+`">Reset password</a></p>
+<p>The link works for {{.Expires}} and can only be used once. Resetting your password signs you out on every device.</p>`)
+)
+
+func mustTemplate(subject, text, html string) *Template {
+	page := htmltemplate.Must(htmltemplate.New("layout").Parse(layout))
+	htmltemplate.Must(page.New("content").Parse(html))
+	return &Template{
+		subject: subject,
+		text:    texttemplate.Must(texttemplate.New("text").Parse(text)),
+		html:    page,
+	}
+}
+
+// Render fills the template in for a message to to
+func (t *Template) Render(to string, data interface{}) (*Message, error) {
+	var text, html bytes.Buffer
+	if err := t.text.Execute(&text, data); err != nil {
+		return nil, err
+	}
+	if err := t.html.ExecuteTemplate(&html, "layout", data); err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		To:      to,
+		Subject: t.subject,
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    html.String(),
+	}, nil
+}
@@ -31,8 +31,8 @@ func AuthMiddleware(authService *services.AuthService) fiber.Handler {
 			})
 		}
 
-		// Validate token
-		claims, err := authService.ValidateToken(token)
+		// Validate token and check its session hasn't been revoked
+		claims, err := authService.Authenticate(token, c.IP())
 		if err != nil {
 			return c.Status(401).JSON(fiber.Map{
 				"error": "Invalid or expired token",
@@ -42,6 +42,7 @@ func AuthMiddleware(authService *services.AuthService) fiber.Handler {
 		// Set user info in context
 		c.Locals("userID", claims.UserID)
 		c.Locals("email", claims.Email)
+		c.Locals("sessionID", claims.SessionID)
 
 		return c.Next()
 	}
@@ -67,7 +68,7 @@ func OptionalAuthMiddleware(authService *services.AuthService) fiber.Handler {
 		}
 
 		// Validate token
-		claims, err := authService.ValidateToken(token)
+		claims, err := authService.Authenticate(token, c.IP())
 		if err != nil {
 			return c.Next()
 		}
@@ -75,6 +76,7 @@ func OptionalAuthMiddleware(authService *services.AuthService) fiber.Handler {
 		// Set user info in context if valid
 		c.Locals("userID", claims.UserID)
 		c.Locals("email", claims.Email)
+		c.Locals("sessionID", claims.SessionID)
 
 		return c.Next()
 	}
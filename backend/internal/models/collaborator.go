@@ -0,0 +1,22 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+)
+
+type NoteCollaborator struct {
+	NoteID    uuid.UUID `json:"note_id" gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;primaryKey;index"`
+	Role      string    `json:"role" gorm:"not null;default:'viewer'"`
+	InvitedBy uuid.UUID `json:"invited_by" gorm:"type:uuid"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
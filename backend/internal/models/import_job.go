@@ -0,0 +1,65 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+type ImportJob struct {
+	ID         uuid.UUID        `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID     uuid.UUID        `json:"user_id" gorm:"type:uuid;not null;index"`
+	Source     string           `json:"source" gorm:"not null"`
+	Filename   string           `json:"filename"`
+	Status     string           `json:"status" gorm:"not null;index"`
+	Total      int              `json:"total"`
+	Processed  int              `json:"processed"`
+	Imported   int              `json:"imported"`
+	Skipped    int              `json:"skipped"` // already imported by an earlier run
+	Failed     int              `json:"failed"`
+	Errors     ImportItemErrors `json:"errors" gorm:"type:jsonb"`
+	Error      string           `json:"error,omitempty"` // why the job as a whole failed
+	StartedAt  *time.Time       `json:"started_at,omitempty"`
+	FinishedAt *time.Time       `json:"finished_at,omitempty"`
+	CreatedAt  time.Time        `json:"created_at"`
+	UpdatedAt  time.Time        `json:"updated_at"`
+}
+
+// ImportItemErrors lists the archive entries that could not be imported
+type ImportItemErrors []ImportItemError
+
+type ImportItemError struct {
+	Item  string `json:"item"`
+	Error string `json:"error"`
+}
+
+func (e ImportItemErrors) Value() (driver.Value, error) {
+	if e == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(e)
+	return string(data), err
+}
+
+func (e *ImportItemErrors) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*e = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, e)
+	case string:
+		return json.Unmarshal([]byte(v), e)
+	default:
+		return errors.New("unsupported type for ImportItemErrors")
+	}
+}
@@ -7,22 +7,40 @@ import (
 )
 
 type Note struct {
-	ID         uuid.UUID      `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	UserID     uuid.UUID      `json:"user_id" gorm:"type:uuid;not null;index"`
-	Title      string         `json:"title"`
-	Content    string         `json:"content" gorm:"type:text"`
-	Color      string         `json:"color" gorm:"default:'#ffffff'"`
-	IsPinned   bool           `json:"is_pinned" gorm:"default:false"`
-	IsArchived bool           `json:"is_archived" gorm:"default:false"`
-	IsDeleted  bool           `json:"is_deleted" gorm:"default:false"`
-	Position   int            `json:"position" gorm:"default:0"`
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
-	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
-
-	User        User         `json:"user,omitempty" gorm:"foreignKey:UserID"`
-	Labels      []Label      `json:"labels,omitempty" gorm:"many2many:note_labels;"`
-	Attachments []Attachment `json:"attachments,omitempty" gorm:"foreignKey:NoteID"`
+	ID                  uuid.UUID      `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID              uuid.UUID      `json:"user_id" gorm:"type:uuid;not null;index;uniqueIndex:idx_notes_user_import"`
+	Title               string         `json:"title"`
+	Content             string         `json:"content" gorm:"type:text"`
+	Color               string         `json:"color" gorm:"default:'#ffffff'"`
+	IsPinned            bool           `json:"is_pinned" gorm:"default:false"`
+	IsArchived          bool           `json:"is_archived" gorm:"default:false"`
+	IsDeleted           bool           `json:"is_deleted" gorm:"default:false"`
+	TrashedAt           *time.Time     `json:"trashed_at,omitempty" gorm:"index"`
+	Position            int            `json:"position" gorm:"default:0"`
+	MoveCheckedToBottom bool           `json:"move_checked_to_bottom" gorm:"default:false"`
+	Version             int64          `json:"version" gorm:"not null;default:1"`          // goes up with every change; see repositories.MigrateSync
+	ImportKey           *string        `json:"-" gorm:"uniqueIndex:idx_notes_user_import"` // identifies notes brought in by an importer
+	CreatedAt           time.Time      `json:"created_at"`
+	UpdatedAt           time.Time      `json:"updated_at"`
+	DeletedAt           gorm.DeletedAt `json:"-" gorm:"index"`
+
+	User          User               `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Labels        []Label            `json:"labels,omitempty" gorm:"many2many:note_labels;"`
+	Attachments   []Attachment       `json:"attachments,omitempty" gorm:"foreignKey:NoteID"`
+	Items         []ChecklistItem    `json:"items,omitempty" gorm:"foreignKey:NoteID"`
+	Reminder      *Reminder          `json:"reminder,omitempty" gorm:"foreignKey:NoteID"`
+	Collaborators []NoteCollaborator `json:"collaborators,omitempty" gorm:"foreignKey:NoteID"`
+}
+
+type ChecklistItem struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	NoteID    uuid.UUID  `json:"note_id" gorm:"type:uuid;not null;index"`
+	ParentID  *uuid.UUID `json:"parent_id,omitempty" gorm:"type:uuid;index"`
+	Text      string     `json:"text" gorm:"type:text"`
+	IsChecked bool       `json:"is_checked" gorm:"default:false"`
+	Position  int        `json:"position" gorm:"default:0"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
 }
 
 type Label struct {
@@ -36,14 +54,53 @@ type Label struct {
 	Notes []Note `json:"notes,omitempty" gorm:"many2many:note_labels;"`
 }
 
+const (
+	ThumbnailPending = "pending"
+	ThumbnailReady   = "ready"
+	ThumbnailFailed  = "failed"
+)
+
 type Attachment struct {
-	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	NoteID    uuid.UUID `json:"note_id" gorm:"type:uuid;not null;index"`
-	Filename  string    `json:"filename" gorm:"not null"`
-	URL       string    `json:"url" gorm:"not null"`
-	Size      int64     `json:"size"`
-	MimeType  string    `json:"mime_type"`
-	CreatedAt time.Time `json:"created_at"`
+	ID                uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	NoteID            uuid.UUID  `json:"note_id" gorm:"type:uuid;not null;index"`
+	UserID            uuid.UUID  `json:"user_id" gorm:"type:uuid;index"` // uploader, charged against their quota
+	Filename          string     `json:"filename" gorm:"not null"`
+	URL               string     `json:"url" gorm:"not null"`
+	Size              int64      `json:"size"`
+	MimeType          string     `json:"mime_type"`
+	SHA256            string     `json:"sha256" gorm:"index"`
+	StorageKey        string     `json:"-"`
+	Width             int        `json:"width,omitempty"`
+	Height            int        `json:"height,omitempty"`
+	TakenAt           *time.Time `json:"taken_at,omitempty"`
+	ThumbnailStatus   string     `json:"thumbnail_status,omitempty" gorm:"index"`
+	ThumbnailMimeType string     `json:"-"`
+	// Failed thumbnail runs so far, and when the next may start
+	ThumbnailAttempts      int        `json:"-" gorm:"not null;default:0"`
+	ThumbnailNextAttemptAt *time.Time `json:"-" gorm:"index"`
+	CreatedAt              time.Time  `json:"created_at"`
+
+	ThumbnailURL map[string]string `json:"thumbnail_url,omitempty" gorm:"-"`
 
 	Note Note `json:"note,omitempty" gorm:"foreignKey:NoteID"`
 }
+
+// ThumbnailSizes lists the thumbnail variants rendered for images
+var ThumbnailSizes = []string{"small", "medium", "large"}
+
+// SetThumbnailURLs fills in the thumbnail variant URLs once they exist
+func (a *Attachment) SetThumbnailURLs() {
+	if a.ThumbnailStatus != ThumbnailReady {
+		a.ThumbnailURL = nil
+		return
+	}
+	a.ThumbnailURL = make(map[string]string, len(ThumbnailSizes))
+	for _, size := range ThumbnailSizes {
+		a.ThumbnailURL[size] = "/attachments/" + a.ID.String() + "/thumbnails/" + size
+	}
+}
+
+func (a *Attachment) AfterFind(tx *gorm.DB) error {
+	a.SetThumbnailURLs()
+	return nil
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+// OutboxEvent is a domain event, written in the same transaction as the
+// change it describes and kept until every subscriber has handled it
+type OutboxEvent struct {
+	ID            int64      `json:"id" gorm:"primaryKey;autoIncrement"`
+	Type          string     `json:"type" gorm:"not null"`
+	ActorID       uuid.UUID  `json:"actor_id" gorm:"type:uuid;not null"`
+	Audience      UUIDList   `json:"audience" gorm:"type:jsonb;not null"` // users the event concerns
+	Payload       string     `json:"payload" gorm:"type:jsonb;not null"`
+	Delivered     StringList `json:"delivered" gorm:"type:jsonb"` // subscribers that have handled it
+	Attempts      int        `json:"attempts" gorm:"not null;default:0"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"not null;index"`
+	DispatchedAt  *time.Time `json:"dispatched_at,omitempty" gorm:"index"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// UUIDList is a list of IDs stored as a JSON array
+type UUIDList []uuid.UUID
+
+func (l UUIDList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(l)
+	return string(data), err
+}
+
+func (l *UUIDList) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, l)
+	case string:
+		return json.Unmarshal([]byte(v), l)
+	default:
+		return errors.New("unsupported type for UUIDList")
+	}
+}
+
+// StringList is a list of strings stored as a JSON array
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(l)
+	return string(data), err
+}
+
+func (l *StringList) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, l)
+	case string:
+		return json.Unmarshal([]byte(v), l)
+	default:
+		return errors.New("unsupported type for StringList")
+	}
+}
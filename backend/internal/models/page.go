@@ -0,0 +1,10 @@
+package models
+
+// NotePage is one page of a note listing. NextCursor fetches the page after
+// it and is empty on the last page. Total counts every note in the listing
+// and is only filled in when asked for.
+type NotePage struct {
+	Notes      []Note `json:"notes"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      *int64 `json:"total,omitempty"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// RecoveryCode signs a user with two-factor authentication in once,
+// in place of a code from their authenticator app. Only its hash is
+// stored.
+type RecoveryCode struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	CodeHash  string     `json:"-" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type Reminder struct {
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	NoteID      uuid.UUID  `json:"note_id" gorm:"type:uuid;not null;uniqueIndex:idx_reminders_note_user"`
+	UserID      uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_reminders_note_user;index"`
+	StartsAt    time.Time  `json:"starts_at" gorm:"not null"`
+	FireAt      time.Time  `json:"fire_at" gorm:"not null;index"`
+	TimeZone    string     `json:"time_zone" gorm:"default:'UTC'"`
+	Recurrence  string     `json:"recurrence"` // RRULE, empty for one-off reminders
+	LastFiredAt *time.Time `json:"last_fired_at,omitempty"`
+	IsDone      bool       `json:"is_done" gorm:"default:false;index"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	Note *Note `json:"note,omitempty" gorm:"foreignKey:NoteID"`
+}
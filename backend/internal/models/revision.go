@@ -0,0 +1,50 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+type NoteRevision struct {
+	ID        uuid.UUID     `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	NoteID    uuid.UUID     `json:"note_id" gorm:"type:uuid;not null;index"`
+	AuthorID  uuid.UUID     `json:"author_id" gorm:"type:uuid;not null"`
+	Title     string        `json:"title"`
+	Content   string        `json:"content" gorm:"type:text"`
+	Color     string        `json:"color"`
+	Labels    LabelSnapshot `json:"labels" gorm:"type:jsonb"`
+	CreatedAt time.Time     `json:"created_at" gorm:"index"`
+}
+
+// LabelSnapshot records the labels a note had when a revision was taken
+type LabelSnapshot []LabelRef
+
+type LabelRef struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+func (s LabelSnapshot) Value() (driver.Value, error) {
+	if s == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(s)
+	return string(data), err
+}
+
+func (s *LabelSnapshot) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*s = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	default:
+		return errors.New("unsupported type for LabelSnapshot")
+	}
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+// SavedSearch is a named advanced search the user can rerun as a view
+type SavedSearch struct {
+	ID        uuid.UUID     `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID    uuid.UUID     `json:"user_id" gorm:"type:uuid;not null;index"`
+	Name      string        `json:"name" gorm:"not null"`
+	Filters   SearchFilters `json:"filters" gorm:"type:jsonb"`
+	Icon      string        `json:"icon"`
+	Position  int           `json:"position" gorm:"default:0"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// SearchFilters is a saved advanced search request, stored the way
+// clients send it
+type SearchFilters struct {
+	Query           string   `json:"query,omitempty"`
+	LabelIDs        []string `json:"label_ids,omitempty"`
+	Color           string   `json:"color,omitempty"`
+	IncludeArchived bool     `json:"include_archived,omitempty"`
+}
+
+func (f SearchFilters) Value() (driver.Value, error) {
+	data, err := json.Marshal(f)
+	return string(data), err
+}
+
+func (f *SearchFilters) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*f = SearchFilters{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, f)
+	case string:
+		return json.Unmarshal([]byte(v), f)
+	default:
+		return errors.New("unsupported type for SearchFilters")
+	}
+}
+
+// SavedSearchCount is how many notes a saved search currently matches
+type SavedSearchCount struct {
+	ID    uuid.UUID `json:"id"`
+	Count int64     `json:"count"`
+}
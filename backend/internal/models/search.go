@@ -0,0 +1,17 @@
+package models
+
+// NoteSearchResult is a note matched by a full-text search. TitleHighlight
+// and Snippet are HTML-escaped with matches wrapped in <mark>.
+type NoteSearchResult struct {
+	Note
+	Rank           float64 `json:"rank"`
+	TitleHighlight string  `json:"title_highlight,omitempty"`
+	Snippet        string  `json:"snippet,omitempty"`
+}
+
+// SearchResponse is a page of search results. Suggestion is a corrected
+// query, offered when nothing matched.
+type SearchResponse struct {
+	Notes      []NoteSearchResult `json:"notes"`
+	Suggestion string             `json:"suggestion,omitempty"`
+}
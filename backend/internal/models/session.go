@@ -0,0 +1,49 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Session is a signed-in device. It holds the hash of the refresh token
+// the device was last given; each refresh swaps it for a new one, and an
+// older token turning up again revokes the session.
+type Session struct {
+	ID                uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID            uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	TokenHash         string     `json:"-" gorm:"not null"`
+	PreviousTokenHash string     `json:"-"`
+	DeviceName        string     `json:"device_name"`
+	IPAddress         string     `json:"ip_address"`
+	UserAgent         string     `json:"user_agent"`
+	LastUsedAt        time.Time  `json:"last_used_at"`
+	RotatedAt         *time.Time `json:"-"`
+	ExpiresAt         time.Time  `json:"expires_at" gorm:"not null;index"`
+	RevokedAt         *time.Time `json:"revoked_at,omitempty"`
+	RevokedReason     string     `json:"revoked_reason,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+
+	Current bool `json:"current" gorm:"-"` // whether it is the session making the request
+}
+
+// Reasons a session was revoked
+const (
+	RevokedLogout        = "logout"
+	RevokedByUser        = "revoked"
+	RevokedTokenReuse    = "refresh token reused"
+	RevokedPasswordReset = "password reset"
+)
+
+// Active reports whether the session can still be used
+func (s *Session) Active() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// AuthTokens is what signing in or refreshing gives the client: a
+// short-lived access token for the Authorization header and the refresh
+// token to get the next one with
+type AuthTokens struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // seconds until the access token expires
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Record types in the change log
+const (
+	SyncNote  = "note"
+	SyncLabel = "label"
+)
+
+// SyncChange is the latest change to a record as seen by one user. Seq
+// comes from a per-user counter that only goes up. Rows are written by
+// database triggers, so every write path is recorded; see
+// repositories.MigrateSync.
+type SyncChange struct {
+	UserID     uuid.UUID `json:"-" gorm:"type:uuid;primaryKey;index:idx_sync_changes_user_seq,priority:1"`
+	EntityType string    `json:"type" gorm:"primaryKey"`
+	EntityID   uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	Seq        int64     `json:"seq" gorm:"not null;index:idx_sync_changes_user_seq,priority:2"`
+	Deleted    bool      `json:"-" gorm:"not null;default:false"`
+	ChangedAt  time.Time `json:"changed_at" gorm:"not null"`
+}
+
+// SyncResponse carries the records changed after the sequence a client
+// asked for. Seq is the point to ask from next time. Full means the
+// response is a complete snapshot and replaces the client's cache.
+type SyncResponse struct {
+	Seq     int64        `json:"seq"`
+	HasMore bool         `json:"has_more"`
+	Full    bool         `json:"full"`
+	Notes   []Note       `json:"notes"`
+	Labels  []Label      `json:"labels"`
+	Deleted []SyncChange `json:"deleted"`
+}
+
+// Outcomes of a pushed mutation
+const (
+	PushAccepted = "accepted"
+	PushConflict = "conflict" // the note changed since; Note holds the current copy
+	PushRejected = "rejected"
+)
+
+type PushResult struct {
+	ClientID string `json:"client_id,omitempty"`
+	Status   string `json:"status"`
+	Note     *Note  `json:"note,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type PushResponse struct {
+	Results []PushResult `json:"results"`
+}
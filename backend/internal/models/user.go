@@ -7,17 +7,26 @@ import (
 )
 
 type User struct {
-	ID         uuid.UUID      `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	Email      string         `json:"email" gorm:"uniqueIndex;not null"`
-	Password   string         `json:"-" gorm:"not null"`
-	Name       string         `json:"name" gorm:"not null"`
-	Avatar     string         `json:"avatar"`
-	Provider   string         `json:"provider" gorm:"default:'local'"` // 'local' or 'google'
-	ProviderID string         `json:"provider_id"`
-	IsVerified bool           `json:"is_verified" gorm:"default:false"`
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
-	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+	ID             uuid.UUID      `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Email          string         `json:"email" gorm:"uniqueIndex;not null"`
+	Password       string         `json:"-" gorm:"not null"`
+	Name           string         `json:"name" gorm:"not null"`
+	Avatar         string         `json:"avatar"`
+	Provider       string         `json:"provider" gorm:"default:'local'"` // 'local' or 'google'
+	ProviderID     string         `json:"provider_id"`
+	IsVerified     bool           `json:"is_verified" gorm:"default:false"`
+	SearchLanguage string         `json:"search_language" gorm:"default:'english'"` // Postgres text search configuration used to stem notes
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Two-factor authentication. The secret is set at setup and only
+	// asked for once TwoFactorEnabled is confirmed with a code.
+	TOTPSecret       string     `json:"-"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled" gorm:"default:false"`
+	TOTPLastStep     int64      `json:"-" gorm:"default:0"` // time step of the last code accepted; it and earlier ones are refused
+	TOTPFailures     int        `json:"-" gorm:"default:0"`
+	TOTPLockedUntil  *time.Time `json:"-"`
 
 	Notes []Note `json:"notes,omitempty" gorm:"foreignKey:UserID"`
 }
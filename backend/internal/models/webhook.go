@@ -0,0 +1,55 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is an endpoint the user has registered to be sent events. The
+// secret signs every delivery; it is only shown when the webhook is
+// created or the secret rotated.
+type Webhook struct {
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID      uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	URL         string     `json:"url" gorm:"not null"`
+	Description string     `json:"description"`
+	Events      StringList `json:"events" gorm:"type:jsonb;not null"` // event names, or "*" for all
+	Secret      string     `json:"secret,omitempty" gorm:"not null"`
+	Active      bool       `json:"active" gorm:"not null;default:true"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// WebhookDelivery is one event to be sent to one webhook. Body is sent
+// as is on every attempt, so a replay repeats exactly what was sent.
+type WebhookDelivery struct {
+	ID            uuid.UUID        `json:"id" gorm:"type:uuid;primary_key"`
+	WebhookID     uuid.UUID        `json:"webhook_id" gorm:"type:uuid;not null;uniqueIndex:idx_webhook_deliveries_event"`
+	EventID       int64            `json:"event_id" gorm:"not null;uniqueIndex:idx_webhook_deliveries_event"`
+	Event         string           `json:"event" gorm:"not null"`
+	Body          string           `json:"body" gorm:"type:jsonb;not null"`
+	Status        string           `json:"status" gorm:"not null;default:'pending'"`
+	Attempts      int              `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt *time.Time       `json:"next_attempt_at,omitempty" gorm:"index"`
+	CreatedAt     time.Time        `json:"created_at" gorm:"index"`
+	UpdatedAt     time.Time        `json:"updated_at"`
+	AttemptLog    []WebhookAttempt `json:"attempt_log,omitempty" gorm:"foreignKey:DeliveryID"`
+}
+
+// WebhookAttempt records one try at sending a delivery
+type WebhookAttempt struct {
+	ID         uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	DeliveryID uuid.UUID `json:"delivery_id" gorm:"type:uuid;not null;index"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Response   string    `json:"response,omitempty"` // start of the response body, from allowed hosts only
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
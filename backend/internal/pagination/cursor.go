@@ -0,0 +1,90 @@
+// Package pagination implements keyset pagination for note listings. A
+// page ends with an opaque cursor naming the last row returned; the next
+// page starts after it, so rows added or removed meanwhile never shift
+// results the way offsets do.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// Sort fields
+const (
+	SortUpdatedAt = "updated_at"
+	SortCreatedAt = "created_at"
+	SortTitle     = "title"
+	SortPosition  = "position"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// A cursor only continues the listing it came from
+	ErrCursorMismatch = errors.New("cursor does not match the requested sort")
+)
+
+// Page asks for one page of a listing
+type Page struct {
+	Limit     int
+	Sort      string
+	Desc      bool
+	After     *Cursor // nil for the first page
+	WithTotal bool
+}
+
+// Cursor marks the last row of a page: its sort value and ID, plus its
+// pinned state for listings that put pinned notes first
+type Cursor struct {
+	Sort   string    `json:"s"`
+	Desc   bool      `json:"d"`
+	Pinned *bool     `json:"p,omitempty"`
+	Value  string    `json:"v"`
+	ID     uuid.UUID `json:"i"`
+}
+
+// IsSortField reports whether notes can be sorted by field
+func IsSortField(field string) bool {
+	switch field {
+	case SortUpdatedAt, SortCreatedAt, SortTitle, SortPosition:
+		return true
+	}
+	return false
+}
+
+// DefaultDesc is the natural direction of a sort field: newest first for
+// dates, A to Z and first to last otherwise
+func DefaultDesc(field string) bool {
+	return field == SortUpdatedAt || field == SortCreatedAt
+}
+
+// Encode renders the cursor as an opaque URL-safe string
+func (c *Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode parses a cursor from Encode and checks it continues a listing
+// sorted the same way
+func Decode(s, sort string, desc bool) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == uuid.Nil {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.Sort != sort || cursor.Desc != desc {
+		return nil, ErrCursorMismatch
+	}
+	return &cursor, nil
+}
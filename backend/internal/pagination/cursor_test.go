@@ -0,0 +1,63 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	pinned, unpinned := true, false
+	id := uuid.New()
+
+	tests := []Cursor{
+		{Sort: SortUpdatedAt, Desc: true, Value: "2025-01-02T03:04:05.123456Z", ID: id},
+		{Sort: SortCreatedAt, Desc: false, Pinned: &pinned, Value: "2025-01-02T03:04:05Z", ID: id},
+		{Sort: SortTitle, Pinned: &unpinned, Value: "Groceries & \"errands\" / ✓", ID: id},
+		{Sort: SortPosition, Value: "", ID: id},
+	}
+	for _, want := range tests {
+		encoded := want.Encode()
+		if _, err := base64.RawURLEncoding.DecodeString(encoded); err != nil {
+			t.Errorf("cursor %q is not URL-safe base64", encoded)
+		}
+
+		got, err := Decode(encoded, want.Sort, want.Desc)
+		if err != nil {
+			t.Errorf("%s: %v", want.Sort, err)
+			continue
+		}
+		if got.Sort != want.Sort || got.Desc != want.Desc || got.Value != want.Value || got.ID != want.ID ||
+			(got.Pinned == nil) != (want.Pinned == nil) || (got.Pinned != nil && *got.Pinned != *want.Pinned) {
+			t.Errorf("decoded %+v; want %+v", *got, want)
+		}
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	valid := (&Cursor{Sort: SortTitle, Value: "a", ID: uuid.New()}).Encode()
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name   string
+		cursor string
+		sort   string
+		desc   bool
+		want   error
+	}{
+		{"not base64", "not base64!", SortTitle, false, ErrInvalidCursor},
+		{"padded", valid + "=", SortTitle, false, ErrInvalidCursor},
+		{"not JSON", encode("cursor"), SortTitle, false, ErrInvalidCursor},
+		{"no ID", encode(`{"s":"title","v":"a"}`), SortTitle, false, ErrInvalidCursor},
+		{"empty", "", SortTitle, false, ErrInvalidCursor},
+		{"other sort", valid, SortUpdatedAt, false, ErrCursorMismatch},
+		{"other direction", valid, SortTitle, true, ErrCursorMismatch},
+	}
+	for _, test := range tests {
+		if _, err := Decode(test.cursor, test.sort, test.desc); !errors.Is(err, test.want) {
+			t.Errorf("%s: err %v; want %v", test.name, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Package recurrence implements the subset of RFC 5545 RRULE used by
+// reminders: FREQ (DAILY, WEEKLY, MONTHLY, YEARLY), INTERVAL, COUNT and UNTIL.
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	Count    int
+	Until    time.Time
+}
+
+// Parse reads an RRULE string such as "FREQ=WEEKLY;INTERVAL=2". A leading
+// "RRULE:" prefix is accepted.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return nil, errors.New("empty recurrence rule")
+	}
+
+	rule := &Rule{Interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid recurrence rule part %q", part)
+		}
+
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			switch freq := Frequency(strings.ToUpper(value)); freq {
+			case Daily, Weekly, Monthly, Yearly:
+				rule.Freq = freq
+			default:
+				return nil, fmt.Errorf("unsupported frequency %q", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, errors.New("INTERVAL must be a positive integer")
+			}
+			rule.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, errors.New("COUNT must be a positive integer")
+			}
+			rule.Count = n
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return nil, err
+			}
+			rule.Until = until
+		default:
+			return nil, fmt.Errorf("unsupported recurrence rule part %q", key)
+		}
+	}
+
+	if rule.Freq == "" {
+		return nil, errors.New("FREQ is required")
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return nil, errors.New("COUNT and UNTIL cannot both be set")
+	}
+
+	return rule, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			if layout == "20060102" {
+				// A date-only UNTIL includes the whole day
+				t = t.Add(24*time.Hour - time.Nanosecond)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid UNTIL value %q", value)
+}
+
+// Next returns the first occurrence strictly after `after` for a series
+// anchored at start. Occurrences keep start's wall-clock time in loc, so a
+// 09:00 reminder stays at 09:00 across DST changes. ok is false once the
+// series is exhausted.
+func (r *Rule) Next(start, after time.Time, loc *time.Location) (next time.Time, ok bool) {
+	start = start.In(loc)
+
+	k := 0
+	if after.After(start) {
+		// Jump close to the answer instead of walking every occurrence
+		k = int(after.Sub(start)/r.maxStep()) - 1
+		if k < 0 {
+			k = 0
+		}
+	}
+
+	for ; ; k++ {
+		if r.Count > 0 && k >= r.Count {
+			return time.Time{}, false
+		}
+
+		occurrence := r.occurrence(start, k)
+		if !r.Until.IsZero() && occurrence.After(r.Until) {
+			return time.Time{}, false
+		}
+		if occurrence.After(after) {
+			return occurrence, true
+		}
+	}
+}
+
+func (r *Rule) occurrence(start time.Time, k int) time.Time {
+	n := k * r.Interval
+	year, month, day := start.Date()
+	hour, minute, sec := start.Clock()
+	nsec := start.Nanosecond()
+	loc := start.Location()
+
+	switch r.Freq {
+	case Daily:
+		return time.Date(year, month, day+n, hour, minute, sec, nsec, loc)
+	case Weekly:
+		return time.Date(year, month, day+7*n, hour, minute, sec, nsec, loc)
+	case Monthly:
+		month += time.Month(n)
+	case Yearly:
+		year += n
+	}
+
+	// Clamp to the last day of shorter months instead of overflowing,
+	// so a reminder on the 31st fires on the 30th in April
+	if last := daysIn(year, month, loc); day > last {
+		day = last
+	}
+	return time.Date(year, month, day, hour, minute, sec, nsec, loc)
+}
+
+// maxStep is never shorter than the real gap between two occurrences, so
+// jumping ahead by it cannot skip past the answer
+func (r *Rule) maxStep() time.Duration {
+	hour := time.Hour
+	switch r.Freq {
+	case Weekly:
+		return time.Duration(r.Interval) * (7*24 + 1) * hour
+	case Monthly:
+		return time.Duration(r.Interval) * (31*24 + 1) * hour
+	case Yearly:
+		return time.Duration(r.Interval) * (366*24 + 1) * hour
+	default:
+		return time.Duration(r.Interval) * 25 * hour
+	}
+}
+
+func daysIn(year int, month time.Month, loc *time.Location) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, loc).Day()
+}
@@ -0,0 +1,126 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Rule
+		wantErr bool
+	}{
+		{input: "FREQ=DAILY", want: Rule{Freq: Daily, Interval: 1}},
+		{input: "RRULE:FREQ=weekly;INTERVAL=2", want: Rule{Freq: Weekly, Interval: 2}},
+		{input: "FREQ=MONTHLY;COUNT=3", want: Rule{Freq: Monthly, Interval: 1, Count: 3}},
+		{input: "FREQ=YEARLY;UNTIL=20300101T120000Z", want: Rule{Freq: Yearly, Interval: 1, Until: time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)}},
+		{input: "FREQ=DAILY;UNTIL=20300101", want: Rule{Freq: Daily, Interval: 1, Until: time.Date(2030, 1, 2, 0, 0, 0, -1, time.UTC)}},
+		{input: "", wantErr: true},
+		{input: "INTERVAL=2", wantErr: true},
+		{input: "FREQ=HOURLY", wantErr: true},
+		{input: "FREQ=DAILY;INTERVAL=0", wantErr: true},
+		{input: "FREQ=DAILY;COUNT=-1", wantErr: true},
+		{input: "FREQ=DAILY;COUNT=2;UNTIL=20300101", wantErr: true},
+		{input: "FREQ=DAILY;BYDAY=MO", wantErr: true},
+		{input: "FREQ=DAILY;UNTIL=tomorrow", wantErr: true},
+		{input: "FREQ", wantErr: true},
+	}
+	for _, test := range tests {
+		rule, err := Parse(test.input)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("Parse(%q) = %+v; want an error", test.input, rule)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.input, err)
+			continue
+		}
+		if rule.Freq != test.want.Freq || rule.Interval != test.want.Interval ||
+			rule.Count != test.want.Count || !rule.Until.Equal(test.want.Until) {
+			t.Errorf("Parse(%q) = %+v; want %+v", test.input, *rule, test.want)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, newYork)
+	}
+
+	tests := []struct {
+		name  string
+		rule  string
+		start time.Time
+		after time.Time
+		want  time.Time // zero when the series is over
+	}{
+		{"daily, first", "FREQ=DAILY", at(2025, 1, 1, 9), at(2025, 1, 1, 9), at(2025, 1, 2, 9)},
+		{"before the start", "FREQ=DAILY", at(2025, 1, 1, 9), at(2024, 12, 1, 0), at(2025, 1, 1, 9)},
+		{"daily, far ahead", "FREQ=DAILY", at(2025, 1, 1, 9), at(2027, 6, 15, 10), at(2027, 6, 16, 9)},
+		{"every 3 days", "FREQ=DAILY;INTERVAL=3", at(2025, 1, 1, 9), at(2025, 1, 2, 0), at(2025, 1, 4, 9)},
+		{"weekly", "FREQ=WEEKLY", at(2025, 1, 6, 9), at(2025, 1, 8, 0), at(2025, 1, 13, 9)},
+		{"biweekly", "FREQ=WEEKLY;INTERVAL=2", at(2025, 1, 6, 9), at(2025, 1, 13, 9), at(2025, 1, 20, 9)},
+		// 09:00 stays 09:00 across the spring and autumn clock changes
+		{"into DST", "FREQ=DAILY", at(2025, 3, 8, 9), at(2025, 3, 8, 9), at(2025, 3, 9, 9)},
+		{"out of DST", "FREQ=WEEKLY", at(2025, 10, 27, 9), at(2025, 10, 27, 9), at(2025, 11, 3, 9)},
+		{"monthly on the 31st", "FREQ=MONTHLY", at(2025, 1, 31, 9), at(2025, 3, 31, 9), at(2025, 4, 30, 9)},
+		{"monthly in February", "FREQ=MONTHLY", at(2024, 1, 31, 9), at(2024, 1, 31, 9), at(2024, 2, 29, 9)},
+		{"leap day yearly", "FREQ=YEARLY", at(2024, 2, 29, 9), at(2024, 2, 29, 9), at(2025, 2, 28, 9)},
+		{"count exhausted", "FREQ=DAILY;COUNT=3", at(2025, 1, 1, 9), at(2025, 1, 3, 9), time.Time{}},
+		{"count left", "FREQ=DAILY;COUNT=3", at(2025, 1, 1, 9), at(2025, 1, 2, 9), at(2025, 1, 3, 9)},
+		{"until inclusive", "FREQ=DAILY;UNTIL=20250103T140000Z", at(2025, 1, 1, 9), at(2025, 1, 2, 9), at(2025, 1, 3, 9)},
+		{"until passed", "FREQ=DAILY;UNTIL=20250103T135959Z", at(2025, 1, 1, 9), at(2025, 1, 2, 9), time.Time{}},
+	}
+	for _, test := range tests {
+		rule, err := Parse(test.rule)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		next, ok := rule.Next(test.start, test.after, newYork)
+		if test.want.IsZero() {
+			if ok {
+				t.Errorf("%s: next %v; want the series over", test.name, next)
+			}
+			continue
+		}
+		if !ok || !next.Equal(test.want) {
+			t.Errorf("%s: next %v (%v); want %v", test.name, next, ok, test.want)
+		}
+	}
+}
+
+// TestNextMatchesWalk checks jumping ahead finds the same occurrence as
+// walking the series one at a time
+func TestNextMatchesWalk(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 1, 31, 8, 30, 0, 0, loc)
+
+	for _, input := range []string{"FREQ=DAILY;INTERVAL=5", "FREQ=WEEKLY;INTERVAL=3", "FREQ=MONTHLY", "FREQ=YEARLY;INTERVAL=2"} {
+		rule, err := Parse(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for after := start; after.Before(start.AddDate(6, 0, 0)); after = after.Add(97 * time.Hour) {
+			var want time.Time
+			for k := 0; ; k++ {
+				if want = rule.occurrence(start, k); want.After(after) {
+					break
+				}
+			}
+			if next, ok := rule.Next(start, after, loc); !ok || !next.Equal(want) {
+				t.Fatalf("%s after %v: next %v; want %v", input, after, next, want)
+			}
+		}
+	}
+}
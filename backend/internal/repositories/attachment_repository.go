@@ -0,0 +1,209 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"google-keep-clone/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AttachmentRepository stores attachments. Adding, removing or
+// thumbnailing one moves its note's version on too.
+type AttachmentRepository struct {
+	db *gorm.DB
+}
+
+func NewAttachmentRepository(db *gorm.DB) *AttachmentRepository {
+	return &AttachmentRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that works within tx
+func (r *AttachmentRepository) WithTx(tx *Tx) *AttachmentRepository {
+	return &AttachmentRepository{db: tx.db}
+}
+
+func (r *AttachmentRepository) Create(attachment *models.Attachment) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Note").Create(attachment).Error; err != nil {
+			return err
+		}
+		return touchNote(tx, attachment.NoteID)
+	})
+}
+
+// CreateWithinQuota saves an attachment unless it would take its
+// uploader's usage past quota bytes, reporting whether it did. The user's
+// row is locked meanwhile so concurrent uploads are counted one at a time.
+func (r *AttachmentRepository) CreateWithinQuota(attachment *models.Attachment, quota int64) (bool, error) {
+	created := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").
+			Where("id = ?", attachment.UserID).
+			First(&user).Error; err != nil {
+			return err
+		}
+
+		var usage int64
+		if err := tx.Model(&models.Attachment{}).
+			Where("user_id = ?", attachment.UserID).
+			Select("COALESCE(SUM(size), 0)").
+			Scan(&usage).Error; err != nil {
+			return err
+		}
+		if usage+attachment.Size > quota {
+			return nil
+		}
+
+		created = true
+		if err := tx.Omit("Note").Create(attachment).Error; err != nil {
+			return err
+		}
+		return touchNote(tx, attachment.NoteID)
+	})
+	return created && err == nil, err
+}
+
+// GetByID returns an attachment on a note the user can see
+func (r *AttachmentRepository) GetByID(id, userID uuid.UUID) (*models.Attachment, error) {
+	var attachment models.Attachment
+	err := r.db.Joins("INNER JOIN notes ON notes.id = attachments.note_id").
+		Scopes(accessibleBy(userID)).
+		Where("attachments.id = ?", id).
+		First(&attachment).Error
+	return &attachment, err
+}
+
+// GetEditableByID returns an attachment on a note the user may edit
+func (r *AttachmentRepository) GetEditableByID(id, userID uuid.UUID) (*models.Attachment, error) {
+	var attachment models.Attachment
+	err := r.db.Joins("INNER JOIN notes ON notes.id = attachments.note_id").
+		Scopes(editableBy(userID)).
+		Where("attachments.id = ?", id).
+		First(&attachment).Error
+	return &attachment, err
+}
+
+func (r *AttachmentRepository) Delete(id uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var attachment models.Attachment
+		result := tx.Clauses(clause.Returning{Columns: []clause.Column{{Name: "note_id"}}}).
+			Where("id = ?", id).
+			Delete(&attachment)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return touchNote(tx, attachment.NoteID)
+	})
+}
+
+// UsageByUser returns the bytes uploaded by a user. Deduplicated blobs are
+// still counted once per attachment.
+func (r *AttachmentRepository) UsageByUser(userID uuid.UUID) (int64, error) {
+	var total int64
+	err := r.db.Model(&models.Attachment{}).
+		Where("user_id = ?", userID).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
+// LockStorageKey runs fn in a transaction that holds a lock on a blob key,
+// with a repository working within it. Uploads and releases of the same
+// blob take it, so checking whether the blob is still in use and acting on
+// that can't interleave.
+func (r *AttachmentRepository) LockStorageKey(key string, fn func(repo *AttachmentRepository) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", key).Error; err != nil {
+			return err
+		}
+		return fn(&AttachmentRepository{db: tx})
+	})
+}
+
+// CountByStorageKey returns how many attachments share a blob
+func (r *AttachmentRepository) CountByStorageKey(key string) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Attachment{}).Where("storage_key = ?", key).Count(&count).Error
+	return count, err
+}
+
+func (r *AttachmentRepository) GetStorageKeysByNoteIDs(noteIDs []uuid.UUID) ([]string, error) {
+	var keys []string
+	if len(noteIDs) == 0 {
+		return keys, nil
+	}
+	err := r.db.Model(&models.Attachment{}).
+		Where("note_id IN ?", noteIDs).
+		Distinct().
+		Pluck("storage_key", &keys).Error
+	return keys, err
+}
+
+// GetPendingThumbnail returns an attachment still waiting for thumbnails
+func (r *AttachmentRepository) GetPendingThumbnail(id uuid.UUID) (*models.Attachment, error) {
+	var attachment models.Attachment
+	err := r.db.Where("id = ? AND thumbnail_status = ?", id, models.ThumbnailPending).First(&attachment).Error
+	return &attachment, err
+}
+
+// GetPendingThumbnailIDs returns up to limit attachments waiting for
+// thumbnails that are due a try, those never tried first
+func (r *AttachmentRepository) GetPendingThumbnailIDs(limit int) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.Model(&models.Attachment{}).
+		Where("thumbnail_status = ?", models.ThumbnailPending).
+		Where("thumbnail_next_attempt_at IS NULL OR thumbnail_next_attempt_at <= ?", time.Now()).
+		Order("thumbnail_next_attempt_at ASC NULLS FIRST, created_at ASC").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// ScheduleThumbnailRetry records a failed thumbnail run on an attachment
+// that is still pending and when to try again
+func (r *AttachmentRepository) ScheduleThumbnailRetry(id uuid.UUID, attempts int, next time.Time) error {
+	return r.db.Model(&models.Attachment{}).
+		Where("id = ? AND thumbnail_status = ?", id, models.ThumbnailPending).
+		Updates(map[string]interface{}{
+			"thumbnail_attempts":        attempts,
+			"thumbnail_next_attempt_at": next,
+		}).Error
+}
+
+// UpdateThumbnail saves the result of thumbnail generation. It reports
+// false when the attachment was deleted in the meantime.
+func (r *AttachmentRepository) UpdateThumbnail(attachment *models.Attachment) (bool, error) {
+	updated := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Attachment{}).
+			Where("id = ?", attachment.ID).
+			Updates(map[string]interface{}{
+				"width":               attachment.Width,
+				"height":              attachment.Height,
+				"taken_at":            attachment.TakenAt,
+				"thumbnail_status":    attachment.ThumbnailStatus,
+				"thumbnail_mime_type": attachment.ThumbnailMimeType,
+			})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		updated = true
+		return touchNote(tx, attachment.NoteID)
+	})
+	return updated && err == nil, err
+}
+
+func (r *AttachmentRepository) GetThumbnailedIDsByNoteIDs(noteIDs []uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	if len(noteIDs) == 0 {
+		return ids, nil
+	}
+	err := r.db.Model(&models.Attachment{}).
+		Where("note_id IN ? AND thumbnail_status = ?", noteIDs, models.ThumbnailReady).
+		Pluck("id", &ids).Error
+	return ids, err
+}
@@ -0,0 +1,100 @@
+package repositories
+
+import (
+	"github.com/google/uuid"
+	"google-keep-clone/internal/models"
+	"gorm.io/gorm"
+)
+
+// ChecklistRepository stores checklist items. Every change to an item
+// moves its note's version on too.
+type ChecklistRepository struct {
+	db *gorm.DB
+}
+
+func NewChecklistRepository(db *gorm.DB) *ChecklistRepository {
+	return &ChecklistRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that works within tx
+func (r *ChecklistRepository) WithTx(tx *Tx) *ChecklistRepository {
+	return &ChecklistRepository{db: tx.db}
+}
+
+func (r *ChecklistRepository) Create(item *models.ChecklistItem) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(item).Error; err != nil {
+			return err
+		}
+		return touchNote(tx, item.NoteID)
+	})
+}
+
+func (r *ChecklistRepository) GetByNoteID(noteID uuid.UUID) ([]models.ChecklistItem, error) {
+	var items []models.ChecklistItem
+	err := r.db.Where("note_id = ?", noteID).Order("position ASC, created_at ASC").Find(&items).Error
+	return items, err
+}
+
+func (r *ChecklistRepository) GetByID(id, noteID uuid.UUID) (*models.ChecklistItem, error) {
+	var item models.ChecklistItem
+	err := r.db.Where("id = ? AND note_id = ?", id, noteID).First(&item).Error
+	return &item, err
+}
+
+func (r *ChecklistRepository) Update(item *models.ChecklistItem) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(item).Error; err != nil {
+			return err
+		}
+		return touchNote(tx, item.NoteID)
+	})
+}
+
+// Delete removes an item together with any items nested under it
+func (r *ChecklistRepository) Delete(id, noteID uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("note_id = ? AND (id = ? OR parent_id = ?)", noteID, id, id).Delete(&models.ChecklistItem{}).Error; err != nil {
+			return err
+		}
+		return touchNote(tx, noteID)
+	})
+}
+
+func (r *ChecklistRepository) MaxPosition(noteID uuid.UUID) (int, error) {
+	var position int
+	err := r.db.Model(&models.ChecklistItem{}).
+		Where("note_id = ?", noteID).
+		Select("COALESCE(MAX(position), -1)").
+		Scan(&position).Error
+	return position, err
+}
+
+// UpdatePositions assigns each item the position of its index in itemIDs
+func (r *ChecklistRepository) UpdatePositions(noteID uuid.UUID, itemIDs []uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for position, id := range itemIDs {
+			if err := tx.Model(&models.ChecklistItem{}).
+				Where("id = ? AND note_id = ?", id, noteID).
+				Update("position", position).Error; err != nil {
+				return err
+			}
+		}
+		return touchNote(tx, noteID)
+	})
+}
+
+// ReplaceForNote swaps the full item list of a note in one transaction
+func (r *ChecklistRepository) ReplaceForNote(noteID uuid.UUID, items []models.ChecklistItem) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("note_id = ?", noteID).Delete(&models.ChecklistItem{}).Error; err != nil {
+			return err
+		}
+		if len(items) > 0 {
+			if err := tx.Create(&items).Error; err != nil {
+				return err
+			}
+		}
+		return touchNote(tx, noteID)
+	})
+}
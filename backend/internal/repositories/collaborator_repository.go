@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"github.com/google/uuid"
+	"google-keep-clone/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CollaboratorRepository struct {
+	db *gorm.DB
+}
+
+func NewCollaboratorRepository(db *gorm.DB) *CollaboratorRepository {
+	return &CollaboratorRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that works within tx
+func (r *CollaboratorRepository) WithTx(tx *Tx) *CollaboratorRepository {
+	return &CollaboratorRepository{db: tx.db}
+}
+
+// Upsert adds a collaborator or changes the role of an existing one
+func (r *CollaboratorRepository) Upsert(collaborator *models.NoteCollaborator) error {
+	return r.db.Omit("User").Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "note_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role", "updated_at"}),
+	}).Create(collaborator).Error
+}
+
+func (r *CollaboratorRepository) GetByNoteID(noteID uuid.UUID) ([]models.NoteCollaborator, error) {
+	var collaborators []models.NoteCollaborator
+	err := r.db.Where("note_id = ?", noteID).Preload("User").Order("created_at ASC").Find(&collaborators).Error
+	return collaborators, err
+}
+
+func (r *CollaboratorRepository) Get(noteID, userID uuid.UUID) (*models.NoteCollaborator, error) {
+	var collaborator models.NoteCollaborator
+	err := r.db.Where("note_id = ? AND user_id = ?", noteID, userID).Preload("User").First(&collaborator).Error
+	return &collaborator, err
+}
+
+// Delete unshares a note with a user, along with the labels they put on
+// it and their reminder for it
+func (r *CollaboratorRepository) Delete(noteID, userID uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("note_id = ? AND user_id = ?", noteID, userID).Delete(&models.NoteCollaborator{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`DELETE FROM note_labels WHERE note_id = ? AND label_id IN (
+			SELECT id FROM labels WHERE user_id = ?)`, noteID, userID).Error; err != nil {
+			return err
+		}
+		return tx.Where("note_id = ? AND user_id = ?", noteID, userID).Delete(&models.Reminder{}).Error
+	})
+}
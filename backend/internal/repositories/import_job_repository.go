@@ -0,0 +1,93 @@
+package repositories
+
+import (
+	"github.com/google/uuid"
+	"google-keep-clone/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var importJobSchema = []string{
+	// A user can only have one import running. Should older servers have
+	// let more through, all but the newest are failed first.
+	`UPDATE import_jobs SET status = 'failed', error = 'another import was already in progress'
+		WHERE status IN ('pending', 'running') AND id NOT IN (
+			SELECT DISTINCT ON (user_id) id FROM import_jobs
+			WHERE status IN ('pending', 'running')
+			ORDER BY user_id, created_at DESC)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_import_jobs_one_active ON import_jobs (user_id)
+		WHERE status IN ('pending', 'running')`,
+}
+
+// MigrateImportJobs installs the index that allows one active import per
+// user. It is safe to run on every start, after AutoMigrate.
+func MigrateImportJobs(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range importJobSchema {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type ImportJobRepository struct {
+	db *gorm.DB
+}
+
+func NewImportJobRepository(db *gorm.DB) *ImportJobRepository {
+	return &ImportJobRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that works within tx
+func (r *ImportJobRepository) WithTx(tx *Tx) *ImportJobRepository {
+	return &ImportJobRepository{db: tx.db}
+}
+
+func (r *ImportJobRepository) GetByID(id, userID uuid.UUID) (*models.ImportJob, error) {
+	var job models.ImportJob
+	err := r.db.Where("id = ? AND user_id = ?", id, userID).First(&job).Error
+	return &job, err
+}
+
+func (r *ImportJobRepository) GetByUserID(userID uuid.UUID, limit int) ([]models.ImportJob, error) {
+	var jobs []models.ImportJob
+	err := r.db.Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&jobs).Error
+	return jobs, err
+}
+
+func (r *ImportJobRepository) Update(job *models.ImportJob) error {
+	return r.db.Save(job).Error
+}
+
+// HasActive reports whether the user has an import that hasn't finished
+func (r *ImportJobRepository) HasActive(userID uuid.UUID) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.ImportJob{}).
+		Where("user_id = ? AND status IN ?", userID, []string{models.ImportPending, models.ImportRunning}).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// CreateIfNoneActive saves a pending job unless the user already has an
+// import that hasn't finished, reporting whether it did
+func (r *ImportJobRepository) CreateIfNoneActive(job *models.ImportJob) (bool, error) {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(job)
+	return result.RowsAffected > 0, result.Error
+}
+
+// FailInterrupted marks imports left unfinished by a restart as failed; the
+// uploaded archive didn't survive it
+func (r *ImportJobRepository) FailInterrupted() (int64, error) {
+	result := r.db.Model(&models.ImportJob{}).
+		Where("status IN ?", []string{models.ImportPending, models.ImportRunning}).
+		Updates(map[string]interface{}{
+			"status": models.ImportFailed,
+			"error":  "import was interrupted by a server restart",
+		})
+	return result.RowsAffected, result.Error
+}
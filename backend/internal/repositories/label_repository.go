@@ -14,6 +14,11 @@ func NewLabelRepository(db *gorm.DB) *LabelRepository {
 	return &LabelRepository{db: db}
 }
 
+// WithTx returns a copy of the repository that works within tx
+func (r *LabelRepository) WithTx(tx *Tx) *LabelRepository {
+	return &LabelRepository{db: tx.db}
+}
+
 func (r *LabelRepository) Create(label *models.Label) error {
 	return r.db.Create(label).Error
 }
@@ -30,6 +35,13 @@ func (r *LabelRepository) GetByID(id, userID uuid.UUID) (*models.Label, error) {
 	return &label, err
 }
 
+// GetByIDs returns the user's labels with the given IDs
+func (r *LabelRepository) GetByIDs(userID uuid.UUID, ids []uuid.UUID) ([]models.Label, error) {
+	var labels []models.Label
+	err := r.db.Where("user_id = ? AND id IN ?", userID, ids).Order("name ASC").Find(&labels).Error
+	return labels, err
+}
+
 func (r *LabelRepository) Update(label *models.Label) error {
 	return r.db.Save(label).Error
 }
@@ -44,21 +56,15 @@ func (r *LabelRepository) GetByName(userID uuid.UUID, name string) (*models.Labe
 	return &label, err
 }
 
-func (r *LabelRepository) AttachToNote(noteID, labelID uuid.UUID) error {
-	return r.db.Exec("INSERT INTO note_labels (note_id, label_id) VALUES (?, ?) ON CONFLICT DO NOTHING", noteID, labelID).Error
-}
-
-func (r *LabelRepository) DetachFromNote(noteID, labelID uuid.UUID) error {
-	return r.db.Exec("DELETE FROM note_labels WHERE note_id = ? AND label_id = ?", noteID, labelID).Error
+// AttachToNote puts one of the user's labels on a note. Labels are
+// personal: on a shared note each collaborator only sees their own.
+func (r *LabelRepository) AttachToNote(noteID, labelID, userID uuid.UUID) error {
+	return r.db.Exec(`INSERT INTO note_labels (note_id, label_id)
+		SELECT ?, id FROM labels WHERE id = ? AND user_id = ?
+		ON CONFLICT DO NOTHING`, noteID, labelID, userID).Error
 }
 
-func (r *LabelRepository) GetNotesByLabel(labelID, userID uuid.UUID) ([]models.Note, error) {
-	var notes []models.Note
-	err := r.db.Table("notes").
-		Joins("INNER JOIN note_labels ON notes.id = note_labels.note_id").
-		Where("note_labels.label_id = ? AND notes.user_id = ? AND notes.is_deleted = ?", labelID, userID, false).
-		Preload("Labels").
-		Order("notes.updated_at DESC").
-		Find(&notes).Error
-	return notes, err
+func (r *LabelRepository) DetachFromNote(noteID, labelID, userID uuid.UUID) error {
+	return r.db.Exec(`DELETE FROM note_labels WHERE note_id = ? AND label_id IN (
+		SELECT id FROM labels WHERE id = ? AND user_id = ?)`, noteID, labelID, userID).Error
 }
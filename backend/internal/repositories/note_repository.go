@@ -1,9 +1,15 @@
 package repositories
 
 import (
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/google/uuid"
 	"google-keep-clone/internal/models"
+	"google-keep-clone/internal/pagination"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type NoteRepository struct {
@@ -14,13 +20,28 @@ func NewNoteRepository(db *gorm.DB) *NoteRepository {
 	return &NoteRepository{db: db}
 }
 
+// WithTx returns a copy of the repository that works within tx
+func (r *NoteRepository) WithTx(tx *Tx) *NoteRepository {
+	return &NoteRepository{db: tx.db}
+}
+
 func (r *NoteRepository) Create(note *models.Note) error {
 	return r.db.Create(note).Error
 }
 
+// ImportKeyExists reports whether a note with the given import key was
+// already brought in for the user
+func (r *NoteRepository) ImportKeyExists(userID uuid.UUID, key string) (bool, error) {
+	var count int64
+	err := r.db.Unscoped().Model(&models.Note{}).
+		Where("user_id = ? AND import_key = ?", userID, key).
+		Count(&count).Error
+	return count > 0, err
+}
+
 func (r *NoteRepository) GetByUserID(userID uuid.UUID, includeArchived, includeDeleted bool) ([]models.Note, error) {
 	var notes []models.Note
-	query := r.db.Where("user_id = ?", userID)
+	query := r.db.Scopes(accessibleBy(userID))
 
 	if !includeArchived {
 		query = query.Where("is_archived = ?", false)
@@ -29,18 +50,109 @@ func (r *NoteRepository) GetByUserID(userID uuid.UUID, includeArchived, includeD
 		query = query.Where("is_deleted = ?", false)
 	}
 
-	err := query.Preload("Labels").Order("is_pinned DESC, position ASC, updated_at DESC").Find(&notes).Error
+	err := query.Preload("Labels", "labels.user_id = ?", userID).Preload("Items", orderItems).Order("is_pinned DESC, position ASC, updated_at DESC").Find(&notes).Error
 	return notes, err
 }
 
 func (r *NoteRepository) GetByID(id, userID uuid.UUID) (*models.Note, error) {
 	var note models.Note
-	err := r.db.Where("id = ? AND user_id = ?", id, userID).Preload("Labels").Preload("Attachments").First(&note).Error
+	err := r.db.Scopes(accessibleBy(userID)).Where("id = ?", id).
+		Preload("Labels", "labels.user_id = ?", userID).
+		Preload("Attachments").
+		Preload("Items", orderItems).
+		Preload("Reminder", "user_id = ?", userID).
+		Preload("Collaborators.User").
+		First(&note).Error
+	return &note, err
+}
+
+// GetOwnedBatch returns up to limit of the user's own notes with IDs after
+// the given one, in ID order, so callers can walk every note without
+// loading them all at once
+func (r *NoteRepository) GetOwnedBatch(userID, afterID uuid.UUID, limit int) ([]models.Note, error) {
+	var notes []models.Note
+	err := r.db.Where("user_id = ? AND id > ?", userID, afterID).
+		Preload("Labels", "labels.user_id = ?", userID).
+		Preload("Attachments").
+		Preload("Items", orderItems).
+		Preload("Reminder", "user_id = ?", userID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&notes).Error
+	return notes, err
+}
+
+// GetForSync loads the notes with the given IDs that the user can see,
+// trashed and archived ones included. Nil IDs load every such note.
+func (r *NoteRepository) GetForSync(userID uuid.UUID, ids []uuid.UUID) ([]models.Note, error) {
+	query := r.db.Scopes(accessibleBy(userID))
+	if ids != nil {
+		query = query.Where("notes.id IN ?", ids)
+	}
+
+	var notes []models.Note
+	err := query.
+		Preload("Labels", "labels.user_id = ?", userID).
+		Preload("Attachments").
+		Preload("Items", orderItems).
+		Preload("Reminder", "user_id = ?", userID).
+		Order("notes.id ASC").
+		Find(&notes).Error
+	return notes, err
+}
+
+// GetEditableByID is GetByID restricted to the owner and editors
+func (r *NoteRepository) GetEditableByID(id, userID uuid.UUID) (*models.Note, error) {
+	var note models.Note
+	err := r.db.Scopes(editableBy(userID)).Where("id = ?", id).
+		Preload("Labels", "labels.user_id = ?", userID).
+		Preload("Attachments").
+		Preload("Items", orderItems).
+		Preload("Reminder", "user_id = ?", userID).
+		First(&note).Error
 	return &note, err
 }
 
+// GetAudience returns the owner and collaborators of a note, everyone who
+// should receive its realtime updates
+func (r *NoteRepository) GetAudience(id uuid.UUID) ([]uuid.UUID, error) {
+	var userIDs []uuid.UUID
+	err := r.db.Raw(`SELECT user_id FROM notes WHERE id = ?
+		UNION SELECT user_id FROM note_collaborators WHERE note_id = ?`, id, id).
+		Scan(&userIDs).Error
+	return userIDs, err
+}
+
+// Update saves the note's own columns; labels and checklist items are
+// managed through their own repositories
 func (r *NoteRepository) Update(note *models.Note) error {
-	return r.db.Save(note).Error
+	return r.db.Omit(clause.Associations).Save(note).Error
+}
+
+// noteColumns are the note's own editable columns
+var noteColumns = []string{"title", "content", "color", "is_pinned", "is_archived", "position", "move_checked_to_bottom", "updated_at"}
+
+// UpdateFields saves the note's own editable columns and reads back the
+// version the database gave it
+func (r *NoteRepository) UpdateFields(note *models.Note) error {
+	return r.db.Model(note).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "version"}}}).
+		Select(noteColumns).
+		Omit(clause.Associations).
+		Updates(note).Error
+}
+
+// UpdateFieldsIfVersion is UpdateFields that only writes if the note is
+// still at expectedVersion. It reports false when someone else got there
+// first.
+func (r *NoteRepository) UpdateFieldsIfVersion(note *models.Note, expectedVersion int64) (bool, error) {
+	result := r.db.Model(note).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "version"}}}).
+		Where("version = ?", expectedVersion).
+		Select(noteColumns).
+		Omit(clause.Associations).
+		Updates(note)
+	return result.RowsAffected > 0, result.Error
 }
 
 func (r *NoteRepository) Delete(id, userID uuid.UUID) error {
@@ -48,95 +160,390 @@ func (r *NoteRepository) Delete(id, userID uuid.UUID) error {
 }
 
 func (r *NoteRepository) SoftDelete(id, userID uuid.UUID) error {
-	return r.db.Model(&models.Note{}).Where("id = ? AND user_id = ?", id, userID).Update("is_deleted", true).Error
+	return r.db.Model(&models.Note{}).Where("id = ? AND user_id = ?", id, userID).Updates(map[string]interface{}{
+		"is_deleted": true,
+		"trashed_at": time.Now(),
+	}).Error
+}
+
+// SoftDeleteIfVersion is SoftDelete that only moves the note if it is
+// still at expectedVersion. It reports false when it wasn't.
+func (r *NoteRepository) SoftDeleteIfVersion(id, userID uuid.UUID, expectedVersion int64) (bool, error) {
+	result := r.db.Model(&models.Note{}).
+		Where("id = ? AND user_id = ? AND version = ?", id, userID, expectedVersion).
+		Updates(map[string]interface{}{
+			"is_deleted": true,
+			"trashed_at": time.Now(),
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetVersion returns the note's current version
+func (r *NoteRepository) GetVersion(id uuid.UUID) (int64, error) {
+	var version int64
+	err := r.db.Model(&models.Note{}).Where("id = ?", id).Select("version").Scan(&version).Error
+	return version, err
+}
+
+// touchNote moves a note's version on after a change to a row that
+// belongs to it, such as a checklist item or attachment, so clients
+// holding the old version know their copy is stale
+func touchNote(db *gorm.DB, noteID uuid.UUID) error {
+	return db.Exec("UPDATE notes SET version = version + 1 WHERE id = ?", noteID).Error
+}
+
+func (r *NoteRepository) Restore(id, userID uuid.UUID) error {
+	return r.db.Model(&models.Note{}).Where("id = ? AND user_id = ? AND is_deleted = ?", id, userID, true).Updates(map[string]interface{}{
+		"is_deleted": false,
+		"trashed_at": nil,
+	}).Error
+}
+
+func (r *NoteRepository) GetTrashedNotes(userID uuid.UUID) ([]models.Note, error) {
+	var notes []models.Note
+	err := r.db.Where("user_id = ? AND is_deleted = ?", userID, true).
+		Preload("Labels", "labels.user_id = ?", userID).
+		Preload("Items", orderItems).
+		Order("trashed_at DESC NULLS LAST, updated_at DESC").
+		Find(&notes).Error
+	return notes, err
+}
+
+// GetTrashedIDs returns the IDs of a user's trashed notes
+func (r *NoteRepository) GetTrashedIDs(userID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.Model(&models.Note{}).
+		Where("user_id = ? AND is_deleted = ?", userID, true).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// GetExpiredTrash returns up to limit notes trashed before cutoff, across
+// all users. Notes trashed before trashed_at existed fall back to updated_at.
+func (r *NoteRepository) GetExpiredTrash(cutoff time.Time, limit int) ([]models.Note, error) {
+	var notes []models.Note
+	err := r.db.Select("id", "user_id").
+		Where("is_deleted = ? AND COALESCE(trashed_at, updated_at) < ?", true, cutoff).
+		Limit(limit).
+		Find(&notes).Error
+	return notes, err
+}
+
+// Purge permanently removes notes along with their label links,
+// attachments, checklist items, reminders, revisions and collaborators
+func (r *NoteRepository) Purge(ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM note_labels WHERE note_id IN ?", ids).Error; err != nil {
+			return err
+		}
+		for _, model := range []interface{}{&models.Attachment{}, &models.ChecklistItem{}, &models.Reminder{}, &models.NoteRevision{}, &models.NoteCollaborator{}} {
+			if err := tx.Where("note_id IN ?", ids).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Where("id IN ?", ids).Delete(&models.Note{}).Error
+	})
+}
+
+// ReplaceLabels sets the user's labels on a note to the given IDs,
+// skipping any that no longer exist. Labels other collaborators put on the
+// note are left alone.
+func (r *NoteRepository) ReplaceLabels(noteID, userID uuid.UUID, labelIDs []uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`DELETE FROM note_labels WHERE note_id = ?
+			AND label_id IN (SELECT id FROM labels WHERE user_id = ?)`, noteID, userID).Error; err != nil {
+			return err
+		}
+		if len(labelIDs) == 0 {
+			return nil
+		}
+		return tx.Exec(`INSERT INTO note_labels (note_id, label_id)
+			SELECT ?, id FROM labels WHERE id IN ? AND user_id = ?
+			ON CONFLICT DO NOTHING`, noteID, labelIDs, userID).Error
+	})
 }
 
 func (r *NoteRepository) TogglePin(id, userID uuid.UUID) error {
-	return r.db.Model(&models.Note{}).Where("id = ? AND user_id = ?", id, userID).Update("is_pinned", gorm.Expr("NOT is_pinned")).Error
+	return r.db.Model(&models.Note{}).Scopes(editableBy(userID)).Where("id = ?", id).Update("is_pinned", gorm.Expr("NOT is_pinned")).Error
 }
 
 func (r *NoteRepository) ToggleArchive(id, userID uuid.UUID) error {
-	return r.db.Model(&models.Note{}).Where("id = ? AND user_id = ?", id, userID).Update("is_archived", gorm.Expr("NOT is_archived")).Error
+	return r.db.Model(&models.Note{}).Scopes(editableBy(userID)).Where("id = ?", id).Update("is_archived", gorm.Expr("NOT is_archived")).Error
 }
 
 func (r *NoteRepository) UpdateColor(id, userID uuid.UUID, color string) error {
-	return r.db.Model(&models.Note{}).Where("id = ? AND user_id = ?", id, userID).Update("color", color).Error
+	return r.db.Model(&models.Note{}).Scopes(editableBy(userID)).Where("id = ?", id).Update("color", color).Error
 }
 
 func (r *NoteRepository) UpdatePosition(id, userID uuid.UUID, position int) error {
-	return r.db.Model(&models.Note{}).Where("id = ? AND user_id = ?", id, userID).Update("position", position).Error
+	return r.db.Model(&models.Note{}).Scopes(editableBy(userID)).Where("id = ?", id).Update("position", position).Error
 }
 
-func (r *NoteRepository) Search(userID uuid.UUID, query string) ([]models.Note, error) {
-	var notes []models.Note
-	err := r.db.Where("user_id = ? AND is_deleted = ? AND (title ILIKE ? OR content ILIKE ?)",
-		userID, false, "%"+query+"%", "%"+query+"%").
-		Preload("Labels").
-		Order("updated_at DESC").
-		Find(&notes).Error
-	return notes, err
+// Search ranks the user's notes by relevance to a full-text query
+func (r *NoteRepository) Search(userID uuid.UUID, query, language string, limit, offset int) ([]models.NoteSearchResult, error) {
+	return r.fullTextSearch(userID, query, language, nil, limit, offset)
 }
 
-func (r *NoteRepository) SearchWithLabels(userID uuid.UUID, query string, labelIDs []uuid.UUID, includeArchived bool) ([]models.Note, error) {
+// SearchWithLabels ranks notes matching a full-text query, restricted to
+// notes with any of the given labels and, if given, the color. Without a
+// query it lists the matching notes, pinned first.
+func (r *NoteRepository) SearchWithLabels(userID uuid.UUID, query, language string, labelIDs []uuid.UUID, color string, includeArchived bool) ([]models.NoteSearchResult, error) {
+	filter := labelFilter(userID, labelIDs, color, includeArchived)
+
+	if query != "" {
+		return r.fullTextSearch(userID, query, language, filter, 0, 0)
+	}
+
 	var notes []models.Note
+	err := r.db.Scopes(accessibleBy(userID), filter).
+		Where("notes.is_deleted = ?", false).
+		Preload("Labels", "labels.user_id = ?", userID).
+		Order("is_pinned DESC, updated_at DESC").
+		Find(&notes).Error
+	if err != nil {
+		return nil, err
+	}
 
-	baseQuery := r.db.Where("user_id = ? AND is_deleted = ?", userID, false)
+	results := make([]models.NoteSearchResult, len(notes))
+	for i, note := range notes {
+		results[i] = models.NoteSearchResult{Note: note}
+	}
+	return results, nil
+}
 
-	if !includeArchived {
-		baseQuery = baseQuery.Where("is_archived = ?", false)
+// CountWithLabels counts the notes SearchWithLabels would return
+func (r *NoteRepository) CountWithLabels(userID uuid.UUID, query, language string, labelIDs []uuid.UUID, color string, includeArchived bool) (int64, error) {
+	if language == "" {
+		language = "simple"
 	}
 
-	// Add text search if query is provided
+	db := r.db.Model(&models.Note{}).
+		Scopes(accessibleBy(userID), labelFilter(userID, labelIDs, color, includeArchived)).
+		Where("notes.is_deleted = ?", false)
 	if query != "" {
-		baseQuery = baseQuery.Where("(title ILIKE ? OR content ILIKE ?)", "%"+query+"%", "%"+query+"%")
+		db = db.Joins("CROSS JOIN (SELECT websearch_to_tsquery(?::regconfig, ?) AS query) q", language, query).
+			Where("(numnode(q.query) = 0 OR notes.search_vector @@ q.query)")
 	}
 
-	// Add label filtering if label IDs are provided
-	if len(labelIDs) > 0 {
-		baseQuery = baseQuery.Joins("INNER JOIN note_labels ON notes.id = note_labels.note_id").
-			Where("note_labels.label_id IN ?", labelIDs).
-			Group("notes.id")
+	var count int64
+	err := db.Count(&count).Error
+	return count, err
+}
+
+// GetPageWithLabels pages through the notes SearchWithLabels would return,
+// pinned first and then in the page's sort order rather than by relevance,
+// so a saved view can be walked with the same cursors as other listings
+func (r *NoteRepository) GetPageWithLabels(userID uuid.UUID, query, language string, labelIDs []uuid.UUID, color string, includeArchived bool, page pagination.Page) (*models.NotePage, error) {
+	if language == "" {
+		language = "simple"
 	}
 
-	err := baseQuery.Preload("Labels").
-		Order("is_pinned DESC, updated_at DESC").
-		Find(&notes).Error
+	filter := labelFilter(userID, labelIDs, color, includeArchived)
+	return r.listPage(userID, func(db *gorm.DB) *gorm.DB {
+		db = filter(db).Where("notes.is_deleted = ?", false)
+		if query != "" {
+			db = db.Where("notes.search_vector @@ websearch_to_tsquery(?::regconfig, ?)", language, query)
+		}
+		return db
+	}, true, page)
+}
 
-	return notes, err
+func labelFilter(userID uuid.UUID, labelIDs []uuid.UUID, color string, includeArchived bool) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if !includeArchived {
+			db = db.Where("notes.is_archived = ?", false)
+		}
+		if len(labelIDs) > 0 {
+			db = db.Where("EXISTS (SELECT 1 FROM note_labels nl JOIN labels l ON l.id = nl.label_id WHERE nl.note_id = notes.id AND l.user_id = ? AND nl.label_id IN ?)", userID, labelIDs)
+		}
+		if color != "" {
+			db = db.Where("notes.color = ?", color)
+		}
+		return db
+	}
 }
 
-func (r *NoteRepository) SearchByColor(userID uuid.UUID, color string, includeArchived bool) ([]models.Note, error) {
-	var notes []models.Note
+// GetPage lists the notes the user can see, pinned first
+func (r *NoteRepository) GetPage(userID uuid.UUID, includeArchived, includeDeleted bool, page pagination.Page) (*models.NotePage, error) {
+	return r.listPage(userID, func(db *gorm.DB) *gorm.DB {
+		if !includeArchived {
+			db = db.Where("notes.is_archived = ?", false)
+		}
+		if !includeDeleted {
+			db = db.Where("notes.is_deleted = ?", false)
+		}
+		return db
+	}, true, page)
+}
 
-	query := r.db.Where("user_id = ? AND is_deleted = ? AND color = ?", userID, false, color)
+func (r *NoteRepository) GetPinnedPage(userID uuid.UUID, page pagination.Page) (*models.NotePage, error) {
+	return r.listPage(userID, func(db *gorm.DB) *gorm.DB {
+		return db.Where("notes.is_pinned = ? AND notes.is_deleted = ? AND notes.is_archived = ?", true, false, false)
+	}, false, page)
+}
 
-	if !includeArchived {
-		query = query.Where("is_archived = ?", false)
+func (r *NoteRepository) GetArchivedPage(userID uuid.UUID, page pagination.Page) (*models.NotePage, error) {
+	return r.listPage(userID, func(db *gorm.DB) *gorm.DB {
+		return db.Where("notes.is_archived = ? AND notes.is_deleted = ?", true, false)
+	}, false, page)
+}
+
+func (r *NoteRepository) GetPageByLabel(userID, labelID uuid.UUID, page pagination.Page) (*models.NotePage, error) {
+	return r.listPage(userID, func(db *gorm.DB) *gorm.DB {
+		return db.Where("notes.is_deleted = ? AND EXISTS (SELECT 1 FROM note_labels nl WHERE nl.note_id = notes.id AND nl.label_id = ?)", false, labelID)
+	}, false, page)
+}
+
+// listPage returns a page of the notes the user can see that pass filter,
+// ordered by the page's sort field with IDs breaking ties
+func (r *NoteRepository) listPage(userID uuid.UUID, filter func(*gorm.DB) *gorm.DB, pinnedFirst bool, page pagination.Page) (*models.NotePage, error) {
+	result := &models.NotePage{}
+
+	if page.WithTotal {
+		var total int64
+		if err := r.db.Model(&models.Note{}).Scopes(accessibleBy(userID), filter).Count(&total).Error; err != nil {
+			return nil, err
+		}
+		result.Total = &total
 	}
 
-	err := query.Preload("Labels").
-		Order("is_pinned DESC, updated_at DESC").
-		Find(&notes).Error
+	direction := " ASC"
+	if page.Desc {
+		direction = " DESC"
+	}
+	column := "notes." + page.Sort
 
-	return notes, err
-}
+	query := r.db.Scopes(accessibleBy(userID), filter)
+	if pinnedFirst {
+		query = query.Order("notes.is_pinned DESC")
+	}
+	query = query.Order(column + direction).Order("notes.id" + direction)
+
+	if page.After != nil {
+		var keys []keysetKey
+		if pinnedFirst {
+			if page.After.Pinned == nil {
+				return nil, pagination.ErrCursorMismatch
+			}
+			keys = append(keys, keysetKey{column: "notes.is_pinned", desc: true, value: *page.After.Pinned})
+		}
+		value, err := cursorValue(page.Sort, page.After.Value)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys,
+			keysetKey{column: column, desc: page.Desc, value: value},
+			keysetKey{column: "notes.id", desc: page.Desc, value: page.After.ID})
+
+		condition, args := keysetCondition(keys)
+		query = query.Where(condition, args...)
+	}
 
-func (r *NoteRepository) GetPinnedNotes(userID uuid.UUID) ([]models.Note, error) {
+	// One extra row tells whether there is a next page
 	var notes []models.Note
-	err := r.db.Where("user_id = ? AND is_pinned = ? AND is_deleted = ? AND is_archived = ?",
-		userID, true, false, false).
-		Preload("Labels").
-		Order("position ASC, updated_at DESC").
+	err := query.Preload("Labels", "labels.user_id = ?", userID).Preload("Items", orderItems).
+		Limit(page.Limit + 1).
 		Find(&notes).Error
-	return notes, err
+	if err != nil {
+		return nil, err
+	}
+
+	if len(notes) > page.Limit {
+		notes = notes[:page.Limit]
+		last := notes[len(notes)-1]
+		cursor := &pagination.Cursor{Sort: page.Sort, Desc: page.Desc, Value: sortValue(&last, page.Sort), ID: last.ID}
+		if pinnedFirst {
+			cursor.Pinned = &last.IsPinned
+		}
+		result.NextCursor = cursor.Encode()
+	}
+	result.Notes = notes
+	return result, nil
 }
 
-func (r *NoteRepository) GetArchivedNotes(userID uuid.UUID) ([]models.Note, error) {
-	var notes []models.Note
-	err := r.db.Where("user_id = ? AND is_archived = ? AND is_deleted = ?",
-		userID, true, false).
-		Preload("Labels").
-		Order("updated_at DESC").
-		Find(&notes).Error
-	return notes, err
+type keysetKey struct {
+	column string
+	desc   bool
+	value  interface{}
+}
+
+// keysetCondition matches rows that sort after the given key values:
+// (a > x) OR (a = x AND b > y) OR ..., flipping > to < for descending keys
+func keysetCondition(keys []keysetKey) (string, []interface{}) {
+	var alternatives []string
+	var args []interface{}
+	for i, key := range keys {
+		var parts []string
+		for _, previous := range keys[:i] {
+			parts = append(parts, previous.column+" = ?")
+			args = append(args, previous.value)
+		}
+		operator := " > ?"
+		if key.desc {
+			operator = " < ?"
+		}
+		parts = append(parts, key.column+operator)
+		args = append(args, key.value)
+		alternatives = append(alternatives, "("+strings.Join(parts, " AND ")+")")
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
+
+// sortValue renders a note's sort field for a cursor
+func sortValue(note *models.Note, sort string) string {
+	switch sort {
+	case pagination.SortCreatedAt:
+		return note.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case pagination.SortTitle:
+		return note.Title
+	case pagination.SortPosition:
+		return strconv.Itoa(note.Position)
+	default:
+		return note.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	}
+}
+
+// cursorValue parses a sort value written by sortValue
+func cursorValue(sort, value string) (interface{}, error) {
+	switch sort {
+	case pagination.SortTitle:
+		return value, nil
+	case pagination.SortPosition:
+		position, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, pagination.ErrInvalidCursor
+		}
+		return position, nil
+	default:
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, pagination.ErrInvalidCursor
+		}
+		return t, nil
+	}
+}
+
+func orderItems(db *gorm.DB) *gorm.DB {
+	return db.Order("position ASC, created_at ASC")
+}
+
+// accessibleBy limits a query to notes the user owns or collaborates on
+func accessibleBy(userID uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(`(notes.user_id = ? OR EXISTS (
+			SELECT 1 FROM note_collaborators nc WHERE nc.note_id = notes.id AND nc.user_id = ?))`, userID, userID)
+	}
+}
+
+// editableBy limits a query to notes the user owns or may edit
+func editableBy(userID uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(`(notes.user_id = ? OR EXISTS (
+			SELECT 1 FROM note_collaborators nc WHERE nc.note_id = notes.id AND nc.user_id = ? AND nc.role = ?))`,
+			userID, userID, models.RoleEditor)
+	}
 }
@@ -0,0 +1,66 @@
+package repositories
+
+import (
+	"time"
+
+	"google-keep-clone/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Tx is a transaction. Repositories bound to it with WithTx write within
+// it, so their changes and the events recorded with them commit together.
+type Tx struct {
+	db *gorm.DB
+}
+
+type OutboxRepository struct {
+	db *gorm.DB
+}
+
+func NewOutboxRepository(db *gorm.DB) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+// Transaction runs fn in a transaction, committing if it returns nil
+func (r *OutboxRepository) Transaction(fn func(tx *Tx) error) error {
+	return r.db.Transaction(func(db *gorm.DB) error {
+		return fn(&Tx{db: db})
+	})
+}
+
+// Record adds an event to the outbox within tx
+func (r *OutboxRepository) Record(tx *Tx, event *models.OutboxEvent) error {
+	return tx.db.Create(event).Error
+}
+
+// Dispatch hands the events due for delivery, oldest first, to deliver,
+// then saves what it recorded on them. The events stay locked meanwhile,
+// so other servers dispatching at the same time skip them.
+func (r *OutboxRepository) Dispatch(limit int, deliver func(event *models.OutboxEvent)) (int, error) {
+	var events []models.OutboxEvent
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("dispatched_at IS NULL AND next_attempt_at <= ?", time.Now()).
+			Order("id").Limit(limit).
+			Find(&events).Error; err != nil {
+			return err
+		}
+
+		for i := range events {
+			deliver(&events[i])
+			if err := tx.Model(&events[i]).
+				Select("delivered", "attempts", "last_error", "next_attempt_at", "dispatched_at").
+				Updates(&events[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return len(events), err
+}
+
+// DeleteDispatchedBefore forgets events dispatched before cutoff
+func (r *OutboxRepository) DeleteDispatchedBefore(cutoff time.Time) error {
+	return r.db.Where("dispatched_at < ?", cutoff).Delete(&models.OutboxEvent{}).Error
+}
@@ -0,0 +1,54 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"google-keep-clone/internal/models"
+	"gorm.io/gorm"
+)
+
+type RecoveryCodeRepository struct {
+	db *gorm.DB
+}
+
+func NewRecoveryCodeRepository(db *gorm.DB) *RecoveryCodeRepository {
+	return &RecoveryCodeRepository{db: db}
+}
+
+// Replace gives the user a new set of codes in place of any they had
+func (r *RecoveryCodeRepository) Replace(userID uuid.UUID, hashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		codes := make([]models.RecoveryCode, len(hashes))
+		for i, hash := range hashes {
+			codes[i] = models.RecoveryCode{UserID: userID, CodeHash: hash}
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// Consume uses up one of the user's unused codes, reporting whether it
+// matched one. Of two requests with the same code only one succeeds.
+func (r *RecoveryCodeRepository) Consume(userID uuid.UUID, hash string) (bool, error) {
+	result := r.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// CountUnused returns how many of the user's codes are left
+func (r *RecoveryCodeRepository) CountUnused(userID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *RecoveryCodeRepository) DeleteByUserID(userID uuid.UUID) error {
+	return r.db.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+}
@@ -0,0 +1,88 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"google-keep-clone/internal/models"
+	"gorm.io/gorm"
+)
+
+type ReminderRepository struct {
+	db *gorm.DB
+}
+
+func NewReminderRepository(db *gorm.DB) *ReminderRepository {
+	return &ReminderRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that works within tx
+func (r *ReminderRepository) WithTx(tx *Tx) *ReminderRepository {
+	return &ReminderRepository{db: tx.db}
+}
+
+func (r *ReminderRepository) Create(reminder *models.Reminder) error {
+	return r.db.Create(reminder).Error
+}
+
+func (r *ReminderRepository) GetByNoteID(noteID, userID uuid.UUID) (*models.Reminder, error) {
+	var reminder models.Reminder
+	err := r.db.Where("note_id = ? AND user_id = ?", noteID, userID).First(&reminder).Error
+	return &reminder, err
+}
+
+func (r *ReminderRepository) Update(reminder *models.Reminder) error {
+	return r.db.Omit("Note").Save(reminder).Error
+}
+
+func (r *ReminderRepository) Delete(noteID, userID uuid.UUID) error {
+	return r.db.Where("note_id = ? AND user_id = ?", noteID, userID).Delete(&models.Reminder{}).Error
+}
+
+// GetUpcoming returns pending reminders firing before `until`, soonest first
+func (r *ReminderRepository) GetUpcoming(userID uuid.UUID, until time.Time, limit int) ([]models.Reminder, error) {
+	var reminders []models.Reminder
+	err := r.db.Joins("INNER JOIN notes ON notes.id = reminders.note_id").
+		Where("reminders.user_id = ? AND reminders.is_done = ? AND reminders.fire_at <= ?", userID, false, until).
+		Where("notes.is_deleted = ? AND notes.deleted_at IS NULL", false).
+		Preload("Note").
+		Order("reminders.fire_at ASC").
+		Limit(limit).
+		Find(&reminders).Error
+	return reminders, err
+}
+
+// GetDue returns pending reminders whose fire time has passed, including
+// ones that came due while the server was down
+func (r *ReminderRepository) GetDue(now time.Time, limit int) ([]models.Reminder, error) {
+	var reminders []models.Reminder
+	err := r.db.Joins("INNER JOIN notes ON notes.id = reminders.note_id").
+		Where("reminders.is_done = ? AND reminders.fire_at <= ?", false, now).
+		Where("notes.is_deleted = ? AND notes.deleted_at IS NULL", false).
+		Preload("Note").
+		Order("reminders.fire_at ASC").
+		Limit(limit).
+		Find(&reminders).Error
+	return reminders, err
+}
+
+// ClaimFire moves a due reminder past the occurrence it was loaded with.
+// The update only matches while fire_at still equals firedAt, so a reminder
+// is claimed at most once even across scheduler runs or replicas. A nil next
+// marks the reminder as done.
+func (r *ReminderRepository) ClaimFire(id uuid.UUID, firedAt time.Time, next *time.Time, now time.Time) (bool, error) {
+	updates := map[string]interface{}{
+		"last_fired_at": now,
+		"updated_at":    now,
+	}
+	if next != nil {
+		updates["fire_at"] = *next
+	} else {
+		updates["is_done"] = true
+	}
+
+	result := r.db.Model(&models.Reminder{}).
+		Where("id = ? AND fire_at = ? AND is_done = ?", id, firedAt, false).
+		Updates(updates)
+	return result.RowsAffected == 1, result.Error
+}
@@ -0,0 +1,49 @@
+package repositories
+
+import (
+	"github.com/google/uuid"
+	"google-keep-clone/internal/models"
+	"gorm.io/gorm"
+)
+
+type RevisionRepository struct {
+	db *gorm.DB
+}
+
+func NewRevisionRepository(db *gorm.DB) *RevisionRepository {
+	return &RevisionRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that works within tx
+func (r *RevisionRepository) WithTx(tx *Tx) *RevisionRepository {
+	return &RevisionRepository{db: tx.db}
+}
+
+func (r *RevisionRepository) Create(revision *models.NoteRevision) error {
+	return r.db.Create(revision).Error
+}
+
+func (r *RevisionRepository) GetByNoteID(noteID uuid.UUID) ([]models.NoteRevision, error) {
+	var revisions []models.NoteRevision
+	err := r.db.Where("note_id = ?", noteID).Order("created_at DESC").Find(&revisions).Error
+	return revisions, err
+}
+
+func (r *RevisionRepository) GetByID(id, noteID uuid.UUID) (*models.NoteRevision, error) {
+	var revision models.NoteRevision
+	err := r.db.Where("id = ? AND note_id = ?", id, noteID).First(&revision).Error
+	return &revision, err
+}
+
+func (r *RevisionRepository) GetLatest(noteID uuid.UUID) (*models.NoteRevision, error) {
+	var revision models.NoteRevision
+	err := r.db.Where("note_id = ?", noteID).Order("created_at DESC").First(&revision).Error
+	return &revision, err
+}
+
+// Prune keeps only the newest keep revisions of a note
+func (r *RevisionRepository) Prune(noteID uuid.UUID, keep int) error {
+	return r.db.Exec(`DELETE FROM note_revisions WHERE note_id = ? AND id NOT IN (
+		SELECT id FROM note_revisions WHERE note_id = ? ORDER BY created_at DESC LIMIT ?
+	)`, noteID, noteID, keep).Error
+}
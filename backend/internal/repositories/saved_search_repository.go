@@ -0,0 +1,55 @@
+package repositories
+
+import (
+	"github.com/google/uuid"
+	"google-keep-clone/internal/models"
+	"gorm.io/gorm"
+)
+
+type SavedSearchRepository struct {
+	db *gorm.DB
+}
+
+func NewSavedSearchRepository(db *gorm.DB) *SavedSearchRepository {
+	return &SavedSearchRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that works within tx
+func (r *SavedSearchRepository) WithTx(tx *Tx) *SavedSearchRepository {
+	return &SavedSearchRepository{db: tx.db}
+}
+
+func (r *SavedSearchRepository) Create(search *models.SavedSearch) error {
+	return r.db.Create(search).Error
+}
+
+func (r *SavedSearchRepository) GetByUserID(userID uuid.UUID) ([]models.SavedSearch, error) {
+	var searches []models.SavedSearch
+	err := r.db.Where("user_id = ?", userID).Order("position ASC, created_at ASC").Find(&searches).Error
+	return searches, err
+}
+
+func (r *SavedSearchRepository) GetByID(id, userID uuid.UUID) (*models.SavedSearch, error) {
+	var search models.SavedSearch
+	err := r.db.Where("id = ? AND user_id = ?", id, userID).First(&search).Error
+	return &search, err
+}
+
+// NextPosition returns the position that puts a new view after the
+// user's existing ones
+func (r *SavedSearchRepository) NextPosition(userID uuid.UUID) (int, error) {
+	var position int
+	err := r.db.Model(&models.SavedSearch{}).
+		Where("user_id = ?", userID).
+		Select("COALESCE(MAX(position) + 1, 0)").
+		Scan(&position).Error
+	return position, err
+}
+
+func (r *SavedSearchRepository) Update(search *models.SavedSearch) error {
+	return r.db.Save(search).Error
+}
+
+func (r *SavedSearchRepository) Delete(id, userID uuid.UUID) error {
+	return r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.SavedSearch{}).Error
+}
@@ -0,0 +1,409 @@
+package repositories
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"google-keep-clone/internal/models"
+	"google-keep-clone/internal/searchquery"
+	"gorm.io/gorm"
+)
+
+// searchSchema keeps notes.search_vector up to date. Titles weigh more than
+// content and checklist items, and every note is stemmed with its owner's
+// search language.
+var searchSchema = []string{
+	`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+
+	`ALTER TABLE notes ADD COLUMN IF NOT EXISTS search_vector tsvector`,
+
+	`CREATE OR REPLACE FUNCTION note_search_vector(p_note_id uuid, p_user_id uuid, p_title text, p_content text)
+	RETURNS tsvector AS $$
+	DECLARE
+		cfg regconfig;
+	BEGIN
+		SELECT COALESCE(NULLIF(search_language, ''), 'simple')::regconfig INTO cfg FROM users WHERE id = p_user_id;
+		IF cfg IS NULL THEN
+			cfg := 'simple';
+		END IF;
+
+		RETURN setweight(to_tsvector(cfg, COALESCE(p_title, '')), 'A') ||
+			setweight(to_tsvector(cfg, COALESCE(p_content, '')), 'B') ||
+			setweight(to_tsvector(cfg, COALESCE(
+				(SELECT string_agg(ci.text, ' ') FROM checklist_items ci WHERE ci.note_id = p_note_id), '')), 'B');
+	END
+	$$ LANGUAGE plpgsql STABLE`,
+
+	`CREATE OR REPLACE FUNCTION notes_search_vector_update() RETURNS trigger AS $$
+	BEGIN
+		NEW.search_vector := note_search_vector(NEW.id, NEW.user_id, NEW.title, NEW.content);
+		RETURN NEW;
+	END
+	$$ LANGUAGE plpgsql`,
+
+	`DROP TRIGGER IF EXISTS notes_search_vector_trigger ON notes`,
+	`CREATE TRIGGER notes_search_vector_trigger
+		BEFORE INSERT OR UPDATE OF title, content ON notes
+		FOR EACH ROW EXECUTE FUNCTION notes_search_vector_update()`,
+
+	// Checklist items live in their own table, so changes to them refresh
+	// the parent note
+	`CREATE OR REPLACE FUNCTION checklist_items_search_vector_update() RETURNS trigger AS $$
+	DECLARE
+		target uuid;
+	BEGIN
+		IF TG_OP = 'DELETE' THEN
+			target := OLD.note_id;
+		ELSE
+			target := NEW.note_id;
+		END IF;
+
+		UPDATE notes SET search_vector = note_search_vector(notes.id, notes.user_id, notes.title, notes.content)
+		WHERE notes.id = target;
+		RETURN NULL;
+	END
+	$$ LANGUAGE plpgsql`,
+
+	`DROP TRIGGER IF EXISTS checklist_items_search_vector_trigger ON checklist_items`,
+	`CREATE TRIGGER checklist_items_search_vector_trigger
+		AFTER INSERT OR UPDATE OF text OR DELETE ON checklist_items
+		FOR EACH ROW EXECUTE FUNCTION checklist_items_search_vector_update()`,
+
+	`CREATE INDEX IF NOT EXISTS idx_notes_search_vector ON notes USING GIN (search_vector)`,
+
+	// Trigram indexes back fuzzy search
+	`CREATE INDEX IF NOT EXISTS idx_notes_title_trgm ON notes USING GIN (title gin_trgm_ops)`,
+	`CREATE INDEX IF NOT EXISTS idx_notes_content_trgm ON notes USING GIN (content gin_trgm_ops)`,
+
+	// Index notes written before the trigger existed
+	`UPDATE notes SET search_vector = note_search_vector(id, user_id, title, content) WHERE search_vector IS NULL`,
+}
+
+// MigrateSearch installs the full-text search column, triggers and indexes.
+// It is safe to run on every start.
+func MigrateSearch(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range searchSchema {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Highlighted snippets are HTML-escaped before matches are wrapped in
+// <mark>, so clients can render them as HTML
+const (
+	headlineOptions      = `StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=" … "`
+	titleHeadlineOptions = `StartSel=<mark>, StopSel=</mark>, HighlightAll=true`
+)
+
+func escapedHTML(column string) string {
+	return "replace(replace(replace(COALESCE(" + column + ", ''), '&', '&amp;'), '<', '&lt;'), '>', '&gt;')"
+}
+
+type searchHit struct {
+	ID             uuid.UUID
+	Rank           float64
+	TitleHighlight string
+	Snippet        string
+}
+
+// fullTextSearch ranks the notes the user can see against a web-search
+// style query ("quoted phrases", -excluded, or).
+func (r *NoteRepository) fullTextSearch(userID uuid.UUID, query, language string, filter func(*gorm.DB) *gorm.DB, limit, offset int) ([]models.NoteSearchResult, error) {
+	return r.searchNotes(userID, []string{query}, language, func(db *gorm.DB) *gorm.DB {
+		db = db.Where("notes.is_deleted = ?", false)
+		if filter != nil {
+			db = filter(db)
+		}
+		return db
+	}, limit, offset)
+}
+
+// searchNotes lists the notes the user can see that pass filter. With
+// text queries, notes must also match every one of them and come back best
+// match first, with highlights. Notes are stemmed with their owner's language, so a
+// collaborator searching a shared note in another language may miss word
+// forms. Filters can use q.cfg, the searcher's text search configuration.
+func (r *NoteRepository) searchNotes(userID uuid.UUID, texts []string, language string, filter func(*gorm.DB) *gorm.DB, limit, offset int) ([]models.NoteSearchResult, error) {
+	if language == "" {
+		language = "simple"
+	}
+
+	tsquery, args := textQuery(language, texts)
+	query := r.db.Table("notes").
+		Joins("CROSS JOIN (SELECT ?::regconfig AS cfg, "+tsquery+" AS query) q", append([]interface{}{language}, args...)...).
+		Scopes(accessibleBy(userID), filter)
+
+	if strings.TrimSpace(strings.Join(texts, "")) != "" {
+		// A query of nothing but stop words has no lexemes and would match
+		// nothing; treat it as no text at all
+		query = query.Select("notes.id, ts_rank(notes.search_vector, q.query) AS rank, "+
+			"ts_headline(q.cfg, "+escapedHTML("notes.title")+", q.query, ?) AS title_highlight, "+
+			"ts_headline(q.cfg, "+escapedHTML("notes.content")+", q.query, ?) AS snippet",
+			titleHeadlineOptions, headlineOptions).
+			Where("(numnode(q.query) = 0 OR notes.search_vector @@ q.query)").
+			Order("rank DESC, notes.updated_at DESC")
+	} else {
+		query = query.Select("notes.id").Order("notes.is_pinned DESC, notes.updated_at DESC")
+	}
+
+	if limit > 0 {
+		query = query.Limit(limit).Offset(offset)
+	}
+
+	var hits []searchHit
+	if err := query.Scan(&hits).Error; err != nil {
+		return nil, err
+	}
+	return r.loadSearchResults(userID, hits)
+}
+
+// textQuery compiles web-search style queries into one tsquery expression
+// matching all of them. Each is parsed on its own, so the "or"s inside one
+// can't reach into the next.
+func textQuery(language string, texts []string) (string, []interface{}) {
+	if len(texts) == 0 {
+		texts = []string{""}
+	}
+
+	parts := make([]string, len(texts))
+	args := make([]interface{}, 0, 2*len(texts))
+	for i, text := range texts {
+		parts[i] = "websearch_to_tsquery(?::regconfig, ?)"
+		args = append(args, language, text)
+	}
+	return "(" + strings.Join(parts, " && ") + ")", args
+}
+
+// loadSearchResults loads the notes behind hits for the user, keeping
+// their order
+func (r *NoteRepository) loadSearchResults(userID uuid.UUID, hits []searchHit) ([]models.NoteSearchResult, error) {
+	if len(hits) == 0 {
+		return []models.NoteSearchResult{}, nil
+	}
+
+	ids := make([]uuid.UUID, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+
+	var notes []models.Note
+	if err := r.db.Where("id IN ?", ids).Preload("Labels", "labels.user_id = ?", userID).Find(&notes).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]models.Note, len(notes))
+	for _, note := range notes {
+		byID[note.ID] = note
+	}
+
+	results := make([]models.NoteSearchResult, 0, len(hits))
+	for _, hit := range hits {
+		note, ok := byID[hit.ID]
+		if !ok {
+			continue
+		}
+		results = append(results, models.NoteSearchResult{
+			Note:           note,
+			Rank:           hit.Rank,
+			TitleHighlight: hit.TitleHighlight,
+			Snippet:        strings.TrimSpace(hit.Snippet),
+		})
+	}
+	return results, nil
+}
+
+// SearchQuery runs a parsed search query. Text-only clauses are matched
+// and ranked together as one full-text query; clauses that OR text with
+// filters become conditions of their own.
+func (r *NoteRepository) SearchQuery(userID uuid.UUID, parsed *searchquery.Query, language string, limit, offset int) ([]models.NoteSearchResult, error) {
+	return r.searchNotes(userID, parsed.TextQueries(), language, queryFilter(userID, parsed), limit, offset)
+}
+
+// FuzzySearch runs a parsed search query with its text matched by trigram
+// similarity instead of full-text search, so misspelt words still find
+// notes. Notes scoring below threshold (0 to 1) are left out and the rest
+// come back best match first.
+func (r *NoteRepository) FuzzySearch(userID uuid.UUID, parsed *searchquery.Query, language string, threshold float64, limit, offset int) ([]models.NoteSearchResult, error) {
+	// Excluded words still exclude exactly; the rest is matched loosely
+	var words []string
+	var excluded []searchquery.Term
+	for _, clause := range parsed.Clauses {
+		if !clause.IsText() {
+			continue
+		}
+		for _, term := range clause.Terms {
+			if term.Negated {
+				excluded = append(excluded, term)
+			} else {
+				words = append(words, term.Value)
+			}
+		}
+	}
+	text := strings.Join(words, " ")
+	if strings.TrimSpace(text) == "" {
+		return r.SearchQuery(userID, parsed, language, limit, offset)
+	}
+	if language == "" {
+		language = "simple"
+	}
+
+	var hits []searchHit
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// The thresholds only last until the end of the transaction
+		value := strconv.FormatFloat(threshold, 'f', -1, 64)
+		if err := tx.Exec("SELECT set_config('pg_trgm.word_similarity_threshold', ?, true)", value).Error; err != nil {
+			return err
+		}
+
+		query := tx.Table("notes").
+			Joins("CROSS JOIN (SELECT ?::regconfig AS cfg) q", language).
+			Scopes(accessibleBy(userID), queryFilter(userID, parsed)).
+			Select("notes.id, GREATEST(word_similarity(?, notes.title), word_similarity(?, notes.content)) AS rank", text, text).
+			Where("(? <% notes.title OR ? <% notes.content)", text, text).
+			Order("rank DESC, notes.updated_at DESC")
+		for _, term := range excluded {
+			condition, args := termCondition(userID, term)
+			query = query.Where("NOT "+condition, args...)
+		}
+		if limit > 0 {
+			query = query.Limit(limit).Offset(offset)
+		}
+		return query.Scan(&hits).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.loadSearchResults(userID, hits)
+}
+
+// queryFilter applies the clauses of a parsed query that involve filters.
+// Clauses made only of text are left to the caller to match.
+func queryFilter(userID uuid.UUID, parsed *searchquery.Query) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		// Trash stays out of results unless asked for
+		if !parsed.Mentions(searchquery.FieldIs, "trashed") {
+			db = db.Where("notes.is_deleted = ?", false)
+		}
+
+		for _, clause := range parsed.Clauses {
+			if clause.IsText() {
+				continue
+			}
+
+			conditions := make([]string, len(clause.Terms))
+			var args []interface{}
+			for i, term := range clause.Terms {
+				sql, termArgs := termCondition(userID, term)
+				if term.Negated {
+					sql = "NOT " + sql
+				}
+				conditions[i] = sql
+				args = append(args, termArgs...)
+			}
+			db = db.Where("("+strings.Join(conditions, " OR ")+")", args...)
+		}
+		return db
+	}
+}
+
+// SimilarWords finds, for each word, the closest word in the user's own
+// notes with a trigram similarity of at least threshold. Words that appear
+// in the notes as they are map to themselves; words with no close match
+// are left out.
+func (r *NoteRepository) SimilarWords(userID uuid.UUID, words []string, threshold float64) (map[string]string, error) {
+	if len(words) == 0 {
+		return map[string]string{}, nil
+	}
+
+	// ts_stat takes the query to gather words from as text. The user ID is
+	// a formatted UUID, so it is safe to inline.
+	vocabulary := fmt.Sprintf(
+		"SELECT to_tsvector('simple', COALESCE(title, '') || ' ' || COALESCE(content, '')) FROM notes WHERE user_id = '%s' AND is_deleted = false",
+		userID)
+
+	var rows []struct {
+		Original   string
+		Suggestion string
+	}
+	err := r.db.Raw(`
+		SELECT DISTINCT ON (w.word) w.word AS original, v.word AS suggestion
+		FROM unnest(string_to_array(?, ' ')) AS w(word)
+		JOIN ts_stat(?) v ON similarity(v.word, w.word) >= ?
+		ORDER BY w.word, similarity(v.word, w.word) DESC, v.nentry DESC`,
+		strings.Join(words, " "), vocabulary, threshold).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	similar := make(map[string]string, len(rows))
+	for _, row := range rows {
+		similar[row.Original] = row.Suggestion
+	}
+	return similar, nil
+}
+
+// termCondition compiles one term into a parenthesized SQL condition on
+// notes
+func termCondition(userID uuid.UUID, term searchquery.Term) (string, []interface{}) {
+	switch term.Kind {
+	case searchquery.Word, searchquery.Phrase:
+		text := term.WebSearch()
+		if term.Negated {
+			// The NOT is applied by the caller
+			text = strings.TrimPrefix(text, "-")
+		}
+		return "(numnode(websearch_to_tsquery(q.cfg, ?)) > 0 AND notes.search_vector @@ websearch_to_tsquery(q.cfg, ?))",
+			[]interface{}{text, text}
+	}
+
+	switch term.Field {
+	case searchquery.FieldLabel:
+		return "(EXISTS (SELECT 1 FROM note_labels nl JOIN labels l ON l.id = nl.label_id WHERE nl.note_id = notes.id AND l.user_id = ? AND lower(l.name) = lower(?)))",
+			[]interface{}{userID, term.Value}
+	case searchquery.FieldColor:
+		values := []string{term.Value}
+		if aliases, ok := searchquery.ColorAliases[term.Value]; ok {
+			values = aliases
+		}
+		return "(lower(notes.color) IN ?)", []interface{}{values}
+	case searchquery.FieldIs:
+		switch term.Value {
+		case "pinned":
+			return "(notes.is_pinned)", nil
+		case "archived":
+			return "(notes.is_archived)", nil
+		case "trashed":
+			return "(notes.is_deleted)", nil
+		case "shared":
+			return "(notes.user_id <> ? OR EXISTS (SELECT 1 FROM note_collaborators sc WHERE sc.note_id = notes.id))",
+				[]interface{}{userID}
+		}
+	case searchquery.FieldHas:
+		switch term.Value {
+		case "checklist":
+			return "(EXISTS (SELECT 1 FROM checklist_items ci WHERE ci.note_id = notes.id))", nil
+		case "attachment":
+			return "(EXISTS (SELECT 1 FROM attachments a WHERE a.note_id = notes.id))", nil
+		case "image":
+			return "(EXISTS (SELECT 1 FROM attachments a WHERE a.note_id = notes.id AND a.mime_type LIKE 'image/%'))", nil
+		case "reminder":
+			return "(EXISTS (SELECT 1 FROM reminders rm WHERE rm.note_id = notes.id AND rm.user_id = ? AND NOT rm.is_done))",
+				[]interface{}{userID}
+		case "label":
+			return "(EXISTS (SELECT 1 FROM note_labels nl JOIN labels l ON l.id = nl.label_id WHERE nl.note_id = notes.id AND l.user_id = ?))",
+				[]interface{}{userID}
+		}
+	case searchquery.FieldBefore:
+		return "(notes.created_at < ?)", []interface{}{term.Date}
+	case searchquery.FieldAfter:
+		// after: starts the day after the one given, which is excluded
+		return "(notes.created_at >= ?)", []interface{}{term.Date.AddDate(0, 0, 1)}
+	}
+
+	return "(TRUE)", nil
+}
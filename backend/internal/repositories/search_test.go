@@ -0,0 +1,104 @@
+package repositories
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"google-keep-clone/internal/searchquery"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestTextQuerySeparatesClauses(t *testing.T) {
+	parsed, err := searchquery.Parse("a OR b c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sql, args := textQuery("english", parsed.TextQueries())
+	want := "(websearch_to_tsquery(?::regconfig, ?) && websearch_to_tsquery(?::regconfig, ?))"
+	if sql != want {
+		t.Errorf("sql = %s; want %s", sql, want)
+	}
+	if len(args) != 4 || args[1] != "a or b" || args[3] != "c" {
+		t.Errorf("args = %q; want the clauses a or b and c", args)
+	}
+
+	if sql, _ := textQuery("english", nil); !strings.Contains(sql, "websearch_to_tsquery") {
+		t.Errorf("sql for no text = %s; want an empty query", sql)
+	}
+}
+
+// TestDateConditions checks before: and after: both leave out the day
+// given
+func TestDateConditions(t *testing.T) {
+	parsed, err := searchquery.Parse("before:2025-06-10 after:2025-06-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		sql  string
+		date time.Time
+	}{
+		{"(notes.created_at < ?)", time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC)},
+		{"(notes.created_at >= ?)", time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)},
+	}
+	if len(parsed.Clauses) != len(tests) {
+		t.Fatalf("%d clauses; want %d", len(parsed.Clauses), len(tests))
+	}
+	for i, test := range tests {
+		sql, args := termCondition(uuid.New(), parsed.Clauses[i].Terms[0])
+		if sql != test.sql || len(args) != 1 || !args[0].(time.Time).Equal(test.date) {
+			t.Errorf("%s: %s %v; want %s %v", parsed.Clauses[i].Terms[0].Field, sql, args, test.sql, test.date)
+		}
+	}
+}
+
+// TestTextQueryPrecedence checks with Postgres itself that OR stays within
+// its clause. It runs when TEST_DATABASE_URL is set.
+func TestTextQueryPrecedence(t *testing.T) {
+	db := testDB(t)
+
+	tests := []struct {
+		input, want string
+	}{
+		{"a OR b c", "( 'a' | 'b' ) & 'c'"},
+		{"c a OR b", "'c' & ( 'a' | 'b' )"},
+		{"cat OR dog food", "( 'cat' | 'dog' ) & 'food'"},
+		{"cat", "'cat'"},
+	}
+	for _, test := range tests {
+		parsed, err := searchquery.Parse(test.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sql, args := textQuery("simple", parsed.TextQueries())
+		var got string
+		if err := db.Raw("SELECT ("+sql+")::text", args...).Scan(&got).Error; err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("%q compiled to %s; want %s", test.input, got, test.want)
+		}
+	}
+}
+
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(url), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connecting to the test database: %v", err)
+	}
+	return db
+}
@@ -0,0 +1,84 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"google-keep-clone/internal/models"
+	"gorm.io/gorm"
+)
+
+type SessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+func (r *SessionRepository) Create(session *models.Session) error {
+	return r.db.Create(session).Error
+}
+
+func (r *SessionRepository) GetByID(id uuid.UUID) (*models.Session, error) {
+	var session models.Session
+	err := r.db.Where("id = ?", id).First(&session).Error
+	return &session, err
+}
+
+// GetActiveByUserID returns the user's sessions that are neither revoked
+// nor expired, most recently used first
+func (r *SessionRepository) GetActiveByUserID(userID uuid.UUID) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// Rotate replaces the session's refresh token hash with next, as long as
+// it is still current and the session active. It reports false if
+// another refresh got there first.
+func (r *SessionRepository) Rotate(session *models.Session, current, next string) (bool, error) {
+	now := time.Now()
+	result := r.db.Model(&models.Session{}).
+		Where("id = ? AND token_hash = ? AND revoked_at IS NULL", session.ID, current).
+		Updates(map[string]interface{}{
+			"token_hash":          next,
+			"previous_token_hash": current,
+			"rotated_at":          now,
+			"last_used_at":        now,
+			"expires_at":          session.ExpiresAt,
+			"ip_address":          session.IPAddress,
+			"user_agent":          session.UserAgent,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// Touch records that the session was just used from ipAddress
+func (r *SessionRepository) Touch(id uuid.UUID, ipAddress string) error {
+	return r.db.Model(&models.Session{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"last_used_at": time.Now(), "ip_address": ipAddress}).Error
+}
+
+// Revoke ends one of the user's sessions. It reports false if there was
+// no such active session.
+func (r *SessionRepository) Revoke(id, userID uuid.UUID, reason string) (bool, error) {
+	result := r.db.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": reason})
+	return result.RowsAffected == 1, result.Error
+}
+
+// RevokeAllForUser ends every session of the user
+func (r *SessionRepository) RevokeAllForUser(userID uuid.UUID, reason string) error {
+	return r.db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": reason}).Error
+}
+
+// DeleteEndedBefore forgets sessions that expired or were revoked before
+// cutoff
+func (r *SessionRepository) DeleteEndedBefore(cutoff time.Time) error {
+	return r.db.Where("expires_at < ? OR revoked_at < ?", cutoff, cutoff).Delete(&models.Session{}).Error
+}
@@ -0,0 +1,196 @@
+package repositories
+
+import (
+	"github.com/google/uuid"
+	"google-keep-clone/internal/models"
+	"gorm.io/gorm"
+)
+
+// syncSchema records every change to notes, labels and the links between
+// them in sync_changes, for each user who can see the record. Link,
+// checklist, attachment and sharing changes count as changes to their
+// note. Each user has one row per record holding its latest change, so the
+// log stays as large as the data it describes.
+var syncSchema = []string{
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS change_seq bigint NOT NULL DEFAULT 0`,
+
+	// Bumping the user's counter locks their row until the transaction
+	// ends, so changes commit in sequence order and a client reading up to
+	// a sequence can never miss a lower one committed later
+	`CREATE OR REPLACE FUNCTION record_change(p_user_id uuid, p_type text, p_id uuid, p_deleted boolean)
+	RETURNS void AS $$
+	DECLARE
+		next_seq bigint;
+	BEGIN
+		UPDATE users SET change_seq = change_seq + 1 WHERE id = p_user_id RETURNING change_seq INTO next_seq;
+		IF next_seq IS NULL THEN
+			RETURN;
+		END IF;
+
+		INSERT INTO sync_changes (user_id, entity_type, entity_id, seq, deleted, changed_at)
+		VALUES (p_user_id, p_type, p_id, next_seq, p_deleted, now())
+		ON CONFLICT (user_id, entity_type, entity_id)
+		DO UPDATE SET seq = EXCLUDED.seq, deleted = EXCLUDED.deleted, changed_at = EXCLUDED.changed_at;
+	END
+	$$ LANGUAGE plpgsql`,
+
+	// Records a note change for its owner and collaborators, in user order
+	// so concurrent changes lock users the same way round
+	`CREATE OR REPLACE FUNCTION record_note_change(p_note_id uuid, p_deleted boolean)
+	RETURNS void AS $$
+	DECLARE
+		audience uuid;
+	BEGIN
+		FOR audience IN
+			SELECT user_id FROM notes WHERE id = p_note_id
+			UNION
+			SELECT user_id FROM note_collaborators WHERE note_id = p_note_id
+			ORDER BY 1
+		LOOP
+			PERFORM record_change(audience, 'note', p_note_id, p_deleted);
+		END LOOP;
+	END
+	$$ LANGUAGE plpgsql`,
+
+	// Any real change to a note moves its version on, whichever code path
+	// made it, so clients can detect edits they haven't seen
+	`CREATE OR REPLACE FUNCTION notes_version_bump() RETURNS trigger AS $$
+	BEGIN
+		IF (to_jsonb(NEW) - 'search_vector' - 'version') <> (to_jsonb(OLD) - 'search_vector' - 'version') THEN
+			NEW.version := OLD.version + 1;
+		END IF;
+		RETURN NEW;
+	END
+	$$ LANGUAGE plpgsql`,
+
+	`DROP TRIGGER IF EXISTS notes_version_trigger ON notes`,
+	`CREATE TRIGGER notes_version_trigger
+		BEFORE UPDATE ON notes
+		FOR EACH ROW EXECUTE FUNCTION notes_version_bump()`,
+
+	`CREATE OR REPLACE FUNCTION notes_sync_change() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP = 'DELETE' THEN
+			PERFORM record_note_change(OLD.id, true);
+			-- The note row is gone, so its owner isn't found above
+			PERFORM record_change(OLD.user_id, 'note', OLD.id, true);
+			RETURN NULL;
+		END IF;
+
+		-- Re-indexing for search isn't a change clients care about
+		IF TG_OP = 'UPDATE' AND (to_jsonb(NEW) - 'search_vector') = (to_jsonb(OLD) - 'search_vector') THEN
+			RETURN NULL;
+		END IF;
+
+		PERFORM record_note_change(NEW.id, NEW.deleted_at IS NOT NULL);
+		RETURN NULL;
+	END
+	$$ LANGUAGE plpgsql`,
+
+	`DROP TRIGGER IF EXISTS notes_sync_trigger ON notes`,
+	`CREATE TRIGGER notes_sync_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON notes
+		FOR EACH ROW EXECUTE FUNCTION notes_sync_change()`,
+
+	// Rows that belong to a note: label links, checklist items, attachments
+	`CREATE OR REPLACE FUNCTION note_child_sync_change() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP = 'DELETE' THEN
+			PERFORM record_note_change(OLD.note_id, false);
+		ELSE
+			PERFORM record_note_change(NEW.note_id, false);
+			IF TG_OP = 'UPDATE' AND NEW.note_id <> OLD.note_id THEN
+				PERFORM record_note_change(OLD.note_id, false);
+			END IF;
+		END IF;
+		RETURN NULL;
+	END
+	$$ LANGUAGE plpgsql`,
+
+	`DROP TRIGGER IF EXISTS note_labels_sync_trigger ON note_labels`,
+	`CREATE TRIGGER note_labels_sync_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON note_labels
+		FOR EACH ROW EXECUTE FUNCTION note_child_sync_change()`,
+	`DROP TRIGGER IF EXISTS checklist_items_sync_trigger ON checklist_items`,
+	`CREATE TRIGGER checklist_items_sync_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON checklist_items
+		FOR EACH ROW EXECUTE FUNCTION note_child_sync_change()`,
+	`DROP TRIGGER IF EXISTS attachments_sync_trigger ON attachments`,
+	`CREATE TRIGGER attachments_sync_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON attachments
+		FOR EACH ROW EXECUTE FUNCTION note_child_sync_change()`,
+
+	// Sharing a note adds it to the collaborator's records; unsharing
+	// leaves them a tombstone
+	`CREATE OR REPLACE FUNCTION note_collaborators_sync_change() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP = 'DELETE' THEN
+			PERFORM record_change(OLD.user_id, 'note', OLD.note_id, true);
+			PERFORM record_note_change(OLD.note_id, false);
+		ELSE
+			PERFORM record_note_change(NEW.note_id, false);
+		END IF;
+		RETURN NULL;
+	END
+	$$ LANGUAGE plpgsql`,
+
+	`DROP TRIGGER IF EXISTS note_collaborators_sync_trigger ON note_collaborators`,
+	`CREATE TRIGGER note_collaborators_sync_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON note_collaborators
+		FOR EACH ROW EXECUTE FUNCTION note_collaborators_sync_change()`,
+
+	`CREATE OR REPLACE FUNCTION labels_sync_change() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP = 'DELETE' THEN
+			PERFORM record_change(OLD.user_id, 'label', OLD.id, true);
+		ELSE
+			PERFORM record_change(NEW.user_id, 'label', NEW.id, false);
+		END IF;
+		RETURN NULL;
+	END
+	$$ LANGUAGE plpgsql`,
+
+	`DROP TRIGGER IF EXISTS labels_sync_trigger ON labels`,
+	`CREATE TRIGGER labels_sync_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON labels
+		FOR EACH ROW EXECUTE FUNCTION labels_sync_change()`,
+}
+
+// MigrateSync installs the change log and note version triggers. It is safe to run on every
+// start, after AutoMigrate has created sync_changes.
+func MigrateSync(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range syncSchema {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type SyncRepository struct {
+	db *gorm.DB
+}
+
+func NewSyncRepository(db *gorm.DB) *SyncRepository {
+	return &SyncRepository{db: db}
+}
+
+// CurrentSeq returns the sequence of the user's latest change
+func (r *SyncRepository) CurrentSeq(userID uuid.UUID) (int64, error) {
+	var seq int64
+	err := r.db.Raw("SELECT change_seq FROM users WHERE id = ?", userID).Scan(&seq).Error
+	return seq, err
+}
+
+// GetChanges returns up to limit of the user's changes after since, oldest
+// first
+func (r *SyncRepository) GetChanges(userID uuid.UUID, since int64, limit int) ([]models.SyncChange, error) {
+	var changes []models.SyncChange
+	err := r.db.Where("user_id = ? AND seq > ?", userID, since).
+		Order("seq ASC").
+		Limit(limit).
+		Find(&changes).Error
+	return changes, err
+}
@@ -1,6 +1,8 @@
 package repositories
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 	"google-keep-clone/internal/models"
 	"gorm.io/gorm"
@@ -34,6 +36,97 @@ func (r *UserRepository) Update(user *models.User) error {
 	return r.db.Save(user).Error
 }
 
+// UpdateName changes only the user's name, leaving columns changed
+// meanwhile, such as the password or two-factor state, alone
+func (r *UserRepository) UpdateName(id uuid.UUID, name string) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Update("name", name).Error
+}
+
+// MarkVerified records that the user has confirmed their email address
+func (r *UserRepository) MarkVerified(id uuid.UUID) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Update("is_verified", true).Error
+}
+
+func (r *UserRepository) UpdatePassword(id uuid.UUID, hash string) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Update("password", hash).Error
+}
+
+// SetTOTPSecret starts two-factor setup with a new secret, unless it is
+// already turned on
+func (r *UserRepository) SetTOTPSecret(id uuid.UUID, secret string) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND two_factor_enabled = false", id).
+		Update("totp_secret", secret)
+	return result.RowsAffected > 0, result.Error
+}
+
+// EnableTwoFactor turns two-factor authentication on, with the code for
+// step as the last one used
+func (r *UserRepository) EnableTwoFactor(id uuid.UUID, step int64) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"two_factor_enabled": true,
+		"totp_last_step":     step,
+		"totp_failures":      0,
+		"totp_locked_until":  nil,
+	}).Error
+}
+
+func (r *UserRepository) DisableTwoFactor(id uuid.UUID) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"two_factor_enabled": false,
+		"totp_secret":        "",
+		"totp_last_step":     0,
+		"totp_failures":      0,
+		"totp_locked_until":  nil,
+	}).Error
+}
+
+// UseTOTPStep records a code for step as used, reporting false if it or
+// a later one already was
+func (r *UserRepository) UseTOTPStep(id uuid.UUID, step int64) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", id, step).
+		Update("totp_last_step", step)
+	return result.RowsAffected > 0, result.Error
+}
+
+// BeginTOTPAttempt counts a two-factor attempt as a failure until
+// ResetTOTPFailures says otherwise. The maxFailures-th in a row locks
+// two-factor sign in until lockedUntil and starts the count again. The
+// lockout is checked in the same statement, so attempts made at once can't
+// all slip in before it; it reports false, counting nothing, while the
+// user is locked out.
+func (r *UserRepository) BeginTOTPAttempt(id uuid.UUID, maxFailures int, lockedUntil time.Time) (bool, error) {
+	var failures []int
+	err := r.db.Raw(`UPDATE users SET
+		totp_locked_until = CASE WHEN totp_failures + 1 >= ? THEN ? ELSE NULL END,
+		totp_failures = CASE WHEN totp_failures + 1 >= ? THEN 0 ELSE totp_failures + 1 END
+		WHERE id = ? AND (totp_locked_until IS NULL OR totp_locked_until <= ?)
+		RETURNING totp_failures`, maxFailures, lockedUntil, maxFailures, id, time.Now()).
+		Scan(&failures).Error
+	return len(failures) == 1, err
+}
+
+// ResetTOTPFailures clears the count after a right code, along with any
+// lockout its attempt started
+func (r *UserRepository) ResetTOTPFailures(id uuid.UUID) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"totp_failures":     0,
+		"totp_locked_until": nil,
+	}).Error
+}
+
+// UpdateSearchLanguage changes the language a user's notes are stemmed
+// with and re-indexes them
+func (r *UserRepository) UpdateSearchLanguage(id uuid.UUID, language string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", id).Update("search_language", language).Error; err != nil {
+			return err
+		}
+		return tx.Exec("UPDATE notes SET search_vector = note_search_vector(id, user_id, title, content) WHERE user_id = ?", id).Error
+	})
+}
+
 func (r *UserRepository) Delete(id uuid.UUID) error {
 	return r.db.Delete(&models.User{}, id).Error
 }
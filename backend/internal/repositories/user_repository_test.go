@@ -0,0 +1,57 @@
+package repositories
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"google-keep-clone/internal/models"
+)
+
+// TestBeginTOTPAttemptLocksOut checks attempts made at once can't get past
+// the lockout. It runs when TEST_DATABASE_URL is set.
+func TestBeginTOTPAttemptLocksOut(t *testing.T) {
+	db := testDB(t)
+	if err := db.AutoMigrate(&models.User{}); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewUserRepository(db)
+	user := &models.User{Email: uuid.NewString() + "@example.com", Password: "x", Name: "Test"}
+	if err := repo.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Unscoped().Delete(user) })
+
+	const maxFailures = 5
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 4*maxFailures; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := repo.BeginTOTPAttempt(user.ID, maxFailures, time.Now().Add(time.Hour))
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := allowed.Load(); n != maxFailures {
+		t.Errorf("%d attempts allowed; want %d", n, maxFailures)
+	}
+
+	// A right code lifts the lockout
+	if err := repo.ResetTOTPFailures(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := repo.BeginTOTPAttempt(user.ID, maxFailures, time.Now().Add(time.Hour)); err != nil || !ok {
+		t.Errorf("attempt after a reset refused (%v)", err)
+	}
+}
@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"google-keep-clone/internal/models"
+	"gorm.io/gorm"
+)
+
+type UserTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewUserTokenRepository(db *gorm.DB) *UserTokenRepository {
+	return &UserTokenRepository{db: db}
+}
+
+// Replace stores a new token, retiring any unused tokens the user had for
+// the same purpose so only the latest email works
+func (r *UserTokenRepository) Replace(token *models.UserToken) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", token.UserID, token.Purpose).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+}
+
+// IssuedSince reports whether the user was given a token for purpose
+// after since
+func (r *UserTokenRepository) IssuedSince(userID uuid.UUID, purpose string, since time.Time) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND created_at > ?", userID, purpose, since).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Consume uses up an unexpired token for purpose and returns the user it
+// was issued to. Of two requests with the same token only one succeeds.
+func (r *UserTokenRepository) Consume(hash, purpose string) (uuid.UUID, error) {
+	var userIDs []uuid.UUID
+	now := time.Now()
+	err := r.db.Raw(`UPDATE user_tokens SET used_at = ?
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?
+		RETURNING user_id`, now, hash, purpose, now).
+		Scan(&userIDs).Error
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if len(userIDs) == 0 {
+		return uuid.Nil, gorm.ErrRecordNotFound
+	}
+	return userIDs[0], nil
+}
+
+// DeleteExpiredBefore forgets tokens that expired before cutoff
+func (r *UserTokenRepository) DeleteExpiredBefore(cutoff time.Time) error {
+	return r.db.Where("expires_at < ?", cutoff).Delete(&models.UserToken{}).Error
+}
@@ -0,0 +1,168 @@
+package repositories
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"google-keep-clone/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WebhookRepository struct {
+	db *gorm.DB
+}
+
+func NewWebhookRepository(db *gorm.DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+func (r *WebhookRepository) Create(webhook *models.Webhook) error {
+	return r.db.Create(webhook).Error
+}
+
+func (r *WebhookRepository) GetByUserID(userID uuid.UUID) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	err := r.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&webhooks).Error
+	return webhooks, err
+}
+
+func (r *WebhookRepository) GetByID(id, userID uuid.UUID) (*models.Webhook, error) {
+	var webhook models.Webhook
+	err := r.db.Where("id = ? AND user_id = ?", id, userID).First(&webhook).Error
+	return &webhook, err
+}
+
+// GetForDelivery returns a webhook whoever it belongs to
+func (r *WebhookRepository) GetForDelivery(id uuid.UUID) (*models.Webhook, error) {
+	var webhook models.Webhook
+	err := r.db.Where("id = ?", id).First(&webhook).Error
+	return &webhook, err
+}
+
+// GetSubscribed returns the active webhooks of the given users that
+// subscribe to event
+func (r *WebhookRepository) GetSubscribed(userIDs []uuid.UUID, event string) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	if len(userIDs) == 0 {
+		return webhooks, nil
+	}
+
+	name, err := json.Marshal([]string{event})
+	if err != nil {
+		return nil, err
+	}
+	err = r.db.Where("user_id IN ? AND active = ?", userIDs, true).
+		Where(`events @> ?::jsonb OR events @> '["*"]'::jsonb`, string(name)).
+		Find(&webhooks).Error
+	return webhooks, err
+}
+
+func (r *WebhookRepository) Update(webhook *models.Webhook) error {
+	return r.db.Save(webhook).Error
+}
+
+// Delete removes a webhook along with its deliveries and their attempts
+func (r *WebhookRepository) Delete(id, userID uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", id, userID).Delete(&models.Webhook{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		deliveries := tx.Model(&models.WebhookDelivery{}).Select("id").Where("webhook_id = ?", id)
+		if err := tx.Where("delivery_id IN (?)", deliveries).Delete(&models.WebhookAttempt{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("webhook_id = ?", id).Delete(&models.WebhookDelivery{}).Error
+	})
+}
+
+// CreateDeliveries queues deliveries, skipping any for an event a webhook
+// already has, so an event handed over twice is only sent once
+func (r *WebhookRepository) CreateDeliveries(deliveries []models.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&deliveries).Error
+}
+
+// GetDeliveries returns a webhook's most recent deliveries, newest first
+func (r *WebhookRepository) GetDeliveries(webhookID uuid.UUID, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := r.db.Where("webhook_id = ?", webhookID).
+		Order("created_at DESC").Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+// GetDelivery returns a delivery with every attempt made at it
+func (r *WebhookRepository) GetDelivery(id, webhookID uuid.UUID) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := r.db.Preload("AttemptLog", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at ASC")
+	}).Where("id = ? AND webhook_id = ?", id, webhookID).First(&delivery).Error
+	return &delivery, err
+}
+
+// ClaimDueDeliveries returns pending deliveries whose next attempt is due,
+// pushing that attempt back to lease so no other server picks them up
+// while they are being sent. A server that dies mid-send leaves them to be
+// retried once the lease runs out.
+func (r *WebhookRepository) ClaimDueDeliveries(limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	now := time.Now()
+	err := r.db.Raw(`UPDATE webhook_deliveries SET next_attempt_at = ?
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = ? AND next_attempt_at <= ?
+			ORDER BY next_attempt_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`, now.Add(lease), models.DeliveryPending, now, limit).
+		Scan(&deliveries).Error
+	return deliveries, err
+}
+
+// RecordAttempt logs an attempt and saves the delivery's new state
+func (r *WebhookRepository) RecordAttempt(delivery *models.WebhookDelivery, attempt *models.WebhookAttempt) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(attempt).Error; err != nil {
+			return err
+		}
+		return tx.Model(delivery).
+			Select("status", "attempts", "next_attempt_at", "updated_at").
+			Updates(delivery).Error
+	})
+}
+
+// Requeue sets a delivery to be sent again right away, with a fresh set
+// of attempts
+func (r *WebhookRepository) Requeue(delivery *models.WebhookDelivery) error {
+	now := time.Now()
+	delivery.Status = models.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = &now
+	return r.db.Model(delivery).
+		Select("status", "attempts", "next_attempt_at", "updated_at").
+		Updates(delivery).Error
+}
+
+// DeleteDeliveriesBefore forgets finished deliveries created before cutoff,
+// along with their attempts
+func (r *WebhookRepository) DeleteDeliveriesBefore(cutoff time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		old := tx.Model(&models.WebhookDelivery{}).Select("id").
+			Where("created_at < ? AND status <> ?", cutoff, models.DeliveryPending)
+		if err := tx.Where("delivery_id IN (?)", old).Delete(&models.WebhookAttempt{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("created_at < ? AND status <> ?", cutoff, models.DeliveryPending).
+			Delete(&models.WebhookDelivery{}).Error
+	})
+}
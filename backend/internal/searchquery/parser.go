@@ -0,0 +1,382 @@
+// Package searchquery parses the search syntax accepted by /notes/search:
+// free text and "quoted phrases" mixed with filters such as label:home,
+// color:yellow, is:pinned, has:checklist and before:2026-01-01. Any term
+// can be excluded with a leading "-", and OR between terms matches either.
+package searchquery
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type TermKind int
+
+const (
+	Word TermKind = iota
+	Phrase
+	Filter
+)
+
+// Filter fields
+const (
+	FieldLabel  = "label"
+	FieldColor  = "color"
+	FieldIs     = "is"
+	FieldHas    = "has"
+	FieldBefore = "before"
+	FieldAfter  = "after"
+)
+
+// Term is a single word, phrase or filter. Pos and Len locate it in the
+// query, counted in characters.
+type Term struct {
+	Kind    TermKind
+	Negated bool
+	Field   string
+	Value   string
+	Date    time.Time // parsed value of before: and after:
+	Pos     int
+	Len     int
+}
+
+// Clause matches when any of its terms does
+type Clause struct {
+	Terms []Term
+}
+
+// Query matches notes that satisfy every clause
+type Query struct {
+	Clauses []Clause
+}
+
+// IsText reports whether the clause is made only of words and phrases
+func (c Clause) IsText() bool {
+	for _, term := range c.Terms {
+		if term.Kind == Filter {
+			return false
+		}
+	}
+	return true
+}
+
+// Mentions reports whether any term filters on field:value
+func (q *Query) Mentions(field, value string) bool {
+	for _, clause := range q.Clauses {
+		for _, term := range clause.Terms {
+			if term.Kind == Filter && term.Field == field && term.Value == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Error describes a problem at a position in the query
+type Error struct {
+	Message  string `json:"message"`
+	Position int    `json:"position"`
+	Length   int    `json:"length"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Message, e.Position)
+}
+
+// Errors holds every problem found in a query
+type Errors []*Error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+var (
+	isValues = map[string]string{
+		"pinned":   "pinned",
+		"archived": "archived",
+		"trashed":  "trashed",
+		"shared":   "shared",
+	}
+	hasValues = map[string]string{
+		"checklist":   "checklist",
+		"checklists":  "checklist",
+		"list":        "checklist",
+		"attachment":  "attachment",
+		"attachments": "attachment",
+		"image":       "image",
+		"images":      "image",
+		"reminder":    "reminder",
+		"reminders":   "reminder",
+		"label":       "label",
+		"labels":      "label",
+	}
+	dateLayouts = []string{"2006-01-02", "2006/01/02"}
+	hexColor    = regexp.MustCompile(`^#([a-f0-9]{6}|[a-f0-9]{3})$`)
+)
+
+// ColorAliases lists the stored values a color name matches: the name
+// itself and the hex codes clients and imports use for it
+var ColorAliases = map[string][]string{
+	"white":  {"white", "default", "#ffffff", "#fff"},
+	"red":    {"red", "#f28b82", "#f44336"},
+	"orange": {"orange", "#fbbc04", "#ff9800"},
+	"yellow": {"yellow", "#fff475", "#ffeb3b"},
+	"green":  {"green", "#ccff90", "#4caf50"},
+	"teal":   {"teal", "#a7ffeb", "#009688"},
+	"blue":   {"blue", "#cbf0f8", "#aecbfa", "#2196f3"},
+	"purple": {"purple", "#d7aefb", "#9c27b0"},
+	"pink":   {"pink", "#fdcfe8", "#e91e63"},
+	"brown":  {"brown", "#e6c9a8", "#795548"},
+	"gray":   {"gray", "grey", "#e8eaed", "#9e9e9e"},
+}
+
+type token struct {
+	text    string
+	quoted  bool // a "phrase"
+	isOr    bool
+	negated bool
+	pos     int
+	len     int
+}
+
+// Parse parses a search query. All problems found are reported together.
+func Parse(input string) (*Query, error) {
+	tokens, errs := lex([]rune(input))
+
+	query := &Query{}
+	joinNext := false
+	for i, tok := range tokens {
+		if tok.isOr {
+			switch {
+			case len(query.Clauses) == 0:
+				errs = append(errs, &Error{Message: "OR needs a term before it", Position: tok.pos, Length: tok.len})
+			case i == len(tokens)-1:
+				errs = append(errs, &Error{Message: "OR needs a term after it", Position: tok.pos, Length: tok.len})
+			case joinNext:
+				errs = append(errs, &Error{Message: "OR cannot follow another OR", Position: tok.pos, Length: tok.len})
+			}
+			joinNext = len(query.Clauses) > 0
+			continue
+		}
+
+		term, err := parseTerm(tok)
+		if err != nil {
+			errs = append(errs, err)
+			joinNext = false
+			continue
+		}
+
+		if joinNext {
+			last := &query.Clauses[len(query.Clauses)-1]
+			last.Terms = append(last.Terms, term)
+		} else {
+			query.Clauses = append(query.Clauses, Clause{Terms: []Term{term}})
+		}
+		joinNext = false
+	}
+
+	if len(errs) > 0 {
+		sort.SliceStable(errs, func(i, j int) bool { return errs[i].Position < errs[j].Position })
+		return nil, errs
+	}
+	return query, nil
+}
+
+func lex(input []rune) ([]token, Errors) {
+	var tokens []token
+	var errs Errors
+
+	for i := 0; i < len(input); {
+		if unicode.IsSpace(input[i]) {
+			i++
+			continue
+		}
+
+		start := i
+		negated := false
+		if input[i] == '-' {
+			if i+1 == len(input) || unicode.IsSpace(input[i+1]) {
+				errs = append(errs, &Error{Message: "- must be followed by a term to exclude", Position: i, Length: 1})
+				i++
+				continue
+			}
+			negated = true
+			i++
+		}
+
+		if input[i] == '"' {
+			end := indexRune(input, i+1, '"')
+			if end < 0 {
+				errs = append(errs, &Error{Message: "unterminated quote", Position: i, Length: len(input) - i})
+				break
+			}
+			text := strings.TrimSpace(string(input[i+1 : end]))
+			if text != "" {
+				tokens = append(tokens, token{text: text, quoted: true, negated: negated, pos: start, len: end + 1 - start})
+			}
+			i = end + 1
+			continue
+		}
+
+		wordStart := i
+		for i < len(input) && !unicode.IsSpace(input[i]) {
+			// A filter value may be quoted: label:"to do"
+			if input[i] == ':' && i+1 < len(input) && input[i+1] == '"' && isField(string(input[wordStart:i])) {
+				end := indexRune(input, i+2, '"')
+				if end < 0 {
+					errs = append(errs, &Error{Message: "unterminated quote", Position: i + 1, Length: len(input) - i - 1})
+					i = len(input)
+					break
+				}
+				i = end + 1
+				break
+			}
+			i++
+		}
+
+		text := string(input[wordStart:i])
+		if text == "" {
+			continue
+		}
+		tokens = append(tokens, token{
+			text:    text,
+			isOr:    text == "OR" && !negated,
+			negated: negated,
+			pos:     start,
+			len:     i - start,
+		})
+	}
+
+	return tokens, errs
+}
+
+func parseTerm(tok token) (Term, *Error) {
+	term := Term{Kind: Word, Negated: tok.negated, Value: tok.text, Pos: tok.pos, Len: tok.len}
+	if tok.quoted {
+		term.Kind = Phrase
+		return term, nil
+	}
+
+	field, value, found := strings.Cut(tok.text, ":")
+	field = strings.ToLower(field)
+	if !found || !isField(field) {
+		// Not a filter, e.g. a time like 10:30
+		return term, nil
+	}
+
+	value = strings.TrimSpace(strings.Trim(value, `"`))
+	if value == "" {
+		return term, &Error{Message: fmt.Sprintf("%s: needs a value", field), Position: tok.pos, Length: tok.len}
+	}
+
+	term.Kind = Filter
+	term.Field = field
+	term.Value = value
+
+	invalid := func(message string) (Term, *Error) {
+		return term, &Error{Message: message, Position: tok.pos, Length: tok.len}
+	}
+
+	switch field {
+	case FieldLabel:
+		// Any name goes
+	case FieldColor:
+		value = strings.ToLower(value)
+		if value == "grey" {
+			value = "gray"
+		}
+		if value == "default" {
+			value = "white"
+		}
+		if _, ok := ColorAliases[value]; !ok && !hexColor.MatchString(value) {
+			return invalid(fmt.Sprintf("unknown color %q", term.Value))
+		}
+		term.Value = value
+	case FieldIs:
+		canonical, ok := isValues[strings.ToLower(value)]
+		if !ok {
+			return invalid(fmt.Sprintf("is: must be one of pinned, archived, trashed or shared, not %q", value))
+		}
+		term.Value = canonical
+	case FieldHas:
+		canonical, ok := hasValues[strings.ToLower(value)]
+		if !ok {
+			return invalid(fmt.Sprintf("has: must be one of checklist, attachment, image, reminder or label, not %q", value))
+		}
+		term.Value = canonical
+	case FieldBefore, FieldAfter:
+		date, ok := parseDate(value)
+		if !ok {
+			return invalid(fmt.Sprintf("%s: needs a date like 2026-01-31, not %q", field, value))
+		}
+		term.Date = date
+	}
+
+	return term, nil
+}
+
+func isField(s string) bool {
+	switch strings.ToLower(s) {
+	case FieldLabel, FieldColor, FieldIs, FieldHas, FieldBefore, FieldAfter:
+		return true
+	}
+	return false
+}
+
+func parseDate(value string) (time.Time, bool) {
+	for _, layout := range dateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func indexRune(input []rune, from int, r rune) int {
+	for i := from; i < len(input); i++ {
+		if input[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// TextQueries renders each of the query's text-only clauses in
+// websearch_to_tsquery syntax. A note must match all of them; they are
+// kept apart because websearch_to_tsquery binds "and" tighter than "or",
+// so joined together "cat OR dog food" would read as cat | (dog & food).
+// Clauses that mix text with filters are left to the caller.
+func (q *Query) TextQueries() []string {
+	var queries []string
+	for _, clause := range q.Clauses {
+		if !clause.IsText() {
+			continue
+		}
+		alternatives := make([]string, len(clause.Terms))
+		for i, term := range clause.Terms {
+			alternatives[i] = term.WebSearch()
+		}
+		queries = append(queries, strings.Join(alternatives, " or "))
+	}
+	return queries
+}
+
+// WebSearch renders a word or phrase in websearch_to_tsquery syntax
+func (t Term) WebSearch() string {
+	text := t.Value
+	// Quote words websearch_to_tsquery would read as operators
+	if t.Kind == Phrase || strings.EqualFold(text, "or") || strings.HasPrefix(text, "-") {
+		text = `"` + strings.ReplaceAll(text, `"`, "") + `"`
+	}
+	if t.Negated {
+		return "-" + text
+	}
+	return text
+}
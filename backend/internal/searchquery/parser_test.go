@@ -0,0 +1,65 @@
+package searchquery
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTextQueries(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"cat", []string{"cat"}},
+		{"cat dog", []string{"cat", "dog"}},
+		// OR binds tighter than the implicit AND between clauses
+		{"a OR b c", []string{"a or b", "c"}},
+		{"cat OR dog food", []string{"cat or dog", "food"}},
+		{"c a OR b", []string{"c", "a or b"}},
+		{`"to do" OR -done`, []string{`"to do" or -done`}},
+		// Filters are left to the caller, along with text ORed with them
+		{"milk label:shopping", []string{"milk"}},
+		{"milk OR label:shopping eggs", []string{"eggs"}},
+		// Words websearch_to_tsquery would take for operators are quoted
+		{"or OR and", []string{`"or" or and`}},
+	}
+
+	for _, test := range tests {
+		query, err := Parse(test.input)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.input, err)
+			continue
+		}
+		if got := query.TextQueries(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%q).TextQueries() = %q; want %q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestParseClauses(t *testing.T) {
+	query, err := Parse("a OR b c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(query.Clauses) != 2 {
+		t.Fatalf("got %d clauses; want 2", len(query.Clauses))
+	}
+	if got := len(query.Clauses[0].Terms); got != 2 {
+		t.Errorf("first clause has %d terms; want a and b", got)
+	}
+	if got := query.Clauses[1].Terms[0].Value; got != "c" {
+		t.Errorf("second clause is %q; want c", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, input := range []string{"OR cat", "cat OR", "cat OR OR dog", `"open`, "color:plaid", "before:soon", "- cat"} {
+		_, err := Parse(input)
+		var errs Errors
+		if !errors.As(err, &errs) || len(errs) == 0 {
+			t.Errorf("Parse(%q) err = %v; want Errors", input, err)
+		}
+	}
+}
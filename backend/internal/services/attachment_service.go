@@ -0,0 +1,327 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"google-keep-clone/internal/events"
+	"google-keep-clone/internal/imaging"
+	"google-keep-clone/internal/models"
+	"google-keep-clone/internal/repositories"
+	"google-keep-clone/internal/storage"
+)
+
+var (
+	ErrFileTooLarge  = errors.New("file exceeds the maximum upload size")
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+)
+
+type AttachmentService struct {
+	attachmentRepo *repositories.AttachmentRepository
+	noteRepo       *repositories.NoteRepository
+	blobs          storage.BlobStore
+	thumbnails     *ThumbnailService
+	maxFileSize    int64
+	userQuota      int64
+	eventBus       *EventBus
+}
+
+func NewAttachmentService(attachmentRepo *repositories.AttachmentRepository, noteRepo *repositories.NoteRepository, blobs storage.BlobStore, thumbnails *ThumbnailService, maxFileSize, userQuota int64, eventBus *EventBus) *AttachmentService {
+	return &AttachmentService{
+		attachmentRepo: attachmentRepo,
+		noteRepo:       noteRepo,
+		blobs:          blobs,
+		thumbnails:     thumbnails,
+		maxFileSize:    maxFileSize,
+		userQuota:      userQuota,
+		eventBus:       eventBus,
+	}
+}
+
+// Upload stores a file on a note. Blobs are keyed by their SHA-256, so the
+// same file uploaded twice is only stored once.
+func (s *AttachmentService) Upload(ctx context.Context, noteID, userID uuid.UUID, header *multipart.FileHeader) (*models.Attachment, error) {
+	if header.Size > s.maxFileSize {
+		return nil, ErrFileTooLarge
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return nil, errors.New("failed to read upload")
+	}
+	defer func() { _ = file.Close() }()
+
+	return s.AddFile(ctx, noteID, userID, header.Filename, file, header.Size)
+}
+
+// AddFile stores size bytes of content as an attachment on a note
+func (s *AttachmentService) AddFile(ctx context.Context, noteID, userID uuid.UUID, filename string, file io.ReadSeeker, size int64) (*models.Attachment, error) {
+	if _, err := s.noteRepo.GetEditableByID(noteID, userID); err != nil {
+		return nil, errors.New("note not found")
+	}
+
+	if size > s.maxFileSize {
+		return nil, ErrFileTooLarge
+	}
+
+	// Checked again when the attachment is saved; this spares storing a
+	// file that is plainly over
+	usage, err := s.attachmentRepo.UsageByUser(userID)
+	if err != nil {
+		return nil, errors.New("failed to check storage usage")
+	}
+	if usage+size > s.userQuota {
+		return nil, ErrQuotaExceeded
+	}
+
+	mimeType, err := sniffContentType(file)
+	if err != nil {
+		return nil, errors.New("failed to read upload")
+	}
+
+	// Photos often carry the location they were taken at; drop it before
+	// the file is stored or shared
+	var content io.ReadSeeker = file
+	if mimeType == "image/jpeg" {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, errors.New("failed to read upload")
+		}
+		imaging.StripGPS(data)
+		content = bytes.NewReader(data)
+	}
+
+	sum, err := hashContent(content)
+	if err != nil {
+		return nil, errors.New("failed to read upload")
+	}
+	key := "sha256/" + sum[:2] + "/" + sum
+
+	exists, err := s.blobs.Exists(ctx, key)
+	if err != nil {
+		return nil, errors.New("failed to store file")
+	}
+	if !exists {
+		if err := s.blobs.Put(ctx, key, content, size, mimeType); err != nil {
+			return nil, errors.New("failed to store file")
+		}
+	}
+
+	id := uuid.New()
+	attachment := &models.Attachment{
+		ID:         id,
+		NoteID:     noteID,
+		UserID:     userID,
+		Filename:   sanitizeFilename(filename),
+		URL:        "/attachments/" + id.String(),
+		Size:       size,
+		MimeType:   mimeType,
+		SHA256:     sum,
+		StorageKey: key,
+	}
+	if imaging.Supported(mimeType) {
+		attachment.ThumbnailStatus = models.ThumbnailPending
+	}
+
+	created := false
+	err = s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		return s.attachmentRepo.WithTx(tx).LockStorageKey(key, func(repo *repositories.AttachmentRepository) error {
+			// The last attachment sharing the blob may have been deleted, and
+			// the blob released with it, since it was checked above
+			present, err := s.blobs.Exists(ctx, key)
+			if err != nil {
+				return err
+			}
+			if !present {
+				if _, err := content.Seek(0, io.SeekStart); err != nil {
+					return err
+				}
+				if err := s.blobs.Put(ctx, key, content, size, mimeType); err != nil {
+					return err
+				}
+			}
+
+			created, err = repo.CreateWithinQuota(attachment, s.userQuota)
+			if err != nil || !created {
+				return err
+			}
+			return publishNoteEvent(s.eventBus, tx, s.noteRepo, events.AttachmentAdded, userID, noteID, attachment)
+		})
+	})
+	if err != nil || !created {
+		s.releaseBlob(ctx, key)
+		if err == nil {
+			return nil, ErrQuotaExceeded
+		}
+		return nil, errors.New("failed to save attachment")
+	}
+
+	if attachment.ThumbnailStatus == models.ThumbnailPending {
+		s.thumbnails.Enqueue(attachment.ID)
+	}
+
+	return attachment, nil
+}
+
+// Open returns the attachment and a reader over length bytes of its content
+// starting at offset. A negative length reads to the end.
+func (s *AttachmentService) Open(ctx context.Context, id, userID uuid.UUID, offset, length int64) (*models.Attachment, io.ReadCloser, error) {
+	attachment, err := s.attachmentRepo.GetByID(id, userID)
+	if err != nil {
+		return nil, nil, errors.New("attachment not found")
+	}
+
+	reader, err := s.blobs.Get(ctx, attachment.StorageKey, offset, length)
+	if err != nil {
+		return nil, nil, errors.New("attachment content not found")
+	}
+
+	return attachment, reader, nil
+}
+
+// ReadContent streams the full content of an attachment the caller has
+// already loaded and authorized
+func (s *AttachmentService) ReadContent(ctx context.Context, attachment *models.Attachment) (io.ReadCloser, error) {
+	return s.blobs.Get(ctx, attachment.StorageKey, 0, -1)
+}
+
+func (s *AttachmentService) GetAttachment(id, userID uuid.UUID) (*models.Attachment, error) {
+	attachment, err := s.attachmentRepo.GetByID(id, userID)
+	if err != nil {
+		return nil, errors.New("attachment not found")
+	}
+	return attachment, nil
+}
+
+func (s *AttachmentService) DeleteAttachment(ctx context.Context, id, userID uuid.UUID) error {
+	attachment, err := s.attachmentRepo.GetEditableByID(id, userID)
+	if err != nil {
+		return errors.New("attachment not found")
+	}
+
+	err = s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		if err := s.attachmentRepo.WithTx(tx).Delete(id); err != nil {
+			return errors.New("failed to delete attachment")
+		}
+		return publishNoteEvent(s.eventBus, tx, s.noteRepo, events.AttachmentDeleted, userID, attachment.NoteID,
+			events.NoteItemDeleted{ID: id, NoteID: attachment.NoteID})
+	})
+	if err != nil {
+		return err
+	}
+
+	s.releaseBlob(ctx, attachment.StorageKey)
+	if attachment.ThumbnailStatus == models.ThumbnailReady {
+		s.thumbnails.DeleteThumbnails(ctx, id)
+	}
+
+	return nil
+}
+
+// StorageKeysForNotes lists the blobs used by notes, thumbnails included,
+// so they can be released once the notes are purged
+func (s *AttachmentService) StorageKeysForNotes(noteIDs []uuid.UUID) []string {
+	keys, err := s.attachmentRepo.GetStorageKeysByNoteIDs(noteIDs)
+	if err != nil {
+		log.Printf("Error loading attachment blobs: %v", err)
+	}
+
+	ids, err := s.attachmentRepo.GetThumbnailedIDsByNoteIDs(noteIDs)
+	if err != nil {
+		log.Printf("Error loading attachment thumbnails: %v", err)
+	}
+	for _, id := range ids {
+		keys = append(keys, thumbnailKeys(id)...)
+	}
+
+	return keys
+}
+
+// OpenThumbnail returns an attachment and a reader over one of its
+// thumbnail variants
+func (s *AttachmentService) OpenThumbnail(ctx context.Context, id, userID uuid.UUID, size string) (*models.Attachment, io.ReadCloser, error) {
+	return s.thumbnails.Open(ctx, id, userID, size)
+}
+
+// ReleaseBlobs deletes blobs no attachment refers to anymore
+func (s *AttachmentService) ReleaseBlobs(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		s.releaseBlob(ctx, key)
+	}
+}
+
+func (s *AttachmentService) releaseBlob(ctx context.Context, key string) {
+	if key == "" {
+		return
+	}
+
+	err := s.attachmentRepo.LockStorageKey(key, func(repo *repositories.AttachmentRepository) error {
+		count, err := repo.CountByStorageKey(key)
+		if err != nil || count > 0 {
+			return err
+		}
+		return s.blobs.Delete(ctx, key)
+	})
+	if err != nil {
+		log.Printf("Error deleting blob %s: %v", key, err)
+	}
+}
+
+// sniffContentType detects the type from the file's first bytes and
+// rewinds it. The client-supplied type is never trusted.
+func sniffContentType(file io.ReadSeeker) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return http.DetectContentType(head[:n]), nil
+}
+
+// hashContent returns the hex SHA-256 of the content, leaving it rewound
+// for storage
+func hashContent(content io.ReadSeeker) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func sanitizeFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	if len(name) > 255 {
+		name = name[len(name)-255:]
+	}
+	return name
+}
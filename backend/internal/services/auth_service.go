@@ -1,31 +1,133 @@
 package services
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"google-keep-clone/internal/config"
+	"google-keep-clone/internal/mail"
 	"google-keep-clone/internal/models"
 	"google-keep-clone/internal/repositories"
+	"google-keep-clone/internal/totp"
 	"google-keep-clone/internal/validators"
+	"google-keep-clone/internal/websocket"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
 	"time"
 )
 
 type AuthService struct {
-	userRepo *repositories.UserRepository
-	config   *config.Config
+	userRepo         *repositories.UserRepository
+	sessionRepo      *repositories.SessionRepository
+	tokenRepo        *repositories.UserTokenRepository
+	recoveryCodeRepo *repositories.RecoveryCodeRepository
+	mailer           mail.Mailer
+	hub              *websocket.Hub // to disconnect revoked sessions
+	config           *config.Config
 }
 
 type Claims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
+	UserID    string `json:"user_id"`
+	Email     string `json:"email"`
+	SessionID string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-func NewAuthService(userRepo *repositories.UserRepository, config *config.Config) *AuthService {
+// mfaClaims identify a user who has given their password but still has
+// to give a second factor
+type mfaClaims struct {
+	UserID     string `json:"user_id"`
+	DeviceName string `json:"device_name,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// MFARequiredError is returned by Login for users with two-factor
+// authentication on. The password was right; Token is exchanged for a
+// session by VerifyTwoFactor along with a code.
+type MFARequiredError struct {
+	Token     string
+	ExpiresIn int
+}
+
+func (e *MFARequiredError) Error() string {
+	return "two-factor authentication required"
+}
+
+// TwoFactorSetup is what an authenticator app needs to start giving codes
+type TwoFactorSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"` // usually shown as a QR code
+}
+
+type TwoFactorStatus struct {
+	Enabled           bool  `json:"enabled"`
+	RecoveryCodesLeft int64 `json:"recovery_codes_left"`
+}
+
+// ClientInfo describes the device a session is for
+type ClientInfo struct {
+	DeviceName string
+	IPAddress  string
+	UserAgent  string
+}
+
+const (
+	// A refresh token replaced this recently is refused without revoking
+	// the session, since a client that sent two refreshes at once will
+	// present it a second time
+	refreshReuseGrace = 30 * time.Second
+	// How often a session's last use is written down
+	sessionTouchInterval = 5 * time.Minute
+	// Ended sessions and expired tokens are kept this long, then deleted
+	sessionRetention = 30 * 24 * time.Hour
+
+	verifyEmailTTL   = 48 * time.Hour
+	resetPasswordTTL = time.Hour
+	// Emails with a token aren't sent to the same user more often than this
+	tokenEmailInterval = time.Minute
+	mailTimeout        = time.Minute
+
+	// Between the password and the second factor
+	mfaTokenTTL      = 5 * time.Minute
+	mfaTokenAudience = "mfa"
+	// This many wrong codes in a row lock two-factor sign in for a while
+	maxTwoFactorFailures = 5
+	twoFactorLockout     = 15 * time.Minute
+	recoveryCodeCount    = 10
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrInvalidToken        = errors.New("invalid or expired token")
+
+	ErrInvalidMFAToken      = errors.New("invalid or expired mfa token")
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	ErrTwoFactorLocked      = errors.New("too many invalid codes; try again later")
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already on")
+	ErrTwoFactorDisabled    = errors.New("two-factor authentication is not on")
+	ErrIncorrectPassword    = errors.New("incorrect password")
+)
+
+func NewAuthService(userRepo *repositories.UserRepository, sessionRepo *repositories.SessionRepository, tokenRepo *repositories.UserTokenRepository, recoveryCodeRepo *repositories.RecoveryCodeRepository, mailer mail.Mailer, hub *websocket.Hub, config *config.Config) *AuthService {
 	return &AuthService{
-		userRepo: userRepo,
-		config:   config,
+		userRepo:         userRepo,
+		sessionRepo:      sessionRepo,
+		tokenRepo:        tokenRepo,
+		recoveryCodeRepo: recoveryCodeRepo,
+		mailer:           mailer,
+		hub:              hub,
+		config:           config,
 	}
 }
 
@@ -39,12 +141,14 @@ func (s *AuthService) CheckPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
-func (s *AuthService) GenerateToken(user *models.User) (string, error) {
+// GenerateToken issues an access token for the user's session
+func (s *AuthService) GenerateToken(user *models.User, sessionID uuid.UUID) (string, error) {
 	claims := &Claims{
-		UserID: user.ID.String(),
-		Email:  user.Email,
+		UserID:    user.ID.String(),
+		Email:     user.Email,
+		SessionID: sessionID.String(),
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.accessTokenTTL())),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
@@ -54,28 +158,63 @@ func (s *AuthService) GenerateToken(user *models.User) (string, error) {
 	return token.SignedString([]byte(s.config.JWTSecret))
 }
 
+// ValidateToken checks an access token's signature and expiry. Use
+// Authenticate to also check that its session is still active.
 func (s *AuthService) ValidateToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		return []byte(s.config.JWTSecret), nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+	// Tokens from Login for users with two-factor authentication on are
+	// only good for VerifyTwoFactor
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid && !slices.Contains(claims.Audience, mfaTokenAudience) {
 		return claims, nil
 	}
-	return nil, err
+	return nil, errors.New("invalid token")
+}
+
+// Authenticate validates an access token and checks that the session it
+// was issued for hasn't been revoked, noting that it was used from
+// ipAddress
+func (s *AuthService) Authenticate(tokenString, ipAddress string) (*Claims, error) {
+	claims, err := s.ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tokens from before sessions existed have no session to check
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return nil, errors.New("token has no session")
+	}
+
+	session, err := s.sessionRepo.GetByID(sessionID)
+	if err != nil || !session.Active() || session.UserID.String() != claims.UserID {
+		return nil, errors.New("session has ended")
+	}
+
+	if time.Since(session.LastUsedAt) > sessionTouchInterval {
+		if err := s.sessionRepo.Touch(sessionID, ipAddress); err != nil {
+			log.Printf("Error updating session %v: %v", sessionID, err)
+		}
+	}
+
+	return claims, nil
 }
 
-func (s *AuthService) Register(req *validators.RegisterRequest) (*models.User, string, error) {
+func (s *AuthService) Register(req *validators.RegisterRequest, client ClientInfo) (*models.User, *models.AuthTokens, error) {
 	// Check if user already exists
-	existingUser, _ := s.userRepo.GetByEmail(req.Email)
-	if existingUser != nil {
-		return nil, "", errors.New("user already exists")
+	if _, err := s.userRepo.GetByEmail(req.Email); err == nil {
+		return nil, nil, errors.New("user already exists")
 	}
 
 	// Hash password
 	hashedPassword, err := s.HashPassword(req.Password)
 	if err != nil {
-		return nil, "", errors.New("failed to hash password")
+		return nil, nil, errors.New("failed to hash password")
 	}
 
 	// Create user
@@ -87,35 +226,645 @@ func (s *AuthService) Register(req *validators.RegisterRequest) (*models.User, s
 	}
 
 	if err := s.userRepo.Create(user); err != nil {
-		return nil, "", errors.New("failed to create user")
+		return nil, nil, errors.New("failed to create user")
+	}
+
+	if err := s.sendVerification(user); err != nil {
+		log.Printf("Error sending verification email to user %v: %v", user.ID, err)
 	}
 
-	// Generate token
-	token, err := s.GenerateToken(user)
+	// Sign the new user in
+	tokens, err := s.startSession(user, client)
 	if err != nil {
-		return nil, "", errors.New("failed to generate token")
+		return nil, nil, errors.New("failed to generate token")
 	}
 
-	return user, token, nil
+	return user, tokens, nil
 }
 
-func (s *AuthService) Login(req *validators.LoginRequest) (*models.User, string, error) {
+func (s *AuthService) Login(req *validators.LoginRequest, client ClientInfo) (*models.User, *models.AuthTokens, error) {
 	// Get user by email
 	user, err := s.userRepo.GetByEmail(req.Email)
 	if err != nil {
-		return nil, "", errors.New("invalid credentials")
+		return nil, nil, errors.New("invalid credentials")
 	}
 
 	// Check password
 	if !s.CheckPasswordHash(req.Password, user.Password) {
-		return nil, "", errors.New("invalid credentials")
+		return nil, nil, errors.New("invalid credentials")
+	}
+
+	if user.TwoFactorEnabled {
+		token, err := s.generateMFAToken(user, client.DeviceName)
+		if err != nil {
+			return nil, nil, errors.New("failed to generate token")
+		}
+		return nil, nil, &MFARequiredError{Token: token, ExpiresIn: int(mfaTokenTTL.Seconds())}
+	}
+
+	tokens, err := s.startSession(user, client)
+	if err != nil {
+		return nil, nil, errors.New("failed to generate token")
+	}
+
+	return user, tokens, nil
+}
+
+// generateMFAToken issues the token Login hands out in place of a session
+// when a second factor is still needed
+func (s *AuthService) generateMFAToken(user *models.User, deviceName string) (string, error) {
+	claims := &mfaClaims{
+		UserID:     user.ID.String(),
+		DeviceName: deviceName,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{mfaTokenAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(mfaTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(s.config.JWTSecret))
+}
+
+// VerifyTwoFactor finishes signing in with the token from Login and a code
+// from the user's authenticator app or one of their recovery codes
+func (s *AuthService) VerifyTwoFactor(mfaToken, code string, client ClientInfo) (*models.User, *models.AuthTokens, error) {
+	token, err := jwt.ParseWithClaims(mfaToken, &mfaClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return []byte(s.config.JWTSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(mfaTokenAudience))
+	if err != nil || !token.Valid {
+		return nil, nil, ErrInvalidMFAToken
+	}
+	claims := token.Claims.(*mfaClaims)
+
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return nil, nil, ErrInvalidMFAToken
+	}
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil || !user.TwoFactorEnabled {
+		return nil, nil, ErrInvalidMFAToken
+	}
+
+	if err := s.verifySecondFactor(user, code); err != nil {
+		return nil, nil, err
+	}
+
+	if client.DeviceName == "" {
+		client.DeviceName = claims.DeviceName
+	}
+	tokens, err := s.startSession(user, client)
+	if err != nil {
+		return nil, nil, errors.New("failed to generate token")
+	}
+
+	return user, tokens, nil
+}
+
+// startSession signs the user in on a new device
+func (s *AuthService) startSession(user *models.User, client ClientInfo) (*models.AuthTokens, error) {
+	now := time.Now()
+	session := &models.Session{
+		ID:         uuid.New(),
+		UserID:     user.ID,
+		DeviceName: client.DeviceName,
+		IPAddress:  client.IPAddress,
+		UserAgent:  client.UserAgent,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(s.refreshTokenTTL()),
+	}
+
+	refreshToken, hash, err := newRefreshToken(session.ID)
+	if err != nil {
+		return nil, err
+	}
+	session.TokenHash = hash
+
+	if err := s.sessionRepo.Create(session); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(user, session.ID, refreshToken)
+}
+
+// Refresh swaps a refresh token for a new access token and a new refresh
+// token. The old refresh token stops working; if it is presented again
+// later, someone has a copy of it, and the session is revoked.
+func (s *AuthService) Refresh(refreshToken string, client ClientInfo) (*models.AuthTokens, error) {
+	sessionID, err := parseRefreshToken(refreshToken)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	session, err := s.sessionRepo.GetByID(sessionID)
+	if err != nil || !session.Active() {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	presented := hashToken(refreshToken)
+	if subtle.ConstantTimeCompare([]byte(presented), []byte(session.TokenHash)) != 1 {
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(session.PreviousTokenHash)) == 1 &&
+			session.RotatedAt != nil && time.Since(*session.RotatedAt) < refreshReuseGrace {
+			return nil, ErrInvalidRefreshToken
+		}
+
+		log.Printf("Refresh token reused for session %v of user %v; revoking it", session.ID, session.UserID)
+		if _, err := s.sessionRepo.Revoke(session.ID, session.UserID, models.RevokedTokenReuse); err != nil {
+			log.Printf("Error revoking session %v: %v", session.ID, err)
+		}
+		s.hub.DisconnectSession(session.UserID, session.ID)
+		return nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.userRepo.GetByID(session.UserID)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	next, nextHash, err := newRefreshToken(session.ID)
+	if err != nil {
+		return nil, errors.New("failed to generate token")
+	}
+
+	session.ExpiresAt = time.Now().Add(s.refreshTokenTTL())
+	session.IPAddress = client.IPAddress
+	session.UserAgent = client.UserAgent
+	rotated, err := s.sessionRepo.Rotate(session, presented, nextHash)
+	if err != nil {
+		return nil, errors.New("failed to refresh session")
+	}
+	if !rotated {
+		// Another refresh with the same token won
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return s.issueTokens(user, session.ID, next)
+}
+
+func (s *AuthService) issueTokens(user *models.User, sessionID uuid.UUID, refreshToken string) (*models.AuthTokens, error) {
+	accessToken, err := s.GenerateToken(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuthTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(s.accessTokenTTL().Seconds()),
+	}, nil
+}
+
+// Logout revokes the session the request was made with
+func (s *AuthService) Logout(sessionID, userID uuid.UUID) error {
+	if _, err := s.sessionRepo.Revoke(sessionID, userID, models.RevokedLogout); err != nil {
+		return errors.New("failed to log out")
+	}
+	s.hub.DisconnectSession(userID, sessionID)
+	return nil
+}
+
+// GetSessions returns the user's active sessions, marking currentID as
+// the current one
+func (s *AuthService) GetSessions(userID, currentID uuid.UUID) ([]models.Session, error) {
+	sessions, err := s.sessionRepo.GetActiveByUserID(userID)
+	if err != nil {
+		return nil, errors.New("failed to load sessions")
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+	return sessions, nil
+}
+
+// RevokeSession signs one of the user's devices out. Its access token
+// stops working straight away, its refresh token can't be used and its
+// websocket connections are closed.
+func (s *AuthService) RevokeSession(id, userID uuid.UUID) error {
+	revoked, err := s.sessionRepo.Revoke(id, userID, models.RevokedByUser)
+	if err != nil {
+		return errors.New("failed to revoke session")
+	}
+	if !revoked {
+		return ErrSessionNotFound
+	}
+	s.hub.DisconnectSession(userID, id)
+	return nil
+}
+
+// GetTwoFactorStatus reports whether the user has two-factor
+// authentication on and how many recovery codes they have left
+func (s *AuthService) GetTwoFactorStatus(userID uuid.UUID) (*TwoFactorStatus, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	status := &TwoFactorStatus{Enabled: user.TwoFactorEnabled}
+	if user.TwoFactorEnabled {
+		if status.RecoveryCodesLeft, err = s.recoveryCodeRepo.CountUnused(userID); err != nil {
+			return nil, errors.New("failed to count recovery codes")
+		}
+	}
+	return status, nil
+}
+
+// SetupTwoFactor gives the user a new secret for their authenticator app.
+// Two-factor authentication isn't on until ConfirmTwoFactor.
+func (s *AuthService) SetupTwoFactor(userID uuid.UUID) (*TwoFactorSetup, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, errors.New("failed to generate secret")
+	}
+	started, err := s.userRepo.SetTOTPSecret(userID, secret)
+	if err != nil {
+		return nil, errors.New("failed to set up two-factor authentication")
+	}
+	if !started {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	return &TwoFactorSetup{
+		Secret: secret,
+		URI:    totp.URI(s.config.TOTPIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTwoFactor turns two-factor authentication on once the user shows
+// their app gives the right codes, and returns their recovery codes. They
+// are only ever shown here and when regenerated.
+func (s *AuthService) ConfirmTwoFactor(userID uuid.UUID, code string) ([]string, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, errors.New("set up two-factor authentication first")
+	}
+
+	step, ok := totp.Validate(user.TOTPSecret, normalizeCode(code), time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, err := s.replaceRecoveryCodes(userID)
+	if err != nil {
+		return nil, errors.New("failed to generate recovery codes")
+	}
+	if err := s.userRepo.EnableTwoFactor(userID, step); err != nil {
+		return nil, errors.New("failed to turn on two-factor authentication")
+	}
+
+	return codes, nil
+}
+
+// DisableTwoFactor turns two-factor authentication off, once the user has
+// given their password and a code again
+func (s *AuthService) DisableTwoFactor(userID uuid.UUID, password, code string) error {
+	if _, err := s.reauthenticate(userID, password, code); err != nil {
+		return err
+	}
+
+	if err := s.userRepo.DisableTwoFactor(userID); err != nil {
+		return errors.New("failed to turn off two-factor authentication")
+	}
+	if err := s.recoveryCodeRepo.DeleteByUserID(userID); err != nil {
+		log.Printf("Error deleting recovery codes of user %v: %v", userID, err)
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes, once they
+// have given their password and a code again
+func (s *AuthService) RegenerateRecoveryCodes(userID uuid.UUID, password, code string) ([]string, error) {
+	if _, err := s.reauthenticate(userID, password, code); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.replaceRecoveryCodes(userID)
+	if err != nil {
+		return nil, errors.New("failed to generate recovery codes")
+	}
+	return codes, nil
+}
+
+// reauthenticate checks the password and second factor of a signed in
+// user with two-factor authentication on
+func (s *AuthService) reauthenticate(userID uuid.UUID, password, code string) (*models.User, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	if !user.TwoFactorEnabled {
+		return nil, ErrTwoFactorDisabled
+	}
+	if !s.CheckPasswordHash(password, user.Password) {
+		return nil, ErrIncorrectPassword
+	}
+	if err := s.verifySecondFactor(user, code); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// verifySecondFactor checks a code from the user's authenticator app, or
+// uses up one of their recovery codes. Codes are refused for a while after
+// too many wrong ones, so they can't be guessed.
+func (s *AuthService) verifySecondFactor(user *models.User, code string) error {
+	allowed, err := s.userRepo.BeginTOTPAttempt(user.ID, maxTwoFactorFailures, time.Now().Add(twoFactorLockout))
+	if err != nil {
+		return errors.New("failed to check two-factor code")
+	}
+	if !allowed {
+		return ErrTwoFactorLocked
+	}
+
+	code = normalizeCode(code)
+	var valid bool
+	if len(code) == totp.Digits {
+		// A code can't be used twice, say by someone who saw it typed
+		if step, ok := totp.Validate(user.TOTPSecret, code, time.Now()); ok {
+			valid, err = s.userRepo.UseTOTPStep(user.ID, step)
+		}
+	} else {
+		valid, err = s.recoveryCodeRepo.Consume(user.ID, hashToken(code))
+	}
+	if err != nil {
+		return errors.New("failed to check two-factor code")
+	}
+	if !valid {
+		return ErrInvalidTwoFactorCode
+	}
+
+	if err := s.userRepo.ResetTOTPFailures(user.ID); err != nil {
+		log.Printf("Error resetting two-factor failures for user %v: %v", user.ID, err)
+	}
+	return nil
+}
+
+// replaceRecoveryCodes gives the user a new set of recovery codes, like
+// "k3x9q-7mw2a", retiring their old ones
+func (s *AuthService) replaceRecoveryCodes(userID uuid.UUID) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		random := make([]byte, 7)
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(random)[:10])
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashToken(code)
+	}
+
+	if err := s.recoveryCodeRepo.Replace(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// normalizeCode drops the spaces and dashes people type codes with
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+// ResendVerification emails the user a new link to verify their address
+func (s *AuthService) ResendVerification(userID uuid.UUID) error {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+	if user.IsVerified {
+		return errors.New("email is already verified")
+	}
+
+	recent, err := s.tokenRepo.IssuedSince(user.ID, models.TokenVerifyEmail, time.Now().Add(-tokenEmailInterval))
+	if err != nil {
+		return errors.New("failed to send verification email")
+	}
+	if recent {
+		return errors.New("a verification email was sent recently; try again in a minute")
+	}
+
+	if err := s.sendVerification(user); err != nil {
+		return errors.New("failed to send verification email")
+	}
+	return nil
+}
+
+func (s *AuthService) sendVerification(user *models.User) error {
+	token, err := s.issueToken(user.ID, models.TokenVerifyEmail, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+
+	s.sendMail(mail.VerifyEmail, user, "/verify-email?token="+url.QueryEscape(token), "48 hours")
+	return nil
+}
+
+// VerifyEmail marks the address the token was sent to as verified
+func (s *AuthService) VerifyEmail(token string) (*models.User, error) {
+	userID, err := s.tokenRepo.Consume(hashToken(token), models.TokenVerifyEmail)
+	if err != nil {
+		return nil, ErrInvalidToken
 	}
 
-	// Generate token
-	token, err := s.GenerateToken(user)
+	if err := s.userRepo.MarkVerified(userID); err != nil {
+		return nil, errors.New("failed to verify email")
+	}
+
+	return s.GetUser(userID)
+}
+
+// ForgotPassword emails a password reset link to the address, if it
+// belongs to an account. Whether it does isn't revealed.
+func (s *AuthService) ForgotPassword(email string) {
+	user, err := s.userRepo.GetByEmail(email)
+	if err != nil {
+		return
+	}
+
+	recent, err := s.tokenRepo.IssuedSince(user.ID, models.TokenResetPassword, time.Now().Add(-tokenEmailInterval))
+	if err != nil || recent {
+		return
+	}
+
+	token, err := s.issueToken(user.ID, models.TokenResetPassword, resetPasswordTTL)
+	if err != nil {
+		log.Printf("Error issuing password reset token for user %v: %v", user.ID, err)
+		return
+	}
+
+	s.sendMail(mail.ResetPassword, user, "/reset-password?token="+url.QueryEscape(token), "1 hour")
+}
+
+// ResetPassword sets a new password with a token from ForgotPassword and
+// signs the user out everywhere
+func (s *AuthService) ResetPassword(token, password string) error {
+	userID, err := s.tokenRepo.Consume(hashToken(token), models.TokenResetPassword)
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	hashedPassword, err := s.HashPassword(password)
+	if err != nil {
+		return errors.New("failed to hash password")
+	}
+	if err := s.userRepo.UpdatePassword(userID, hashedPassword); err != nil {
+		return errors.New("failed to reset password")
+	}
+
+	if err := s.sessionRepo.RevokeAllForUser(userID, models.RevokedPasswordReset); err != nil {
+		return errors.New("failed to sign out existing sessions")
+	}
+	s.hub.DisconnectUser(userID)
+
+	// The reset link reached the user's inbox, which proves the address
+	if err := s.userRepo.MarkVerified(userID); err != nil {
+		log.Printf("Error marking user %v verified: %v", userID, err)
+	}
+
+	return nil
+}
+
+// issueToken stores a new single-use token for the user, retiring any
+// earlier one for the same purpose
+func (s *AuthService) issueToken(userID uuid.UUID, purpose string, ttl time.Duration) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.tokenRepo.Replace(&models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	return token, err
+}
+
+// sendMail emails the user a link into the app in the background, so
+// requests don't wait on the mail server or reveal by their timing
+// whether an email went out
+func (s *AuthService) sendMail(template *mail.Template, user *models.User, path, expires string) {
+	msg, err := template.Render(user.Email, mail.LinkData{
+		Name:    user.Name,
+		Link:    strings.TrimSuffix(s.config.AppURL, "/") + path,
+		Expires: expires,
+	})
 	if err != nil {
-		return nil, "", errors.New("failed to generate token")
+		log.Printf("Error rendering email for user %v: %v", user.ID, err)
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+		if err := s.mailer.Send(ctx, msg); err != nil {
+			log.Printf("Error sending email to user %v: %v", user.ID, err)
+		}
+	}()
+}
+
+// RunCleanup deletes long-ended sessions and expired tokens every interval
+func (s *AuthService) RunCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		cutoff := time.Now().Add(-sessionRetention)
+		if err := s.sessionRepo.DeleteEndedBefore(cutoff); err != nil {
+			log.Printf("Error deleting ended sessions: %v", err)
+		}
+		if err := s.tokenRepo.DeleteExpiredBefore(cutoff); err != nil {
+			log.Printf("Error deleting expired tokens: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+func (s *AuthService) accessTokenTTL() time.Duration {
+	return time.Duration(s.config.AccessTokenTTLMinutes) * time.Minute
+}
+
+func (s *AuthService) refreshTokenTTL() time.Duration {
+	return time.Duration(s.config.RefreshTokenTTLDays) * 24 * time.Hour
+}
+
+// newRefreshToken returns a refresh token for a session, which names the
+// session followed by a random secret, and the hash to store for it
+func newRefreshToken(sessionID uuid.UUID) (string, string, error) {
+	secret, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	token := sessionID.String() + "." + secret
+	return token, hashToken(token), nil
+}
+
+func randomToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+func parseRefreshToken(token string) (uuid.UUID, error) {
+	sessionID, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return uuid.Nil, errors.New("malformed refresh token")
+	}
+	return uuid.Parse(sessionID)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *AuthService) GetUser(id uuid.UUID) (*models.User, error) {
+	user, err := s.userRepo.GetByID(id)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	return user, nil
+}
+
+func (s *AuthService) UpdateProfile(id uuid.UUID, req *validators.UpdateProfileRequest) (*models.User, error) {
+	user, err := s.userRepo.GetByID(id)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if req.Name != nil {
+		user.Name = strings.TrimSpace(*req.Name)
+		if err := s.userRepo.UpdateName(id, user.Name); err != nil {
+			return nil, errors.New("failed to update profile")
+		}
+	}
+
+	// Changing the language re-indexes every note, so skip it when unchanged
+	if req.SearchLanguage != nil && *req.SearchLanguage != user.SearchLanguage {
+		if err := s.userRepo.UpdateSearchLanguage(id, *req.SearchLanguage); err != nil {
+			return nil, errors.New("failed to update search language")
+		}
+		user.SearchLanguage = *req.SearchLanguage
 	}
 
-	return user, token, nil
+	return user, nil
 }
@@ -0,0 +1,352 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+	"google-keep-clone/internal/events"
+	"google-keep-clone/internal/models"
+	"google-keep-clone/internal/repositories"
+	"google-keep-clone/internal/validators"
+)
+
+type ChecklistService struct {
+	checklistRepo *repositories.ChecklistRepository
+	noteRepo      *repositories.NoteRepository
+	eventBus      *EventBus
+}
+
+func NewChecklistService(checklistRepo *repositories.ChecklistRepository, noteRepo *repositories.NoteRepository, eventBus *EventBus) *ChecklistService {
+	return &ChecklistService{
+		checklistRepo: checklistRepo,
+		noteRepo:      noteRepo,
+		eventBus:      eventBus,
+	}
+}
+
+func (s *ChecklistService) AddItem(noteID, userID uuid.UUID, req *validators.CreateChecklistItemRequest) (*models.ChecklistItem, error) {
+	note, err := s.noteRepo.GetEditableByID(noteID, userID)
+	if err != nil {
+		return nil, errors.New("note not found")
+	}
+
+	// Past the limit the items could no longer be reordered, which has to
+	// list them all
+	if len(note.Items) >= validators.MaxChecklistItems {
+		return nil, fmt.Errorf("a checklist cannot have more than %d items", validators.MaxChecklistItems)
+	}
+
+	item := &models.ChecklistItem{
+		NoteID:    noteID,
+		Text:      req.Text,
+		IsChecked: req.IsChecked,
+	}
+
+	if req.ParentID != nil {
+		parentID, _ := uuid.Parse(*req.ParentID)
+		if err := s.checkParent(noteID, uuid.Nil, parentID); err != nil {
+			return nil, err
+		}
+		item.ParentID = &parentID
+	}
+
+	err = s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		checklistRepo := s.checklistRepo.WithTx(tx)
+
+		if req.Position != nil {
+			item.Position = *req.Position
+		} else {
+			maxPosition, err := checklistRepo.MaxPosition(noteID)
+			if err != nil {
+				return errors.New("failed to add item")
+			}
+			item.Position = maxPosition + 1
+		}
+
+		if err := checklistRepo.Create(item); err != nil {
+			return errors.New("failed to add item")
+		}
+
+		if req.Position != nil || req.ParentID != nil || note.MoveCheckedToBottom {
+			if err := normalizePositions(checklistRepo, note, item.ID); err != nil {
+				return errors.New("failed to reorder items")
+			}
+			var err error
+			if item, err = checklistRepo.GetByID(item.ID, noteID); err != nil {
+				return errors.New("failed to reorder items")
+			}
+		}
+
+		return publishNoteEvent(s.eventBus, tx, s.noteRepo, events.ChecklistItemCreated, userID, noteID, item)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+func (s *ChecklistService) UpdateItem(noteID, itemID, userID uuid.UUID, req *validators.UpdateChecklistItemRequest) (*models.ChecklistItem, error) {
+	note, err := s.noteRepo.GetEditableByID(noteID, userID)
+	if err != nil {
+		return nil, errors.New("note not found")
+	}
+
+	item, err := s.checklistRepo.GetByID(itemID, noteID)
+	if err != nil {
+		return nil, errors.New("item not found")
+	}
+
+	if req.Text != nil {
+		item.Text = *req.Text
+	}
+
+	checkedChanged := req.IsChecked != nil && *req.IsChecked != item.IsChecked
+	if req.IsChecked != nil {
+		item.IsChecked = *req.IsChecked
+	}
+
+	if req.ParentID != nil {
+		if *req.ParentID == "" {
+			item.ParentID = nil
+		} else {
+			parentID, _ := uuid.Parse(*req.ParentID)
+			if err := s.checkParent(noteID, itemID, parentID); err != nil {
+				return nil, err
+			}
+			item.ParentID = &parentID
+		}
+	}
+
+	err = s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		checklistRepo := s.checklistRepo.WithTx(tx)
+
+		if err := checklistRepo.Update(item); err != nil {
+			return errors.New("failed to update item")
+		}
+
+		// Checking a parent checks its children too, as in Keep
+		if checkedChanged && item.ParentID == nil {
+			if err := setChildrenChecked(checklistRepo, noteID, itemID, item.IsChecked); err != nil {
+				return errors.New("failed to update item")
+			}
+		}
+
+		if (checkedChanged && note.MoveCheckedToBottom) || req.ParentID != nil {
+			if err := normalizePositions(checklistRepo, note, uuid.Nil); err != nil {
+				return errors.New("failed to reorder items")
+			}
+			var err error
+			if item, err = checklistRepo.GetByID(itemID, noteID); err != nil {
+				return errors.New("failed to reorder items")
+			}
+		}
+
+		return publishNoteEvent(s.eventBus, tx, s.noteRepo, events.ChecklistItemUpdated, userID, noteID, item)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+func (s *ChecklistService) ReorderItems(noteID, userID uuid.UUID, req *validators.ReorderChecklistItemsRequest) ([]models.ChecklistItem, error) {
+	note, err := s.noteRepo.GetEditableByID(noteID, userID)
+	if err != nil {
+		return nil, errors.New("note not found")
+	}
+
+	if len(req.ItemIDs) != len(note.Items) {
+		return nil, errors.New("item_ids must list every item of the note")
+	}
+
+	known := make(map[uuid.UUID]bool, len(note.Items))
+	for _, item := range note.Items {
+		known[item.ID] = true
+	}
+
+	// IDs were trimmed and checked for duplicates by the validator
+	itemIDs := make([]uuid.UUID, 0, len(req.ItemIDs))
+	for _, idStr := range req.ItemIDs {
+		id, _ := uuid.Parse(idStr)
+		if !known[id] {
+			return nil, errors.New("item not found: " + idStr)
+		}
+		itemIDs = append(itemIDs, id)
+	}
+
+	var items []models.ChecklistItem
+	err = s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		checklistRepo := s.checklistRepo.WithTx(tx)
+
+		if err := checklistRepo.UpdatePositions(noteID, itemIDs); err != nil {
+			return errors.New("failed to reorder items")
+		}
+
+		// Children the client moved away from their parent are put back
+		// under it
+		if err := normalizePositions(checklistRepo, note, uuid.Nil); err != nil {
+			return errors.New("failed to reorder items")
+		}
+
+		var err error
+		if items, err = checklistRepo.GetByNoteID(noteID); err != nil {
+			return errors.New("failed to load items")
+		}
+
+		return publishNoteEvent(s.eventBus, tx, s.noteRepo, events.ChecklistItemsReordered, userID, noteID,
+			events.ItemsReordered{NoteID: noteID, Items: items})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (s *ChecklistService) DeleteItem(noteID, itemID, userID uuid.UUID) error {
+	if _, err := s.noteRepo.GetEditableByID(noteID, userID); err != nil {
+		return errors.New("note not found")
+	}
+
+	if _, err := s.checklistRepo.GetByID(itemID, noteID); err != nil {
+		return errors.New("item not found")
+	}
+
+	return s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		if err := s.checklistRepo.WithTx(tx).Delete(itemID, noteID); err != nil {
+			return errors.New("failed to delete item")
+		}
+
+		return publishNoteEvent(s.eventBus, tx, s.noteRepo, events.ChecklistItemDeleted, userID, noteID,
+			events.NoteItemDeleted{ID: itemID, NoteID: noteID})
+	})
+}
+
+// checkParent makes sure parentID is a top-level item of the same note
+func (s *ChecklistService) checkParent(noteID, itemID, parentID uuid.UUID) error {
+	if parentID == itemID {
+		return errors.New("an item cannot be its own parent")
+	}
+
+	parent, err := s.checklistRepo.GetByID(parentID, noteID)
+	if err != nil {
+		return errors.New("parent item not found")
+	}
+
+	if parent.ParentID != nil {
+		return errors.New("items can only be nested one level deep")
+	}
+
+	if itemID != uuid.Nil {
+		items, err := s.checklistRepo.GetByNoteID(noteID)
+		if err != nil {
+			return errors.New("failed to load items")
+		}
+		for _, item := range items {
+			if item.ParentID != nil && *item.ParentID == itemID {
+				return errors.New("items can only be nested one level deep")
+			}
+		}
+	}
+
+	return nil
+}
+
+func setChildrenChecked(checklistRepo *repositories.ChecklistRepository, noteID, parentID uuid.UUID, checked bool) error {
+	items, err := checklistRepo.GetByNoteID(noteID)
+	if err != nil {
+		return err
+	}
+
+	for i := range items {
+		if items[i].ParentID != nil && *items[i].ParentID == parentID && items[i].IsChecked != checked {
+			items[i].IsChecked = checked
+			if err := checklistRepo.Update(&items[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// normalizePositions rewrites positions as 0..n-1, keeping children right
+// below their parent. If preferred is set, that item wins ties with an
+// existing item at the same position.
+func normalizePositions(checklistRepo *repositories.ChecklistRepository, note *models.Note, preferred uuid.UUID) error {
+	items, err := checklistRepo.GetByNoteID(note.ID)
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Position != items[j].Position {
+			return items[i].Position < items[j].Position
+		}
+		return items[i].ID == preferred
+	})
+
+	return checklistRepo.UpdatePositions(note.ID, orderChecklist(items, note.MoveCheckedToBottom))
+}
+
+// orderChecklist returns item IDs with children grouped under their parent.
+// When moveCheckedToBottom is set, checked top-level groups go last.
+func orderChecklist(items []models.ChecklistItem, moveCheckedToBottom bool) []uuid.UUID {
+	children := make(map[uuid.UUID][]models.ChecklistItem)
+	var roots []models.ChecklistItem
+	for _, item := range items {
+		if item.ParentID != nil {
+			children[*item.ParentID] = append(children[*item.ParentID], item)
+		} else {
+			roots = append(roots, item)
+		}
+	}
+
+	if moveCheckedToBottom {
+		sort.SliceStable(roots, func(i, j int) bool {
+			return !roots[i].IsChecked && roots[j].IsChecked
+		})
+	}
+
+	ids := make([]uuid.UUID, 0, len(items))
+	for _, root := range roots {
+		ids = append(ids, root.ID)
+		for _, child := range children[root.ID] {
+			ids = append(ids, child.ID)
+		}
+	}
+
+	return ids
+}
+
+// buildChecklistItems turns inline item input into models for noteID
+func buildChecklistItems(noteID uuid.UUID, inputs []validators.ChecklistItemInput, moveCheckedToBottom bool) []models.ChecklistItem {
+	items := make([]models.ChecklistItem, len(inputs))
+	for i, input := range inputs {
+		items[i] = models.ChecklistItem{
+			ID:        uuid.New(),
+			NoteID:    noteID,
+			Text:      input.Text,
+			IsChecked: input.IsChecked,
+			Position:  i,
+		}
+		if input.ParentIndex != nil {
+			parentID := items[*input.ParentIndex].ID
+			items[i].ParentID = &parentID
+		}
+	}
+
+	positions := make(map[uuid.UUID]int, len(items))
+	for position, id := range orderChecklist(items, moveCheckedToBottom) {
+		positions[id] = position
+	}
+	for i := range items {
+		items[i].Position = positions[items[i].ID]
+	}
+
+	return items
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"google-keep-clone/internal/events"
+	"google-keep-clone/internal/models"
+	"google-keep-clone/internal/repositories"
+	"google-keep-clone/internal/validators"
+)
+
+type CollaboratorService struct {
+	collaboratorRepo *repositories.CollaboratorRepository
+	noteRepo         *repositories.NoteRepository
+	userRepo         *repositories.UserRepository
+	eventBus         *EventBus
+}
+
+func NewCollaboratorService(collaboratorRepo *repositories.CollaboratorRepository, noteRepo *repositories.NoteRepository, userRepo *repositories.UserRepository, eventBus *EventBus) *CollaboratorService {
+	return &CollaboratorService{
+		collaboratorRepo: collaboratorRepo,
+		noteRepo:         noteRepo,
+		userRepo:         userRepo,
+		eventBus:         eventBus,
+	}
+}
+
+func (s *CollaboratorService) GetCollaborators(noteID, userID uuid.UUID) ([]models.NoteCollaborator, error) {
+	// Verify note is visible to the user
+	if _, err := s.noteRepo.GetByID(noteID, userID); err != nil {
+		return nil, errors.New("note not found")
+	}
+
+	return s.collaboratorRepo.GetByNoteID(noteID)
+}
+
+// AddCollaborator shares a note with the user registered under req.Email,
+// or changes their role if the note is already shared with them. An email
+// without an account is not an error, so callers can't use this to find
+// out who is registered.
+func (s *CollaboratorService) AddCollaborator(noteID, userID uuid.UUID, req *validators.AddCollaboratorRequest) error {
+	note, err := s.noteRepo.GetByID(noteID, userID)
+	if err != nil {
+		return errors.New("note not found")
+	}
+
+	if note.UserID != userID {
+		return errors.New("only the owner can share this note")
+	}
+
+	invitee, err := s.userRepo.GetByEmail(req.Email)
+	if err != nil {
+		return nil
+	}
+
+	if invitee.ID == userID {
+		return errors.New("cannot share a note with yourself")
+	}
+
+	collaborator := &models.NoteCollaborator{
+		NoteID:    noteID,
+		UserID:    invitee.ID,
+		Role:      req.Role,
+		InvitedBy: userID,
+	}
+
+	return s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		collaboratorRepo := s.collaboratorRepo.WithTx(tx)
+		noteRepo := s.noteRepo.WithTx(tx)
+
+		if err := collaboratorRepo.Upsert(collaborator); err != nil {
+			return errors.New("failed to add collaborator")
+		}
+
+		collaborator, err := collaboratorRepo.Get(noteID, invitee.ID)
+		if err != nil {
+			return errors.New("failed to add collaborator")
+		}
+
+		// Tell the owner and everyone sharing the note, then hand the
+		// note to the invitee
+		if err := publishNoteEvent(s.eventBus, tx, s.noteRepo, events.CollaboratorAdded, userID, noteID, collaborator); err != nil {
+			return err
+		}
+		shared, err := noteRepo.GetByID(noteID, invitee.ID)
+		if err != nil {
+			return err
+		}
+		return s.eventBus.Publish(tx, events.NoteShared, userID, []uuid.UUID{invitee.ID}, shared)
+	})
+}
+
+// RemoveCollaborator unshares a note, dropping the collaborator's labels
+// on it and their reminder for it. The owner can remove anyone; a
+// collaborator can only remove themselves.
+func (s *CollaboratorService) RemoveCollaborator(noteID, collaboratorID, userID uuid.UUID) error {
+	note, err := s.noteRepo.GetByID(noteID, userID)
+	if err != nil {
+		return errors.New("note not found")
+	}
+
+	if note.UserID != userID && collaboratorID != userID {
+		return errors.New("only the owner can remove other collaborators")
+	}
+
+	if _, err := s.collaboratorRepo.Get(noteID, collaboratorID); err != nil {
+		return errors.New("collaborator not found")
+	}
+
+	return s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		if err := s.collaboratorRepo.WithTx(tx).Delete(noteID, collaboratorID); err != nil {
+			return errors.New("failed to remove collaborator")
+		}
+
+		// The removed collaborator is no longer among those who can see
+		// the note, so they are told separately
+		payload := events.CollaboratorLink{NoteID: noteID, UserID: collaboratorID}
+		if err := publishNoteEvent(s.eventBus, tx, s.noteRepo, events.CollaboratorRemoved, userID, noteID, payload); err != nil {
+			return err
+		}
+		return s.eventBus.Publish(tx, events.NoteUnshared, userID, []uuid.UUID{collaboratorID}, payload)
+	})
+}
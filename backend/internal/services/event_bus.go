@@ -0,0 +1,226 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"google-keep-clone/internal/events"
+	"google-keep-clone/internal/models"
+	"google-keep-clone/internal/repositories"
+	"google-keep-clone/internal/websocket"
+)
+
+const (
+	eventDispatchBatchSize = 100
+	// Dispatched events are kept this long, then deleted
+	eventRetention = 7 * 24 * time.Hour
+	// An event a subscriber keeps failing is retried with growing delays,
+	// then given up on
+	maxEventAttempts = 20
+	maxEventBackoff  = time.Hour
+)
+
+// EventBus records domain events in the outbox alongside the changes they
+// describe and dispatches them to subscribers once committed
+type EventBus struct {
+	outboxRepo  *repositories.OutboxRepository
+	subscribers []events.Subscriber
+	mutex       sync.RWMutex
+	wake        chan struct{}
+}
+
+func NewEventBus(outboxRepo *repositories.OutboxRepository) *EventBus {
+	return &EventBus{
+		outboxRepo: outboxRepo,
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+// Subscribe adds a subscriber for every event from now on
+func (b *EventBus) Subscribe(subscriber events.Subscriber) {
+	b.mutex.Lock()
+	b.subscribers = append(b.subscribers, subscriber)
+	b.mutex.Unlock()
+}
+
+// Transaction runs fn in a transaction. Events published within it are
+// dispatched once it commits, and dropped with it if it doesn't.
+func (b *EventBus) Transaction(fn func(tx *repositories.Tx) error) error {
+	if err := b.outboxRepo.Transaction(fn); err != nil {
+		return err
+	}
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Publish records an event within tx for the users in audience
+func (b *EventBus) Publish(tx *repositories.Tx, eventType events.Type, actorID uuid.UUID, audience []uuid.UUID, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return b.outboxRepo.Record(tx, &models.OutboxEvent{
+		Type:          string(eventType),
+		ActorID:       actorID,
+		Audience:      audience,
+		Payload:       string(data),
+		NextAttemptAt: time.Now(),
+	})
+}
+
+// Run dispatches events as they are committed, and every interval to pick
+// up retries and events left behind by a crash
+func (b *EventBus) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastPrune := time.Time{}
+
+	for {
+		for {
+			dispatched, err := b.outboxRepo.Dispatch(eventDispatchBatchSize, b.deliver)
+			if err != nil {
+				log.Printf("Error dispatching events: %v", err)
+			}
+			if err != nil || dispatched < eventDispatchBatchSize {
+				break
+			}
+		}
+
+		if time.Since(lastPrune) > time.Hour {
+			if err := b.outboxRepo.DeleteDispatchedBefore(time.Now().Add(-eventRetention)); err != nil {
+				log.Printf("Error pruning events: %v", err)
+			}
+			lastPrune = time.Now()
+		}
+
+		select {
+		case <-b.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliver hands an event to each subscriber that hasn't handled it yet,
+// and schedules a retry if any of them fail
+func (b *EventBus) deliver(outboxEvent *models.OutboxEvent) {
+	event := &events.Event{
+		ID:         outboxEvent.ID,
+		Type:       events.Type(outboxEvent.Type),
+		ActorID:    outboxEvent.ActorID,
+		Audience:   outboxEvent.Audience,
+		Payload:    json.RawMessage(outboxEvent.Payload),
+		OccurredAt: outboxEvent.CreatedAt,
+	}
+
+	delivered := make(map[string]bool, len(outboxEvent.Delivered))
+	for _, name := range outboxEvent.Delivered {
+		delivered[name] = true
+	}
+
+	b.mutex.RLock()
+	subscribers := b.subscribers
+	b.mutex.RUnlock()
+
+	var failure error
+	for _, subscriber := range subscribers {
+		if delivered[subscriber.Name()] {
+			continue
+		}
+		if err := subscriber.Handle(event); err != nil {
+			failure = err
+			continue
+		}
+		outboxEvent.Delivered = append(outboxEvent.Delivered, subscriber.Name())
+	}
+
+	outboxEvent.Attempts++
+	if failure == nil || outboxEvent.Attempts >= maxEventAttempts {
+		if failure != nil {
+			log.Printf("Giving up on event %d (%s) after %d attempts: %v", outboxEvent.ID, outboxEvent.Type, outboxEvent.Attempts, failure)
+			outboxEvent.LastError = failure.Error()
+		}
+		now := time.Now()
+		outboxEvent.DispatchedAt = &now
+		return
+	}
+
+	outboxEvent.LastError = failure.Error()
+	outboxEvent.NextAttemptAt = time.Now().Add(eventBackoff(outboxEvent.Attempts))
+}
+
+// eventBackoff doubles from a second up to maxEventBackoff
+func eventBackoff(attempts int) time.Duration {
+	backoff := time.Second << min(attempts-1, 12)
+	return min(backoff, maxEventBackoff)
+}
+
+// publishNoteEvent records an event about a note for everyone who can see
+// it. Call it before the note is deleted, while its collaborators are
+// still on record. A note payload is sent without what is personal to
+// the user it was loaded for.
+func publishNoteEvent(bus *EventBus, tx *repositories.Tx, noteRepo *repositories.NoteRepository, eventType events.Type, actorID, noteID uuid.UUID, payload interface{}) error {
+	audience, err := noteRepo.WithTx(tx).GetAudience(noteID)
+	if err != nil {
+		return err
+	}
+	if note, ok := payload.(*models.Note); ok {
+		payload = sharedNote(note)
+	}
+	return bus.Publish(tx, eventType, actorID, audience, payload)
+}
+
+// sharedNote copies a note for everyone who can see it: without the labels
+// and reminder of the user it was loaded for, which stay personal, or the
+// list of who it is shared with
+func sharedNote(note *models.Note) *models.Note {
+	shared := *note
+	shared.Labels = nil
+	shared.Reminder = nil
+	shared.Collaborators = nil
+	return &shared
+}
+
+// HubSubscriber passes events on to the websocket clients of their
+// audience
+type HubSubscriber struct {
+	hub *websocket.Hub
+}
+
+func NewHubSubscriber(hub *websocket.Hub) *HubSubscriber {
+	return &HubSubscriber{hub: hub}
+}
+
+func (s *HubSubscriber) Name() string {
+	return "websocket"
+}
+
+func (s *HubSubscriber) Handle(event *events.Event) error {
+	for _, userID := range event.Audience {
+		s.hub.BroadcastToUser(userID, string(event.Type), event.Payload)
+	}
+	return nil
+}
+
+// AuditLogSubscriber writes a line to the server log for every event
+type AuditLogSubscriber struct{}
+
+func NewAuditLogSubscriber() *AuditLogSubscriber {
+	return &AuditLogSubscriber{}
+}
+
+func (s *AuditLogSubscriber) Name() string {
+	return "audit_log"
+}
+
+func (s *AuditLogSubscriber) Handle(event *events.Event) error {
+	log.Printf("Audit: event %d %s by %v at %s: %s", event.ID, event.Type, event.ActorID, event.OccurredAt.Format(time.RFC3339), event.Payload)
+	return nil
+}
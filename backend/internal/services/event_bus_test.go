@@ -0,0 +1,28 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"google-keep-clone/internal/models"
+)
+
+func TestSharedNoteLeavesOutPersonalFields(t *testing.T) {
+	note := &models.Note{
+		Title:         "Groceries",
+		Labels:        []models.Label{{Name: "private"}},
+		Reminder:      &models.Reminder{},
+		Collaborators: []models.NoteCollaborator{{UserID: uuid.New()}},
+	}
+
+	shared := sharedNote(note)
+	if shared.Title != note.Title {
+		t.Errorf("title = %q; want %q", shared.Title, note.Title)
+	}
+	if shared.Labels != nil || shared.Reminder != nil || shared.Collaborators != nil {
+		t.Errorf("shared note keeps personal fields: %+v", shared)
+	}
+	if len(note.Labels) != 1 || note.Reminder == nil || len(note.Collaborators) != 1 {
+		t.Error("the original note was changed")
+	}
+}
@@ -0,0 +1,338 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"google-keep-clone/internal/export"
+	"google-keep-clone/internal/models"
+	"google-keep-clone/internal/repositories"
+	"google-keep-clone/internal/takeout"
+)
+
+const (
+	ExportJSON     = "json"
+	ExportMarkdown = "markdown"
+	ExportKeep     = "keep"
+
+	// Notes are loaded this many at a time so exports of large accounts
+	// stay within bounded memory
+	exportBatchSize = 200
+	// Version of the JSON export layout
+	exportJSONVersion = 1
+)
+
+var ErrUnknownExportFormat = errors.New("format must be json, markdown or keep")
+
+type ExportService struct {
+	noteRepo          *repositories.NoteRepository
+	labelRepo         *repositories.LabelRepository
+	userRepo          *repositories.UserRepository
+	attachmentService *AttachmentService
+}
+
+func NewExportService(noteRepo *repositories.NoteRepository, labelRepo *repositories.LabelRepository, userRepo *repositories.UserRepository, attachmentService *AttachmentService) *ExportService {
+	return &ExportService{
+		noteRepo:          noteRepo,
+		labelRepo:         labelRepo,
+		userRepo:          userRepo,
+		attachmentService: attachmentService,
+	}
+}
+
+// noteExporter writes one export format into a zip
+type noteExporter interface {
+	begin(user *models.User, labels []models.Label) error
+	note(note *models.Note) error
+	end() error
+}
+
+func ValidateExportFormat(format string) error {
+	switch format {
+	case ExportJSON, ExportMarkdown, ExportKeep:
+		return nil
+	}
+	return ErrUnknownExportFormat
+}
+
+// Export writes a zip of all of the user's notes, labels and attachments to
+// w as it reads them
+func (s *ExportService) Export(ctx context.Context, userID uuid.UUID, format string, w io.Writer) error {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	labels, err := s.labelRepo.GetByUserID(userID)
+	if err != nil {
+		return errors.New("failed to load labels")
+	}
+
+	zw := zip.NewWriter(w)
+	base := zipExporter{ctx: ctx, zw: zw, attachments: s.attachmentService}
+
+	var exporter noteExporter
+	switch format {
+	case ExportJSON:
+		exporter = &jsonExporter{base}
+	case ExportMarkdown:
+		exporter = &markdownExporter{base}
+	case ExportKeep:
+		exporter = &keepExporter{zipExporter: base}
+	default:
+		return ErrUnknownExportFormat
+	}
+
+	if err := exporter.begin(user, labels); err != nil {
+		return err
+	}
+
+	after := uuid.Nil
+	for {
+		notes, err := s.noteRepo.GetOwnedBatch(userID, after, exportBatchSize)
+		if err != nil {
+			return errors.New("failed to load notes")
+		}
+
+		for i := range notes {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := exporter.note(&notes[i]); err != nil {
+				return err
+			}
+		}
+
+		if len(notes) < exportBatchSize {
+			break
+		}
+		after = notes[len(notes)-1].ID
+	}
+
+	if err := exporter.end(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// zipExporter holds what every format needs to write entries
+type zipExporter struct {
+	ctx         context.Context
+	zw          *zip.Writer
+	attachments *AttachmentService
+}
+
+func (e *zipExporter) writeFile(name string, data []byte, modified time.Time) error {
+	f, err := e.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+func (e *zipExporter) writeJSON(name string, v interface{}, modified time.Time) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return e.writeFile(name, data, modified)
+}
+
+// writeAttachment copies an attachment's content into the zip. Missing
+// blobs are skipped so one lost file doesn't sink the whole export.
+func (e *zipExporter) writeAttachment(name string, attachment *models.Attachment) (bool, error) {
+	reader, err := e.attachments.ReadContent(e.ctx, attachment)
+	if err != nil {
+		log.Printf("Skipping attachment %s in export: %v", attachment.ID, err)
+		return false, nil
+	}
+	defer func() { _ = reader.Close() }()
+
+	// Media is already compressed; deflating it again only costs CPU
+	method := zip.Deflate
+	if isCompressedMedia(attachment.MimeType) {
+		method = zip.Store
+	}
+
+	f, err := e.zw.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: attachment.CreatedAt})
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(f, reader); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func isCompressedMedia(mimeType string) bool {
+	if mimeType == "image/svg+xml" || mimeType == "image/bmp" {
+		return false
+	}
+	for _, prefix := range []string{"image/", "audio/", "video/", "application/zip", "application/pdf"} {
+		if strings.HasPrefix(mimeType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// attachmentFileName names an attachment's file so names can't collide
+// across notes
+func attachmentFileName(attachment *models.Attachment) string {
+	return attachment.ID.String()[:8] + "-" + attachment.Filename
+}
+
+// jsonExporter writes a lossless dump: a manifest with the account and its
+// labels, one file per note and every attachment's content
+type jsonExporter struct {
+	zipExporter
+}
+
+func (e *jsonExporter) begin(user *models.User, labels []models.Label) error {
+	return e.writeJSON("export.json", map[string]interface{}{
+		"version":     exportJSONVersion,
+		"exported_at": time.Now().UTC(),
+		"user": map[string]interface{}{
+			"id":    user.ID,
+			"email": user.Email,
+			"name":  user.Name,
+		},
+		"labels": labels,
+	}, time.Now())
+}
+
+func (e *jsonExporter) note(note *models.Note) error {
+	// Point attachment URLs at the files in the archive instead of the server
+	files := make(map[uuid.UUID]string, len(note.Attachments))
+	for i := range note.Attachments {
+		attachment := &note.Attachments[i]
+		name := path.Join("attachments", attachmentFileName(attachment))
+		ok, err := e.writeAttachment(name, attachment)
+		if err != nil {
+			return err
+		}
+		if ok {
+			files[attachment.ID] = name
+		}
+	}
+
+	type exportedAttachment struct {
+		models.Attachment
+		File string `json:"file,omitempty"`
+	}
+	attachments := make([]exportedAttachment, len(note.Attachments))
+	for i, attachment := range note.Attachments {
+		attachment.ThumbnailURL = nil
+		attachments[i] = exportedAttachment{Attachment: attachment, File: files[attachment.ID]}
+	}
+
+	return e.writeJSON(path.Join("notes", note.ID.String()+".json"), struct {
+		*models.Note
+		User        *models.User         `json:"user,omitempty"`
+		Attachments []exportedAttachment `json:"attachments"`
+	}{Note: note, Attachments: attachments}, note.UpdatedAt)
+}
+
+func (e *jsonExporter) end() error {
+	return nil
+}
+
+// markdownExporter writes one .md file per note, with attachments in a
+// folder next to them
+type markdownExporter struct {
+	zipExporter
+}
+
+func (e *markdownExporter) begin(user *models.User, labels []models.Label) error {
+	return nil
+}
+
+func (e *markdownExporter) note(note *models.Note) error {
+	name := export.FileName(note.Title, note.ID, "")
+
+	links := make(map[uuid.UUID]string, len(note.Attachments))
+	for i := range note.Attachments {
+		attachment := &note.Attachments[i]
+		file := path.Join("attachments", name, attachmentFileName(attachment))
+		ok, err := e.writeAttachment(file, attachment)
+		if err != nil {
+			return err
+		}
+		if ok {
+			links[attachment.ID] = file
+		}
+	}
+
+	return e.writeFile(name+".md", export.Markdown(note, links), note.UpdatedAt)
+}
+
+func (e *markdownExporter) end() error {
+	return nil
+}
+
+// keepExporter mirrors the layout of a Google Takeout archive, so exports
+// can be imported by anything that reads Takeout, this server included
+type keepExporter struct {
+	zipExporter
+	labels []string
+}
+
+const keepDir = "Takeout/Keep"
+
+func (e *keepExporter) begin(user *models.User, labels []models.Label) error {
+	for _, label := range labels {
+		e.labels = append(e.labels, label.Name)
+	}
+	return nil
+}
+
+func (e *keepExporter) note(note *models.Note) error {
+	keepNote := takeout.KeepNote{
+		Title:                   note.Title,
+		TextContent:             note.Content,
+		Color:                   takeout.KeepColorName(note.Color),
+		IsPinned:                note.IsPinned,
+		IsArchived:              note.IsArchived,
+		IsTrashed:               note.IsDeleted,
+		CreatedTimestampUsec:    note.CreatedAt.UnixMicro(),
+		UserEditedTimestampUsec: note.UpdatedAt.UnixMicro(),
+	}
+
+	// Keep has no nesting; children follow their parents in a flat list
+	for _, item := range note.Items {
+		keepNote.ListContent = append(keepNote.ListContent, takeout.KeepListItem{Text: item.Text, IsChecked: item.IsChecked})
+	}
+	for _, label := range note.Labels {
+		keepNote.Labels = append(keepNote.Labels, takeout.KeepLabel{Name: label.Name})
+	}
+
+	for i := range note.Attachments {
+		attachment := &note.Attachments[i]
+		file := attachmentFileName(attachment)
+		ok, err := e.writeAttachment(path.Join(keepDir, file), attachment)
+		if err != nil {
+			return err
+		}
+		if ok {
+			keepNote.Attachments = append(keepNote.Attachments, takeout.KeepAttachment{FilePath: file, MimeType: attachment.MimeType})
+		}
+	}
+
+	return e.writeJSON(path.Join(keepDir, export.FileName(note.Title, note.ID, ".json")), keepNote, note.UpdatedAt)
+}
+
+func (e *keepExporter) end() error {
+	if len(e.labels) == 0 {
+		return nil
+	}
+	return e.writeFile(path.Join(keepDir, "Labels.txt"), []byte(strings.Join(e.labels, "\n")+"\n"), time.Now())
+}
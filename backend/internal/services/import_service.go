@@ -0,0 +1,394 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"mime/multipart"
+	"os"
+	"path"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"google-keep-clone/internal/events"
+	"google-keep-clone/internal/models"
+	"google-keep-clone/internal/repositories"
+	"google-keep-clone/internal/takeout"
+	"google-keep-clone/internal/validators"
+)
+
+var ErrImportInProgress = errors.New("an import is already in progress")
+
+const (
+	// How often a running import saves and broadcasts its progress
+	importProgressEvery = 25
+	// Cap on the per-item error report kept on a job
+	maxImportErrors = 1000
+)
+
+type ImportService struct {
+	importJobRepo     *repositories.ImportJobRepository
+	noteRepo          *repositories.NoteRepository
+	labelRepo         *repositories.LabelRepository
+	attachmentService *AttachmentService
+	eventBus          *EventBus
+}
+
+func NewImportService(importJobRepo *repositories.ImportJobRepository, noteRepo *repositories.NoteRepository, labelRepo *repositories.LabelRepository, attachmentService *AttachmentService, eventBus *EventBus) *ImportService {
+	return &ImportService{
+		importJobRepo:     importJobRepo,
+		noteRepo:          noteRepo,
+		labelRepo:         labelRepo,
+		attachmentService: attachmentService,
+		eventBus:          eventBus,
+	}
+}
+
+// StartKeepImport checks a Google Takeout archive and imports its Keep
+// notes in the background. Progress is tracked on the returned job.
+func (s *ImportService) StartKeepImport(userID uuid.UUID, header *multipart.FileHeader) (*models.ImportJob, error) {
+	// Spares copying the archive; saving the job checks again
+	active, err := s.importJobRepo.HasActive(userID)
+	if err != nil {
+		return nil, errors.New("failed to check running imports")
+	}
+	if active {
+		return nil, ErrImportInProgress
+	}
+
+	archivePath, err := saveUpload(header)
+	if err != nil {
+		return nil, errors.New("failed to read upload")
+	}
+
+	total, err := countKeepNotes(archivePath)
+	if err != nil {
+		_ = os.Remove(archivePath)
+		return nil, err
+	}
+
+	job := &models.ImportJob{
+		ID:       uuid.New(),
+		UserID:   userID,
+		Source:   "keep",
+		Filename: sanitizeFilename(header.Filename),
+		Status:   models.ImportPending,
+		Total:    total,
+	}
+	created, err := s.importJobRepo.CreateIfNoneActive(job)
+	if err != nil || !created {
+		_ = os.Remove(archivePath)
+		if err == nil {
+			return nil, ErrImportInProgress
+		}
+		return nil, errors.New("failed to create import job")
+	}
+
+	go s.runKeepImport(*job, archivePath)
+
+	return job, nil
+}
+
+func (s *ImportService) GetImportJob(id, userID uuid.UUID) (*models.ImportJob, error) {
+	job, err := s.importJobRepo.GetByID(id, userID)
+	if err != nil {
+		return nil, errors.New("import job not found")
+	}
+	return job, nil
+}
+
+func (s *ImportService) GetImportJobs(userID uuid.UUID) ([]models.ImportJob, error) {
+	return s.importJobRepo.GetByUserID(userID, 20)
+}
+
+// FailInterruptedImports cleans up after a restart; the archives of jobs
+// that were running are gone
+func (s *ImportService) FailInterruptedImports() {
+	if n, err := s.importJobRepo.FailInterrupted(); err != nil {
+		log.Printf("Error failing interrupted imports: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d interrupted imports as failed", n)
+	}
+}
+
+func (s *ImportService) runKeepImport(job models.ImportJob, archivePath string) {
+	defer func() { _ = os.Remove(archivePath) }()
+	// A malformed archive must not take the server down with it
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Import %s panicked: %v\n%s", job.ID, r, debug.Stack())
+			s.failImport(&job, "the archive could not be read")
+		}
+	}()
+
+	now := time.Now()
+	job.Status = models.ImportRunning
+	job.StartedAt = &now
+	s.saveProgress(&job, events.ImportProgress)
+
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		s.failImport(&job, "failed to open archive")
+		return
+	}
+	defer func() { _ = reader.Close() }()
+
+	archive, err := takeout.OpenArchive(&reader.Reader)
+	if err != nil {
+		s.failImport(&job, err.Error())
+		return
+	}
+
+	labels, err := s.labelIDsByName(job.UserID)
+	if err != nil {
+		s.failImport(&job, "failed to load labels")
+		return
+	}
+
+	for _, name := range archive.Notes() {
+		imported, itemErrors, err := s.importKeepNote(job.UserID, archive, name, labels)
+		switch {
+		case err != nil:
+			job.Failed++
+			s.addImportError(&job, path.Base(name), err.Error())
+		case imported:
+			job.Imported++
+		default:
+			job.Skipped++
+		}
+		for _, itemErr := range itemErrors {
+			s.addImportError(&job, itemErr.Item, itemErr.Error)
+		}
+
+		job.Processed++
+		if job.Processed%importProgressEvery == 0 {
+			s.saveProgress(&job, events.ImportProgress)
+		}
+	}
+
+	finished := time.Now()
+	job.Status = models.ImportCompleted
+	job.FinishedAt = &finished
+	s.saveProgress(&job, events.ImportCompleted)
+}
+
+// importKeepNote imports one note file. It reports false without an error
+// when the note was already imported. Attachments that can't be imported
+// don't fail the note; they come back as item errors.
+func (s *ImportService) importKeepNote(userID uuid.UUID, archive *takeout.Archive, name string, labels map[string]uuid.UUID) (bool, []models.ImportItemError, error) {
+	keepNote, err := archive.ReadNote(name)
+	if err != nil {
+		return false, nil, err
+	}
+
+	// Takeout file names are unique within an export and stable across
+	// exports; the creation time guards against a reused name
+	importKey := "keep:" + path.Base(name) + ":" + strconv.FormatInt(keepNote.CreatedTimestampUsec, 10)
+	exists, err := s.noteRepo.ImportKeyExists(userID, importKey)
+	if err != nil {
+		return false, nil, errors.New("failed to check for an earlier import")
+	}
+	if exists {
+		return false, nil, nil
+	}
+
+	req := &validators.CreateNoteRequest{
+		Title:   keepNote.Title,
+		Content: keepNote.TextContent,
+		Color:   keepNote.HexColor(),
+	}
+	for _, item := range keepNote.ListContent {
+		req.Items = append(req.Items, validators.ChecklistItemInput{Text: item.Text, IsChecked: item.IsChecked})
+	}
+	validate := validators.ValidateCreateNoteRequest
+	if len(keepNote.Attachments) > 0 {
+		// A photo on its own makes a note too
+		validate = validators.ValidateNoteFields
+	}
+	if err := validate(req); err != nil {
+		return false, nil, err
+	}
+
+	note := &models.Note{
+		ID:         uuid.New(),
+		UserID:     userID,
+		Title:      req.Title,
+		Content:    req.Content,
+		Color:      req.Color,
+		IsPinned:   keepNote.IsPinned,
+		IsArchived: keepNote.IsArchived,
+		IsDeleted:  keepNote.IsTrashed,
+		ImportKey:  &importKey,
+		CreatedAt:  keepNote.CreatedAt(),
+		UpdatedAt:  keepNote.UpdatedAt(),
+	}
+	if keepNote.IsTrashed {
+		// Retention counts from the import, or old trash would be purged
+		// straight away
+		now := time.Now()
+		note.TrashedAt = &now
+	}
+
+	if len(req.Items) > 0 {
+		note.Items = buildChecklistItems(note.ID, req.Items, false)
+	}
+
+	for _, label := range keepNote.Labels {
+		labelID, err := s.resolveLabel(userID, label.Name, labels)
+		if err != nil {
+			return false, nil, err
+		}
+		if labelID != uuid.Nil {
+			note.Labels = append(note.Labels, models.Label{ID: labelID})
+		}
+	}
+
+	err = s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		if err := s.noteRepo.WithTx(tx).Create(note); err != nil {
+			return err
+		}
+		return s.eventBus.Publish(tx, events.NoteCreated, userID, []uuid.UUID{userID}, note)
+	})
+	if err != nil {
+		return false, nil, errors.New("failed to create note")
+	}
+
+	var itemErrors []models.ImportItemError
+	for _, attachment := range keepNote.Attachments {
+		if err := s.importKeepAttachment(userID, note.ID, archive, name, attachment.FilePath); err != nil {
+			itemErrors = append(itemErrors, models.ImportItemError{
+				Item:  path.Base(name) + ": " + path.Base(attachment.FilePath),
+				Error: err.Error(),
+			})
+		}
+	}
+
+	return true, itemErrors, nil
+}
+
+func (s *ImportService) importKeepAttachment(userID, noteID uuid.UUID, archive *takeout.Archive, notePath, filePath string) error {
+	data, err := archive.ReadAttachment(notePath, filePath, s.attachmentService.maxFileSize)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.attachmentService.AddFile(context.Background(), noteID, userID, path.Base(filePath), bytes.NewReader(data), int64(len(data)))
+	return err
+}
+
+// labelIDsByName indexes the user's labels by lowercased name
+func (s *ImportService) labelIDsByName(userID uuid.UUID) (map[string]uuid.UUID, error) {
+	existing, err := s.labelRepo.GetByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make(map[string]uuid.UUID, len(existing))
+	for _, label := range existing {
+		labels[strings.ToLower(label.Name)] = label.ID
+	}
+	return labels, nil
+}
+
+// resolveLabel finds the user's label with the given name, creating it the
+// first time it's seen
+func (s *ImportService) resolveLabel(userID uuid.UUID, name string, labels map[string]uuid.UUID) (uuid.UUID, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return uuid.Nil, nil
+	}
+	if id, ok := labels[strings.ToLower(name)]; ok {
+		return id, nil
+	}
+
+	if err := validators.ValidateCreateLabelRequest(&validators.CreateLabelRequest{Name: name}); err != nil {
+		return uuid.Nil, errors.New("label " + name + ": " + err.Error())
+	}
+
+	label := &models.Label{UserID: userID, Name: name, Color: "#ffffff"}
+	err := s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		if err := s.labelRepo.WithTx(tx).Create(label); err != nil {
+			return err
+		}
+		return s.eventBus.Publish(tx, events.LabelCreated, userID, []uuid.UUID{userID}, label)
+	})
+	if err != nil {
+		return uuid.Nil, errors.New("failed to create label " + name)
+	}
+
+	labels[strings.ToLower(name)] = label.ID
+	return label.ID, nil
+}
+
+func (s *ImportService) addImportError(job *models.ImportJob, item, message string) {
+	if len(job.Errors) < maxImportErrors {
+		job.Errors = append(job.Errors, models.ImportItemError{Item: item, Error: message})
+	}
+}
+
+func (s *ImportService) failImport(job *models.ImportJob, message string) {
+	finished := time.Now()
+	job.Status = models.ImportFailed
+	job.Error = message
+	job.FinishedAt = &finished
+	s.saveProgress(job, events.ImportCompleted)
+}
+
+func (s *ImportService) saveProgress(job *models.ImportJob, eventType events.Type) {
+	err := s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		if err := s.importJobRepo.WithTx(tx).Update(job); err != nil {
+			return err
+		}
+		return s.eventBus.Publish(tx, eventType, job.UserID, []uuid.UUID{job.UserID}, job)
+	})
+	if err != nil {
+		log.Printf("Error saving import job %s: %v", job.ID, err)
+	}
+}
+
+// saveUpload copies an uploaded archive to a temporary file, since the
+// request's copy is gone once the handler returns
+func saveUpload(header *multipart.FileHeader) (string, error) {
+	src, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = src.Close() }()
+
+	dst, err := os.CreateTemp("", "import-*.zip")
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+		return "", err
+	}
+	if err := dst.Close(); err != nil {
+		_ = os.Remove(dst.Name())
+		return "", err
+	}
+
+	return dst.Name(), nil
+}
+
+func countKeepNotes(archivePath string) (int, error) {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return 0, errors.New("file is not a zip archive")
+	}
+	defer func() { _ = reader.Close() }()
+
+	archive, err := takeout.OpenArchive(&reader.Reader)
+	if err != nil {
+		return 0, err
+	}
+	return len(archive.Notes()), nil
+}
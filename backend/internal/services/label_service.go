@@ -5,25 +5,26 @@ import (
 	"strings"
 
 	"github.com/google/uuid"
+	"google-keep-clone/internal/events"
 	"google-keep-clone/internal/models"
+	"google-keep-clone/internal/pagination"
 	"google-keep-clone/internal/repositories"
 	"google-keep-clone/internal/validators"
-	"google-keep-clone/internal/websocket"
 )
 
 type LabelService struct {
 	labelRepo *repositories.LabelRepository
 	noteRepo  *repositories.NoteRepository
 	userRepo  *repositories.UserRepository
-	hub       *websocket.Hub
+	eventBus  *EventBus
 }
 
-func NewLabelService(labelRepo *repositories.LabelRepository, noteRepo *repositories.NoteRepository, userRepo *repositories.UserRepository, hub *websocket.Hub) *LabelService {
+func NewLabelService(labelRepo *repositories.LabelRepository, noteRepo *repositories.NoteRepository, userRepo *repositories.UserRepository, eventBus *EventBus) *LabelService {
 	return &LabelService{
 		labelRepo: labelRepo,
 		noteRepo:  noteRepo,
 		userRepo:  userRepo,
-		hub:       hub,
+		eventBus:  eventBus,
 	}
 }
 
@@ -49,15 +50,16 @@ func (s *LabelService) CreateLabel(userID uuid.UUID, req *validators.CreateLabel
 		label.Color = req.Color
 	}
 
-	if err := s.labelRepo.Create(label); err != nil {
+	err = s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		if err := s.labelRepo.WithTx(tx).Create(label); err != nil {
+			return err
+		}
+		return s.eventBus.Publish(tx, events.LabelCreated, userID, []uuid.UUID{userID}, label)
+	})
+	if err != nil {
 		return nil, errors.New("failed to create label")
 	}
 
-	// Broadcast label creation to WebSocket clients
-	if s.hub != nil {
-		s.hub.BroadcastToUser(userID, "label_created", label)
-	}
-
 	return label, nil
 }
 
@@ -96,15 +98,16 @@ func (s *LabelService) UpdateLabel(id, userID uuid.UUID, req *validators.UpdateL
 		label.Color = *req.Color
 	}
 
-	if err := s.labelRepo.Update(label); err != nil {
+	err = s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		if err := s.labelRepo.WithTx(tx).Update(label); err != nil {
+			return err
+		}
+		return s.eventBus.Publish(tx, events.LabelUpdated, userID, []uuid.UUID{userID}, label)
+	})
+	if err != nil {
 		return nil, errors.New("failed to update label")
 	}
 
-	// Broadcast label update to WebSocket clients
-	if s.hub != nil {
-		s.hub.BroadcastToUser(userID, "label_updated", label)
-	}
-
 	return label, nil
 }
 
@@ -115,21 +118,22 @@ func (s *LabelService) DeleteLabel(id, userID uuid.UUID) error {
 		return errors.New("label not found")
 	}
 
-	if err := s.labelRepo.Delete(id, userID); err != nil {
+	err = s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		if err := s.labelRepo.WithTx(tx).Delete(id, userID); err != nil {
+			return err
+		}
+		return s.eventBus.Publish(tx, events.LabelDeleted, userID, []uuid.UUID{userID}, events.Deleted{ID: id})
+	})
+	if err != nil {
 		return errors.New("failed to delete label")
 	}
 
-	// Broadcast label deletion to WebSocket clients
-	if s.hub != nil {
-		s.hub.BroadcastToUser(userID, "label_deleted", map[string]string{"id": id.String()})
-	}
-
 	return nil
 }
 
 func (s *LabelService) AttachLabelToNote(noteID, labelID, userID uuid.UUID) error {
-	// Verify note exists and belongs to user
-	_, err := s.noteRepo.GetByID(noteID, userID)
+	// Verify note exists and the user may edit it
+	_, err := s.noteRepo.GetEditableByID(noteID, userID)
 	if err != nil {
 		return errors.New("note not found")
 	}
@@ -140,22 +144,24 @@ func (s *LabelService) AttachLabelToNote(noteID, labelID, userID uuid.UUID) erro
 		return errors.New("label not found")
 	}
 
-	if err := s.labelRepo.AttachToNote(noteID, labelID); err != nil {
-		return errors.New("failed to attach label to note")
-	}
-
-	// Get updated note for broadcasting
-	note, _ := s.noteRepo.GetByID(noteID, userID)
-	if s.hub != nil {
-		s.hub.BroadcastToUser(userID, "note_updated", note)
-	}
+	return s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		if err := s.labelRepo.WithTx(tx).AttachToNote(noteID, labelID, userID); err != nil {
+			return errors.New("failed to attach label to note")
+		}
 
-	return nil
+		note, err := s.noteRepo.WithTx(tx).GetByID(noteID, userID)
+		if err != nil {
+			return errors.New("note not found")
+		}
+		// Labels are personal, so only their owner hears of the change
+		link := events.LabelLink{NoteID: noteID, LabelID: labelID, Note: note}
+		return s.eventBus.Publish(tx, events.LabelAttached, userID, []uuid.UUID{userID}, link)
+	})
 }
 
 func (s *LabelService) DetachLabelFromNote(noteID, labelID, userID uuid.UUID) error {
-	// Verify note exists and belongs to user
-	_, err := s.noteRepo.GetByID(noteID, userID)
+	// Verify note exists and the user may edit it
+	_, err := s.noteRepo.GetEditableByID(noteID, userID)
 	if err != nil {
 		return errors.New("note not found")
 	}
@@ -166,25 +172,36 @@ func (s *LabelService) DetachLabelFromNote(noteID, labelID, userID uuid.UUID) er
 		return errors.New("label not found")
 	}
 
-	if err := s.labelRepo.DetachFromNote(noteID, labelID); err != nil {
-		return errors.New("failed to detach label from note")
-	}
-
-	// Get updated note for broadcasting
-	note, _ := s.noteRepo.GetByID(noteID, userID)
-	if s.hub != nil {
-		s.hub.BroadcastToUser(userID, "note_updated", note)
-	}
+	return s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		if err := s.labelRepo.WithTx(tx).DetachFromNote(noteID, labelID, userID); err != nil {
+			return errors.New("failed to detach label from note")
+		}
 
-	return nil
+		note, err := s.noteRepo.WithTx(tx).GetByID(noteID, userID)
+		if err != nil {
+			return errors.New("note not found")
+		}
+		// Labels are personal, so only their owner hears of the change
+		link := events.LabelLink{NoteID: noteID, LabelID: labelID, Note: note}
+		return s.eventBus.Publish(tx, events.LabelDetached, userID, []uuid.UUID{userID}, link)
+	})
 }
 
-func (s *LabelService) GetNotesByLabel(labelID, userID uuid.UUID) ([]models.Note, error) {
+func (s *LabelService) GetNotesByLabel(labelID, userID uuid.UUID, req *validators.ListNotesRequest) (*models.NotePage, error) {
 	// Verify label exists and belongs to user
 	_, err := s.labelRepo.GetByID(labelID, userID)
 	if err != nil {
 		return nil, errors.New("label not found")
 	}
 
-	return s.labelRepo.GetNotesByLabel(labelID, userID)
+	page, err := notePage(req, pagination.SortUpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	notes, err := s.noteRepo.GetPageByLabel(userID, labelID, page)
+	if err != nil {
+		return nil, errors.New("failed to load notes")
+	}
+	return notes, nil
 }
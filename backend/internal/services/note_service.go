@@ -1,26 +1,51 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"github.com/google/uuid"
+	"google-keep-clone/internal/diff"
+	"google-keep-clone/internal/events"
 	"google-keep-clone/internal/models"
+	"google-keep-clone/internal/pagination"
 	"google-keep-clone/internal/repositories"
+	"google-keep-clone/internal/searchquery"
 	"google-keep-clone/internal/validators"
 	"google-keep-clone/internal/websocket"
+	"log"
+	"sort"
+	"strings"
 	"time"
+	"unicode/utf8"
+)
+
+const (
+	trashPurgeBatchSize = 500
+	// Edits by the same author within this window share one revision
+	revisionCoalesceWindow = 2 * time.Minute
+	maxRevisionsPerNote    = 50
 )
 
 type NoteService struct {
-	noteRepo *repositories.NoteRepository
-	userRepo *repositories.UserRepository
-	hub      *websocket.Hub
+	noteRepo          *repositories.NoteRepository
+	checklistRepo     *repositories.ChecklistRepository
+	revisionRepo      *repositories.RevisionRepository
+	userRepo          *repositories.UserRepository
+	attachmentService *AttachmentService
+	eventBus          *EventBus
+	// Trigram similarity fuzzy matches and suggestions need, 0 to 1
+	similarityThreshold float64
 }
 
-func NewNoteService(noteRepo *repositories.NoteRepository, userRepo *repositories.UserRepository, hub *websocket.Hub) *NoteService {
+func NewNoteService(noteRepo *repositories.NoteRepository, checklistRepo *repositories.ChecklistRepository, revisionRepo *repositories.RevisionRepository, userRepo *repositories.UserRepository, attachmentService *AttachmentService, similarityThreshold float64, eventBus *EventBus) *NoteService {
 	return &NoteService{
-		noteRepo: noteRepo,
-		userRepo: userRepo,
-		hub:      hub,
+		noteRepo:            noteRepo,
+		checklistRepo:       checklistRepo,
+		revisionRepo:        revisionRepo,
+		userRepo:            userRepo,
+		attachmentService:   attachmentService,
+		eventBus:            eventBus,
+		similarityThreshold: similarityThreshold,
 	}
 }
 
@@ -32,6 +57,7 @@ func (s *NoteService) CreateNote(userID uuid.UUID, req *validators.CreateNoteReq
 	}
 
 	note := &models.Note{
+		ID:         uuid.New(),
 		UserID:     userID,
 		Title:      req.Title,
 		Content:    req.Content,
@@ -50,20 +76,38 @@ func (s *NoteService) CreateNote(userID uuid.UUID, req *validators.CreateNoteReq
 		note.IsPinned = *req.IsPinned
 	}
 
-	if err := s.noteRepo.Create(note); err != nil {
-		return nil, errors.New("failed to create note")
+	if req.MoveCheckedToBottom != nil {
+		note.MoveCheckedToBottom = *req.MoveCheckedToBottom
 	}
 
-	// Broadcast note creation to WebSocket clients
-	if s.hub != nil {
-		s.hub.BroadcastToUser(userID, "note_created", note)
+	if len(req.Items) > 0 {
+		note.Items = buildChecklistItems(note.ID, req.Items, note.MoveCheckedToBottom)
+	}
+
+	err = s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		if err := s.noteRepo.WithTx(tx).Create(note); err != nil {
+			return err
+		}
+		return s.eventBus.Publish(tx, events.NoteCreated, userID, []uuid.UUID{userID}, note)
+	})
+	if err != nil {
+		return nil, errors.New("failed to create note")
 	}
 
 	return note, nil
 }
 
-func (s *NoteService) GetNotesByUserID(userID uuid.UUID, includeArchived, includeDeleted bool) ([]models.Note, error) {
-	return s.noteRepo.GetByUserID(userID, includeArchived, includeDeleted)
+func (s *NoteService) GetNotesByUserID(userID uuid.UUID, includeArchived, includeDeleted bool, req *validators.ListNotesRequest) (*models.NotePage, error) {
+	page, err := notePage(req, pagination.SortPosition)
+	if err != nil {
+		return nil, err
+	}
+
+	notes, err := s.noteRepo.GetPage(userID, includeArchived, includeDeleted, page)
+	if err != nil {
+		return nil, errors.New("failed to load notes")
+	}
+	return notes, nil
 }
 
 func (s *NoteService) GetNoteByID(id, userID uuid.UUID) (*models.Note, error) {
@@ -74,13 +118,35 @@ func (s *NoteService) GetNoteByID(id, userID uuid.UUID) (*models.Note, error) {
 	return note, nil
 }
 
+// VersionConflictError reports an update made against a version of a note
+// that is no longer current. Current is the note as it is now.
+type VersionConflictError struct {
+	Current *models.Note
+}
+
+func (e *VersionConflictError) Error() string {
+	return "note has been changed since version was read"
+}
+
 func (s *NoteService) UpdateNote(id, userID uuid.UUID, req *validators.UpdateNoteRequest) (*models.Note, error) {
-	// Get existing note
-	note, err := s.noteRepo.GetByID(id, userID)
+	// Get existing note the user may edit
+	note, err := s.noteRepo.GetEditableByID(id, userID)
 	if err != nil {
 		return nil, errors.New("note not found")
 	}
 
+	if req.ExpectedVersion != nil && *req.ExpectedVersion != note.Version {
+		return nil, s.versionConflict(id, userID)
+	}
+
+	// Keep the text being overwritten so it can be restored later. The
+	// revision is saved with the update, so a failed update leaves none.
+	var previous *models.Note
+	if noteFieldsChange(note, req) {
+		snapshot := *note
+		previous = &snapshot
+	}
+
 	// Update fields if provided
 	if req.Title != nil {
 		note.Title = *req.Title
@@ -106,113 +172,716 @@ func (s *NoteService) UpdateNote(id, userID uuid.UUID, req *validators.UpdateNot
 		note.Position = *req.Position
 	}
 
+	reorderItems := req.MoveCheckedToBottom != nil && *req.MoveCheckedToBottom != note.MoveCheckedToBottom
+	if req.MoveCheckedToBottom != nil {
+		note.MoveCheckedToBottom = *req.MoveCheckedToBottom
+	}
+
+	note.UpdatedAt = time.Now()
+
+	conflict := false
+	err = s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		noteRepo := s.noteRepo.WithTx(tx)
+		checklistRepo := s.checklistRepo.WithTx(tx)
+
+		if req.ExpectedVersion != nil {
+			// Someone may have saved between the check above and now
+			updated, err := noteRepo.UpdateFieldsIfVersion(note, *req.ExpectedVersion)
+			if err != nil {
+				return errors.New("failed to update note")
+			}
+			if !updated {
+				conflict = true
+				return errors.New("version conflict")
+			}
+		} else if err := noteRepo.UpdateFields(note); err != nil {
+			return errors.New("failed to update note")
+		}
+
+		if previous != nil {
+			if err := s.recordRevision(tx, previous, userID, true); err != nil {
+				return errors.New("failed to record revision")
+			}
+		}
+
+		if req.Items != nil {
+			items := buildChecklistItems(note.ID, *req.Items, note.MoveCheckedToBottom)
+			if err := checklistRepo.ReplaceForNote(note.ID, items); err != nil {
+				return errors.New("failed to update checklist items")
+			}
+			note.Items = items
+		} else if reorderItems && note.MoveCheckedToBottom {
+			if err := checklistRepo.UpdatePositions(note.ID, orderChecklist(note.Items, true)); err != nil {
+				return errors.New("failed to reorder checklist items")
+			}
+			note.Items, _ = checklistRepo.GetByNoteID(note.ID)
+		}
+
+		if req.Items != nil || reorderItems {
+			// Changing the items moved the version on again
+			version, err := noteRepo.GetVersion(note.ID)
+			if err != nil {
+				return errors.New("failed to update note")
+			}
+			note.Version = version
+		}
+
+		return publishNoteEvent(s.eventBus, tx, s.noteRepo, events.NoteUpdated, userID, note.ID, note)
+	})
+	if conflict {
+		return nil, s.versionConflict(id, userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return note, nil
+}
+
+// LoadDocument returns the content and version of a note userID may edit,
+// for live editing over the websocket
+func (s *NoteService) LoadDocument(noteID, userID uuid.UUID) (string, int64, error) {
+	note, err := s.noteRepo.GetEditableByID(noteID, userID)
+	if err != nil {
+		return "", 0, websocket.ErrDocumentNotFound
+	}
+	return note.Content, note.Version, nil
+}
+
+// SaveDocument writes live edits back to a note's content, as long as the
+// note is still at version. It reports false if the note changed since.
+func (s *NoteService) SaveDocument(noteID, userID uuid.UUID, content string, version int64) (int64, bool, error) {
+	note, err := s.noteRepo.GetEditableByID(noteID, userID)
+	if err != nil {
+		return 0, false, websocket.ErrDocumentNotFound
+	}
+	if note.Version != version {
+		return note.Version, false, nil
+	}
+	if note.Content == content {
+		return note.Version, true, nil
+	}
+
+	previous := *note
+	note.Content = content
+	note.UpdatedAt = time.Now()
+	updated := false
+	err = s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		var err error
+		if updated, err = s.noteRepo.WithTx(tx).UpdateFieldsIfVersion(note, version); err != nil || !updated {
+			return err
+		}
+		if err := s.recordRevision(tx, &previous, userID, true); err != nil {
+			return err
+		}
+		return publishNoteEvent(s.eventBus, tx, s.noteRepo, events.NoteUpdated, userID, note.ID, note)
+	})
+	if err != nil {
+		return 0, false, errors.New("failed to update note")
+	}
+	if !updated {
+		return 0, false, nil
+	}
+
+	return note.Version, true, nil
+}
+
+func (s *NoteService) versionConflict(id, userID uuid.UUID) error {
+	current, err := s.noteRepo.GetByID(id, userID)
+	if err != nil {
+		return errors.New("note not found")
+	}
+	return &VersionConflictError{Current: current}
+}
+
+// recordRevision snapshots the note's current state. With coalesce set, a
+// burst of edits by the same author shares one revision: the snapshot taken
+// before the burst started already holds the text worth restoring.
+func (s *NoteService) recordRevision(tx *repositories.Tx, note *models.Note, authorID uuid.UUID, coalesce bool) error {
+	revisionRepo := s.revisionRepo.WithTx(tx)
+	if latest, err := revisionRepo.GetLatest(note.ID); coalesce && err == nil &&
+		latest.AuthorID == authorID && time.Since(latest.CreatedAt) < revisionCoalesceWindow {
+		return nil
+	}
+
+	labels := make(models.LabelSnapshot, len(note.Labels))
+	for i, label := range note.Labels {
+		labels[i] = models.LabelRef{ID: label.ID, Name: label.Name}
+	}
+
+	revision := &models.NoteRevision{
+		NoteID:   note.ID,
+		AuthorID: authorID,
+		Title:    note.Title,
+		Content:  note.Content,
+		Color:    note.Color,
+		Labels:   labels,
+	}
+
+	if err := revisionRepo.Create(revision); err != nil {
+		return err
+	}
+
+	return revisionRepo.Prune(note.ID, maxRevisionsPerNote)
+}
+
+func (s *NoteService) GetRevisions(noteID, userID uuid.UUID) ([]models.NoteRevision, error) {
+	if _, err := s.noteRepo.GetByID(noteID, userID); err != nil {
+		return nil, errors.New("note not found")
+	}
+
+	return s.revisionRepo.GetByNoteID(noteID)
+}
+
+// DiffRevision compares a revision with the current version of the note
+func (s *NoteService) DiffRevision(noteID, revisionID, userID uuid.UUID) (map[string]interface{}, error) {
+	note, err := s.noteRepo.GetByID(noteID, userID)
+	if err != nil {
+		return nil, errors.New("note not found")
+	}
+
+	revision, err := s.revisionRepo.GetByID(revisionID, noteID)
+	if err != nil {
+		return nil, errors.New("revision not found")
+	}
+
+	result := map[string]interface{}{
+		"revision_id": revision.ID,
+		"content_diff": diff.Unified(
+			"revision/"+revision.ID.String(), "current",
+			revision.Content, note.Content, 3,
+		),
+	}
+
+	if revision.Title != note.Title {
+		result["title"] = map[string]string{"revision": revision.Title, "current": note.Title}
+	}
+	if revision.Color != note.Color {
+		result["color"] = map[string]string{"revision": revision.Color, "current": note.Color}
+	}
+
+	revisionLabels := make([]string, len(revision.Labels))
+	for i, label := range revision.Labels {
+		revisionLabels[i] = label.Name
+	}
+	currentLabels := make([]string, len(note.Labels))
+	for i, label := range note.Labels {
+		currentLabels[i] = label.Name
+	}
+	sort.Strings(revisionLabels)
+	sort.Strings(currentLabels)
+	if strings.Join(revisionLabels, "\x00") != strings.Join(currentLabels, "\x00") {
+		result["labels"] = map[string][]string{"revision": revisionLabels, "current": currentLabels}
+	}
+
+	return result, nil
+}
+
+// RestoreRevision brings a note back to a revision. The current state is
+// snapshotted first, so a restore can itself be undone.
+func (s *NoteService) RestoreRevision(noteID, revisionID, userID uuid.UUID) (*models.Note, error) {
+	note, err := s.noteRepo.GetEditableByID(noteID, userID)
+	if err != nil {
+		return nil, errors.New("note not found")
+	}
+
+	revision, err := s.revisionRepo.GetByID(revisionID, noteID)
+	if err != nil {
+		return nil, errors.New("revision not found")
+	}
+
+	previous := *note
+	note.Title = revision.Title
+	note.Content = revision.Content
+	note.Color = revision.Color
 	note.UpdatedAt = time.Now()
 
-	if err := s.noteRepo.Update(note); err != nil {
-		return nil, errors.New("failed to update note")
+	labelIDs := make([]uuid.UUID, len(revision.Labels))
+	for i, label := range revision.Labels {
+		labelIDs[i] = label.ID
 	}
 
-	// Broadcast note update to WebSocket clients
-	if s.hub != nil {
-		s.hub.BroadcastToUser(userID, "note_updated", note)
+	err = s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		noteRepo := s.noteRepo.WithTx(tx)
+		if err := s.recordRevision(tx, &previous, userID, false); err != nil {
+			return errors.New("failed to record revision")
+		}
+		if err := noteRepo.Update(note); err != nil {
+			return errors.New("failed to restore revision")
+		}
+		if err := noteRepo.ReplaceLabels(noteID, userID, labelIDs); err != nil {
+			return errors.New("failed to restore labels")
+		}
+
+		var err error
+		if note, err = noteRepo.GetByID(noteID, userID); err != nil {
+			return errors.New("note not found")
+		}
+		return publishNoteEvent(s.eventBus, tx, s.noteRepo, events.NoteUpdated, userID, noteID, note)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return note, nil
 }
 
+func noteFieldsChange(note *models.Note, req *validators.UpdateNoteRequest) bool {
+	return (req.Title != nil && *req.Title != note.Title) ||
+		(req.Content != nil && *req.Content != note.Content) ||
+		(req.Color != nil && *req.Color != note.Color)
+}
+
 func (s *NoteService) DeleteNote(id, userID uuid.UUID, soft bool) error {
 	// Check if note exists and belongs to user
-	_, err := s.noteRepo.GetByID(id, userID)
+	note, err := s.noteRepo.GetByID(id, userID)
 	if err != nil {
 		return errors.New("note not found")
 	}
 
-	if soft {
-		return s.noteRepo.SoftDelete(id, userID)
+	if note.UserID != userID {
+		return errors.New("only the owner can delete this note")
 	}
 
-	err = s.noteRepo.Delete(id, userID)
+	return s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		noteRepo := s.noteRepo.WithTx(tx)
+
+		if soft {
+			if err := noteRepo.SoftDelete(id, userID); err != nil {
+				return err
+			}
+			return s.publishTrashed(tx, noteRepo, id, userID)
+		}
+
+		// Collaborators lose access once the note is gone, so the event
+		// goes in first
+		if err := publishNoteEvent(s.eventBus, tx, s.noteRepo, events.NoteDeleted, userID, id, events.Deleted{ID: id}); err != nil {
+			return err
+		}
+		return noteRepo.Delete(id, userID)
+	})
+}
 
-	// Broadcast note deletion to WebSocket clients
-	if err == nil && s.hub != nil {
-		s.hub.BroadcastToUser(userID, "note_deleted", map[string]string{"id": id.String()})
+// TrashNoteIfVersion moves a note to the trash only if it is still at
+// expectedVersion. The check and the move are one statement, so an edit
+// saved in between is reported as a conflict rather than trashed unseen.
+func (s *NoteService) TrashNoteIfVersion(id, userID uuid.UUID, expectedVersion int64) error {
+	note, err := s.noteRepo.GetByID(id, userID)
+	if err != nil {
+		return errors.New("note not found")
+	}
+
+	if note.UserID != userID {
+		return errors.New("only the owner can delete this note")
 	}
 
+	conflict := false
+	err = s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		noteRepo := s.noteRepo.WithTx(tx)
+
+		trashed, err := noteRepo.SoftDeleteIfVersion(id, userID, expectedVersion)
+		if err != nil {
+			return err
+		}
+		if !trashed {
+			conflict = true
+			return errors.New("version conflict")
+		}
+		return s.publishTrashed(tx, noteRepo, id, userID)
+	})
+	if conflict {
+		return s.versionConflict(id, userID)
+	}
 	return err
 }
 
-func (s *NoteService) TogglePin(id, userID uuid.UUID) (*models.Note, error) {
-	// Check if note exists and belongs to user
-	_, err := s.noteRepo.GetByID(id, userID)
+func (s *NoteService) publishTrashed(tx *repositories.Tx, noteRepo *repositories.NoteRepository, id, userID uuid.UUID) error {
+	note, err := noteRepo.GetByID(id, userID)
+	if err != nil {
+		return err
+	}
+	return publishNoteEvent(s.eventBus, tx, s.noteRepo, events.NoteTrashed, userID, id, note)
+}
+
+func (s *NoteService) GetTrashedNotes(userID uuid.UUID) ([]models.Note, error) {
+	return s.noteRepo.GetTrashedNotes(userID)
+}
+
+func (s *NoteService) RestoreNote(id, userID uuid.UUID) (*models.Note, error) {
+	note, err := s.noteRepo.GetByID(id, userID)
 	if err != nil {
 		return nil, errors.New("note not found")
 	}
 
-	if err := s.noteRepo.TogglePin(id, userID); err != nil {
-		return nil, errors.New("failed to toggle pin")
+	if note.UserID != userID {
+		return nil, errors.New("only the owner can restore this note")
 	}
 
-	// Return updated note
-	return s.noteRepo.GetByID(id, userID)
+	if !note.IsDeleted {
+		return nil, errors.New("note is not in trash")
+	}
+
+	err = s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		noteRepo := s.noteRepo.WithTx(tx)
+		if err := noteRepo.Restore(id, userID); err != nil {
+			return errors.New("failed to restore note")
+		}
+
+		var err error
+		if note, err = noteRepo.GetByID(id, userID); err != nil {
+			return errors.New("note not found")
+		}
+		return publishNoteEvent(s.eventBus, tx, s.noteRepo, events.NoteRestored, userID, id, note)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return note, nil
 }
 
-func (s *NoteService) ToggleArchive(id, userID uuid.UUID) (*models.Note, error) {
-	// Check if note exists and belongs to user
-	_, err := s.noteRepo.GetByID(id, userID)
+// EmptyTrash permanently deletes every trashed note of the user and
+// returns how many were removed
+func (s *NoteService) EmptyTrash(userID uuid.UUID) (int, error) {
+	ids, err := s.noteRepo.GetTrashedIDs(userID)
+	if err != nil {
+		return 0, errors.New("failed to load trash")
+	}
+
+	if err := s.purge(userID, ids); err != nil {
+		return 0, errors.New("failed to empty trash")
+	}
+
+	return len(ids), nil
+}
+
+// RunTrashPurge permanently deletes notes that have been in the trash
+// longer than retention, checking every interval
+func (s *NoteService) RunTrashPurge(interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if purged, err := s.PurgeExpiredTrash(time.Now().Add(-retention)); err != nil {
+			log.Printf("Error purging trash: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d notes from trash", purged)
+		}
+		<-ticker.C
+	}
+}
+
+func (s *NoteService) PurgeExpiredTrash(cutoff time.Time) (int, error) {
+	purged := 0
+	for {
+		notes, err := s.noteRepo.GetExpiredTrash(cutoff, trashPurgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+		if len(notes) == 0 {
+			return purged, nil
+		}
+
+		ids := make([]uuid.UUID, len(notes))
+		for i, note := range notes {
+			ids[i] = note.ID
+		}
+
+		// Expired notes go without anyone acting on them
+		if err := s.purge(uuid.Nil, ids); err != nil {
+			return purged, err
+		}
+		purged += len(ids)
+	}
+}
+
+// purge permanently deletes notes, frees attachment blobs nothing else
+// uses and tells everyone who could see the notes
+func (s *NoteService) purge(actorID uuid.UUID, ids []uuid.UUID) error {
+	// Must happen while the notes still exist
+	var blobKeys []string
+	if s.attachmentService != nil {
+		blobKeys = s.attachmentService.StorageKeysForNotes(ids)
+	}
+
+	err := s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		for _, id := range ids {
+			if err := publishNoteEvent(s.eventBus, tx, s.noteRepo, events.NoteDeleted, actorID, id, events.Deleted{ID: id}); err != nil {
+				return err
+			}
+		}
+		return s.noteRepo.WithTx(tx).Purge(ids)
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.attachmentService != nil {
+		s.attachmentService.ReleaseBlobs(context.Background(), blobKeys)
+	}
+
+	return nil
+}
+
+func (s *NoteService) TogglePin(id, userID uuid.UUID) (*models.Note, error) {
+	// Check if note exists and the user may edit it
+	_, err := s.noteRepo.GetEditableByID(id, userID)
 	if err != nil {
 		return nil, errors.New("note not found")
 	}
 
-	if err := s.noteRepo.ToggleArchive(id, userID); err != nil {
-		return nil, errors.New("failed to toggle archive")
+	return s.toggle(id, userID, (*repositories.NoteRepository).TogglePin, "failed to toggle pin", func(note *models.Note) events.Type {
+		if note.IsPinned {
+			return events.NotePinned
+		}
+		return events.NoteUnpinned
+	})
+}
+
+func (s *NoteService) ToggleArchive(id, userID uuid.UUID) (*models.Note, error) {
+	// Check if note exists and the user may edit it
+	_, err := s.noteRepo.GetEditableByID(id, userID)
+	if err != nil {
+		return nil, errors.New("note not found")
 	}
 
-	// Return updated note
-	return s.noteRepo.GetByID(id, userID)
+	return s.toggle(id, userID, (*repositories.NoteRepository).ToggleArchive, "failed to toggle archive", func(note *models.Note) events.Type {
+		if note.IsArchived {
+			return events.NoteArchived
+		}
+		return events.NoteUnarchived
+	})
 }
 
 func (s *NoteService) UpdateColor(id, userID uuid.UUID, color string) (*models.Note, error) {
-	// Check if note exists and belongs to user
-	_, err := s.noteRepo.GetByID(id, userID)
+	// Check if note exists and the user may edit it
+	_, err := s.noteRepo.GetEditableByID(id, userID)
 	if err != nil {
 		return nil, errors.New("note not found")
 	}
 
-	if err := s.noteRepo.UpdateColor(id, userID, color); err != nil {
-		return nil, errors.New("failed to update color")
+	var note *models.Note
+	err = s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		noteRepo := s.noteRepo.WithTx(tx)
+		if err := noteRepo.UpdateColor(id, userID, color); err != nil {
+			return errors.New("failed to update color")
+		}
+
+		var err error
+		if note, err = noteRepo.GetByID(id, userID); err != nil {
+			return errors.New("note not found")
+		}
+		return publishNoteEvent(s.eventBus, tx, s.noteRepo, events.NoteColorChanged, userID, id, note)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	// Return updated note
-	return s.noteRepo.GetByID(id, userID)
+	return note, nil
 }
 
-func (s *NoteService) SearchNotes(userID uuid.UUID, query string) ([]models.Note, error) {
-	if query == "" {
-		return s.noteRepo.GetByUserID(userID, false, false)
+// toggle flips a flag of a note with update and publishes the event
+// eventType picks for the note as it is afterwards
+func (s *NoteService) toggle(id, userID uuid.UUID, update func(r *repositories.NoteRepository, id, userID uuid.UUID) error, failure string, eventType func(*models.Note) events.Type) (*models.Note, error) {
+	var note *models.Note
+	err := s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		noteRepo := s.noteRepo.WithTx(tx)
+		if err := update(noteRepo, id, userID); err != nil {
+			return errors.New(failure)
+		}
+
+		var err error
+		if note, err = noteRepo.GetByID(id, userID); err != nil {
+			return errors.New("note not found")
+		}
+		return publishNoteEvent(s.eventBus, tx, s.noteRepo, eventType(note), userID, id, note)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return s.noteRepo.Search(userID, query)
+	// Return updated note
+	return note, nil
 }
 
-func (s *NoteService) SearchNotesAdvanced(userID uuid.UUID, query string, labelIDs []uuid.UUID, color string, includeArchived bool) ([]models.Note, error) {
-	// If searching by color specifically
-	if color != "" && query == "" && len(labelIDs) == 0 {
-		return s.noteRepo.SearchByColor(userID, color, includeArchived)
+func (s *NoteService) SearchNotes(userID uuid.UUID, req *validators.SearchRequest) (*models.SearchResponse, error) {
+	// Problems with the query come back as searchquery.Errors. An empty
+	// query has no clauses and lists notes, pinned first.
+	parsed, err := searchquery.Parse(req.Query)
+	if err != nil {
+		return nil, err
 	}
 
-	// If using advanced search with labels or other filters
-	if query != "" || len(labelIDs) > 0 {
-		return s.noteRepo.SearchWithLabels(userID, query, labelIDs, includeArchived)
+	threshold := s.similarityThreshold
+	if req.Threshold > 0 {
+		threshold = req.Threshold
+	}
+
+	language := s.searchLanguage(userID)
+	var results []models.NoteSearchResult
+	if req.Fuzzy {
+		results, err = s.noteRepo.FuzzySearch(userID, parsed, language, threshold, req.Limit, req.Page*req.Limit)
+	} else {
+		results, err = s.noteRepo.SearchQuery(userID, parsed, language, req.Limit, req.Page*req.Limit)
+	}
+	if err != nil {
+		return nil, errors.New("failed to search notes")
+	}
+
+	response := &models.SearchResponse{Notes: results}
+	if len(results) == 0 && req.Page == 0 {
+		response.Suggestion = s.suggestQuery(userID, req.Query, parsed, threshold)
+	}
+	return response, nil
+}
+
+// suggestQuery rewrites misspelt words in a query with the closest words
+// from the user's notes, for "did you mean". It returns "" when there is
+// nothing to correct.
+func (s *NoteService) suggestQuery(userID uuid.UUID, query string, parsed *searchquery.Query, threshold float64) string {
+	var terms []searchquery.Term
+	var words []string
+	for _, clause := range parsed.Clauses {
+		for _, term := range clause.Terms {
+			// Short words have too few trigrams to compare sensibly
+			if term.Kind == searchquery.Word && !term.Negated && utf8.RuneCountInString(term.Value) >= 3 {
+				terms = append(terms, term)
+				words = append(words, strings.ToLower(term.Value))
+			}
+		}
+	}
+	if len(terms) == 0 {
+		return ""
+	}
+
+	similar, err := s.noteRepo.SimilarWords(userID, words, threshold)
+	if err != nil {
+		log.Printf("Error finding search suggestions for user %s: %v", userID, err)
+		return ""
+	}
+
+	// Replace from the end so earlier positions stay valid
+	runes := []rune(query)
+	changed := false
+	for i := len(terms) - 1; i >= 0; i-- {
+		term := terms[i]
+		suggestion, ok := similar[words[i]]
+		if !ok || suggestion == words[i] {
+			continue
+		}
+		runes = append(runes[:term.Pos], append([]rune(suggestion), runes[term.Pos+term.Len:]...)...)
+		changed = true
+	}
+	if !changed {
+		return ""
+	}
+	return string(runes)
+}
+
+func (s *NoteService) SearchNotesAdvanced(userID uuid.UUID, query string, labelIDs []uuid.UUID, color string, includeArchived bool) ([]models.NoteSearchResult, error) {
+	// If using advanced search with a query, labels or a color
+	if query != "" || len(labelIDs) > 0 || color != "" {
+		return s.noteRepo.SearchWithLabels(userID, query, s.searchLanguage(userID), labelIDs, color, includeArchived)
 	}
 
 	// Default to getting all notes
-	return s.noteRepo.GetByUserID(userID, includeArchived, false)
+	notes, err := s.noteRepo.GetByUserID(userID, includeArchived, false)
+	return asSearchResults(notes), err
+}
+
+// GetNotesAdvancedPage pages through the notes SearchNotesAdvanced would
+// return, sorted like the other listings
+func (s *NoteService) GetNotesAdvancedPage(userID uuid.UUID, query string, labelIDs []uuid.UUID, color string, includeArchived bool, req *validators.ListNotesRequest) (*models.NotePage, error) {
+	page, err := notePage(req, pagination.SortUpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	notes, err := s.noteRepo.GetPageWithLabels(userID, query, s.searchLanguage(userID), labelIDs, color, includeArchived, page)
+	if err != nil {
+		return nil, errors.New("failed to load notes")
+	}
+	return notes, nil
+}
+
+// CountNotesAdvanced counts the notes SearchNotesAdvanced would return
+func (s *NoteService) CountNotesAdvanced(userID uuid.UUID, query string, labelIDs []uuid.UUID, color string, includeArchived bool) (int64, error) {
+	return s.noteRepo.CountWithLabels(userID, query, s.searchLanguage(userID), labelIDs, color, includeArchived)
+}
+
+// searchLanguage returns the text search configuration queries are parsed
+// with, matching how the user's notes were indexed
+func (s *NoteService) searchLanguage(userID uuid.UUID) string {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return ""
+	}
+	return user.SearchLanguage
+}
+
+// asSearchResults wraps notes listed without a text query, so every search
+// responds with the same shape
+func asSearchResults(notes []models.Note) []models.NoteSearchResult {
+	results := make([]models.NoteSearchResult, len(notes))
+	for i, note := range notes {
+		results[i] = models.NoteSearchResult{Note: note}
+	}
+	return results
+}
+
+func (s *NoteService) GetPinnedNotes(userID uuid.UUID, req *validators.ListNotesRequest) (*models.NotePage, error) {
+	page, err := notePage(req, pagination.SortPosition)
+	if err != nil {
+		return nil, err
+	}
+
+	notes, err := s.noteRepo.GetPinnedPage(userID, page)
+	if err != nil {
+		return nil, errors.New("failed to load notes")
+	}
+	return notes, nil
 }
 
-func (s *NoteService) GetPinnedNotes(userID uuid.UUID) ([]models.Note, error) {
-	return s.noteRepo.GetPinnedNotes(userID)
+func (s *NoteService) GetArchivedNotes(userID uuid.UUID, req *validators.ListNotesRequest) (*models.NotePage, error) {
+	page, err := notePage(req, pagination.SortUpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	notes, err := s.noteRepo.GetArchivedPage(userID, page)
+	if err != nil {
+		return nil, errors.New("failed to load notes")
+	}
+	return notes, nil
 }
 
-func (s *NoteService) GetArchivedNotes(userID uuid.UUID) ([]models.Note, error) {
-	return s.noteRepo.GetArchivedNotes(userID)
+// notePage turns a validated listing request into a page, falling back to
+// the listing's own default sort. Bad cursors come back as pagination
+// errors.
+func notePage(req *validators.ListNotesRequest, defaultSort string) (pagination.Page, error) {
+	page := pagination.Page{
+		Limit:     req.Limit,
+		Sort:      req.Sort,
+		WithTotal: req.WithTotal,
+	}
+	if page.Limit == 0 {
+		page.Limit = pagination.DefaultLimit
+	}
+	if page.Sort == "" {
+		page.Sort = defaultSort
+	}
+	page.Desc = pagination.DefaultDesc(page.Sort)
+	if req.Order != "" {
+		page.Desc = req.Order == "desc"
+	}
+
+	if req.Cursor != "" {
+		cursor, err := pagination.Decode(req.Cursor, page.Sort, page.Desc)
+		if err != nil {
+			return page, err
+		}
+		page.After = cursor
+	}
+	return page, nil
 }
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"google-keep-clone/internal/events"
+	"google-keep-clone/internal/models"
+	"google-keep-clone/internal/recurrence"
+	"google-keep-clone/internal/repositories"
+	"google-keep-clone/internal/validators"
+)
+
+const (
+	dueReminderBatchSize = 100
+	// Reminders fired later than this after their time are flagged as missed
+	missedReminderGrace = 2 * time.Minute
+)
+
+type ReminderService struct {
+	reminderRepo *repositories.ReminderRepository
+	noteRepo     *repositories.NoteRepository
+	eventBus     *EventBus
+}
+
+func NewReminderService(reminderRepo *repositories.ReminderRepository, noteRepo *repositories.NoteRepository, eventBus *EventBus) *ReminderService {
+	return &ReminderService{
+		reminderRepo: reminderRepo,
+		noteRepo:     noteRepo,
+		eventBus:     eventBus,
+	}
+}
+
+func (s *ReminderService) CreateReminder(noteID, userID uuid.UUID, req *validators.CreateReminderRequest) (*models.Reminder, error) {
+	// Verify note exists and belongs to user
+	if _, err := s.noteRepo.GetByID(noteID, userID); err != nil {
+		return nil, errors.New("note not found")
+	}
+
+	if _, err := s.reminderRepo.GetByNoteID(noteID, userID); err == nil {
+		return nil, errors.New("note already has a reminder")
+	}
+
+	reminder := &models.Reminder{
+		NoteID:     noteID,
+		UserID:     userID,
+		StartsAt:   req.FireAt.UTC(),
+		FireAt:     req.FireAt.UTC(),
+		TimeZone:   "UTC",
+		Recurrence: req.Recurrence,
+	}
+
+	if req.TimeZone != "" {
+		reminder.TimeZone = req.TimeZone
+	}
+
+	// Reminders are personal, so only their owner hears of changes
+	err := s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		if err := s.reminderRepo.WithTx(tx).Create(reminder); err != nil {
+			return errors.New("failed to create reminder")
+		}
+		return s.eventBus.Publish(tx, events.ReminderCreated, userID, []uuid.UUID{userID}, reminder)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reminder, nil
+}
+
+func (s *ReminderService) GetReminder(noteID, userID uuid.UUID) (*models.Reminder, error) {
+	reminder, err := s.reminderRepo.GetByNoteID(noteID, userID)
+	if err != nil {
+		return nil, errors.New("reminder not found")
+	}
+	return reminder, nil
+}
+
+func (s *ReminderService) UpdateReminder(noteID, userID uuid.UUID, req *validators.UpdateReminderRequest) (*models.Reminder, error) {
+	reminder, err := s.reminderRepo.GetByNoteID(noteID, userID)
+	if err != nil {
+		return nil, errors.New("reminder not found")
+	}
+
+	if req.FireAt != nil {
+		reminder.FireAt = req.FireAt.UTC()
+		reminder.IsDone = false
+	}
+
+	if req.TimeZone != nil {
+		reminder.TimeZone = *req.TimeZone
+		if reminder.TimeZone == "" {
+			reminder.TimeZone = "UTC"
+		}
+	}
+
+	if req.Recurrence != nil {
+		reminder.Recurrence = *req.Recurrence
+	}
+
+	// A new time or rule starts a new series from the next fire time
+	if req.FireAt != nil || req.Recurrence != nil {
+		reminder.StartsAt = reminder.FireAt
+	}
+
+	err = s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		if err := s.reminderRepo.WithTx(tx).Update(reminder); err != nil {
+			return errors.New("failed to update reminder")
+		}
+		return s.eventBus.Publish(tx, events.ReminderUpdated, userID, []uuid.UUID{userID}, reminder)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reminder, nil
+}
+
+func (s *ReminderService) DeleteReminder(noteID, userID uuid.UUID) error {
+	if _, err := s.reminderRepo.GetByNoteID(noteID, userID); err != nil {
+		return errors.New("reminder not found")
+	}
+
+	return s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		if err := s.reminderRepo.WithTx(tx).Delete(noteID, userID); err != nil {
+			return errors.New("failed to delete reminder")
+		}
+		return s.eventBus.Publish(tx, events.ReminderDeleted, userID, []uuid.UUID{userID}, events.NoteRef{NoteID: noteID})
+	})
+}
+
+func (s *ReminderService) GetUpcomingReminders(userID uuid.UUID, within time.Duration, limit int) ([]models.Reminder, error) {
+	return s.reminderRepo.GetUpcoming(userID, time.Now().Add(within), limit)
+}
+
+// RunScheduler fires due reminders every interval. The first pass runs
+// immediately, so reminders missed while the server was down go out once
+// on startup.
+func (s *ReminderService) RunScheduler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.FireDueReminders(time.Now()); err != nil {
+			log.Printf("Error firing reminders: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// FireDueReminders delivers every reminder due at now and advances
+// recurring ones to their next occurrence after now. Occurrences missed
+// while the server was down collapse into a single delivery.
+func (s *ReminderService) FireDueReminders(now time.Time) error {
+	for {
+		due, err := s.reminderRepo.GetDue(now, dueReminderBatchSize)
+		if err != nil {
+			return err
+		}
+
+		claimed := 0
+		for i := range due {
+			reminder := &due[i]
+
+			next := s.nextOccurrence(reminder, now)
+			ok, err := s.fire(reminder, next, now)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue // Already fired elsewhere
+			}
+			claimed++
+		}
+
+		// Stop once a batch is short or nothing could be claimed, so a row
+		// that keeps failing to claim can't spin this loop
+		if len(due) < dueReminderBatchSize || claimed == 0 {
+			return nil
+		}
+	}
+}
+
+// fire claims a due reminder and records its delivery in one transaction,
+// so a claimed reminder always goes out. It reports false if another
+// server claimed it first.
+func (s *ReminderService) fire(reminder *models.Reminder, next *time.Time, now time.Time) (bool, error) {
+	claimed := false
+	err := s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		var err error
+		if claimed, err = s.reminderRepo.WithTx(tx).ClaimFire(reminder.ID, reminder.FireAt, next, now); err != nil || !claimed {
+			return err
+		}
+		return s.eventBus.Publish(tx, events.ReminderFired, reminder.UserID, []uuid.UUID{reminder.UserID}, events.ReminderFiring{
+			Reminder:     reminder,
+			ScheduledFor: reminder.FireAt,
+			Missed:       now.Sub(reminder.FireAt) > missedReminderGrace,
+			NextFireAt:   next,
+		})
+	})
+	return claimed && err == nil, err
+}
+
+func (s *ReminderService) nextOccurrence(reminder *models.Reminder, now time.Time) *time.Time {
+	if reminder.Recurrence == "" {
+		return nil
+	}
+
+	rule, err := recurrence.Parse(reminder.Recurrence)
+	if err != nil {
+		log.Printf("Invalid recurrence on reminder %v: %v", reminder.ID, err)
+		return nil
+	}
+
+	loc, err := time.LoadLocation(reminder.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	next, ok := rule.Next(reminder.StartsAt, now, loc)
+	if !ok {
+		return nil
+	}
+
+	next = next.UTC()
+	return &next
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"google-keep-clone/internal/models"
+	"google-keep-clone/internal/repositories"
+	"google-keep-clone/internal/validators"
+)
+
+const (
+	DefaultSyncLimit = 500
+	MaxSyncLimit     = 1000
+)
+
+type SyncService struct {
+	syncRepo    *repositories.SyncRepository
+	noteRepo    *repositories.NoteRepository
+	labelRepo   *repositories.LabelRepository
+	noteService *NoteService
+}
+
+func NewSyncService(syncRepo *repositories.SyncRepository, noteRepo *repositories.NoteRepository, labelRepo *repositories.LabelRepository, noteService *NoteService) *SyncService {
+	return &SyncService{
+		syncRepo:    syncRepo,
+		noteRepo:    noteRepo,
+		labelRepo:   labelRepo,
+		noteService: noteService,
+	}
+}
+
+// Changes returns the notes and labels changed after since, and tombstones
+// for those deleted, up to limit changes at a time. A since of 0, or one
+// the server has never handed out, gets a full snapshot instead.
+func (s *SyncService) Changes(userID uuid.UUID, since int64, limit int) (*models.SyncResponse, error) {
+	// Read the sequence before the data, so anything changed meanwhile is
+	// sent again next time rather than missed
+	current, err := s.syncRepo.CurrentSeq(userID)
+	if err != nil {
+		return nil, errors.New("failed to read sync state")
+	}
+
+	if since <= 0 || since > current {
+		return s.snapshot(userID, current)
+	}
+
+	changes, err := s.syncRepo.GetChanges(userID, since, limit+1)
+	if err != nil {
+		return nil, errors.New("failed to load changes")
+	}
+
+	response := &models.SyncResponse{
+		Seq:     current,
+		Notes:   []models.Note{},
+		Labels:  []models.Label{},
+		Deleted: []models.SyncChange{},
+	}
+	if len(changes) > limit {
+		changes = changes[:limit]
+		response.HasMore = true
+	}
+	if len(changes) == 0 {
+		return response, nil
+	}
+	if response.HasMore {
+		response.Seq = changes[len(changes)-1].Seq
+	}
+
+	var noteIDs, labelIDs []uuid.UUID
+	for _, change := range changes {
+		switch {
+		case change.Deleted:
+			response.Deleted = append(response.Deleted, change)
+		case change.EntityType == models.SyncNote:
+			noteIDs = append(noteIDs, change.EntityID)
+		case change.EntityType == models.SyncLabel:
+			labelIDs = append(labelIDs, change.EntityID)
+		}
+	}
+
+	if len(noteIDs) > 0 {
+		notes, err := s.noteRepo.GetForSync(userID, noteIDs)
+		if err != nil {
+			return nil, errors.New("failed to load notes")
+		}
+		response.Notes = notes
+		response.Deleted = append(response.Deleted, missing(changes, models.SyncNote, noteIDsOf(notes))...)
+	}
+
+	if len(labelIDs) > 0 {
+		labels, err := s.labelRepo.GetByIDs(userID, labelIDs)
+		if err != nil {
+			return nil, errors.New("failed to load labels")
+		}
+		response.Labels = labels
+		response.Deleted = append(response.Deleted, missing(changes, models.SyncLabel, labelIDsOf(labels))...)
+	}
+
+	return response, nil
+}
+
+// Push applies a batch of mutations queued by an offline client, in order.
+// Each gets its own result; one failing doesn't stop the rest.
+func (s *SyncService) Push(userID uuid.UUID, req *validators.PushRequest) *models.PushResponse {
+	response := &models.PushResponse{Results: make([]models.PushResult, len(req.Mutations))}
+	for i := range req.Mutations {
+		response.Results[i] = s.apply(userID, &req.Mutations[i])
+	}
+	return response
+}
+
+func (s *SyncService) apply(userID uuid.UUID, m *validators.PushMutation) models.PushResult {
+	result := models.PushResult{ClientID: m.ClientID}
+	reject := func(err error) models.PushResult {
+		result.Status = models.PushRejected
+		result.Error = err.Error()
+		return result
+	}
+
+	if err := validators.ValidatePushMutation(m); err != nil {
+		return reject(err)
+	}
+
+	var note *models.Note
+	var err error
+	switch m.Op {
+	case validators.PushCreate:
+		note, err = s.noteService.CreateNote(userID, m.Note)
+	case validators.PushUpdate:
+		noteID, _ := uuid.Parse(m.NoteID)
+		if m.ExpectedVersion != nil {
+			m.Changes.ExpectedVersion = m.ExpectedVersion
+		}
+		note, err = s.noteService.UpdateNote(noteID, userID, m.Changes)
+	case validators.PushDelete:
+		noteID, _ := uuid.Parse(m.NoteID)
+		err = s.trash(noteID, userID, m.ExpectedVersion)
+	}
+
+	var conflict *VersionConflictError
+	switch {
+	case errors.As(err, &conflict):
+		result.Status = models.PushConflict
+		result.Note = conflict.Current
+		result.Error = err.Error()
+	case err != nil:
+		return reject(err)
+	default:
+		result.Status = models.PushAccepted
+		result.Note = note
+	}
+	return result
+}
+
+// trash moves a note to the trash if it is still at expectedVersion
+func (s *SyncService) trash(noteID, userID uuid.UUID, expectedVersion *int64) error {
+	if expectedVersion != nil {
+		return s.noteService.TrashNoteIfVersion(noteID, userID, *expectedVersion)
+	}
+	return s.noteService.DeleteNote(noteID, userID, true)
+}
+
+func (s *SyncService) snapshot(userID uuid.UUID, current int64) (*models.SyncResponse, error) {
+	notes, err := s.noteRepo.GetForSync(userID, nil)
+	if err != nil {
+		return nil, errors.New("failed to load notes")
+	}
+
+	labels, err := s.labelRepo.GetByUserID(userID)
+	if err != nil {
+		return nil, errors.New("failed to load labels")
+	}
+
+	return &models.SyncResponse{
+		Seq:     current,
+		Full:    true,
+		Notes:   notes,
+		Labels:  labels,
+		Deleted: []models.SyncChange{},
+	}, nil
+}
+
+// missing turns records that changed but can no longer be loaded, such as
+// a note whose sharing was revoked since, into tombstones
+func missing(changes []models.SyncChange, entityType string, found map[uuid.UUID]bool) []models.SyncChange {
+	var tombstones []models.SyncChange
+	for _, change := range changes {
+		if change.EntityType == entityType && !change.Deleted && !found[change.EntityID] {
+			change.Deleted = true
+			tombstones = append(tombstones, change)
+		}
+	}
+	return tombstones
+}
+
+func noteIDsOf(notes []models.Note) map[uuid.UUID]bool {
+	ids := make(map[uuid.UUID]bool, len(notes))
+	for _, note := range notes {
+		ids[note.ID] = true
+	}
+	return ids
+}
+
+func labelIDsOf(labels []models.Label) map[uuid.UUID]bool {
+	ids := make(map[uuid.UUID]bool, len(labels))
+	for _, label := range labels {
+		ids[label.ID] = true
+	}
+	return ids
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"google-keep-clone/internal/events"
+	"google-keep-clone/internal/imaging"
+	"google-keep-clone/internal/models"
+	"google-keep-clone/internal/repositories"
+	"google-keep-clone/internal/storage"
+)
+
+const (
+	thumbnailQueueSize = 256
+	// Attachments whose blob can't be read or whose thumbnails can't be
+	// stored are retried with growing delays, then marked failed
+	maxThumbnailAttempts = 8
+	maxThumbnailBackoff  = 6 * time.Hour
+)
+
+// ThumbnailService renders image thumbnails in the background. Uploads are
+// queued as they arrive; a periodic sweep picks up anything the queue
+// dropped or a restart interrupted.
+type ThumbnailService struct {
+	attachmentRepo *repositories.AttachmentRepository
+	noteRepo       *repositories.NoteRepository
+	blobs          storage.BlobStore
+	eventBus       *EventBus
+	queue          chan uuid.UUID
+}
+
+func NewThumbnailService(attachmentRepo *repositories.AttachmentRepository, noteRepo *repositories.NoteRepository, blobs storage.BlobStore, eventBus *EventBus) *ThumbnailService {
+	return &ThumbnailService{
+		attachmentRepo: attachmentRepo,
+		noteRepo:       noteRepo,
+		blobs:          blobs,
+		eventBus:       eventBus,
+		queue:          make(chan uuid.UUID, thumbnailQueueSize),
+	}
+}
+
+// Enqueue schedules thumbnail generation for an attachment. It never
+// blocks; when the queue is full the next sweep handles the attachment.
+func (s *ThumbnailService) Enqueue(id uuid.UUID) {
+	select {
+	case s.queue <- id:
+	default:
+	}
+}
+
+// RunWorker processes queued attachments until the process exits
+func (s *ThumbnailService) RunWorker(sweepInterval time.Duration) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	s.sweep()
+	for {
+		select {
+		case id := <-s.queue:
+			s.process(id)
+		case <-ticker.C:
+			s.sweep()
+		}
+	}
+}
+
+func (s *ThumbnailService) sweep() {
+	ids, err := s.attachmentRepo.GetPendingThumbnailIDs(100)
+	if err != nil {
+		log.Printf("Error loading pending thumbnails: %v", err)
+		return
+	}
+	for _, id := range ids {
+		s.process(id)
+	}
+}
+
+func (s *ThumbnailService) process(id uuid.UUID) {
+	// Already handled, or deleted since it was queued
+	attachment, err := s.attachmentRepo.GetPendingThumbnail(id)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	result, err := s.render(ctx, attachment)
+	if err != nil {
+		var storageErr *thumbnailStorageError
+		attachment.ThumbnailAttempts++
+		if errors.As(err, &storageErr) && !errors.Is(err, storage.ErrNotFound) &&
+			attachment.ThumbnailAttempts < maxThumbnailAttempts {
+			// Storage trouble is usually transient; leave it pending for a
+			// later sweep
+			log.Printf("Error storing thumbnails for attachment %s: %v", id, err)
+			next := time.Now().Add(thumbnailBackoff(attachment.ThumbnailAttempts))
+			if err := s.attachmentRepo.ScheduleThumbnailRetry(id, attachment.ThumbnailAttempts, next); err != nil {
+				log.Printf("Error updating attachment %s: %v", id, err)
+			}
+			return
+		}
+
+		log.Printf("Error rendering thumbnails for attachment %s: %v", id, err)
+		attachment.ThumbnailStatus = models.ThumbnailFailed
+		if _, err := s.saveThumbnail(attachment); err != nil {
+			log.Printf("Error updating attachment %s: %v", id, err)
+		}
+		return
+	}
+
+	attachment.Width = result.Width
+	attachment.Height = result.Height
+	attachment.TakenAt = result.Metadata.TakenAt
+	attachment.ThumbnailStatus = models.ThumbnailReady
+	attachment.ThumbnailMimeType = result.Thumbnails[0].MimeType
+
+	updated, err := s.saveThumbnail(attachment)
+	if err != nil {
+		log.Printf("Error updating attachment %s: %v", id, err)
+		return
+	}
+	if !updated {
+		// The attachment was deleted while we were rendering
+		s.DeleteThumbnails(ctx, id)
+	}
+}
+
+// saveThumbnail records the outcome of thumbnail generation and tells
+// everyone who can see the note. It reports false when the attachment was
+// deleted in the meantime.
+func (s *ThumbnailService) saveThumbnail(attachment *models.Attachment) (bool, error) {
+	updated := false
+	err := s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		var err error
+		if updated, err = s.attachmentRepo.WithTx(tx).UpdateThumbnail(attachment); err != nil || !updated {
+			return err
+		}
+
+		attachment.SetThumbnailURLs()
+		return publishNoteEvent(s.eventBus, tx, s.noteRepo, events.AttachmentUpdated, attachment.UserID, attachment.NoteID, attachment)
+	})
+	return updated, err
+}
+
+// thumbnailBackoff doubles from a minute up to maxThumbnailBackoff
+func thumbnailBackoff(attempts int) time.Duration {
+	backoff := time.Minute << min(attempts-1, 16)
+	return min(backoff, maxThumbnailBackoff)
+}
+
+type thumbnailStorageError struct {
+	err error
+}
+
+func (e *thumbnailStorageError) Error() string { return e.err.Error() }
+
+func (e *thumbnailStorageError) Unwrap() error { return e.err }
+
+func (s *ThumbnailService) render(ctx context.Context, attachment *models.Attachment) (*imaging.Result, error) {
+	reader, err := s.blobs.Get(ctx, attachment.StorageKey, 0, -1)
+	if err != nil {
+		return nil, &thumbnailStorageError{err}
+	}
+	data, err := io.ReadAll(io.LimitReader(reader, attachment.Size+1))
+	_ = reader.Close()
+	if err != nil {
+		return nil, &thumbnailStorageError{err}
+	}
+
+	result, err := imaging.Process(data, attachment.MimeType)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, thumb := range result.Thumbnails {
+		key := thumbnailKey(attachment.ID, thumb.Size.Name)
+		if err := s.blobs.Put(ctx, key, bytes.NewReader(thumb.Data), int64(len(thumb.Data)), thumb.MimeType); err != nil {
+			return nil, &thumbnailStorageError{err}
+		}
+	}
+
+	return result, nil
+}
+
+// Open returns an attachment and a reader over one of its thumbnails
+func (s *ThumbnailService) Open(ctx context.Context, id, userID uuid.UUID, size string) (*models.Attachment, io.ReadCloser, error) {
+	if !slices.Contains(models.ThumbnailSizes, size) {
+		return nil, nil, errors.New("unknown thumbnail size")
+	}
+
+	attachment, err := s.attachmentRepo.GetByID(id, userID)
+	if err != nil {
+		return nil, nil, errors.New("attachment not found")
+	}
+	if attachment.ThumbnailStatus != models.ThumbnailReady {
+		return nil, nil, errors.New("thumbnail not available")
+	}
+
+	reader, err := s.blobs.Get(ctx, thumbnailKey(id, size), 0, -1)
+	if err != nil {
+		return nil, nil, errors.New("thumbnail not available")
+	}
+
+	return attachment, reader, nil
+}
+
+func (s *ThumbnailService) DeleteThumbnails(ctx context.Context, id uuid.UUID) {
+	for _, key := range thumbnailKeys(id) {
+		if err := s.blobs.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Error deleting thumbnail %s: %v", key, err)
+		}
+	}
+}
+
+func thumbnailKey(id uuid.UUID, size string) string {
+	s := id.String()
+	return "thumbnails/" + s[:2] + "/" + s + "-" + size
+}
+
+func thumbnailKeys(id uuid.UUID) []string {
+	keys := make([]string, 0, len(models.ThumbnailSizes))
+	for _, size := range models.ThumbnailSizes {
+		keys = append(keys, thumbnailKey(id, size))
+	}
+	return keys
+}
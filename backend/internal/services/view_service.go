@@ -0,0 +1,177 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"google-keep-clone/internal/events"
+	"google-keep-clone/internal/models"
+	"google-keep-clone/internal/pagination"
+	"google-keep-clone/internal/repositories"
+	"google-keep-clone/internal/validators"
+)
+
+var ErrViewNotFound = errors.New("view not found")
+
+// ViewService manages saved searches, shown to users as views
+type ViewService struct {
+	viewRepo    *repositories.SavedSearchRepository
+	noteService *NoteService
+	eventBus    *EventBus
+}
+
+func NewViewService(viewRepo *repositories.SavedSearchRepository, noteService *NoteService, eventBus *EventBus) *ViewService {
+	return &ViewService{
+		viewRepo:    viewRepo,
+		noteService: noteService,
+		eventBus:    eventBus,
+	}
+}
+
+func (s *ViewService) CreateView(userID uuid.UUID, req *validators.CreateViewRequest) (*models.SavedSearch, error) {
+	view := &models.SavedSearch{
+		UserID:  userID,
+		Name:    req.Name,
+		Filters: searchFilters(&req.Filters),
+		Icon:    req.Icon,
+	}
+
+	// Views are personal, so only their owner hears of changes
+	err := s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		viewRepo := s.viewRepo.WithTx(tx)
+
+		if req.Position != nil {
+			view.Position = *req.Position
+		} else {
+			position, err := viewRepo.NextPosition(userID)
+			if err != nil {
+				return errors.New("failed to create view")
+			}
+			view.Position = position
+		}
+
+		if err := viewRepo.Create(view); err != nil {
+			return errors.New("failed to create view")
+		}
+		return s.eventBus.Publish(tx, events.ViewCreated, userID, []uuid.UUID{userID}, view)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return view, nil
+}
+
+func (s *ViewService) GetViews(userID uuid.UUID) ([]models.SavedSearch, error) {
+	return s.viewRepo.GetByUserID(userID)
+}
+
+func (s *ViewService) GetView(id, userID uuid.UUID) (*models.SavedSearch, error) {
+	view, err := s.viewRepo.GetByID(id, userID)
+	if err != nil {
+		return nil, ErrViewNotFound
+	}
+	return view, nil
+}
+
+func (s *ViewService) UpdateView(id, userID uuid.UUID, req *validators.UpdateViewRequest) (*models.SavedSearch, error) {
+	view, err := s.viewRepo.GetByID(id, userID)
+	if err != nil {
+		return nil, ErrViewNotFound
+	}
+
+	if req.Name != nil {
+		view.Name = *req.Name
+	}
+	if req.Filters != nil {
+		view.Filters = searchFilters(req.Filters)
+	}
+	if req.Icon != nil {
+		view.Icon = *req.Icon
+	}
+	if req.Position != nil {
+		view.Position = *req.Position
+	}
+
+	err = s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		if err := s.viewRepo.WithTx(tx).Update(view); err != nil {
+			return errors.New("failed to update view")
+		}
+		return s.eventBus.Publish(tx, events.ViewUpdated, userID, []uuid.UUID{userID}, view)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return view, nil
+}
+
+func (s *ViewService) DeleteView(id, userID uuid.UUID) error {
+	if _, err := s.viewRepo.GetByID(id, userID); err != nil {
+		return ErrViewNotFound
+	}
+
+	return s.eventBus.Transaction(func(tx *repositories.Tx) error {
+		if err := s.viewRepo.WithTx(tx).Delete(id, userID); err != nil {
+			return errors.New("failed to delete view")
+		}
+		return s.eventBus.Publish(tx, events.ViewDeleted, userID, []uuid.UUID{userID}, events.Deleted{ID: id})
+	})
+}
+
+// GetViewNotes runs a saved search, a page at a time
+func (s *ViewService) GetViewNotes(id, userID uuid.UUID, req *validators.ListNotesRequest) (*models.NotePage, error) {
+	view, err := s.viewRepo.GetByID(id, userID)
+	if err != nil {
+		return nil, ErrViewNotFound
+	}
+
+	filters := view.Filters
+	notes, err := s.noteService.GetNotesAdvancedPage(userID, filters.Query, labelUUIDs(filters.LabelIDs), filters.Color, filters.IncludeArchived, req)
+	if err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) || errors.Is(err, pagination.ErrCursorMismatch) {
+			return nil, err
+		}
+		return nil, errors.New("failed to run view")
+	}
+	return notes, nil
+}
+
+// GetViewCounts counts the notes each of the user's views matches right now
+func (s *ViewService) GetViewCounts(userID uuid.UUID) ([]models.SavedSearchCount, error) {
+	views, err := s.viewRepo.GetByUserID(userID)
+	if err != nil {
+		return nil, errors.New("failed to load views")
+	}
+
+	counts := make([]models.SavedSearchCount, len(views))
+	for i, view := range views {
+		filters := view.Filters
+		count, err := s.noteService.CountNotesAdvanced(userID, filters.Query, labelUUIDs(filters.LabelIDs), filters.Color, filters.IncludeArchived)
+		if err != nil {
+			return nil, errors.New("failed to count notes")
+		}
+		counts[i] = models.SavedSearchCount{ID: view.ID, Count: count}
+	}
+	return counts, nil
+}
+
+func searchFilters(req *validators.AdvancedSearchRequest) models.SearchFilters {
+	return models.SearchFilters{
+		Query:           req.Query,
+		LabelIDs:        req.LabelIDs,
+		Color:           req.Color,
+		IncludeArchived: req.IncludeArchived,
+	}
+}
+
+// labelUUIDs parses saved label IDs; they were validated when saved
+func labelUUIDs(ids []string) []uuid.UUID {
+	labelIDs := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if labelID, err := uuid.Parse(id); err == nil {
+			labelIDs = append(labelIDs, labelID)
+		}
+	}
+	return labelIDs
+}
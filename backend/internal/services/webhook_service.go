@@ -0,0 +1,528 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"google-keep-clone/internal/events"
+	"google-keep-clone/internal/models"
+	"google-keep-clone/internal/repositories"
+	"google-keep-clone/internal/validators"
+)
+
+const (
+	webhookTimeout     = 10 * time.Second
+	webhookConcurrency = 8
+	webhookBatchSize   = 100
+	// A claimed delivery isn't picked up again for this long, which must
+	// outlast an attempt
+	webhookLease = time.Minute
+	// Failed attempts are retried after 30s, 1m, 2m and so on, up to
+	// maxWebhookBackoff apart, then given up on
+	maxWebhookAttempts = 10
+	maxWebhookBackoff  = 6 * time.Hour
+	// Finished deliveries are kept this long, then deleted
+	webhookRetention = 30 * 24 * time.Hour
+	// How much of a response from an allowed host is kept in the attempt log
+	maxWebhookResponse   = 1024
+	webhookDeliveryLimit = 50
+)
+
+// Headers sent with every delivery. The signature is the hex HMAC-SHA256,
+// keyed with the webhook's secret, of the timestamp, a dot and the body.
+const (
+	WebhookEventHeader     = "X-Keep-Event"
+	WebhookDeliveryHeader  = "X-Keep-Delivery"
+	WebhookTimestampHeader = "X-Keep-Timestamp"
+	WebhookSignatureHeader = "X-Keep-Signature"
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("delivery not found")
+	ErrWebhookTarget    = errors.New("url must not point to a loopback or private address")
+)
+
+// WebhookService lets users register endpoints for events. It subscribes
+// to the event bus, queueing a delivery per event for each webhook that
+// wants it, and a worker sends them.
+//
+// Deliveries are never sent to loopback, private or link-local addresses,
+// which is checked as each connection is made, so a host can't be pointed
+// inside the network once registered. Hosts allowed by configuration are
+// exempt, and only their responses are kept in the attempt log; for
+// others just the status code is.
+type WebhookService struct {
+	webhookRepo  *repositories.WebhookRepository
+	client       *http.Client // for public addresses only
+	trusted      *http.Client // for allowedHosts
+	allowedHosts map[string]bool
+	wake         chan struct{}
+}
+
+func NewWebhookService(webhookRepo *repositories.WebhookRepository, allowedHosts []string) *WebhookService {
+	allowed := make(map[string]bool, len(allowedHosts))
+	for _, host := range allowedHosts {
+		allowed[strings.ToLower(host)] = true
+	}
+
+	return &WebhookService{
+		webhookRepo:  webhookRepo,
+		client:       newWebhookClient(&net.Dialer{Timeout: webhookTimeout, Control: publicAddressOnly}),
+		trusted:      newWebhookClient(&net.Dialer{Timeout: webhookTimeout}),
+		allowedHosts: allowed,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+func newWebhookClient(dialer *net.Dialer) *http.Client {
+	return &http.Client{
+		Timeout: webhookTimeout,
+		// Without a proxy, which would leave the proxy's address the only
+		// one checked
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: webhookTimeout,
+			MaxIdleConnsPerHost: webhookConcurrency,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		// A redirect counts as a failure; the user should register the
+		// URL it points to
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// publicAddressOnly is a dialer's Control, called with the address being
+// connected to once the host is resolved. It refuses anything but public
+// addresses.
+func publicAddressOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicAddress(ip) {
+		return ErrWebhookTarget
+	}
+	return nil
+}
+
+func publicAddress(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast()
+}
+
+// allowed reports whether rawURL's host is exempt from the address check
+func (s *WebhookService) allowed(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	return err == nil && s.allowedHosts[strings.ToLower(parsed.Hostname())]
+}
+
+// checkTarget refuses URLs that are plainly local, so they fail when they
+// are registered rather than on every delivery. Hostnames are checked when
+// connecting.
+func (s *WebhookService) checkTarget(rawURL string) error {
+	if s.allowed(rawURL) {
+		return nil
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrWebhookTarget
+	}
+	if ip := net.ParseIP(host); ip != nil && !publicAddress(ip) {
+		return ErrWebhookTarget
+	}
+	return nil
+}
+
+// webhookBody is what a delivery sends
+type webhookBody struct {
+	ID         uuid.UUID       `json:"id"` // the delivery's ID, the same on every attempt
+	Event      string          `json:"event"`
+	EventID    int64           `json:"event_id"`
+	ActorID    uuid.UUID       `json:"actor_id"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+func (s *WebhookService) CreateWebhook(userID uuid.UUID, req *validators.CreateWebhookRequest) (*models.Webhook, error) {
+	if err := s.checkTarget(req.URL); err != nil {
+		return nil, err
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, errors.New("failed to create webhook")
+	}
+
+	webhook := &models.Webhook{
+		UserID:      userID,
+		URL:         req.URL,
+		Description: req.Description,
+		Events:      req.Events,
+		Secret:      secret,
+		Active:      true,
+	}
+	if req.Active != nil {
+		webhook.Active = *req.Active
+	}
+
+	if err := s.webhookRepo.Create(webhook); err != nil {
+		return nil, errors.New("failed to create webhook")
+	}
+
+	// The only time the secret is shown, besides rotating it
+	return webhook, nil
+}
+
+func (s *WebhookService) GetWebhooks(userID uuid.UUID) ([]models.Webhook, error) {
+	webhooks, err := s.webhookRepo.GetByUserID(userID)
+	if err != nil {
+		return nil, errors.New("failed to load webhooks")
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	return webhooks, nil
+}
+
+func (s *WebhookService) GetWebhook(id, userID uuid.UUID) (*models.Webhook, error) {
+	webhook, err := s.webhookRepo.GetByID(id, userID)
+	if err != nil {
+		return nil, ErrWebhookNotFound
+	}
+	webhook.Secret = ""
+	return webhook, nil
+}
+
+func (s *WebhookService) UpdateWebhook(id, userID uuid.UUID, req *validators.UpdateWebhookRequest) (*models.Webhook, error) {
+	webhook, err := s.webhookRepo.GetByID(id, userID)
+	if err != nil {
+		return nil, ErrWebhookNotFound
+	}
+
+	if req.URL != nil {
+		if err := s.checkTarget(*req.URL); err != nil {
+			return nil, err
+		}
+		webhook.URL = *req.URL
+	}
+	if req.Description != nil {
+		webhook.Description = *req.Description
+	}
+	if req.Events != nil {
+		webhook.Events = *req.Events
+	}
+	if req.Active != nil {
+		webhook.Active = *req.Active
+	}
+
+	if err := s.webhookRepo.Update(webhook); err != nil {
+		return nil, errors.New("failed to update webhook")
+	}
+
+	webhook.Secret = ""
+	return webhook, nil
+}
+
+// RotateSecret gives a webhook a new secret. Deliveries are signed with
+// it from the next attempt on.
+func (s *WebhookService) RotateSecret(id, userID uuid.UUID) (*models.Webhook, error) {
+	webhook, err := s.webhookRepo.GetByID(id, userID)
+	if err != nil {
+		return nil, ErrWebhookNotFound
+	}
+
+	if webhook.Secret, err = newWebhookSecret(); err != nil {
+		return nil, errors.New("failed to rotate secret")
+	}
+	if err := s.webhookRepo.Update(webhook); err != nil {
+		return nil, errors.New("failed to rotate secret")
+	}
+
+	return webhook, nil
+}
+
+func (s *WebhookService) DeleteWebhook(id, userID uuid.UUID) error {
+	if err := s.webhookRepo.Delete(id, userID); err != nil {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// GetDeliveries returns the webhook's most recent deliveries
+func (s *WebhookService) GetDeliveries(id, userID uuid.UUID) ([]models.WebhookDelivery, error) {
+	if _, err := s.webhookRepo.GetByID(id, userID); err != nil {
+		return nil, ErrWebhookNotFound
+	}
+
+	deliveries, err := s.webhookRepo.GetDeliveries(id, webhookDeliveryLimit)
+	if err != nil {
+		return nil, errors.New("failed to load deliveries")
+	}
+	return deliveries, nil
+}
+
+// GetDelivery returns a delivery with the log of its attempts
+func (s *WebhookService) GetDelivery(id, deliveryID, userID uuid.UUID) (*models.WebhookDelivery, error) {
+	if _, err := s.webhookRepo.GetByID(id, userID); err != nil {
+		return nil, ErrWebhookNotFound
+	}
+
+	delivery, err := s.webhookRepo.GetDelivery(deliveryID, id)
+	if err != nil {
+		return nil, ErrDeliveryNotFound
+	}
+	return delivery, nil
+}
+
+// ReplayDelivery sends a delivery again, whatever became of it, with the
+// same body and ID
+func (s *WebhookService) ReplayDelivery(id, deliveryID, userID uuid.UUID) (*models.WebhookDelivery, error) {
+	delivery, err := s.GetDelivery(id, deliveryID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.webhookRepo.Requeue(delivery); err != nil {
+		return nil, errors.New("failed to replay delivery")
+	}
+	s.notify()
+
+	return delivery, nil
+}
+
+func (s *WebhookService) Name() string {
+	return "webhooks"
+}
+
+// Handle queues a delivery of event to every webhook of its audience
+// subscribed to it
+func (s *WebhookService) Handle(event *events.Event) error {
+	name := event.Type.Name()
+	webhooks, err := s.webhookRepo.GetSubscribed(event.Audience, name)
+	if err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	deliveries := make([]models.WebhookDelivery, len(webhooks))
+	for i, webhook := range webhooks {
+		id := uuid.New()
+		body, err := json.Marshal(webhookBody{
+			ID:         id,
+			Event:      name,
+			EventID:    event.ID,
+			ActorID:    event.ActorID,
+			OccurredAt: event.OccurredAt,
+			Data:       event.Payload,
+		})
+		if err != nil {
+			return err
+		}
+
+		deliveries[i] = models.WebhookDelivery{
+			ID:            id,
+			WebhookID:     webhook.ID,
+			EventID:       event.ID,
+			Event:         name,
+			Body:          string(body),
+			Status:        models.DeliveryPending,
+			NextAttemptAt: &now,
+		}
+	}
+
+	if err := s.webhookRepo.CreateDeliveries(deliveries); err != nil {
+		return err
+	}
+	s.notify()
+	return nil
+}
+
+func (s *WebhookService) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// RunWorker sends deliveries as they are queued, and every interval to
+// pick up retries
+func (s *WebhookService) RunWorker(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastPrune := time.Time{}
+
+	for {
+		for {
+			deliveries, err := s.webhookRepo.ClaimDueDeliveries(webhookBatchSize, webhookLease)
+			if err != nil {
+				log.Printf("Error loading webhook deliveries: %v", err)
+				break
+			}
+			s.sendAll(deliveries)
+			if len(deliveries) < webhookBatchSize {
+				break
+			}
+		}
+
+		if time.Since(lastPrune) > time.Hour {
+			if err := s.webhookRepo.DeleteDeliveriesBefore(time.Now().Add(-webhookRetention)); err != nil {
+				log.Printf("Error pruning webhook deliveries: %v", err)
+			}
+			lastPrune = time.Now()
+		}
+
+		select {
+		case <-s.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendAll sends deliveries, a few at a time
+func (s *WebhookService) sendAll(deliveries []models.WebhookDelivery) {
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, webhookConcurrency)
+	for i := range deliveries {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(delivery *models.WebhookDelivery) {
+			defer wg.Done()
+			s.send(delivery)
+			<-slots
+		}(&deliveries[i])
+	}
+	wg.Wait()
+}
+
+// send makes one attempt at a delivery and schedules the next if it fails
+func (s *WebhookService) send(delivery *models.WebhookDelivery) {
+	attempt := &models.WebhookAttempt{DeliveryID: delivery.ID}
+	delivery.Attempts++
+
+	webhook, err := s.webhookRepo.GetForDelivery(delivery.WebhookID)
+	switch {
+	case err != nil:
+		attempt.Error = "webhook not found"
+		delivery.Attempts = maxWebhookAttempts
+	case !webhook.Active:
+		attempt.Error = "webhook is disabled"
+		delivery.Attempts = maxWebhookAttempts
+	default:
+		s.post(webhook, delivery, attempt)
+	}
+
+	if attempt.Error == "" && attempt.StatusCode >= 200 && attempt.StatusCode < 300 {
+		delivery.Status = models.DeliverySucceeded
+		delivery.NextAttemptAt = nil
+	} else if delivery.Attempts >= maxWebhookAttempts {
+		delivery.Status = models.DeliveryFailed
+		delivery.NextAttemptAt = nil
+	} else {
+		next := time.Now().Add(webhookBackoff(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+	}
+
+	if err := s.webhookRepo.RecordAttempt(delivery, attempt); err != nil {
+		log.Printf("Error recording webhook delivery %v: %v", delivery.ID, err)
+	}
+}
+
+// post sends the delivery's body to the webhook, noting how it went in
+// attempt
+func (s *WebhookService) post(webhook *models.Webhook, delivery *models.WebhookDelivery, attempt *models.WebhookAttempt) {
+	body := []byte(delivery.Body)
+	request, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "google-keep-clone-webhooks")
+	request.Header.Set(WebhookEventHeader, delivery.Event)
+	request.Header.Set(WebhookDeliveryHeader, delivery.ID.String())
+	request.Header.Set(WebhookTimestampHeader, timestamp)
+	request.Header.Set(WebhookSignatureHeader, Sign(webhook.Secret, timestamp, body))
+
+	client := s.client
+	trusted := s.allowed(webhook.URL)
+	if trusted {
+		client = s.trusted
+	}
+
+	start := time.Now()
+	response, err := client.Do(request)
+	attempt.DurationMs = time.Since(start).Milliseconds()
+	if errors.Is(err, ErrWebhookTarget) {
+		// Without the address the host resolved to
+		attempt.Error = ErrWebhookTarget.Error()
+		return
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+		return
+	}
+	defer response.Body.Close()
+
+	attempt.StatusCode = response.StatusCode
+	if trusted {
+		excerpt, _ := io.ReadAll(io.LimitReader(response.Body, maxWebhookResponse))
+		attempt.Response = strings.ToValidUTF8(string(excerpt), "")
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		attempt.Error = "unexpected status " + response.Status
+	}
+}
+
+// Sign returns the signature of a delivery body sent at timestamp, as
+// carried in WebhookSignatureHeader
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+// webhookBackoff doubles from 30 seconds up to maxWebhookBackoff
+func webhookBackoff(attempts int) time.Duration {
+	backoff := 30 * time.Second << min(attempts-1, 16)
+	return min(backoff, maxWebhookBackoff)
+}
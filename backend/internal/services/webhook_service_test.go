@@ -0,0 +1,277 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"google-keep-clone/internal/models"
+	"google-keep-clone/internal/repositories"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestSign(t *testing.T) {
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(`1700000000.{"a":1}`))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if got := Sign("secret", "1700000000", []byte(`{"a":1}`)); got != want {
+		t.Errorf("Sign = %s; want %s", got, want)
+	}
+	if Sign("other", "1700000000", []byte(`{"a":1}`)) == want {
+		t.Error("signature does not depend on the secret")
+	}
+	if Sign("secret", "1700000001", []byte(`{"a":1}`)) == want {
+		t.Error("signature does not depend on the timestamp")
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{9, 128 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, maxWebhookBackoff},
+		{100, maxWebhookBackoff},
+	}
+	for _, test := range tests {
+		if got := webhookBackoff(test.attempts); got != test.want {
+			t.Errorf("backoff after %d attempts = %v; want %v", test.attempts, got, test.want)
+		}
+	}
+}
+
+// TestWebhookPost checks what a receiver gets, and that the response of an
+// allowed host is kept
+func TestWebhookPost(t *testing.T) {
+	var received *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		w.Write([]byte("thanks"))
+	}))
+	defer server.Close()
+
+	s := NewWebhookService(nil, []string{"127.0.0.1"})
+	webhook := &models.Webhook{URL: server.URL, Secret: "secret"}
+	delivery := &models.WebhookDelivery{ID: uuid.New(), Event: "note.created", Body: `{"event":"note.created"}`}
+	attempt := &models.WebhookAttempt{}
+	s.post(webhook, delivery, attempt)
+
+	if attempt.Error != "" || attempt.StatusCode != http.StatusOK || attempt.Response != "thanks" {
+		t.Fatalf("attempt = %+v; want 200 with the response", attempt)
+	}
+	if string(body) != delivery.Body {
+		t.Errorf("body = %s; want %s", body, delivery.Body)
+	}
+	if got := received.Header.Get(WebhookEventHeader); got != "note.created" {
+		t.Errorf("event header = %q", got)
+	}
+	if got := received.Header.Get(WebhookDeliveryHeader); got != delivery.ID.String() {
+		t.Errorf("delivery header = %q; want %v", got, delivery.ID)
+	}
+	timestamp := received.Header.Get(WebhookTimestampHeader)
+	if got := received.Header.Get(WebhookSignatureHeader); got != Sign("secret", timestamp, body) {
+		t.Errorf("signature header = %q doesn't match the body", got)
+	}
+}
+
+// TestWebhookRefusesLocalTargets checks loopback and private addresses are
+// refused unless allowed, both when registering and when connecting
+func TestWebhookRefusesLocalTargets(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte("secret internals"))
+	}))
+	defer server.Close()
+
+	s := NewWebhookService(nil, []string{"receiver.internal"})
+
+	for _, target := range []string{
+		"http://localhost/hook",
+		"http://api.localhost/hook",
+		"http://127.0.0.1/hook",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+		"http://0.0.0.0/hook",
+	} {
+		if err := s.checkTarget(target); !errors.Is(err, ErrWebhookTarget) {
+			t.Errorf("checkTarget(%s) = %v; want ErrWebhookTarget", target, err)
+		}
+	}
+	for _, target := range []string{"https://example.com/hook", "http://93.184.216.34/hook", "http://RECEIVER.internal:8080/hook"} {
+		if err := s.checkTarget(target); err != nil {
+			t.Errorf("checkTarget(%s) = %v; want nil", target, err)
+		}
+	}
+
+	// Connections are refused too, whatever the host's name
+	parsed, _ := url.Parse(server.URL)
+	webhook := &models.Webhook{Secret: "secret"}
+	for _, target := range []string{server.URL, "http://localhost:" + parsed.Port()} {
+		webhook.URL = target
+		attempt := &models.WebhookAttempt{}
+		s.post(webhook, &models.WebhookDelivery{ID: uuid.New(), Body: `{}`}, attempt)
+		if attempt.Error == "" || attempt.StatusCode != 0 || attempt.Response != "" {
+			t.Errorf("post to %s: attempt = %+v; want it refused", target, attempt)
+		}
+	}
+	if n := hits.Load(); n != 0 {
+		t.Errorf("receiver hit %d times; want none", n)
+	}
+}
+
+// TestWebhookKeepsOnlyStatusOfOtherHosts checks a response is left out of
+// the attempt log unless its host is allowed
+func TestWebhookKeepsOnlyStatusOfOtherHosts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("secret internals"))
+	}))
+	defer server.Close()
+
+	// Allowed by name, so reached although it resolves to a loopback address
+	s := NewWebhookService(nil, []string{"localhost"})
+	parsed, _ := url.Parse(server.URL)
+	webhook := &models.Webhook{URL: "http://localhost:" + parsed.Port(), Secret: "secret"}
+
+	attempt := &models.WebhookAttempt{}
+	s.post(webhook, &models.WebhookDelivery{ID: uuid.New(), Body: `{}`}, attempt)
+	if attempt.StatusCode != http.StatusTeapot || attempt.Response != "secret internals" {
+		t.Fatalf("attempt = %+v; want 418 with the response", attempt)
+	}
+
+	// Not allowed, with the address check left out so the receiver stands
+	// in for a public host
+	s.allowedHosts = map[string]bool{}
+	s.client = newWebhookClient(&net.Dialer{})
+	attempt = &models.WebhookAttempt{}
+	s.post(webhook, &models.WebhookDelivery{ID: uuid.New(), Body: `{}`}, attempt)
+	if attempt.StatusCode != http.StatusTeapot || attempt.Response != "" {
+		t.Errorf("attempt = %+v; want 418 without the response", attempt)
+	}
+}
+
+// TestWebhookRetriesAndReplay sends a delivery to a receiver that fails
+// twice, then replays it. It runs when TEST_DATABASE_URL is set.
+func TestWebhookRetriesAndReplay(t *testing.T) {
+	db := testDB(t)
+	if err := db.AutoMigrate(&models.Webhook{}, &models.WebhookDelivery{}, &models.WebhookAttempt{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	repo := repositories.NewWebhookRepository(db)
+	s := NewWebhookService(repo, []string{"127.0.0.1"})
+
+	userID := uuid.New()
+	webhook := &models.Webhook{UserID: userID, URL: server.URL, Events: models.StringList{"*"}, Secret: "secret", Active: true}
+	if err := repo.Create(webhook); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = repo.Delete(webhook.ID, userID) })
+
+	now := time.Now()
+	delivery := models.WebhookDelivery{
+		ID:            uuid.New(),
+		WebhookID:     webhook.ID,
+		EventID:       1,
+		Event:         "note.created",
+		Body:          `{"event":"note.created"}`,
+		Status:        models.DeliveryPending,
+		NextAttemptAt: &now,
+	}
+	if err := repo.CreateDeliveries([]models.WebhookDelivery{delivery}); err != nil {
+		t.Fatal(err)
+	}
+
+	for attempts := 1; attempts <= 2; attempts++ {
+		before := time.Now()
+		s.send(&delivery)
+		if delivery.Status != models.DeliveryPending || delivery.Attempts != attempts {
+			t.Fatalf("after a 503: status %s, %d attempts; want pending, %d", delivery.Status, delivery.Attempts, attempts)
+		}
+		if next := delivery.NextAttemptAt.Sub(before); next < webhookBackoff(attempts) || next > webhookBackoff(attempts)+time.Minute {
+			t.Errorf("attempt %d retried after %v; want %v", attempts, next, webhookBackoff(attempts))
+		}
+	}
+	s.send(&delivery)
+	if delivery.Status != models.DeliverySucceeded || delivery.NextAttemptAt != nil {
+		t.Fatalf("after a 204: status %s; want succeeded", delivery.Status)
+	}
+
+	logged, err := s.GetDelivery(webhook.ID, delivery.ID, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logged.AttemptLog) != 3 {
+		t.Fatalf("%d attempts logged; want 3", len(logged.AttemptLog))
+	}
+	for i, want := range []int{503, 503, 204} {
+		attempt := logged.AttemptLog[i]
+		if attempt.StatusCode != want || (want == 503) == (attempt.Error == "") {
+			t.Errorf("attempt %d = %+v; want status %d", i+1, attempt, want)
+		}
+	}
+
+	replayed, err := s.ReplayDelivery(webhook.ID, delivery.ID, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.Status != models.DeliveryPending || replayed.Attempts != 0 {
+		t.Fatalf("replayed delivery: status %s, %d attempts; want pending, 0", replayed.Status, replayed.Attempts)
+	}
+	s.send(replayed)
+	if replayed.Status != models.DeliverySucceeded || calls.Load() != 4 {
+		t.Errorf("after the replay: status %s, %d calls; want succeeded, 4", replayed.Status, calls.Load())
+	}
+	if logged, _ := s.GetDelivery(webhook.ID, delivery.ID, userID); len(logged.AttemptLog) != 4 {
+		t.Errorf("%d attempts logged after the replay; want 4", len(logged.AttemptLog))
+	}
+}
+
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(url), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connecting to the test database: %v", err)
+	}
+	return db
+}
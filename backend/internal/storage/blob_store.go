@@ -0,0 +1,21 @@
+// Package storage holds the blob backends attachments are stored in.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores opaque blobs under string keys
+type BlobStore interface {
+	// Put stores size bytes from r under key
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get streams length bytes of the blob starting at offset. A negative
+	// length reads to the end.
+	Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	Delete(ctx context.Context, key string) error
+}
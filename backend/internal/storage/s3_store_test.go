@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// TestS3Store runs against an S3-compatible service such as a local MinIO
+// when S3_TEST_ENDPOINT is set, e.g.
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//	S3_TEST_ENDPOINT=localhost:9000 go test ./internal/storage
+func TestS3Store(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT not set")
+	}
+
+	ctx := context.Background()
+	store, err := NewS3Store(ctx, S3Config{
+		Endpoint:  endpoint,
+		Bucket:    envOr("S3_TEST_BUCKET", "keep-attachments-test"),
+		AccessKey: envOr("S3_TEST_ACCESS_KEY", "minioadmin"),
+		SecretKey: envOr("S3_TEST_SECRET_KEY", "minioadmin"),
+		Region:    envOr("S3_TEST_REGION", "us-east-1"),
+		UseSSL:    os.Getenv("S3_TEST_USE_SSL") == "true",
+	})
+	if err != nil {
+		t.Fatalf("connecting to %s: %v", endpoint, err)
+	}
+
+	// Keys are unique per run so a shared bucket can be reused
+	prefix := "test/" + uuid.NewString() + "/"
+
+	t.Run("missing", func(t *testing.T) {
+		key := prefix + "missing"
+
+		exists, err := store.Exists(ctx, key)
+		if err != nil || exists {
+			t.Fatalf("Exists = %v, %v; want false, nil", exists, err)
+		}
+		if _, err := store.Get(ctx, key, 0, -1); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get err = %v; want ErrNotFound", err)
+		}
+		if err := store.Delete(ctx, key); err != nil {
+			t.Fatalf("Delete of a missing blob: %v", err)
+		}
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		key := prefix + "sha256/ab/abcdef"
+		content := []byte("hello, blob store")
+		if err := store.Put(ctx, key, bytes.NewReader(content), int64(len(content)), "text/plain"); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+
+		exists, err := store.Exists(ctx, key)
+		if err != nil || !exists {
+			t.Fatalf("Exists = %v, %v; want true, nil", exists, err)
+		}
+
+		ranges := []struct {
+			offset, length int64
+			want           string
+		}{
+			{0, -1, "hello, blob store"},
+			{7, 4, "blob"},
+			{7, -1, "blob store"},
+			{0, 5, "hello"},
+		}
+		for _, r := range ranges {
+			if got := readBlob(t, store, key, r.offset, r.length); got != r.want {
+				t.Errorf("Get(%d, %d) = %q; want %q", r.offset, r.length, got, r.want)
+			}
+		}
+
+		if err := store.Delete(ctx, key); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		exists, err = store.Exists(ctx, key)
+		if err != nil || exists {
+			t.Fatalf("Exists after Delete = %v, %v; want false, nil", exists, err)
+		}
+	})
+}
+
+func readBlob(t *testing.T, store BlobStore, key string, offset, length int64) string {
+	t.Helper()
+	reader, err := store.Get(context.Background(), key, offset, length)
+	if err != nil {
+		t.Fatalf("Get(%d, %d): %v", offset, length, err)
+	}
+	defer func() { _ = reader.Close() }()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("reading blob: %v", err)
+	}
+	return string(data)
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
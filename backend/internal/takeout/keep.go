@@ -0,0 +1,203 @@
+// Package takeout reads and writes the notes in a Google Takeout archive.
+package takeout
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Limits on what we read from an archive, so a crafted zip can't exhaust
+// memory
+const (
+	MaxEntries      = 100_000
+	MaxNoteFileSize = 10 << 20
+)
+
+// KeepNote is a note as exported by Google Keep
+type KeepNote struct {
+	Title                   string           `json:"title"`
+	TextContent             string           `json:"textContent"`
+	ListContent             []KeepListItem   `json:"listContent,omitempty"`
+	Color                   string           `json:"color"`
+	IsPinned                bool             `json:"isPinned"`
+	IsArchived              bool             `json:"isArchived"`
+	IsTrashed               bool             `json:"isTrashed"`
+	Labels                  []KeepLabel      `json:"labels,omitempty"`
+	Attachments             []KeepAttachment `json:"attachments,omitempty"`
+	CreatedTimestampUsec    int64            `json:"createdTimestampUsec"`
+	UserEditedTimestampUsec int64            `json:"userEditedTimestampUsec"`
+}
+
+type KeepListItem struct {
+	Text      string `json:"text"`
+	IsChecked bool   `json:"isChecked"`
+}
+
+type KeepLabel struct {
+	Name string `json:"name"`
+}
+
+type KeepAttachment struct {
+	FilePath string `json:"filePath"`
+	MimeType string `json:"mimetype"`
+}
+
+// CreatedAt returns when the note was created, falling back to the last
+// edit for old exports that lack a creation time
+func (n *KeepNote) CreatedAt() time.Time {
+	if n.CreatedTimestampUsec > 0 {
+		return time.UnixMicro(n.CreatedTimestampUsec).UTC()
+	}
+	return n.UpdatedAt()
+}
+
+func (n *KeepNote) UpdatedAt() time.Time {
+	if n.UserEditedTimestampUsec > 0 {
+		return time.UnixMicro(n.UserEditedTimestampUsec).UTC()
+	}
+	return time.Now().UTC()
+}
+
+// keepColors maps Keep's color names onto its palette
+var keepColors = map[string]string{
+	"DEFAULT":  "#ffffff",
+	"RED":      "#f28b82",
+	"ORANGE":   "#fbbc04",
+	"YELLOW":   "#fff475",
+	"GREEN":    "#ccff90",
+	"TEAL":     "#a7ffeb",
+	"BLUE":     "#cbf0f8",
+	"CERULEAN": "#aecbfa",
+	"PURPLE":   "#d7aefb",
+	"PINK":     "#fdcfe8",
+	"BROWN":    "#e6c9a8",
+	"GRAY":     "#e8eaed",
+}
+
+// HexColor returns the note's color as hex, white for unknown colors
+func (n *KeepNote) HexColor() string {
+	if hex, ok := keepColors[strings.ToUpper(n.Color)]; ok {
+		return hex
+	}
+	return keepColors["DEFAULT"]
+}
+
+// KeepColorName returns the Keep name of a hex color. Colors outside
+// Keep's palette export as the default.
+func KeepColorName(hex string) string {
+	for name, value := range keepColors {
+		if strings.EqualFold(value, hex) {
+			return name
+		}
+	}
+	return "DEFAULT"
+}
+
+// Archive is an opened Takeout zip
+type Archive struct {
+	files map[string]*zip.File
+	notes []string
+}
+
+// OpenArchive indexes the Keep notes in a Takeout zip
+func OpenArchive(r *zip.Reader) (*Archive, error) {
+	if len(r.File) > MaxEntries {
+		return nil, errors.New("archive has too many entries")
+	}
+
+	archive := &Archive{files: make(map[string]*zip.File, len(r.File))}
+	for _, f := range r.File {
+		name := path.Clean(f.Name)
+		archive.files[name] = f
+
+		// Keep notes live in Takeout/Keep/*.json; other products' JSON
+		// files are ignored
+		if strings.EqualFold(path.Ext(name), ".json") && path.Base(path.Dir(name)) == "Keep" {
+			archive.notes = append(archive.notes, name)
+		}
+	}
+
+	if len(archive.notes) == 0 {
+		return nil, errors.New("no Google Keep notes found in archive")
+	}
+
+	sort.Strings(archive.notes)
+	return archive, nil
+}
+
+// Notes returns the paths of the note files in the archive
+func (a *Archive) Notes() []string {
+	return a.notes
+}
+
+// ReadNote parses the note stored at name
+func (a *Archive) ReadNote(name string) (*KeepNote, error) {
+	data, err := a.read(a.files[name], MaxNoteFileSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var note KeepNote
+	if err := json.Unmarshal(data, &note); err != nil {
+		return nil, errors.New("invalid note JSON")
+	}
+	return &note, nil
+}
+
+// ReadAttachment returns the content of an attachment referenced by the
+// note at notePath. Takeout sometimes renames files on export (".jpg"
+// listed as ".jpeg" and vice versa), so a file with the same base name is
+// accepted too.
+func (a *Archive) ReadAttachment(notePath, filePath string, maxSize int64) ([]byte, error) {
+	dir := path.Dir(notePath)
+	name := path.Join(dir, path.Base(filePath))
+
+	f, ok := a.files[name]
+	if !ok {
+		stem := strings.TrimSuffix(name, path.Ext(name))
+		for candidate, file := range a.files {
+			if path.Dir(candidate) == dir && strings.TrimSuffix(candidate, path.Ext(candidate)) == stem && !strings.EqualFold(path.Ext(candidate), ".json") {
+				f, ok = file, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, errors.New("attachment file missing from archive")
+	}
+
+	return a.read(f, maxSize)
+}
+
+var errEntryTooLarge = errors.New("archive entry too large")
+
+func (a *Archive) read(f *zip.File, maxSize int64) ([]byte, error) {
+	if f == nil {
+		return nil, errors.New("file missing from archive")
+	}
+	// The header's size can lie; the limited read below is what counts
+	if f.UncompressedSize64 > uint64(maxSize) {
+		return nil, errEntryTooLarge
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rc.Close() }()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, errEntryTooLarge
+	}
+	return data, nil
+}
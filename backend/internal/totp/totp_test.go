@@ -0,0 +1,110 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The RFC 6238 test secret, "12345678901234567890", base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// TestCode checks the SHA1 vectors of RFC 6238 appendix B, cut to six digits
+func TestCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, test := range tests {
+		for _, secret := range []string{rfcSecret, strings.ToLower(rfcSecret)} {
+			got, err := Code(secret, Counter(time.Unix(test.unix, 0)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("code at %d = %s; want %s", test.unix, got, test.want)
+			}
+		}
+	}
+
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("code from an invalid secret")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Counter(now)
+	code := func(counter int64) string {
+		c, err := Code(rfcSecret, counter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current", code(step), step, true},
+		{"one period behind", code(step - 1), step - 1, true},
+		{"one period ahead", code(step + 1), step + 1, true},
+		{"two periods behind", code(step - 2), 0, false},
+		{"two periods ahead", code(step + 2), 0, false},
+		{"too short", code(step)[:5], 0, false},
+		{"too long", code(step) + "0", 0, false},
+		{"empty", "", 0, false},
+	}
+	for _, test := range tests {
+		gotStep, ok := Validate(rfcSecret, test.code, now)
+		if ok != test.wantOK || gotStep != test.wantStep {
+			t.Errorf("%s: step %d, ok %v; want %d, %v", test.name, gotStep, ok, test.wantStep, test.wantOK)
+		}
+	}
+
+	if _, ok := Validate("not base32!", code(step), now); ok {
+		t.Error("validated against an invalid secret")
+	}
+}
+
+func TestCounterBoundaries(t *testing.T) {
+	if Counter(time.Unix(29, 0)) != 0 || Counter(time.Unix(30, 0)) != 1 || Counter(time.Unix(59, 999)) != 1 {
+		t.Error("time steps don't start every 30 seconds")
+	}
+}
+
+func TestGenerateSecretAndURI(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("secret %q is %d characters; want 32 for 160 bits", secret, len(secret))
+	}
+	if _, err := Code(secret, 1); err != nil {
+		t.Errorf("generated secret doesn't decode: %v", err)
+	}
+
+	uri, err := url.Parse(URI("Keep", "ada@example.com", secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Keep:ada@example.com" {
+		t.Errorf("URI %s; want otpauth://totp/Keep:ada@example.com", uri)
+	}
+	query := uri.Query()
+	if query.Get("secret") != secret || query.Get("issuer") != "Keep" || query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("URI parameters %v", query)
+	}
+}
@@ -7,20 +7,106 @@ import (
 )
 
 type RegisterRequest struct {
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8"`
-	Name     string `json:"name" validate:"required,min=2,max=100"`
+	Email      string `json:"email" validate:"required,email"`
+	Password   string `json:"password" validate:"required,min=8"`
+	Name       string `json:"name" validate:"required,min=2,max=100"`
+	DeviceName string `json:"device_name,omitempty" validate:"omitempty,max=100"` // shown in the session list
 }
 
 type LoginRequest struct {
-	Email    string `json:"email" validate:"required,email"`
+	Email      string `json:"email" validate:"required,email"`
+	Password   string `json:"password" validate:"required"`
+	DeviceName string `json:"device_name,omitempty" validate:"omitempty,max=100"` // shown in the session list
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8"`
+}
+
+type TwoFactorVerifyRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required"` // from the authenticator app, or a recovery code
+}
+
+type TwoFactorConfirmRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// TwoFactorReauthRequest asks for the password and a code again before
+// two-factor authentication is turned off or its recovery codes replaced
+type TwoFactorReauthRequest struct {
 	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"` // from the authenticator app, or a recovery code
 }
 
 type GoogleLoginRequest struct {
 	Token string `json:"token" validate:"required"`
 }
 
+type UpdateProfileRequest struct {
+	Name           *string `json:"name"`
+	SearchLanguage *string `json:"search_language"`
+}
+
+// SearchLanguages are the Postgres text search configurations notes can be
+// stemmed with; "simple" only lowercases words
+var SearchLanguages = map[string]bool{
+	"simple":     true,
+	"arabic":     true,
+	"danish":     true,
+	"dutch":      true,
+	"english":    true,
+	"finnish":    true,
+	"french":     true,
+	"german":     true,
+	"greek":      true,
+	"hungarian":  true,
+	"indonesian": true,
+	"irish":      true,
+	"italian":    true,
+	"lithuanian": true,
+	"nepali":     true,
+	"norwegian":  true,
+	"portuguese": true,
+	"romanian":   true,
+	"russian":    true,
+	"spanish":    true,
+	"swedish":    true,
+	"tamil":      true,
+	"turkish":    true,
+}
+
+func ValidateUpdateProfileRequest(req *UpdateProfileRequest) error {
+	if req.Name == nil && req.SearchLanguage == nil {
+		return errors.New("nothing to update")
+	}
+
+	if req.Name != nil {
+		if err := validateName(*req.Name); err != nil {
+			return err
+		}
+	}
+
+	if req.SearchLanguage != nil && !SearchLanguages[*req.SearchLanguage] {
+		return errors.New("unsupported search language")
+	}
+
+	return nil
+}
+
 func ValidateStruct(req interface{}) error {
 	switch v := req.(type) {
 	case *RegisterRequest:
@@ -29,6 +115,20 @@ func ValidateStruct(req interface{}) error {
 		return validateLoginRequest(v)
 	case *GoogleLoginRequest:
 		return validateGoogleLoginRequest(v)
+	case *RefreshRequest:
+		return validateRefreshRequest(v)
+	case *VerifyEmailRequest:
+		return validateVerifyEmailRequest(v)
+	case *ForgotPasswordRequest:
+		return validateEmail(v.Email)
+	case *ResetPasswordRequest:
+		return validateResetPasswordRequest(v)
+	case *TwoFactorVerifyRequest:
+		return validateTwoFactorVerifyRequest(v)
+	case *TwoFactorConfirmRequest:
+		return validateTwoFactorCode(v.Code)
+	case *TwoFactorReauthRequest:
+		return validateTwoFactorReauthRequest(v)
 	default:
 		return errors.New("unknown request type")
 	}
@@ -47,7 +147,7 @@ func validateRegisterRequest(req *RegisterRequest) error {
 		return err
 	}
 
-	return nil
+	return validateDeviceName(req.DeviceName)
 }
 
 func validateLoginRequest(req *LoginRequest) error {
@@ -59,6 +159,66 @@ func validateLoginRequest(req *LoginRequest) error {
 		return errors.New("password is required")
 	}
 
+	return validateDeviceName(req.DeviceName)
+}
+
+func validateRefreshRequest(req *RefreshRequest) error {
+	if req.RefreshToken == "" {
+		return errors.New("refresh token is required")
+	}
+
+	return nil
+}
+
+func validateVerifyEmailRequest(req *VerifyEmailRequest) error {
+	if req.Token == "" {
+		return errors.New("token is required")
+	}
+
+	return nil
+}
+
+func validateResetPasswordRequest(req *ResetPasswordRequest) error {
+	if req.Token == "" {
+		return errors.New("token is required")
+	}
+
+	return validatePassword(req.Password)
+}
+
+func validateTwoFactorVerifyRequest(req *TwoFactorVerifyRequest) error {
+	if req.MFAToken == "" {
+		return errors.New("mfa token is required")
+	}
+
+	return validateTwoFactorCode(req.Code)
+}
+
+func validateTwoFactorReauthRequest(req *TwoFactorReauthRequest) error {
+	if req.Password == "" {
+		return errors.New("password is required")
+	}
+
+	return validateTwoFactorCode(req.Code)
+}
+
+func validateTwoFactorCode(code string) error {
+	if strings.TrimSpace(code) == "" {
+		return errors.New("code is required")
+	}
+
+	if len(code) > 32 {
+		return errors.New("invalid code")
+	}
+
+	return nil
+}
+
+func validateDeviceName(name string) error {
+	if len(name) > 100 {
+		return errors.New("device name must be less than 100 characters long")
+	}
+
 	return nil
 }
 
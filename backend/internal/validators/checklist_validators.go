@@ -0,0 +1,124 @@
+package validators
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// The most items a note's checklist can hold
+	MaxChecklistItems    = 500
+	maxChecklistItemText = 1000
+)
+
+// ChecklistItemInput describes an item sent inline with a note create/update.
+// ParentIndex refers to an earlier item in the same list.
+type ChecklistItemInput struct {
+	Text        string `json:"text"`
+	IsChecked   bool   `json:"is_checked"`
+	ParentIndex *int   `json:"parent_index,omitempty"`
+}
+
+type CreateChecklistItemRequest struct {
+	Text      string  `json:"text"`
+	IsChecked bool    `json:"is_checked"`
+	ParentID  *string `json:"parent_id,omitempty"`
+	Position  *int    `json:"position,omitempty"`
+}
+
+type UpdateChecklistItemRequest struct {
+	Text      *string `json:"text,omitempty"`
+	IsChecked *bool   `json:"is_checked,omitempty"`
+	ParentID  *string `json:"parent_id,omitempty"`
+}
+
+type ReorderChecklistItemsRequest struct {
+	ItemIDs []string `json:"item_ids"`
+}
+
+func ValidateChecklistItems(items []ChecklistItemInput) error {
+	if len(items) > MaxChecklistItems {
+		return fmt.Errorf("a checklist cannot have more than %d items", MaxChecklistItems)
+	}
+
+	for i, item := range items {
+		if len(item.Text) > maxChecklistItemText {
+			return fmt.Errorf("item %d: text must be less than 1,000 characters", i)
+		}
+
+		if item.ParentIndex != nil {
+			parent := *item.ParentIndex
+			if parent < 0 || parent >= i {
+				return fmt.Errorf("item %d: parent_index must refer to an earlier item", i)
+			}
+			if items[parent].ParentIndex != nil {
+				return fmt.Errorf("item %d: items can only be nested one level deep", i)
+			}
+		}
+	}
+
+	return nil
+}
+
+func ValidateCreateChecklistItemRequest(req *CreateChecklistItemRequest) error {
+	if len(req.Text) > maxChecklistItemText {
+		return errors.New("text must be less than 1,000 characters")
+	}
+
+	if req.ParentID != nil {
+		if _, err := uuid.Parse(*req.ParentID); err != nil {
+			return errors.New("invalid parent ID")
+		}
+	}
+
+	if req.Position != nil && *req.Position < 0 {
+		return errors.New("position must be non-negative")
+	}
+
+	return nil
+}
+
+func ValidateUpdateChecklistItemRequest(req *UpdateChecklistItemRequest) error {
+	if req.Text != nil && len(*req.Text) > maxChecklistItemText {
+		return errors.New("text must be less than 1,000 characters")
+	}
+
+	// An empty parent ID un-nests the item
+	if req.ParentID != nil && *req.ParentID != "" {
+		if _, err := uuid.Parse(*req.ParentID); err != nil {
+			return errors.New("invalid parent ID")
+		}
+	}
+
+	return nil
+}
+
+func ValidateReorderChecklistItemsRequest(req *ReorderChecklistItemsRequest) error {
+	if len(req.ItemIDs) == 0 {
+		return errors.New("item_ids is required")
+	}
+
+	if len(req.ItemIDs) > MaxChecklistItems {
+		return fmt.Errorf("cannot reorder more than %d items", MaxChecklistItems)
+	}
+
+	// Compared parsed, since the same ID can be written in either case
+	seen := make(map[uuid.UUID]bool, len(req.ItemIDs))
+	for i := range req.ItemIDs {
+		req.ItemIDs[i] = strings.TrimSpace(req.ItemIDs[i])
+		id := req.ItemIDs[i]
+		parsed, err := uuid.Parse(id)
+		if err != nil {
+			return errors.New("invalid item ID: " + id)
+		}
+		if seen[parsed] {
+			return errors.New("duplicate item ID: " + id)
+		}
+		seen[parsed] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package validators
+
+import (
+	"errors"
+	"strings"
+)
+
+type AddCollaboratorRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role,omitempty" validate:"omitempty,oneof=viewer editor"`
+}
+
+func ValidateAddCollaboratorRequest(req *AddCollaboratorRequest) error {
+	req.Email = strings.TrimSpace(req.Email)
+	if err := validateEmail(req.Email); err != nil {
+		return err
+	}
+
+	if req.Role == "" {
+		req.Role = "viewer"
+	}
+
+	if req.Role != "viewer" && req.Role != "editor" {
+		return errors.New("role must be either viewer or editor")
+	}
+
+	return nil
+}
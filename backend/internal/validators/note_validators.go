@@ -2,15 +2,20 @@ package validators
 
 import (
 	"errors"
+	"fmt"
 	"regexp"
 	"strings"
+
+	"google-keep-clone/internal/pagination"
 )
 
 type CreateNoteRequest struct {
-	Title    string `json:"title"`
-	Content  string `json:"content"`
-	Color    string `json:"color"`
-	IsPinned *bool  `json:"is_pinned"`
+	Title               string               `json:"title"`
+	Content             string               `json:"content"`
+	Color               string               `json:"color"`
+	IsPinned            *bool                `json:"is_pinned"`
+	Items               []ChecklistItemInput `json:"items,omitempty"`
+	MoveCheckedToBottom *bool                `json:"move_checked_to_bottom,omitempty"`
 }
 
 type UpdateNoteRequest struct {
@@ -20,6 +25,11 @@ type UpdateNoteRequest struct {
 	IsPinned   *bool   `json:"is_pinned"`
 	IsArchived *bool   `json:"is_archived"`
 	Position   *int    `json:"position"`
+	// Items replaces the whole checklist when provided
+	Items               *[]ChecklistItemInput `json:"items,omitempty"`
+	MoveCheckedToBottom *bool                 `json:"move_checked_to_bottom,omitempty"`
+	// ExpectedVersion makes the update fail if the note has changed since
+	ExpectedVersion *int64 `json:"expected_version,omitempty"`
 }
 
 type ColorUpdateRequest struct {
@@ -27,9 +37,21 @@ type ColorUpdateRequest struct {
 }
 
 type SearchRequest struct {
-	Query string `json:"query"`
-	Limit int    `json:"limit"`
-	Page  int    `json:"page"`
+	Query     string  `json:"query"`
+	Limit     int     `json:"limit"`
+	Page      int     `json:"page"`
+	Fuzzy     bool    `json:"fuzzy"`
+	Threshold float64 `json:"threshold"` // trigram similarity for fuzzy search, 0 for the default
+}
+
+// ListNotesRequest asks for a page of a note listing. Order is asc or desc;
+// when empty the sort field's natural direction is used.
+type ListNotesRequest struct {
+	Cursor    string `json:"cursor"`
+	Limit     int    `json:"limit"`
+	Sort      string `json:"sort"`
+	Order     string `json:"order"`
+	WithTotal bool   `json:"with_total"`
 }
 
 type AdvancedSearchRequest struct {
@@ -40,11 +62,17 @@ type AdvancedSearchRequest struct {
 }
 
 func ValidateCreateNoteRequest(req *CreateNoteRequest) error {
-	// At least title or content must be provided
-	if strings.TrimSpace(req.Title) == "" && strings.TrimSpace(req.Content) == "" {
-		return errors.New("either title or content must be provided")
+	// At least title, content or checklist items must be provided
+	if strings.TrimSpace(req.Title) == "" && strings.TrimSpace(req.Content) == "" && len(req.Items) == 0 {
+		return errors.New("either title, content or items must be provided")
 	}
 
+	return ValidateNoteFields(req)
+}
+
+// ValidateNoteFields checks the limits on a new note's fields without
+// requiring any of them, for notes that may hold nothing but attachments
+func ValidateNoteFields(req *CreateNoteRequest) error {
 	// Validate title length
 	if len(req.Title) > 255 {
 		return errors.New("title must be less than 255 characters")
@@ -62,6 +90,10 @@ func ValidateCreateNoteRequest(req *CreateNoteRequest) error {
 		}
 	}
 
+	if err := ValidateChecklistItems(req.Items); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -88,6 +120,16 @@ func ValidateUpdateNoteRequest(req *UpdateNoteRequest) error {
 		return errors.New("position must be non-negative")
 	}
 
+	if req.Items != nil {
+		if err := ValidateChecklistItems(*req.Items); err != nil {
+			return err
+		}
+	}
+
+	if req.ExpectedVersion != nil && *req.ExpectedVersion < 1 {
+		return errors.New("expected_version must be positive")
+	}
+
 	return nil
 }
 
@@ -96,9 +138,9 @@ func ValidateColorUpdateRequest(req *ColorUpdateRequest) error {
 }
 
 func ValidateSearchRequest(req *SearchRequest) error {
-	// Validate query length
-	if len(req.Query) > 100 {
-		return errors.New("search query must be less than 100 characters")
+	// Validate query length; filters make queries longer than plain text
+	if len(req.Query) > 500 {
+		return errors.New("search query must be less than 500 characters")
 	}
 
 	// Validate limit
@@ -111,6 +153,27 @@ func ValidateSearchRequest(req *SearchRequest) error {
 		return errors.New("page must be non-negative")
 	}
 
+	// Validate similarity threshold
+	if req.Threshold < 0 || req.Threshold > 1 {
+		return errors.New("threshold must be between 0 and 1")
+	}
+
+	return nil
+}
+
+func ValidateListNotesRequest(req *ListNotesRequest) error {
+	if req.Limit < 0 || req.Limit > pagination.MaxLimit {
+		return fmt.Errorf("limit must be between 0 and %d", pagination.MaxLimit)
+	}
+
+	if req.Sort != "" && !pagination.IsSortField(req.Sort) {
+		return errors.New("sort must be one of updated_at, created_at, title or position")
+	}
+
+	if req.Order != "" && req.Order != "asc" && req.Order != "desc" {
+		return errors.New("order must be asc or desc")
+	}
+
 	return nil
 }
 
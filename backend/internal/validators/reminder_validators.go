@@ -0,0 +1,78 @@
+package validators
+
+import (
+	"errors"
+	"time"
+
+	"google-keep-clone/internal/recurrence"
+)
+
+type CreateReminderRequest struct {
+	FireAt     time.Time `json:"fire_at"`
+	TimeZone   string    `json:"time_zone,omitempty"`
+	Recurrence string    `json:"recurrence,omitempty"`
+}
+
+type UpdateReminderRequest struct {
+	FireAt     *time.Time `json:"fire_at,omitempty"`
+	TimeZone   *string    `json:"time_zone,omitempty"`
+	Recurrence *string    `json:"recurrence,omitempty"`
+}
+
+func ValidateCreateReminderRequest(req *CreateReminderRequest) error {
+	if req.FireAt.IsZero() {
+		return errors.New("fire_at is required")
+	}
+
+	if req.FireAt.Before(time.Now().Add(-time.Minute)) {
+		return errors.New("fire_at must be in the future")
+	}
+
+	if err := validateTimeZone(req.TimeZone); err != nil {
+		return err
+	}
+
+	return validateRecurrence(req.Recurrence)
+}
+
+func ValidateUpdateReminderRequest(req *UpdateReminderRequest) error {
+	if req.FireAt != nil && req.FireAt.Before(time.Now().Add(-time.Minute)) {
+		return errors.New("fire_at must be in the future")
+	}
+
+	if req.TimeZone != nil {
+		if err := validateTimeZone(*req.TimeZone); err != nil {
+			return err
+		}
+	}
+
+	if req.Recurrence != nil {
+		return validateRecurrence(*req.Recurrence)
+	}
+
+	return nil
+}
+
+func validateTimeZone(tz string) error {
+	if tz == "" {
+		return nil // Defaults to UTC
+	}
+
+	if _, err := time.LoadLocation(tz); err != nil {
+		return errors.New("invalid time zone: " + tz)
+	}
+
+	return nil
+}
+
+func validateRecurrence(rule string) error {
+	if rule == "" {
+		return nil // One-off reminder
+	}
+
+	if _, err := recurrence.Parse(rule); err != nil {
+		return errors.New("invalid recurrence: " + err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package validators
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Mutation operations a client can queue while offline
+const (
+	PushCreate = "create"
+	PushUpdate = "update"
+	PushDelete = "delete" // moves the note to the trash
+)
+
+const MaxPushMutations = 100
+
+type PushRequest struct {
+	Mutations []PushMutation `json:"mutations"`
+}
+
+// PushMutation is one queued change. Create takes Note; update takes
+// Changes; update and delete take NoteID and, to detect conflicts, the
+// version the change was made against.
+type PushMutation struct {
+	ClientID        string             `json:"client_id,omitempty"` // echoed back to match results up
+	Op              string             `json:"op"`
+	NoteID          string             `json:"note_id,omitempty"`
+	ExpectedVersion *int64             `json:"expected_version,omitempty"`
+	Note            *CreateNoteRequest `json:"note,omitempty"`
+	Changes         *UpdateNoteRequest `json:"changes,omitempty"`
+}
+
+func ValidatePushRequest(req *PushRequest) error {
+	if len(req.Mutations) == 0 {
+		return errors.New("mutations are required")
+	}
+
+	if len(req.Mutations) > MaxPushMutations {
+		return fmt.Errorf("cannot push more than %d mutations at once", MaxPushMutations)
+	}
+
+	return nil
+}
+
+// ValidatePushMutation checks a single mutation; a bad one is rejected on
+// its own without failing the rest of the batch
+func ValidatePushMutation(m *PushMutation) error {
+	if m.ExpectedVersion != nil && *m.ExpectedVersion < 1 {
+		return errors.New("expected_version must be positive")
+	}
+
+	switch m.Op {
+	case PushCreate:
+		if m.Note == nil {
+			return errors.New("note is required to create a note")
+		}
+		return ValidateCreateNoteRequest(m.Note)
+	case PushUpdate:
+		if _, err := uuid.Parse(m.NoteID); err != nil {
+			return errors.New("invalid note ID")
+		}
+		if m.Changes == nil {
+			return errors.New("changes are required to update a note")
+		}
+		return ValidateUpdateNoteRequest(m.Changes)
+	case PushDelete:
+		if _, err := uuid.Parse(m.NoteID); err != nil {
+			return errors.New("invalid note ID")
+		}
+		return nil
+	default:
+		return errors.New("op must be create, update or delete")
+	}
+}
@@ -0,0 +1,88 @@
+package validators
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type CreateViewRequest struct {
+	Name     string                `json:"name" validate:"required,min=1,max=50"`
+	Filters  AdvancedSearchRequest `json:"filters"`
+	Icon     string                `json:"icon,omitempty" validate:"omitempty,max=50"`
+	Position *int                  `json:"position,omitempty"`
+}
+
+type UpdateViewRequest struct {
+	Name     *string                `json:"name,omitempty" validate:"omitempty,min=1,max=50"`
+	Filters  *AdvancedSearchRequest `json:"filters,omitempty"`
+	Icon     *string                `json:"icon,omitempty" validate:"omitempty,max=50"`
+	Position *int                   `json:"position,omitempty"`
+}
+
+func ValidateCreateViewRequest(req *CreateViewRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if len(req.Name) > 50 {
+		return errors.New("name cannot exceed 50 characters")
+	}
+
+	if len(req.Icon) > 50 {
+		return errors.New("icon cannot exceed 50 characters")
+	}
+
+	if req.Position != nil && *req.Position < 0 {
+		return errors.New("position must be non-negative")
+	}
+
+	return validateViewFilters(&req.Filters)
+}
+
+func ValidateUpdateViewRequest(req *UpdateViewRequest) error {
+	if req.Name == nil && req.Filters == nil && req.Icon == nil && req.Position == nil {
+		return errors.New("nothing to update")
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return errors.New("name cannot be empty")
+		}
+		if len(name) > 50 {
+			return errors.New("name cannot exceed 50 characters")
+		}
+		*req.Name = name
+	}
+
+	if req.Icon != nil && len(*req.Icon) > 50 {
+		return errors.New("icon cannot exceed 50 characters")
+	}
+
+	if req.Position != nil && *req.Position < 0 {
+		return errors.New("position must be non-negative")
+	}
+
+	if req.Filters != nil {
+		return validateViewFilters(req.Filters)
+	}
+
+	return nil
+}
+
+func validateViewFilters(filters *AdvancedSearchRequest) error {
+	if err := ValidateAdvancedSearchRequest(filters); err != nil {
+		return err
+	}
+
+	for _, labelID := range filters.LabelIDs {
+		if _, err := uuid.Parse(labelID); err != nil {
+			return errors.New("invalid label ID: " + labelID)
+		}
+	}
+
+	return nil
+}
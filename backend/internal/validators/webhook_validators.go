@@ -0,0 +1,117 @@
+package validators
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+
+	"google-keep-clone/internal/events"
+)
+
+// AllEvents subscribes a webhook to every event
+const AllEvents = "*"
+
+type CreateWebhookRequest struct {
+	URL         string   `json:"url" validate:"required,url,max=2048"`
+	Description string   `json:"description,omitempty" validate:"omitempty,max=200"`
+	Events      []string `json:"events" validate:"required,min=1"`
+	Active      *bool    `json:"active,omitempty"`
+}
+
+type UpdateWebhookRequest struct {
+	URL         *string   `json:"url,omitempty" validate:"omitempty,url,max=2048"`
+	Description *string   `json:"description,omitempty" validate:"omitempty,max=200"`
+	Events      *[]string `json:"events,omitempty" validate:"omitempty,min=1"`
+	Active      *bool     `json:"active,omitempty"`
+}
+
+func ValidateCreateWebhookRequest(req *CreateWebhookRequest) error {
+	if err := validateWebhookURL(req.URL); err != nil {
+		return err
+	}
+
+	if len(req.Description) > 200 {
+		return errors.New("description cannot exceed 200 characters")
+	}
+
+	names, err := validateWebhookEvents(req.Events)
+	if err != nil {
+		return err
+	}
+	req.Events = names
+
+	return nil
+}
+
+func ValidateUpdateWebhookRequest(req *UpdateWebhookRequest) error {
+	if req.URL == nil && req.Description == nil && req.Events == nil && req.Active == nil {
+		return errors.New("nothing to update")
+	}
+
+	if req.URL != nil {
+		if err := validateWebhookURL(*req.URL); err != nil {
+			return err
+		}
+	}
+
+	if req.Description != nil && len(*req.Description) > 200 {
+		return errors.New("description cannot exceed 200 characters")
+	}
+
+	if req.Events != nil {
+		names, err := validateWebhookEvents(*req.Events)
+		if err != nil {
+			return err
+		}
+		*req.Events = names
+	}
+
+	return nil
+}
+
+func validateWebhookURL(rawURL string) error {
+	if rawURL == "" {
+		return errors.New("url is required")
+	}
+	if len(rawURL) > 2048 {
+		return errors.New("url cannot exceed 2048 characters")
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	if parsed.User != nil {
+		return errors.New("url cannot contain credentials")
+	}
+
+	return nil
+}
+
+// validateWebhookEvents checks event names such as note.created and
+// returns them without duplicates
+func validateWebhookEvents(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, errors.New("at least one event is required")
+	}
+
+	known := make(map[string]bool, len(events.Types)+1)
+	known[AllEvents] = true
+	for _, eventType := range events.Types {
+		known[eventType.Name()] = true
+	}
+
+	unique := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if !known[name] {
+			return nil, errors.New("unknown event: " + name)
+		}
+		if !slices.Contains(unique, name) {
+			unique = append(unique, name)
+		}
+	}
+
+	return unique, nil
+}
@@ -0,0 +1,69 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Broadcaster carries messages for users between the replicas of the
+// server. Every replica subscribes and delivers what it receives to the
+// clients connected to it.
+type Broadcaster interface {
+	// Publish sends a message for a user to every replica, this one included
+	Publish(userID uuid.UUID, data []byte) error
+	// Subscribe starts calling deliver with every message published
+	Subscribe(deliver func(userID uuid.UUID, data []byte)) error
+	Close() error
+}
+
+// envelope is a message on its way between replicas
+type envelope struct {
+	UserID uuid.UUID       `json:"user_id"`
+	Data   json.RawMessage `json:"data"`
+}
+
+func encodeEnvelope(userID uuid.UUID, data []byte) ([]byte, error) {
+	return json.Marshal(envelope{UserID: userID, Data: data})
+}
+
+func decodeEnvelope(payload []byte) (uuid.UUID, []byte, error) {
+	var env envelope
+	if err := json.Unmarshal(payload, &env); err != nil {
+		return uuid.Nil, nil, err
+	}
+	return env.UserID, env.Data, nil
+}
+
+// MemoryBroadcaster delivers within the process, for a single replica
+type MemoryBroadcaster struct {
+	mutex   sync.RWMutex
+	deliver func(userID uuid.UUID, data []byte)
+}
+
+func NewMemoryBroadcaster() *MemoryBroadcaster {
+	return &MemoryBroadcaster{}
+}
+
+func (b *MemoryBroadcaster) Publish(userID uuid.UUID, data []byte) error {
+	b.mutex.RLock()
+	deliver := b.deliver
+	b.mutex.RUnlock()
+
+	if deliver != nil {
+		deliver(userID, data)
+	}
+	return nil
+}
+
+func (b *MemoryBroadcaster) Subscribe(deliver func(userID uuid.UUID, data []byte)) error {
+	b.mutex.Lock()
+	b.deliver = deliver
+	b.mutex.Unlock()
+	return nil
+}
+
+func (b *MemoryBroadcaster) Close() error {
+	return nil
+}
@@ -0,0 +1,152 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TestRedisBroadcaster runs when REDIS_TEST_URL is set, e.g.
+//
+//	docker run -p 6379:6379 redis
+//	REDIS_TEST_URL=redis://localhost:6379/0 go test ./internal/websocket
+func TestRedisBroadcaster(t *testing.T) {
+	url := os.Getenv("REDIS_TEST_URL")
+	if url == "" {
+		t.Skip("REDIS_TEST_URL not set")
+	}
+
+	replicas := make([]Broadcaster, 2)
+	for i := range replicas {
+		broadcaster, err := NewRedisBroadcaster(context.Background(), url)
+		if err != nil {
+			t.Fatalf("connecting to %s: %v", url, err)
+		}
+		t.Cleanup(func() { _ = broadcaster.Close() })
+		replicas[i] = broadcaster
+	}
+
+	testReplicas(t, replicas[0], replicas[1], "hello")
+}
+
+// TestPostgresBroadcaster runs when TEST_DATABASE_URL is set. Besides
+// messages that fit in a notification, it sends one too large for one,
+// which has to go through ws_broadcasts.
+func TestPostgresBroadcaster(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	replicas := make([]Broadcaster, 2)
+	for i := range replicas {
+		broadcaster, err := NewPostgresBroadcaster(context.Background(), url)
+		if err != nil {
+			t.Fatalf("connecting to the test database: %v", err)
+		}
+		t.Cleanup(func() { _ = broadcaster.Close() })
+		replicas[i] = broadcaster
+	}
+
+	testReplicas(t, replicas[0], replicas[1], "hello")
+
+	large := uuid.NewString() + strings.Repeat("x", 2*maxNotifyPayload)
+	testReplicas(t, replicas[0], replicas[1], large)
+
+	pool, err := pgxpool.New(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	var stored int
+	err = pool.QueryRow(context.Background(), `SELECT count(*) FROM ws_broadcasts WHERE payload LIKE '%' || $1 || '%'`, large[:36]).Scan(&stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// testReplicas sends it once from each hub
+	if stored != 2 {
+		t.Errorf("large message stored %d times in ws_broadcasts; want 2", stored)
+	}
+}
+
+// testReplicas runs a hub on each broadcaster and checks that a message
+// sent from either reaches a client connected to the other
+func testReplicas(t *testing.T, a, b Broadcaster, text string) {
+	t.Helper()
+
+	hubA, hubB := NewHub(a), NewHub(b)
+	go hubA.Run()
+	go hubB.Run()
+
+	userID := uuid.New()
+	clientA := connectTestClient(t, hubA, userID)
+	clientB := connectTestClient(t, hubB, userID)
+
+	hubA.BroadcastToUser(userID, "note_updated", map[string]string{"text": text})
+	for _, c := range []*Client{clientA, clientB} {
+		if got := receiveText(t, c); got != text {
+			t.Errorf("received %.40q; want %.40q", got, text)
+		}
+	}
+
+	hubB.BroadcastToUser(userID, "note_updated", map[string]string{"text": text})
+	if got := receiveText(t, clientA); got != text {
+		t.Errorf("hub A received %.40q from hub B; want %.40q", got, text)
+	}
+}
+
+// newTestClient makes a client without a connection; the hub queues its
+// messages on send as usual and nothing reads them unless the test does
+func newTestClient(h *Hub, userID uuid.UUID, buffer int) *Client {
+	return &Client{
+		hub:     h,
+		send:    make(chan []byte, buffer),
+		done:    make(chan struct{}),
+		userID:  userID,
+		editing: make(map[uuid.UUID]bool),
+	}
+}
+
+// connectTestClient registers a client and reads its session message
+func connectTestClient(t *testing.T, h *Hub, userID uuid.UUID) *Client {
+	t.Helper()
+	c := newTestClient(h, userID, sendBufferSize)
+	h.register <- c
+	if msg := receive(t, c); msg.Type != "session" {
+		t.Fatalf("first message is %s; want session", msg.Type)
+	}
+	return c
+}
+
+func receive(t *testing.T, c *Client) publishedMessage {
+	t.Helper()
+	select {
+	case data := <-c.send:
+		var msg publishedMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("decoding %s: %v", data, err)
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message within 5s")
+		return publishedMessage{}
+	}
+}
+
+func receiveText(t *testing.T, c *Client) string {
+	t.Helper()
+	var payload struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(receive(t, c).Payload, &payload); err != nil {
+		t.Fatal(err)
+	}
+	return payload.Text
+}
@@ -0,0 +1,168 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/google/uuid"
+)
+
+const (
+	// Time allowed to write a message to the client
+	writeWait = 10 * time.Second
+	// Time allowed between pongs before the connection is considered dead
+	pongWait = 60 * time.Second
+	// Pings go out a little more often than pongWait
+	pingPeriod = pongWait * 9 / 10
+	// Large enough for a full batch of edit ops
+	maxMessageSize = 512 << 10
+	// Messages queued for a client before it is dropped as too slow
+	sendBufferSize = 256
+)
+
+// Client is one websocket connection. Messages for it are queued on send,
+// which is never closed; done is closed by the hub when the client is torn
+// down, and stops the write pump.
+type Client struct {
+	hub    *Hub
+	conn   *websocket.Conn
+	send   chan []byte
+	done   chan struct{}
+	userID uuid.UUID
+	// The login session the connection was authenticated with; revoking
+	// it disconnects the client
+	sessionID uuid.UUID
+
+	resumeFrom string             // seq of the last event seen before reconnecting
+	editing    map[uuid.UUID]bool // notes joined for live editing; read pump only
+}
+
+// queue hands a message to the write pump without blocking. A client whose
+// buffer is full is evicted. It reports whether the message was queued.
+func (c *Client) queue(data []byte) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	select {
+	case c.send <- data:
+		return true
+	default:
+		c.hub.evict(c)
+		return false
+	}
+}
+
+func (c *Client) sendMessage(messageType string, payload interface{}) {
+	data, err := json.Marshal(Message{Type: messageType, Payload: payload})
+	if err != nil {
+		log.Printf("Error marshaling message: %v", err)
+		return
+	}
+	c.queue(data)
+}
+
+func (c *Client) readPump() {
+	defer func() {
+		for noteID := range c.editing {
+			c.hub.leaveDocument(c, noteID)
+		}
+		c.hub.unregister <- c
+	}()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, message, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("Error reading from client %v: %v", c.userID, err)
+			}
+			return
+		}
+
+		var msg inboundMessage
+		if err := json.Unmarshal(message, &msg); err != nil {
+			log.Printf("Error unmarshaling message: %v", err)
+			continue
+		}
+
+		switch msg.Type {
+		case "ping":
+			c.queue([]byte(`{"type":"pong"}`))
+		case "edit_join", "edit_leave", "edit_ops":
+			c.handleEdit(&msg)
+		default:
+			c.sendMessage("error", map[string]string{"error": "unknown message type " + msg.Type})
+		}
+	}
+}
+
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		_ = c.conn.Close()
+	}()
+
+	for {
+		select {
+		case message := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				c.hub.evict(c)
+				return
+			}
+
+		case <-ticker.C:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.hub.evict(c)
+				return
+			}
+
+		case <-c.done:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			_ = c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return
+		}
+	}
+}
+
+// HandleWebSocket serves a client's connection until it closes, or until
+// sessionID is revoked. resumeFrom is the seq of the last event the client
+// saw on an earlier connection, or empty for a fresh start.
+func (h *Hub) HandleWebSocket(c *websocket.Conn, userID, sessionID uuid.UUID, resumeFrom string) {
+	client := &Client{
+		hub:       h,
+		conn:      c,
+		send:      make(chan []byte, sendBufferSize),
+		done:      make(chan struct{}),
+		userID:    userID,
+		sessionID: sessionID,
+
+		resumeFrom: resumeFrom,
+		editing:    make(map[uuid.UUID]bool),
+	}
+
+	h.register <- client
+
+	written := make(chan struct{})
+	go func() {
+		client.writePump()
+		close(written)
+	}()
+
+	// The connection is released once the handler returns, so read on its
+	// goroutine until the client goes away, then wait for the writer
+	client.readPump()
+	<-written
+}
@@ -0,0 +1,424 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"google-keep-clone/internal/crdt"
+)
+
+const (
+	// How often edited documents are written back to their notes
+	documentSaveInterval = 3 * time.Second
+	// Matches the content limit of the notes API
+	maxDocumentLength = 10000
+	maxOpsPerMessage  = 1000
+	// Deleted characters stay in the sequence as tombstones, so its size
+	// is capped separately from the text's length
+	maxDocumentElements = 5 * maxDocumentLength
+	// Tombstones a document may gather before it is rebuilt from its text
+	compactTombstones = 1000
+)
+
+// ErrDocumentNotFound is returned by a DocumentStore for a note that
+// doesn't exist or that the user may not edit
+var ErrDocumentNotFound = errors.New("note not found")
+
+// DocumentStore loads and saves the content of notes being edited live
+type DocumentStore interface {
+	// LoadDocument returns the content and version of a note userID may edit
+	LoadDocument(noteID, userID uuid.UUID) (string, int64, error)
+	// SaveDocument writes content to the note as userID if the note is
+	// still at version, returning the new version. It reports false when
+	// the note was changed by other means in the meantime.
+	SaveDocument(noteID, userID uuid.UUID, content string, version int64) (int64, bool, error)
+}
+
+// document is a note's content while someone has it open for editing. The
+// sequence is saved back to the note every documentSaveInterval and when
+// the last session leaves. Each server keeps its own; edits made on
+// different servers meet when they are saved, each merging the others'.
+type document struct {
+	mutex    sync.Mutex
+	noteID   uuid.UUID
+	seq      *crdt.Sequence
+	site     string             // the server's own site, for merging outside changes
+	sessions map[*Client]string // site of each client editing
+	dirty    bool
+	editor   uuid.UUID // last user to edit who still may; saves are made as them
+
+	// The note as last loaded or saved, and the IDs of its characters
+	version  int64
+	savedIDs []crdt.ID
+	saved    []rune
+}
+
+type editRequest struct {
+	NoteID uuid.UUID `json:"note_id"`
+	Ops    []crdt.Op `json:"ops,omitempty"`
+}
+
+type editSnapshot struct {
+	NoteID   uuid.UUID      `json:"note_id"`
+	Site     string         `json:"site"` // the site this client's inserts must use
+	Version  int64          `json:"version"`
+	Clock    uint64         `json:"clock"`
+	Elements []crdt.Element `json:"elements"`
+}
+
+type editOps struct {
+	NoteID uuid.UUID `json:"note_id"`
+	UserID uuid.UUID `json:"user_id,omitempty"` // who made them; empty for merged outside changes
+	Ops    []crdt.Op `json:"ops"`
+}
+
+type editAck struct {
+	NoteID  uuid.UUID `json:"note_id"`
+	Applied int       `json:"applied"`
+}
+
+// editError tells a client its edit was refused. Ops before the failing one
+// were applied; the client should rejoin to get back in step.
+type editError struct {
+	NoteID uuid.UUID `json:"note_id"`
+	Error  string    `json:"error"`
+}
+
+// SetDocumentStore enables live editing, loading and saving notes through
+// store
+func (h *Hub) SetDocumentStore(store DocumentStore) {
+	h.store = store
+}
+
+// handleEdit serves the live editing messages:
+//
+//	edit_join  {note_id}       replied to with edit_snapshot: the note's
+//	                           characters with their IDs, the clock so far
+//	                           and the site the client's inserts must use
+//	edit_ops   {note_id, ops}  replied to with edit_ack; the ops that changed
+//	                           the note go to the other sessions as edit_ops,
+//	                           each with the index it took effect at
+//	edit_leave {note_id}
+//
+// Any refusal is an edit_error. A session editing a note alone may also be
+// sent an edit_snapshot unasked, when the document is rebuilt without its
+// tombstones; the client starts over from it, and ops it sent before are
+// refused.
+func (c *Client) handleEdit(msg *inboundMessage) {
+	var req editRequest
+	if err := json.Unmarshal(msg.Payload, &req); err != nil || req.NoteID == uuid.Nil {
+		c.sendMessage("edit_error", editError{NoteID: req.NoteID, Error: "invalid payload"})
+		return
+	}
+
+	if c.hub.store == nil {
+		c.sendMessage("edit_error", editError{NoteID: req.NoteID, Error: "live editing is not available"})
+		return
+	}
+
+	switch msg.Type {
+	case "edit_join":
+		if err := c.hub.joinDocument(c, req.NoteID); err != nil {
+			c.sendMessage("edit_error", editError{NoteID: req.NoteID, Error: err.Error()})
+			return
+		}
+		c.editing[req.NoteID] = true
+	case "edit_leave":
+		c.hub.leaveDocument(c, req.NoteID)
+		delete(c.editing, req.NoteID)
+	case "edit_ops":
+		applied, err := c.hub.applyEdits(c, req.NoteID, req.Ops)
+		if err != nil {
+			c.sendMessage("edit_error", editError{NoteID: req.NoteID, Error: err.Error()})
+			return
+		}
+		c.sendMessage("edit_ack", editAck{NoteID: req.NoteID, Applied: applied})
+	}
+}
+
+// joinDocument opens a note for editing by c and sends it a snapshot to
+// edit from
+func (h *Hub) joinDocument(c *Client, noteID uuid.UUID) error {
+	content, version, err := h.store.LoadDocument(noteID, c.userID)
+	if err != nil {
+		return errors.New("note not found")
+	}
+
+	h.documentsMutex.Lock()
+	doc, ok := h.documents[noteID]
+	if !ok {
+		doc = newDocument(noteID, content, version)
+		h.documents[noteID] = doc
+	}
+	doc.mutex.Lock()
+	h.documentsMutex.Unlock()
+	defer doc.mutex.Unlock()
+
+	h.sendSnapshot(doc, c)
+	return nil
+}
+
+// sendSnapshot gives c a new site and sends it the document to edit from.
+// It is queued under doc.mutex, which the caller holds, so no ops reach the
+// client before it.
+func (h *Hub) sendSnapshot(doc *document, c *Client) {
+	site := uuid.NewString()
+	doc.sessions[c] = site
+
+	h.sendToSession(doc, c, "edit_snapshot", editSnapshot{
+		NoteID:   doc.noteID,
+		Site:     site,
+		Version:  doc.version,
+		Clock:    doc.seq.Clock(),
+		Elements: doc.seq.Elements(),
+	})
+}
+
+// leaveDocument ends c's session on a note, saving and closing the
+// document when nobody is left editing it
+func (h *Hub) leaveDocument(c *Client, noteID uuid.UUID) {
+	h.documentsMutex.Lock()
+	doc, ok := h.documents[noteID]
+	if !ok {
+		h.documentsMutex.Unlock()
+		return
+	}
+	doc.mutex.Lock()
+	defer doc.mutex.Unlock()
+
+	delete(doc.sessions, c)
+	closing := len(doc.sessions) == 0
+	if closing {
+		delete(h.documents, noteID)
+	}
+	h.documentsMutex.Unlock()
+
+	if closing {
+		h.saveDocument(doc)
+	}
+}
+
+// applyEdits merges a client's ops into the document and passes the ones
+// that changed it on to the other sessions
+func (h *Hub) applyEdits(c *Client, noteID uuid.UUID, ops []crdt.Op) (int, error) {
+	if len(ops) > maxOpsPerMessage {
+		return 0, errors.New("too many ops in one message")
+	}
+
+	h.documentsMutex.Lock()
+	doc, ok := h.documents[noteID]
+	h.documentsMutex.Unlock()
+	if !ok {
+		return 0, errors.New("join the note before editing it")
+	}
+
+	doc.mutex.Lock()
+	defer doc.mutex.Unlock()
+
+	site, ok := doc.sessions[c]
+	if !ok {
+		return 0, errors.New("join the note before editing it")
+	}
+
+	inserts := 0
+	for _, op := range ops {
+		if op.Type == crdt.OpInsert {
+			inserts++
+		}
+	}
+	if doc.seq.Len()+inserts > maxDocumentLength {
+		return 0, errors.New("note is too long")
+	}
+	if doc.seq.Size()+inserts > maxDocumentElements {
+		return 0, errors.New("note has too many edits in progress; try again once other sessions leave")
+	}
+
+	var applied []crdt.Op
+	var err error
+	for _, op := range ops {
+		if op.Type == crdt.OpInsert && op.ID.Site != site {
+			err = errors.New("inserts must use the site from edit_snapshot")
+			break
+		}
+		var changed bool
+		if changed, err = doc.seq.Apply(&op); err != nil {
+			break
+		}
+		if changed {
+			applied = append(applied, op)
+		}
+	}
+
+	if len(applied) > 0 {
+		doc.dirty = true
+		doc.editor = c.userID
+		h.sendToSessions(doc, c, "edit_ops", editOps{NoteID: noteID, UserID: c.userID, Ops: applied})
+	}
+	return len(applied), err
+}
+
+// saveDocuments writes every edited document back to its note, forever
+func (h *Hub) saveDocuments() {
+	ticker := time.NewTicker(documentSaveInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		h.documentsMutex.Lock()
+		docs := make([]*document, 0, len(h.documents))
+		for _, doc := range h.documents {
+			docs = append(docs, doc)
+		}
+		h.documentsMutex.Unlock()
+
+		for _, doc := range docs {
+			doc.mutex.Lock()
+			h.saveDocument(doc)
+			doc.mutex.Unlock()
+		}
+	}
+}
+
+// saveDocument writes the document's text to its note. If the note was
+// changed by other means since it was loaded, those changes are merged
+// into the document instead, to be saved along with it next time. The
+// caller holds doc.mutex.
+func (h *Hub) saveDocument(doc *document) {
+	if !doc.dirty {
+		return
+	}
+
+	text := doc.seq.Text()
+	version, saved, err := h.store.SaveDocument(doc.noteID, doc.editor, text, doc.version)
+	for errors.Is(err, ErrDocumentNotFound) {
+		// The editor has lost access to the note, so their sessions end and
+		// the save is made as someone else still editing
+		h.dropEditor(doc, doc.editor)
+		if !h.pickEditor(doc) {
+			log.Printf("Discarding edits to document %v: nobody editing it may save it", doc.noteID)
+			doc.dirty = false
+			return
+		}
+		version, saved, err = h.store.SaveDocument(doc.noteID, doc.editor, text, doc.version)
+	}
+	if err != nil {
+		log.Printf("Error saving document %v: %v", doc.noteID, err)
+		return
+	}
+	if saved {
+		doc.dirty = false
+		doc.version = version
+		if len(doc.sessions) <= 1 && doc.seq.Size()-doc.seq.Len() >= compactTombstones {
+			h.compactDocument(doc, text)
+		}
+		doc.savedIDs = doc.seq.VisibleIDs()
+		doc.saved = []rune(text)
+		return
+	}
+
+	content, version, err := h.store.LoadDocument(doc.noteID, doc.editor)
+	if err != nil {
+		log.Printf("Error reloading document %v: %v", doc.noteID, err)
+		return
+	}
+
+	ops, ids := crdt.Splice(doc.savedIDs, doc.saved, []rune(content), doc.site, doc.seq.Clock())
+	merged := make([]crdt.Op, 0, len(ops))
+	for _, op := range ops {
+		if changed, err := doc.seq.Apply(&op); err == nil && changed {
+			merged = append(merged, op)
+		}
+	}
+
+	doc.version = version
+	doc.savedIDs = ids
+	doc.saved = []rune(content)
+	if len(merged) > 0 {
+		h.sendToSessions(doc, nil, "edit_ops", editOps{NoteID: doc.noteID, Ops: merged})
+	}
+}
+
+// dropEditor ends the sessions of a user who may no longer edit the
+// document. The caller holds doc.mutex.
+func (h *Hub) dropEditor(doc *document, userID uuid.UUID) {
+	for c := range doc.sessions {
+		if c.userID == userID {
+			h.sendToSession(doc, c, "edit_error", editError{NoteID: doc.noteID, Error: ErrDocumentNotFound.Error()})
+			delete(doc.sessions, c)
+		}
+	}
+}
+
+// pickEditor makes the user of one of the remaining sessions the one saves
+// are made as. It reports false when there are none. The caller holds
+// doc.mutex.
+func (h *Hub) pickEditor(doc *document) bool {
+	for c := range doc.sessions {
+		doc.editor = c.userID
+		return true
+	}
+	return false
+}
+
+// compactDocument rebuilds the document's sequence from its text, dropping
+// its tombstones. Ops in flight may name characters that no longer exist,
+// so this is only done with at most one session, which is sent a fresh
+// snapshot to carry on from. The caller holds doc.mutex.
+func (h *Hub) compactDocument(doc *document, text string) {
+	doc.seq = crdt.FromText(text, uuid.NewString())
+	for c := range doc.sessions {
+		h.sendSnapshot(doc, c)
+	}
+}
+
+func newDocument(noteID uuid.UUID, content string, version int64) *document {
+	// A fresh site per load, so ops made against an earlier load of the
+	// note are refused rather than applied to the wrong characters
+	seq := crdt.FromText(content, uuid.NewString())
+	return &document{
+		noteID:   noteID,
+		seq:      seq,
+		site:     uuid.NewString(),
+		sessions: make(map[*Client]string),
+		version:  version,
+		savedIDs: seq.VisibleIDs(),
+		saved:    []rune(content),
+	}
+}
+
+// sendToSessions sends a message to every session on the document except
+// skip. The caller holds doc.mutex.
+func (h *Hub) sendToSessions(doc *document, skip *Client, messageType string, payload interface{}) {
+	data, err := json.Marshal(Message{Type: messageType, Payload: payload})
+	if err != nil {
+		log.Printf("Error marshaling message: %v", err)
+		return
+	}
+
+	for client := range doc.sessions {
+		if client != skip {
+			h.queueToSession(doc, client, data)
+		}
+	}
+}
+
+func (h *Hub) sendToSession(doc *document, c *Client, messageType string, payload interface{}) {
+	data, err := json.Marshal(Message{Type: messageType, Payload: payload})
+	if err != nil {
+		log.Printf("Error marshaling message: %v", err)
+		return
+	}
+	h.queueToSession(doc, c, data)
+}
+
+// queueToSession never blocks while the document is locked. A client that
+// misses a message is dropped from the document, since it has missed ops.
+func (h *Hub) queueToSession(doc *document, c *Client, data []byte) {
+	if !c.queue(data) {
+		delete(doc.sessions, c)
+	}
+}
@@ -0,0 +1,103 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"google-keep-clone/internal/crdt"
+)
+
+// memoryStore keeps notes in memory, letting only editors load and save
+// them
+type memoryStore struct {
+	mutex   sync.Mutex
+	content string
+	version int64
+	editors map[uuid.UUID]bool
+	savedBy []uuid.UUID
+}
+
+func (s *memoryStore) LoadDocument(noteID, userID uuid.UUID) (string, int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.editors[userID] {
+		return "", 0, ErrDocumentNotFound
+	}
+	return s.content, s.version, nil
+}
+
+func (s *memoryStore) SaveDocument(noteID, userID uuid.UUID, content string, version int64) (int64, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.editors[userID] {
+		return 0, false, ErrDocumentNotFound
+	}
+	if version != s.version {
+		return s.version, false, nil
+	}
+	s.content = content
+	s.version++
+	s.savedBy = append(s.savedBy, userID)
+	return s.version, true, nil
+}
+
+// TestSaveDocumentAfterEditorLosesAccess checks edits are still saved, as
+// someone else editing, once the last user to edit may no longer
+func TestSaveDocumentAfterEditorLosesAccess(t *testing.T) {
+	removed, kept := uuid.New(), uuid.New()
+	store := &memoryStore{content: "hi", version: 1, editors: map[uuid.UUID]bool{removed: true, kept: true}}
+	hub := NewHub(NewMemoryBroadcaster())
+	hub.SetDocumentStore(store)
+
+	noteID := uuid.New()
+	join := func(userID uuid.UUID) (*Client, editSnapshot) {
+		c := newTestClient(hub, userID, sendBufferSize)
+		if err := hub.joinDocument(c, noteID); err != nil {
+			t.Fatal(err)
+		}
+		msg := receive(t, c)
+		var snapshot editSnapshot
+		if err := json.Unmarshal(msg.Payload, &snapshot); err != nil || msg.Type != "edit_snapshot" {
+			t.Fatalf("got %s (%v); want edit_snapshot", msg.Type, err)
+		}
+		return c, snapshot
+	}
+	keptClient, _ := join(kept)
+	removedClient, snapshot := join(removed)
+
+	last := snapshot.Elements[len(snapshot.Elements)-1].ID
+	op := crdt.Op{Type: crdt.OpInsert, ID: crdt.ID{Site: snapshot.Site, Clock: snapshot.Clock + 1}, Origin: &last, Value: "!"}
+	if _, err := hub.applyEdits(removedClient, noteID, []crdt.Op{op}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := receive(t, keptClient); msg.Type != "edit_ops" {
+		t.Fatalf("other editor got %s; want edit_ops", msg.Type)
+	}
+
+	store.mutex.Lock()
+	delete(store.editors, removed)
+	store.mutex.Unlock()
+
+	doc := hub.documents[noteID]
+	doc.mutex.Lock()
+	hub.saveDocument(doc)
+	_, stillEditing := doc.sessions[removedClient]
+	dirty := doc.dirty
+	doc.mutex.Unlock()
+
+	if store.content != "hi!" || len(store.savedBy) != 1 || store.savedBy[0] != kept {
+		t.Errorf("saved %q by %v; want \"hi!\" by the remaining editor", store.content, store.savedBy)
+	}
+	if dirty {
+		t.Error("document still dirty after saving")
+	}
+	if stillEditing {
+		t.Error("the editor without access still has a session")
+	}
+	if msg := receive(t, removedClient); msg.Type != "edit_error" {
+		t.Errorf("removed editor got %s; want edit_error", msg.Type)
+	}
+}
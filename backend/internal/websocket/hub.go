@@ -3,72 +3,158 @@ package websocket
 import (
 	"encoding/json"
 	"log"
+	"strconv"
 	"sync"
+	"time"
 
-	"github.com/gofiber/contrib/websocket"
 	"github.com/google/uuid"
 )
 
+// Hub tracks the clients connected to this server, indexed by user. Run is
+// the only goroutine that adds or removes clients, and the only one that
+// tears a client down, so teardown happens exactly once.
+//
+// Every event sent to a user carries a seq, increasing per user. On
+// connecting, a client gets a session message with the latest seq. A
+// client that reconnects with ?resume_from=<seq> gets the events it missed
+// replayed before anything new, then a session message; if they are no
+// longer held it gets resync_required instead and should reload.
 type Hub struct {
-	clients    map[*Client]bool
-	broadcast  chan []byte
+	users      map[uuid.UUID]*stream
 	register   chan *Client
 	unregister chan *Client
 	mutex      sync.RWMutex
-}
 
-type Client struct {
-	hub    *Hub
-	conn   *websocket.Conn
-	send   chan []byte
-	userID uuid.UUID
+	// Carries BroadcastToUser messages to every replica of the server
+	broadcaster Broadcaster
+
+	// Notes open for live editing
+	store          DocumentStore
+	documents      map[uuid.UUID]*document
+	documentsMutex sync.Mutex
 }
 
 type Message struct {
 	Type    string      `json:"type"`
+	Seq     uint64      `json:"seq,omitempty"`
 	UserID  string      `json:"user_id,omitempty"`
 	Payload interface{} `json:"payload"`
 }
 
-func NewHub() *Hub {
+// inboundMessage is a message from a client, its payload left for the
+// handler of its type to decode
+type inboundMessage struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// publishedMessage is a Message as it arrives from the broadcaster
+type publishedMessage struct {
+	Type    string          `json:"type"`
+	UserID  string          `json:"user_id,omitempty"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+type sessionState struct {
+	Seq uint64 `json:"seq"`
+}
+
+// disconnectType is published to a user to tear down their clients rather
+// than be delivered to them
+const disconnectType = "disconnect"
+
+// disconnect names the session whose clients are torn down; nil for all
+// of the user's
+type disconnect struct {
+	SessionID uuid.UUID `json:"session_id"`
+}
+
+func NewHub(broadcaster Broadcaster) *Hub {
 	return &Hub{
-		clients:    make(map[*Client]bool),
-		broadcast:  make(chan []byte),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
+		broadcaster: broadcaster,
+		users:       make(map[uuid.UUID]*stream),
+		register:    make(chan *Client),
+		unregister:  make(chan *Client),
+		documents:   make(map[uuid.UUID]*document),
 	}
 }
 
 func (h *Hub) Run() {
+	if err := h.broadcaster.Subscribe(h.deliverToUser); err != nil {
+		log.Printf("Error subscribing to broadcasts: %v", err)
+	}
+	go h.saveDocuments()
+
+	prune := time.NewTicker(time.Minute)
+	defer prune.Stop()
+
 	for {
 		select {
 		case client := <-h.register:
 			h.mutex.Lock()
-			h.clients[client] = true
+			st, ok := h.users[client.userID]
+			if !ok {
+				st = newStream()
+				h.users[client.userID] = st
+			}
+			st.mutex.Lock()
+			st.clients[client] = struct{}{}
+			h.startSession(st, client)
+			st.mutex.Unlock()
 			h.mutex.Unlock()
 			log.Printf("Client connected: %v", client.userID)
 
 		case client := <-h.unregister:
 			h.mutex.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-			}
-			h.mutex.Unlock()
-			log.Printf("Client disconnected: %v", client.userID)
-
-		case message := <-h.broadcast:
-			h.mutex.RLock()
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
+			if st, ok := h.users[client.userID]; ok {
+				st.mutex.Lock()
+				if _, ok := st.clients[client]; ok {
+					delete(st.clients, client)
+					if len(st.clients) == 0 {
+						st.idleSince = time.Now()
+					}
+					close(client.done)
+					log.Printf("Client disconnected: %v", client.userID)
 				}
+				st.mutex.Unlock()
 			}
-			h.mutex.RUnlock()
+			h.mutex.Unlock()
+
+		case <-prune.C:
+			h.pruneStreams()
+		}
+	}
+}
+
+// startSession catches a new client up: the events it missed if it is
+// resuming, and the seq to resume from next time. The caller holds
+// st.mutex, so nothing newer is queued ahead of these.
+func (h *Hub) startSession(st *stream, c *Client) {
+	if c.resumeFrom != "" {
+		seq, err := strconv.ParseUint(c.resumeFrom, 10, 64)
+		events, ok := st.since(seq)
+		if err != nil || !ok {
+			c.sendMessage("resync_required", sessionState{Seq: st.last()})
+			return
 		}
+		for _, data := range events {
+			c.queue(data)
+		}
+	}
+	c.sendMessage("session", sessionState{Seq: st.last()})
+}
+
+// pruneStreams forgets the events of users who left a while ago
+func (h *Hub) pruneStreams() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for userID, st := range h.users {
+		st.mutex.Lock()
+		if len(st.clients) == 0 && time.Since(st.idleSince) > streamRetention {
+			delete(h.users, userID)
+		}
+		st.mutex.Unlock()
 	}
 }
 
@@ -85,75 +171,84 @@ func (h *Hub) BroadcastToUser(userID uuid.UUID, messageType string, payload inte
 		return
 	}
 
-	h.mutex.RLock()
-	for client := range h.clients {
-		if client.userID == userID {
-			select {
-			case client.send <- data:
-			default:
-				close(client.send)
-				delete(h.clients, client)
-			}
-		}
+	if err := h.broadcaster.Publish(userID, data); err != nil {
+		// Other servers miss out, but this one's clients still get it
+		log.Printf("Error publishing message: %v", err)
+		h.deliverToUser(userID, data)
 	}
-	h.mutex.RUnlock()
 }
 
-func (c *Client) readPump() {
-	defer func() {
-		c.hub.unregister <- c
-		_ = c.conn.Close()
-	}()
+// DisconnectSession tears down the user's clients authenticated with a
+// session, on every replica, once the session is revoked
+func (h *Hub) DisconnectSession(userID, sessionID uuid.UUID) {
+	h.BroadcastToUser(userID, disconnectType, disconnect{SessionID: sessionID})
+}
 
-	for {
-		_, message, err := c.conn.ReadMessage()
-		if err != nil {
-			break
-		}
+// DisconnectUser tears down every client of the user, on every replica
+func (h *Hub) DisconnectUser(userID uuid.UUID) {
+	h.BroadcastToUser(userID, disconnectType, disconnect{})
+}
 
-		var msg Message
-		if err := json.Unmarshal(message, &msg); err != nil {
-			log.Printf("Error unmarshaling message: %v", err)
-			continue
-		}
+// deliverToUser numbers a published message and sends it to the user's
+// clients connected to this server. Users who haven't connected here
+// recently have no stream, and their messages are dropped.
+func (h *Hub) deliverToUser(userID uuid.UUID, data []byte) {
+	h.mutex.RLock()
+	st, ok := h.users[userID]
+	h.mutex.RUnlock()
+	if !ok {
+		return
+	}
 
-		// Handle different message types here
-		switch msg.Type {
-		case "ping":
-			c.send <- []byte(`{"type":"pong"}`)
-		}
+	var published publishedMessage
+	if err := json.Unmarshal(data, &published); err != nil {
+		log.Printf("Error unmarshaling message: %v", err)
+		return
 	}
-}
 
-func (c *Client) writePump() {
-	defer func() { _ = c.conn.Close() }()
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
 
-	//nolint:staticcheck // This is the correct pattern for WebSocket pumps
-	for {
-		select {
-		case message, ok := <-c.send:
-			if !ok {
-				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
+	if published.Type == disconnectType {
+		h.disconnect(st, published.Payload)
+		return
+	}
 
-			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
-				return
-			}
-		}
+	data, err := json.Marshal(Message{
+		Type:    published.Type,
+		Seq:     st.next,
+		UserID:  published.UserID,
+		Payload: published.Payload,
+	})
+	if err != nil {
+		log.Printf("Error marshaling message: %v", err)
+		return
+	}
+	st.append(data)
+
+	for client := range st.clients {
+		client.queue(data)
 	}
 }
 
-func (h *Hub) HandleWebSocket(c *websocket.Conn, userID uuid.UUID) {
-	client := &Client{
-		hub:    h,
-		conn:   c,
-		send:   make(chan []byte, 256),
-		userID: userID,
+// disconnect evicts the clients a disconnect message names. The caller
+// holds st.mutex.
+func (h *Hub) disconnect(st *stream, payload json.RawMessage) {
+	var target disconnect
+	if err := json.Unmarshal(payload, &target); err != nil {
+		log.Printf("Error unmarshaling message: %v", err)
+		return
 	}
 
-	client.hub.register <- client
+	for client := range st.clients {
+		if target.SessionID == uuid.Nil || client.sessionID == target.SessionID {
+			h.evict(client)
+		}
+	}
+}
 
-	go client.writePump()
-	go client.readPump()
+// evict tears down a client that can't keep up. It never blocks, so it is
+// safe to call with locks held.
+func (h *Hub) evict(c *Client) {
+	go func() { h.unregister <- c }()
 }
@@ -0,0 +1,205 @@
+package websocket
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMain(m *testing.M) {
+	// The hub logs every connect and disconnect
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// TestHubStress connects, broadcasts to and tears down thousands of
+// clients at once, some leaving and some evicted, both at the same time
+// for a few. Run it with -race.
+func TestHubStress(t *testing.T) {
+	const (
+		users             = 50
+		clientsPerUser    = 40
+		messagesPerSender = 200
+	)
+
+	hub := NewHub(NewMemoryBroadcaster())
+	go hub.Run()
+
+	userIDs := make([]uuid.UUID, users)
+	for i := range userIDs {
+		userIDs[i] = uuid.New()
+	}
+
+	var clients sync.WaitGroup
+	var senders sync.WaitGroup
+	stop := make(chan struct{})
+
+	for i := 0; i < users; i++ {
+		senders.Add(1)
+		go func(userID uuid.UUID) {
+			defer senders.Done()
+			for n := 0; n < messagesPerSender; n++ {
+				hub.BroadcastToUser(userID, "note_updated", map[string]int{"n": n})
+			}
+		}(userIDs[i])
+	}
+
+	for i := 0; i < users*clientsPerUser; i++ {
+		clients.Add(1)
+		go func(i int) {
+			defer clients.Done()
+			c := newTestClient(hub, userIDs[i%users], sendBufferSize)
+			hub.register <- c
+
+			// Read until torn down, checking events arrive in order
+			drained := make(chan struct{})
+			go func() {
+				defer close(drained)
+				var last uint64
+				for {
+					select {
+					case data := <-c.send:
+						var msg Message
+						if err := json.Unmarshal(data, &msg); err != nil {
+							t.Errorf("decoding %s: %v", data, err)
+							return
+						}
+						if msg.Seq != 0 {
+							if last != 0 && msg.Seq != last+1 {
+								t.Errorf("seq %d after %d", msg.Seq, last)
+							}
+							last = msg.Seq
+						}
+					case <-c.done:
+						return
+					case <-stop:
+						return
+					}
+				}
+			}()
+
+			switch i % 3 {
+			case 0:
+				hub.unregister <- c
+			case 1:
+				hub.evict(c)
+			default:
+				hub.evict(c)
+				hub.unregister <- c
+			}
+			<-drained
+		}(i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		clients.Wait()
+		senders.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		close(stop)
+		t.Fatal("clients not torn down within 30s")
+	}
+
+	// Every client is gone, leaving each user's stream empty
+	hub.mutex.RLock()
+	defer hub.mutex.RUnlock()
+	for userID, st := range hub.users {
+		st.mutex.Lock()
+		if n := len(st.clients); n != 0 {
+			t.Errorf("user %v still has %d clients", userID, n)
+		}
+		st.mutex.Unlock()
+	}
+}
+
+// TestHubEvictsSlowConsumer checks a client that stops reading is torn
+// down once its buffer fills, while others of the same user carry on
+func TestHubEvictsSlowConsumer(t *testing.T) {
+	hub := NewHub(NewMemoryBroadcaster())
+	go hub.Run()
+
+	userID := uuid.New()
+	fast := connectTestClient(t, hub, userID)
+
+	const buffer = 4
+	slow := newTestClient(hub, userID, buffer)
+	hub.register <- slow
+
+	// Fill the slow client's buffer, then send one more
+	n := 0
+	for full := false; !full; n++ {
+		full = len(slow.send) == buffer
+		hub.BroadcastToUser(userID, "note_updated", map[string]int{"n": n})
+		if msg := receive(t, fast); msg.Type != "note_updated" {
+			t.Fatalf("fast client got %s; want note_updated", msg.Type)
+		}
+	}
+
+	select {
+	case <-slow.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow client not evicted")
+	}
+
+	select {
+	case <-fast.done:
+		t.Fatal("fast client evicted")
+	default:
+	}
+
+	hub.BroadcastToUser(userID, "note_updated", map[string]int{"n": n})
+	if msg := receive(t, fast); msg.Type != "note_updated" {
+		t.Fatalf("fast client got %s after the eviction; want note_updated", msg.Type)
+	}
+}
+
+// TestHubDisconnectSession checks revoking a session tears down only the
+// clients connected with it, and that nothing is sent to the others
+func TestHubDisconnectSession(t *testing.T) {
+	hub := NewHub(NewMemoryBroadcaster())
+	go hub.Run()
+
+	userID := uuid.New()
+	revoked, kept := uuid.New(), uuid.New()
+	clients := make([]*Client, 3)
+	for i, sessionID := range []uuid.UUID{revoked, revoked, kept} {
+		c := newTestClient(hub, userID, sendBufferSize)
+		c.sessionID = sessionID
+		hub.register <- c
+		if msg := receive(t, c); msg.Type != "session" {
+			t.Fatalf("first message is %s; want session", msg.Type)
+		}
+		clients[i] = c
+	}
+
+	hub.DisconnectSession(userID, revoked)
+	for _, c := range clients[:2] {
+		select {
+		case <-c.done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("client of the revoked session not disconnected")
+		}
+	}
+
+	hub.BroadcastToUser(userID, "note_updated", map[string]int{"n": 1})
+	if msg := receive(t, clients[2]); msg.Type != "note_updated" {
+		t.Fatalf("client of the other session got %s; want note_updated", msg.Type)
+	}
+
+	hub.DisconnectUser(userID)
+	select {
+	case <-clients[2].done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("client not disconnected with the rest of the user's")
+	}
+}
@@ -0,0 +1,170 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	postgresChannel = "keep_ws"
+	// NOTIFY payloads must stay under 8000 bytes. Larger messages are
+	// stored in postgresOverflowTable and only their ID is sent.
+	maxNotifyPayload = 7900
+	overflowPrefix   = "@"
+	overflowTTL      = time.Minute
+)
+
+const postgresOverflowTable = `CREATE UNLOGGED TABLE IF NOT EXISTS ws_broadcasts (
+	id BIGSERIAL PRIMARY KEY,
+	payload TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+// PostgresBroadcaster fans messages out to replicas through Postgres
+// LISTEN/NOTIFY, for deployments without Redis
+type PostgresBroadcaster struct {
+	pool   *pgxpool.Pool
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewPostgresBroadcaster(ctx context.Context, databaseURL string) (*PostgresBroadcaster, error) {
+	pool, err := pgxpool.New(ctx, databaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := pool.Exec(ctx, postgresOverflowTable); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	listenCtx, cancel := context.WithCancel(context.Background())
+	return &PostgresBroadcaster{pool: pool, ctx: listenCtx, cancel: cancel}, nil
+}
+
+func (b *PostgresBroadcaster) Publish(userID uuid.UUID, data []byte) error {
+	payload, err := encodeEnvelope(userID, data)
+	if err != nil {
+		return err
+	}
+
+	message := string(payload)
+	if len(payload) > maxNotifyPayload {
+		var id int64
+		if err := b.pool.QueryRow(b.ctx, `INSERT INTO ws_broadcasts (payload) VALUES ($1) RETURNING id`, message).Scan(&id); err != nil {
+			return err
+		}
+		message = overflowPrefix + strconv.FormatInt(id, 10)
+	}
+
+	_, err = b.pool.Exec(b.ctx, `SELECT pg_notify($1, $2)`, postgresChannel, message)
+	return err
+}
+
+// Subscribe listens on a connection of its own in the background,
+// reconnecting when it drops. Messages sent while disconnected are missed.
+func (b *PostgresBroadcaster) Subscribe(deliver func(userID uuid.UUID, data []byte)) error {
+	conn, err := b.listen()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		backoff := time.Second
+		for {
+			if conn != nil {
+				err := b.receive(conn, deliver)
+				conn.Release()
+				if b.ctx.Err() != nil {
+					return
+				}
+				log.Printf("Lost broadcast listener connection: %v", err)
+			}
+
+			select {
+			case <-b.ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+
+			if conn, err = b.listen(); err != nil {
+				log.Printf("Error reconnecting broadcast listener: %v", err)
+				backoff = min(backoff*2, time.Minute)
+				continue
+			}
+			backoff = time.Second
+		}
+	}()
+
+	go b.pruneOverflow()
+	return nil
+}
+
+func (b *PostgresBroadcaster) listen() (*pgxpool.Conn, error) {
+	conn, err := b.pool.Acquire(b.ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Exec(b.ctx, "LISTEN "+postgresChannel); err != nil {
+		conn.Release()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (b *PostgresBroadcaster) receive(conn *pgxpool.Conn, deliver func(userID uuid.UUID, data []byte)) error {
+	for {
+		notification, err := conn.Conn().WaitForNotification(b.ctx)
+		if err != nil {
+			return err
+		}
+
+		payload := []byte(notification.Payload)
+		if id, ok := strings.CutPrefix(notification.Payload, overflowPrefix); ok {
+			var stored string
+			if err := b.pool.QueryRow(b.ctx, `SELECT payload FROM ws_broadcasts WHERE id = $1`, id).Scan(&stored); err != nil {
+				log.Printf("Error loading broadcast %s: %v", id, err)
+				continue
+			}
+			payload = []byte(stored)
+		}
+
+		userID, data, err := decodeEnvelope(payload)
+		if err != nil {
+			log.Printf("Error decoding broadcast: %v", err)
+			continue
+		}
+		deliver(userID, data)
+	}
+}
+
+// pruneOverflow deletes stored messages every replica has had time to read
+func (b *PostgresBroadcaster) pruneOverflow() {
+	ticker := time.NewTicker(overflowTTL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := b.pool.Exec(b.ctx, `DELETE FROM ws_broadcasts WHERE created_at < now() - make_interval(secs => $1)`,
+				overflowTTL.Seconds()); err != nil {
+				log.Printf("Error pruning stored broadcasts: %v", err)
+			}
+		}
+	}
+}
+
+func (b *PostgresBroadcaster) Close() error {
+	b.cancel()
+	b.pool.Close()
+	return nil
+}
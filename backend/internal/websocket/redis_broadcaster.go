@@ -0,0 +1,72 @@
+package websocket
+
+import (
+	"context"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const redisChannel = "keep:ws"
+
+// RedisBroadcaster fans messages out to replicas through Redis pub/sub
+type RedisBroadcaster struct {
+	client *redis.Client
+	pubsub *redis.PubSub
+}
+
+func NewRedisBroadcaster(ctx context.Context, url string) (*RedisBroadcaster, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+
+	return &RedisBroadcaster{client: client}, nil
+}
+
+func (b *RedisBroadcaster) Publish(userID uuid.UUID, data []byte) error {
+	payload, err := encodeEnvelope(userID, data)
+	if err != nil {
+		return err
+	}
+	return b.client.Publish(context.Background(), redisChannel, payload).Err()
+}
+
+// Subscribe listens on the channel in the background. The client
+// resubscribes by itself after losing its connection; messages published
+// meanwhile are missed.
+func (b *RedisBroadcaster) Subscribe(deliver func(userID uuid.UUID, data []byte)) error {
+	ctx := context.Background()
+	b.pubsub = b.client.Subscribe(ctx, redisChannel)
+	// Wait for the subscription so nothing published after this returns is missed
+	if _, err := b.pubsub.Receive(ctx); err != nil {
+		_ = b.pubsub.Close()
+		return err
+	}
+
+	go func() {
+		for msg := range b.pubsub.Channel() {
+			userID, data, err := decodeEnvelope([]byte(msg.Payload))
+			if err != nil {
+				log.Printf("Error decoding broadcast: %v", err)
+				continue
+			}
+			deliver(userID, data)
+		}
+	}()
+	return nil
+}
+
+func (b *RedisBroadcaster) Close() error {
+	if b.pubsub != nil {
+		_ = b.pubsub.Close()
+	}
+	return b.client.Close()
+}
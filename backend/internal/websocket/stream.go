@@ -0,0 +1,63 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// Events kept per user for replay; less than sendBufferSize so a full
+	// replay fits in a client's queue
+	replayBufferSize = 128
+	// How long a user's events are kept after their last client leaves
+	streamRetention = 5 * time.Minute
+)
+
+// stream is a user's events on this server: the clients receiving them,
+// and the most recent ones kept for clients that reconnect
+type stream struct {
+	mutex     sync.Mutex
+	clients   map[*Client]struct{}
+	events    [replayBufferSize][]byte
+	held      int       // events in the buffer
+	next      uint64    // seq of the next event
+	idleSince time.Time // when the last client left
+}
+
+func newStream() *stream {
+	// Sequences start from the time the stream opened, so a number from an
+	// expired stream or from another server falls outside this one's range
+	return &stream{
+		clients: make(map[*Client]struct{}),
+		next:    uint64(time.Now().UnixMicro()),
+	}
+}
+
+// last returns the seq of the latest event
+func (s *stream) last() uint64 {
+	return s.next - 1
+}
+
+// append keeps an event, whose seq must be s.next, for replay
+func (s *stream) append(data []byte) {
+	s.events[s.next%replayBufferSize] = data
+	s.next++
+	if s.held < replayBufferSize {
+		s.held++
+	}
+}
+
+// since returns the events after seq. It reports false if seq isn't from
+// this stream or some of those events are no longer held.
+func (s *stream) since(seq uint64) ([][]byte, bool) {
+	oldest := s.next - uint64(s.held)
+	if seq+1 < oldest || seq >= s.next {
+		return nil, false
+	}
+
+	events := make([][]byte, 0, s.next-seq-1)
+	for n := seq + 1; n < s.next; n++ {
+		events = append(events, s.events[n%replayBufferSize])
+	}
+	return events, true
+}
@@ -1,9 +1,9 @@
-import type { User, LoginRequest, RegisterRequest, AuthResponse } from '@/types/auth'
+import type { User, LoginRequest, RegisterRequest, AuthResponse, AuthTokens, MFAChallenge } from '@/types/auth'
 
 const API_BASE = import.meta.env.VITE_API_URL || 'http://localhost:8080'
 
 export class AuthService {
-  async login(credentials: LoginRequest): Promise<AuthResponse> {
+  async login(credentials: LoginRequest): Promise<AuthResponse | MFAChallenge> {
     const response = await fetch(`${API_BASE}/auth/login`, {
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
@@ -18,6 +18,21 @@ export class AuthService {
     return response.json()
   }
 
+  async verifyTwoFactor(mfaToken: string, code: string): Promise<AuthResponse> {
+    const response = await fetch(`${API_BASE}/auth/2fa/verify`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ mfa_token: mfaToken, code }),
+    })
+
+    if (!response.ok) {
+      const error = await response.json()
+      throw new Error(error.error || 'Verification failed')
+    }
+
+    return response.json()
+  }
+
   async register(userData: RegisterRequest): Promise<AuthResponse> {
     const response = await fetch(`${API_BASE}/auth/register`, {
       method: 'POST',
@@ -67,8 +82,45 @@ export class AuthService {
     return response.json()
   }
 
-  logout() {
+  // Swaps the stored refresh token for new tokens. Each refresh token
+  // works once, so the new one must replace it.
+  async refresh(): Promise<AuthTokens> {
+    const refreshToken = this.getRefreshToken()
+    if (!refreshToken) {
+      throw new Error('No refresh token found')
+    }
+
+    const response = await fetch(`${API_BASE}/auth/refresh`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ refresh_token: refreshToken }),
+    })
+
+    if (!response.ok) {
+      this.clear()
+      throw new Error('Session expired')
+    }
+
+    const tokens: AuthTokens = await response.json()
+    this.setTokens(tokens)
+    return tokens
+  }
+
+  async logout() {
+    const token = this.getToken()
+    if (token) {
+      // Revoke the session on the server; the local copy goes either way
+      await fetch(`${API_BASE}/auth/logout`, {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${token}` },
+      }).catch(() => undefined)
+    }
+    this.clear()
+  }
+
+  private clear() {
     localStorage.removeItem('token')
+    localStorage.removeItem('refresh_token')
     localStorage.removeItem('user')
   }
 
@@ -81,10 +133,19 @@ export class AuthService {
     return userStr ? JSON.parse(userStr) : null
   }
 
+  getRefreshToken(): string | null {
+    return localStorage.getItem('refresh_token')
+  }
+
   setToken(token: string) {
     localStorage.setItem('token', token)
   }
 
+  setTokens(tokens: AuthTokens) {
+    localStorage.setItem('token', tokens.token)
+    localStorage.setItem('refresh_token', tokens.refresh_token)
+  }
+
   setUser(user: User) {
     localStorage.setItem('user', JSON.stringify(user))
   }
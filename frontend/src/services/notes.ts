@@ -1,4 +1,4 @@
-import type { Note, CreateNoteRequest, UpdateNoteRequest } from '@/types/note'
+import type { Note, NotePage, CreateNoteRequest, UpdateNoteRequest } from '@/types/note'
 import { authService } from './auth'
 
 const API_BASE = import.meta.env.VITE_API_URL || 'http://localhost:8080'
@@ -12,20 +12,36 @@ export class NotesService {
     }
   }
 
+  // Listings come back a page at a time; follow next_cursor to the end
+  private async getAllPages(path: string, params: URLSearchParams, errorMessage: string): Promise<Note[]> {
+    const notes: Note[] = []
+    let cursor = ''
+
+    do {
+      if (cursor) params.set('cursor', cursor)
+
+      const response = await fetch(`${API_BASE}${path}?${params}`, {
+        headers: this.getAuthHeaders(),
+      })
+
+      if (!response.ok) {
+        throw new Error(errorMessage)
+      }
+
+      const page: NotePage = await response.json()
+      notes.push(...page.notes)
+      cursor = page.next_cursor ?? ''
+    } while (cursor)
+
+    return notes
+  }
+
   async getNotes(includeArchived = false, includeDeleted = false): Promise<Note[]> {
-    const params = new URLSearchParams()
+    const params = new URLSearchParams({ limit: '200' })
     if (includeArchived) params.set('archived', 'true')
     if (includeDeleted) params.set('deleted', 'true')
 
-    const response = await fetch(`${API_BASE}/notes?${params}`, {
-      headers: this.getAuthHeaders(),
-    })
-
-    if (!response.ok) {
-      throw new Error('Failed to fetch notes')
-    }
-
-    return response.json()
+    return this.getAllPages('/notes', params, 'Failed to fetch notes')
   }
 
   async createNote(noteData: CreateNoteRequest): Promise<Note> {
@@ -138,31 +154,16 @@ export class NotesService {
       throw new Error('Failed to search notes')
     }
 
-    return response.json()
+    const data = await response.json()
+    return data.notes
   }
 
   async getPinnedNotes(): Promise<Note[]> {
-    const response = await fetch(`${API_BASE}/notes/pinned`, {
-      headers: this.getAuthHeaders(),
-    })
-
-    if (!response.ok) {
-      throw new Error('Failed to fetch pinned notes')
-    }
-
-    return response.json()
+    return this.getAllPages('/notes/pinned', new URLSearchParams({ limit: '200' }), 'Failed to fetch pinned notes')
   }
 
   async getArchivedNotes(): Promise<Note[]> {
-    const response = await fetch(`${API_BASE}/notes/archived`, {
-      headers: this.getAuthHeaders(),
-    })
-
-    if (!response.ok) {
-      throw new Error('Failed to fetch archived notes')
-    }
-
-    return response.json()
+    return this.getAllPages('/notes/archived', new URLSearchParams({ limit: '200' }), 'Failed to fetch archived notes')
   }
 }
 
@@ -6,6 +6,7 @@ export interface User {
   provider: 'local' | 'google'
   provider_id?: string
   is_verified: boolean
+  two_factor_enabled: boolean
   created_at: string
   updated_at: string
 }
@@ -25,9 +26,43 @@ export interface GoogleLoginRequest {
   token: string
 }
 
-export interface AuthResponse {
-  user: User
+export interface AuthTokens {
   token: string
+  refresh_token: string
+  expires_in: number
+}
+
+export interface AuthResponse extends AuthTokens {
+  user: User
+}
+
+// Returned by login in place of tokens when the user has two-factor
+// authentication on; exchange mfa_token and a code at /auth/2fa/verify
+export interface MFAChallenge {
+  mfa_required: true
+  mfa_token: string
+  expires_in: number
+}
+
+export interface TwoFactorSetup {
+  secret: string
+  otpauth_uri: string
+}
+
+export interface TwoFactorStatus {
+  enabled: boolean
+  recovery_codes_left: number
+}
+
+export interface Session {
+  id: string
+  device_name: string
+  ip_address: string
+  user_agent: string
+  last_used_at: string
+  expires_at: string
+  created_at: string
+  current: boolean
 }
 
 export interface AuthState {
@@ -17,6 +17,7 @@ export interface PaginatedResponse<T> {
 
 export interface WebSocketMessage {
   type: string
+  seq?: number // reconnect with ?resume_from=<seq> to replay what was missed
   user_id?: string
   payload: any
 }
\ No newline at end of file
@@ -14,6 +14,12 @@ export interface Note {
   attachments?: Attachment[]
 }
 
+export interface NotePage {
+  notes: Note[]
+  next_cursor?: string
+  total?: number
+}
+
 export interface Label {
   id: string
   user_id: string